@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/eval"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+var (
+	configPath = flag.String("config", "", "Path to optional YAML config file")
+	language   = flag.String("language", "it", "Language of the retrieved context, one of the supported languages")
+	sampleSize = flag.Int("sample-size", 200, "Number of cards to query with their own embedding")
+	textType   = flag.String("text-type", "rules", "Text type to benchmark: rules, flavor or name")
+	seed       = flag.Int64("seed", 1, "Sample seed; runs with the same seed query the same cards")
+	depth      = flag.Int("depth", 10, "Number of results searched for each card; lower ranks count as misses")
+	probes     = flag.Int("probes", 0, "ivfflat.probes for the queries (0 = the database setting)")
+	reportPath = flag.String("report", "", "Write the summary and per-card ranks as JSON to this file")
+	showMisses = flag.Int("show-misses", 10, "Print the cards that were not ranked first")
+	dbHost     = flag.String("db-host", "localhost", "PostgreSQL host")
+	dbPort     = flag.Int("db-port", 5432, "PostgreSQL port")
+	dbUser     = flag.String("db-user", "arkham", "PostgreSQL user")
+	dbPassword = flag.String("db-password", "arkham", "PostgreSQL password")
+	dbName     = flag.String("db-name", "arkham_localize", "PostgreSQL database name")
+)
+
+// flagConfigKeys maps flags to the config keys they override when set explicitly
+var flagConfigKeys = map[string]string{
+	"db-host":     "database.host",
+	"db-port":     "database.port",
+	"db-user":     "database.user",
+	"db-password": "database.password",
+	"db-name":     "database.name",
+}
+
+// fileReport is the JSON written with -report
+type fileReport struct {
+	Language string              `json:"language"`
+	TextType string              `json:"text_type"`
+	Seed     int64               `json:"seed"`
+	Depth    int                 `json:"depth"`
+	Probes   int                 `json:"probes,omitempty"`
+	Summary  eval.RecallReport   `json:"summary"`
+	Results  []eval.RecallResult `json:"results"`
+}
+
+func main() {
+	flag.Parse()
+
+	// Load .env file if exists
+	godotenv.Load()
+
+	// Config file < env vars < explicitly set flags
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok && flagErr == nil {
+			flagErr = cfg.Set(key, f.Value.String(), config.SourceFlag)
+		}
+	})
+	if flagErr != nil {
+		log.Fatalf("Invalid flag: %v", flagErr)
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if !options.ValidLanguage(*language) {
+		log.Fatalf("Unsupported language: %s (supported: %s)", *language, strings.Join(options.SupportedLanguages, ", "))
+	}
+	if !rag.ValidTextType(*textType) {
+		log.Fatalf("Unsupported text type: %s (supported: rules, flavor, name)", *textType)
+	}
+	if *sampleSize <= 0 {
+		log.Fatalf("-sample-size must be positive, got %d", *sampleSize)
+	}
+	if *depth < 5 {
+		log.Fatalf("-depth must be at least 5 to measure recall@5, got %d", *depth)
+	}
+	if *probes < 0 {
+		log.Fatalf("-probes must not be negative, got %d", *probes)
+	}
+
+	// Rank with the same retrieval settings as the server
+	if rag.LanguageFallbacks, err = options.ParseLanguageFallbacks(cfg.Retrieval.LanguageFallbacks); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	rag.PriorityWeight = cfg.Retrieval.PriorityWeight
+	rag.PackWeight = cfg.Retrieval.PackWeight
+	rag.BackFallback = cfg.Retrieval.BackFallback
+
+	database, err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	if *probes > 0 {
+		// SET applies to one session, so keep every query on that connection
+		database.SetMaxOpenConns(1)
+		if _, err := database.Exec(fmt.Sprintf("SET ivfflat.probes = %d", *probes)); err != nil {
+			log.Fatalf("Failed to set ivfflat.probes: %v", err)
+		}
+	}
+
+	// Query with the metric the index was built with, like the server
+	if opClass, err := db.IndexOpClass(database, "card_embeddings_embedding_idx"); err == nil {
+		if metric, err := rag.MetricForOpClass(opClass); err == nil {
+			rag.SimilarityMetric = metric
+		}
+	}
+
+	samples, err := eval.LoadSample(database, *language, *textType, *sampleSize, *seed)
+	if err != nil {
+		log.Fatalf("Failed to load sample: %v", err)
+	}
+	if len(samples) == 0 {
+		log.Fatalf("No %s entries with an official %s translation found (run the ingest tool first)", *textType, *language)
+	}
+
+	store, err := rag.NewVectorStore(cfg.Retrieval.VectorStore, database)
+	if err != nil {
+		log.Fatalf("Failed to open vector store: %v", err)
+	}
+
+	fmt.Printf("Querying %d %s entries with their own embedding (language %s, seed %d)...\n", len(samples), *textType, *language, *seed)
+
+	results, err := eval.SelfRecall(context.Background(), store, samples, *language, *textType, *depth)
+	if err != nil {
+		log.Fatalf("Benchmark failed: %v", err)
+	}
+	summary := eval.SummarizeRecall(results)
+
+	fmt.Println()
+	fmt.Println("=" + strings.Repeat("=", 59))
+	fmt.Printf("Cards:                %d\n", summary.Cards)
+	fmt.Printf("Recall@1:             %.1f%%\n", summary.RecallAt1*100)
+	fmt.Printf("Recall@5:             %.1f%%\n", summary.RecallAt5*100)
+	fmt.Printf("Mean reciprocal rank: %.3f\n", summary.MRR)
+	fmt.Println("=" + strings.Repeat("=", 59))
+
+	printMisses(results, *showMisses, *depth)
+
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(fileReport{
+			Language: *language,
+			TextType: *textType,
+			Seed:     *seed,
+			Depth:    *depth,
+			Probes:   *probes,
+			Summary:  summary,
+			Results:  results,
+		}, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode report: %v", err)
+		}
+		if err := os.WriteFile(*reportPath, data, 0644); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		fmt.Printf("\nReport written to %s\n", *reportPath)
+	}
+}
+
+// printMisses prints up to n cards that were not ranked first, the entries
+// to look at when the index loses precision
+func printMisses(results []eval.RecallResult, n, depth int) {
+	var misses []eval.RecallResult
+	for _, result := range results {
+		if result.Rank != 1 {
+			misses = append(misses, result)
+		}
+	}
+	if n > len(misses) {
+		n = len(misses)
+	}
+	if n <= 0 {
+		return
+	}
+
+	fmt.Printf("\nCards not ranked first:\n")
+	for _, result := range misses[:n] {
+		side := "front"
+		if result.IsBack {
+			side = "back"
+		}
+		if result.Rank == 0 {
+			fmt.Printf("  %s (%s, %s): not in the first %d\n", result.CardName, result.CardCode, side, depth)
+			continue
+		}
+		fmt.Printf("  %s (%s, %s): rank %d\n", result.CardName, result.CardCode, side, result.Rank)
+	}
+}
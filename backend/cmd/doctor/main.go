@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+)
+
+var (
+	configPath = flag.String("config", "", "Path to optional YAML config file")
+	dimensions = flag.Int("dimensions", 0, "Expected embedding dimensions (0 uses the size of EMBEDDING_MODEL, or else the declared column size)")
+	dbHost     = flag.String("db-host", "localhost", "PostgreSQL host")
+	dbPort     = flag.Int("db-port", 5432, "PostgreSQL port")
+	dbUser     = flag.String("db-user", "arkham", "PostgreSQL user")
+	dbPassword = flag.String("db-password", "arkham", "PostgreSQL password")
+	dbName     = flag.String("db-name", "arkham_localize", "PostgreSQL database name")
+)
+
+// flagConfigKeys maps flags to the config keys they override when set explicitly
+var flagConfigKeys = map[string]string{
+	"db-host":     "database.host",
+	"db-port":     "database.port",
+	"db-user":     "database.user",
+	"db-password": "database.password",
+	"db-name":     "database.name",
+}
+
+func main() {
+	flag.Parse()
+
+	// Load .env file if exists
+	godotenv.Load()
+
+	// Config file < env vars < explicitly set flags
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok && flagErr == nil {
+			flagErr = cfg.Set(key, f.Value.String(), config.SourceFlag)
+		}
+	})
+	if flagErr != nil {
+		log.Fatalf("Invalid flag: %v", flagErr)
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if *dimensions < 0 {
+		log.Fatalf("-dimensions must not be negative, got %d", *dimensions)
+	}
+
+	database, err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	expected := *dimensions
+	if expected == 0 {
+		var ok bool
+		if expected, ok = embeddings.ExpectedDimensions(cfg.OpenAI.EmbeddingModel, 0); !ok {
+			if expected, err = db.EmbeddingDimensions(database, "card_embeddings"); err != nil || expected <= 0 {
+				log.Fatalf("Unknown size of %s embeddings and no declared column size; pass -dimensions", cfg.OpenAI.EmbeddingModel)
+			}
+		}
+	}
+
+	report, err := ingest.CheckEmbeddings(context.Background(), database, expected)
+	if err != nil {
+		log.Fatalf("Check failed: %v", err)
+	}
+	report.Print(os.Stdout)
+	if !report.Healthy() {
+		os.Exit(1)
+	}
+}
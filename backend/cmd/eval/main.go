@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/eval"
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// contextCardLimit matches the number of context cards the server uses
+const contextCardLimit = 6
+
+var (
+	configPath = flag.String("config", "", "Path to optional YAML config file")
+	language   = flag.String("language", "it", "Language to evaluate, one of the supported languages")
+	sampleSize = flag.Int("sample-size", 50, "Number of cards with an official translation to translate")
+	textType   = flag.String("text-type", "rules", "Text type to evaluate: rules, flavor or name")
+	seed       = flag.Int64("seed", 1, "Sample seed; runs with the same seed evaluate the same cards")
+	reportPath = flag.String("report", "", "Write the summary and per-card results as JSON to this file")
+	showWorst  = flag.Int("show-worst", 5, "Print the cards least similar to their official translation")
+	openAIKey  = flag.String("openai-key", "", "OpenAI API key (or use OPENAI_API_KEY env var)")
+	chatModel  = flag.String("model", "gpt-4o", "Chat model to evaluate (or use CHAT_MODEL env var)")
+	dbHost     = flag.String("db-host", "localhost", "PostgreSQL host")
+	dbPort     = flag.Int("db-port", 5432, "PostgreSQL port")
+	dbUser     = flag.String("db-user", "arkham", "PostgreSQL user")
+	dbPassword = flag.String("db-password", "arkham", "PostgreSQL password")
+	dbName     = flag.String("db-name", "arkham_localize", "PostgreSQL database name")
+)
+
+// flagConfigKeys maps flags to the config keys they override when set explicitly
+var flagConfigKeys = map[string]string{
+	"openai-key":  "openai.api_key",
+	"model":       "openai.chat_model",
+	"db-host":     "database.host",
+	"db-port":     "database.port",
+	"db-user":     "database.user",
+	"db-password": "database.password",
+	"db-name":     "database.name",
+}
+
+// fileReport is the JSON written with -report
+type fileReport struct {
+	Language string        `json:"language"`
+	TextType string        `json:"text_type"`
+	Model    string        `json:"model"`
+	Seed     int64         `json:"seed"`
+	Summary  eval.Report   `json:"summary"`
+	Results  []eval.Result `json:"results"`
+}
+
+func main() {
+	flag.Parse()
+
+	// Load .env file if exists
+	godotenv.Load()
+
+	// Config file < env vars < explicitly set flags
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok && flagErr == nil {
+			flagErr = cfg.Set(key, f.Value.String(), config.SourceFlag)
+		}
+	})
+	if flagErr != nil {
+		log.Fatalf("Invalid flag: %v", flagErr)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v\nSet OPENAI_API_KEY env var or use -openai-key flag", err)
+	}
+	if !options.ValidLanguage(*language) {
+		log.Fatalf("Unsupported language: %s (supported: %s)", *language, strings.Join(options.SupportedLanguages, ", "))
+	}
+	if !rag.ValidTextType(*textType) {
+		log.Fatalf("Unsupported text type: %s (supported: rules, flavor, name)", *textType)
+	}
+	if *sampleSize <= 0 {
+		log.Fatalf("-sample-size must be positive, got %d", *sampleSize)
+	}
+
+	// Translate with the same prompt settings as the server, so prompt and
+	// glossary changes show up in the scores
+	openai.BaseURL = cfg.OpenAI.BaseURL
+	openai.Organization = cfg.OpenAI.Organization
+	openai.Project = cfg.OpenAI.Project
+	openai.MaxRetries = cfg.OpenAI.MaxRetries
+	openai.RetryBaseDelay = cfg.OpenAI.RetryBaseDelay
+	rag.TranslationTimeout = cfg.OpenAI.TranslationTimeout
+	rag.LanguageFallbacks, _ = options.ParseLanguageFallbacks(cfg.Retrieval.LanguageFallbacks)    // Validated above
+	rag.ReferenceLanguages, _ = options.ParseReferenceLanguages(cfg.Retrieval.ReferenceLanguages) // Validated above
+	rag.SimilarityMetric, _ = rag.ParseMetric(cfg.Retrieval.Metric)                               // Validated above
+	rag.PriorityWeight = cfg.Retrieval.PriorityWeight
+	rag.PackWeight = cfg.Retrieval.PackWeight
+	rag.MaxInputChars = cfg.Translation.MaxInputChars
+	rag.MaxPromptTokens = cfg.Translation.MaxPromptTokens
+	rag.ContextTokenBudget = cfg.Translation.ContextTokenBudget
+	if err := rag.LoadPromptTemplates(cfg.Translation.PromptTemplateDir); err != nil {
+		log.Fatalf("Invalid prompt templates: %v", err)
+	}
+	rag.JSONOutput = cfg.Translation.JSONOutput
+	rag.ContextOrder = cfg.Translation.ContextOrder
+	rag.BackFallback = cfg.Retrieval.BackFallback
+	rag.PostProcessors, _ = options.ParsePostProcessors(cfg.Translation.PostProcessors)    // Validated above
+	rag.PreservedTokens, _ = options.ParsePreservedTokens(cfg.Translation.PreservedTokens) // Validated above
+	if err := rag.LoadGlossaries(cfg.Translation.GlossaryDir); err != nil {
+		log.Fatalf("Invalid glossary: %v", err)
+	}
+
+	database, err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	// Query with the metric the index was built with, like the server
+	if opClass, err := db.IndexOpClass(database, "card_embeddings_embedding_idx"); err == nil {
+		if metric, err := rag.MetricForOpClass(opClass); err == nil {
+			rag.SimilarityMetric = metric
+		}
+	}
+
+	samples, err := eval.LoadSample(database, *language, *textType, *sampleSize, *seed)
+	if err != nil {
+		log.Fatalf("Failed to load sample: %v", err)
+	}
+	if len(samples) == 0 {
+		log.Fatalf("No %s entries with an official %s translation found (run the ingest tool first)", *textType, *language)
+	}
+
+	store, err := rag.NewVectorStore(cfg.Retrieval.VectorStore, database)
+	if err != nil {
+		log.Fatalf("Failed to open vector store: %v", err)
+	}
+
+	model := cfg.OpenAI.ChatModel
+	fmt.Printf("Evaluating %s on %d %s entries (language %s, seed %d)...\n", model, len(samples), *textType, *language, *seed)
+
+	translator := rag.OpenAITranslator{APIKey: cfg.OpenAI.APIKey}
+	results := eval.Run(context.Background(), store, translator, samples, eval.Options{
+		Language:     *language,
+		TextType:     *textType,
+		Model:        model,
+		ContextLimit: contextCardLimit,
+		Rerank:       cfg.Retrieval.Rerank,
+		APIKey:       cfg.OpenAI.APIKey,
+		Progress: func(done, total int, result eval.Result) {
+			if result.Error != "" {
+				fmt.Printf("[%d/%d] %s: failed: %s\n", done, total, result.CardCode, result.Error)
+				return
+			}
+			fmt.Printf("[%d/%d] %s: similarity %.2f\n", done, total, result.CardCode, result.Similarity)
+		},
+	})
+	summary := eval.Summarize(results)
+
+	fmt.Println()
+	fmt.Println("=" + strings.Repeat("=", 59))
+	fmt.Printf("Model:                %s\n", model)
+	fmt.Printf("Cards:                %d translated, %d failed\n", summary.Translated, summary.Failed)
+	fmt.Printf("Exact match:          %.1f%%\n", summary.ExactMatchRate*100)
+	fmt.Printf("Symbols preserved:    %.1f%%\n", summary.SymbolPreservationRate*100)
+	fmt.Printf("Mean edit similarity: %.3f\n", summary.MeanSimilarity)
+	fmt.Println("=" + strings.Repeat("=", 59))
+
+	printWorst(results, *showWorst)
+
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(fileReport{
+			Language: *language,
+			TextType: *textType,
+			Model:    model,
+			Seed:     *seed,
+			Summary:  summary,
+			Results:  results,
+		}, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode report: %v", err)
+		}
+		if err := os.WriteFile(*reportPath, data, 0644); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		fmt.Printf("\nReport written to %s\n", *reportPath)
+	}
+}
+
+// printWorst prints the n translated cards least similar to their official
+// translation, the first places to look after a regression
+func printWorst(results []eval.Result, n int) {
+	var translated []eval.Result
+	for _, result := range results {
+		if result.Error == "" {
+			translated = append(translated, result)
+		}
+	}
+	sort.SliceStable(translated, func(i, j int) bool { return translated[i].Similarity < translated[j].Similarity })
+	if n > len(translated) {
+		n = len(translated)
+	}
+	if n <= 0 {
+		return
+	}
+
+	fmt.Printf("\nLeast similar translations:\n")
+	for _, result := range translated[:n] {
+		fmt.Printf("\n%s (%s) - similarity %.2f\n", result.CardName, result.CardCode, result.Similarity)
+		fmt.Printf("  English:   %s\n", result.EnglishText)
+		fmt.Printf("  Official:  %s\n", result.Official)
+		fmt.Printf("  Generated: %s\n", result.Translation)
+		if len(result.MissingSymbols) > 0 {
+			fmt.Printf("  Missing:   %s\n", strings.Join(result.MissingSymbols, " "))
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+)
+
+var (
+	configPath = flag.String("config", "", "Path to optional YAML config file")
+	outPath    = flag.String("out", "snapshot.jsonl.gz", "Snapshot file to write (gzip-compressed if it ends in .gz)")
+	dbHost     = flag.String("db-host", "localhost", "PostgreSQL host")
+	dbPort     = flag.Int("db-port", 5432, "PostgreSQL port")
+	dbUser     = flag.String("db-user", "arkham", "PostgreSQL user")
+	dbPassword = flag.String("db-password", "arkham", "PostgreSQL password")
+	dbName     = flag.String("db-name", "arkham_localize", "PostgreSQL database name")
+)
+
+// flagConfigKeys maps flags to the config keys they override when set explicitly
+var flagConfigKeys = map[string]string{
+	"db-host":     "database.host",
+	"db-port":     "database.port",
+	"db-user":     "database.user",
+	"db-password": "database.password",
+	"db-name":     "database.name",
+}
+
+func main() {
+	flag.Parse()
+
+	// Load .env file if exists
+	godotenv.Load()
+
+	// Config file < env vars < explicitly set flags
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok && flagErr == nil {
+			flagErr = cfg.Set(key, f.Value.String(), config.SourceFlag)
+		}
+	})
+	if flagErr != nil {
+		log.Fatalf("Invalid flag: %v", flagErr)
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	database, err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	// Write to a temporary file first so a failed export leaves no partial snapshot
+	tmpPath := *outPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		log.Fatalf("Failed to create snapshot: %v", err)
+	}
+	defer os.Remove(tmpPath)
+
+	var out io.Writer = file
+	var compressed *gzip.Writer
+	if strings.HasSuffix(*outPath, ".gz") {
+		compressed = gzip.NewWriter(file)
+		out = compressed
+	}
+
+	fmt.Printf("Exporting database %s to %s...\n", cfg.Database.Name, *outPath)
+	stats, err := ingest.ExportSnapshot(database, out)
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	if compressed != nil {
+		if err := compressed.Close(); err != nil {
+			log.Fatalf("Failed to write snapshot: %v", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Failed to write snapshot: %v", err)
+	}
+	if err := os.Rename(tmpPath, *outPath); err != nil {
+		log.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	fmt.Printf("✓ Exported %d entries, %d translations and %d source files\n", stats.CardEmbeddings, stats.CardTranslations, stats.SourceFiles)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+var (
+	configPath = flag.String("config", "", "Path to optional YAML config file")
+	language   = flag.String("language", "it", "Language to report missing translations for")
+	textType   = flag.String("text-type", "rules", "Text type to report: rules, flavor or name")
+	outPath    = flag.String("out", "gaps.csv", "CSV file to write, or - for standard output")
+	dbHost     = flag.String("db-host", "localhost", "PostgreSQL host")
+	dbPort     = flag.Int("db-port", 5432, "PostgreSQL port")
+	dbUser     = flag.String("db-user", "arkham", "PostgreSQL user")
+	dbPassword = flag.String("db-password", "arkham", "PostgreSQL password")
+	dbName     = flag.String("db-name", "arkham_localize", "PostgreSQL database name")
+)
+
+// flagConfigKeys maps flags to the config keys they override when set explicitly
+var flagConfigKeys = map[string]string{
+	"db-host":     "database.host",
+	"db-port":     "database.port",
+	"db-user":     "database.user",
+	"db-password": "database.password",
+	"db-name":     "database.name",
+}
+
+func main() {
+	flag.Parse()
+
+	// Load .env file if exists
+	godotenv.Load()
+
+	// Config file < env vars < explicitly set flags
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok && flagErr == nil {
+			flagErr = cfg.Set(key, f.Value.String(), config.SourceFlag)
+		}
+	})
+	if flagErr != nil {
+		log.Fatalf("Invalid flag: %v", flagErr)
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if !options.ValidLanguage(*language) {
+		log.Fatalf("Unsupported language: %s (supported: %s)", *language, strings.Join(options.SupportedLanguages, ", "))
+	}
+	if !rag.ValidTextType(*textType) {
+		log.Fatalf("Unsupported text type: %s (supported: rules, flavor, name)", *textType)
+	}
+
+	database, err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	if *outPath == "-" {
+		if _, err := ingest.ExportCoverageGaps(database, os.Stdout, *language, *textType); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		return
+	}
+
+	// Write to a temporary file first so a failed export leaves no partial report
+	tmpPath := *outPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		log.Fatalf("Failed to create report: %v", err)
+	}
+	defer os.Remove(tmpPath)
+
+	count, err := ingest.ExportCoverageGaps(database, file, *language, *textType)
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	if err := os.Rename(tmpPath, *outPath); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+
+	fmt.Printf("✓ Wrote %d %s entries without a %s translation to %s\n", count, *textType, *language, *outPath)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+var (
+	configPath = flag.String("config", "", "Path to optional YAML config file")
+	inPath     = flag.String("in", "snapshot.jsonl.gz", "Snapshot file written by the export tool (gzip-compressed if it ends in .gz)")
+	clearDB    = flag.Bool("clear", false, "Clear existing data before importing (otherwise the database must be empty)")
+	metric     = flag.String("metric", "cosine", "Distance metric of the vector indexes: cosine, ip or l2 (or use SIMILARITY_METRIC env var)")
+	dbHost     = flag.String("db-host", "localhost", "PostgreSQL host")
+	dbPort     = flag.Int("db-port", 5432, "PostgreSQL port")
+	dbUser     = flag.String("db-user", "arkham", "PostgreSQL user")
+	dbPassword = flag.String("db-password", "arkham", "PostgreSQL password")
+	dbName     = flag.String("db-name", "arkham_localize", "PostgreSQL database name")
+)
+
+// flagConfigKeys maps flags to the config keys they override when set explicitly
+var flagConfigKeys = map[string]string{
+	"metric":      "retrieval.metric",
+	"db-host":     "database.host",
+	"db-port":     "database.port",
+	"db-user":     "database.user",
+	"db-password": "database.password",
+	"db-name":     "database.name",
+}
+
+func main() {
+	flag.Parse()
+
+	// Load .env file if exists
+	godotenv.Load()
+
+	// Config file < env vars < explicitly set flags
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok && flagErr == nil {
+			flagErr = cfg.Set(key, f.Value.String(), config.SourceFlag)
+		}
+	})
+	if flagErr != nil {
+		log.Fatalf("Invalid flag: %v", flagErr)
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	similarityMetric, err := rag.ParseMetric(cfg.Retrieval.Metric)
+	if err != nil {
+		log.Fatalf("Invalid configuration: retrieval.metric: %v", err)
+	}
+
+	file, err := os.Open(*inPath)
+	if err != nil {
+		log.Fatalf("Failed to open snapshot: %v", err)
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if strings.HasSuffix(*inPath, ".gz") {
+		decompressed, err := gzip.NewReader(file)
+		if err != nil {
+			log.Fatalf("Failed to read snapshot: %v", err)
+		}
+		defer decompressed.Close()
+		in = decompressed
+	}
+
+	database, err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	fmt.Printf("Importing %s into database %s...\n", *inPath, cfg.Database.Name)
+	stats, err := ingest.ImportSnapshot(database, in, ingest.Options{Clear: *clearDB, Metric: similarityMetric})
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+
+	fmt.Printf("✓ Imported %d entries, %d translations and %d source files\n", stats.CardEmbeddings, stats.CardTranslations, stats.SourceFiles)
+}
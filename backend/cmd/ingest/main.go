@@ -1,40 +1,47 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
 )
 
-type Card struct {
-	Code     string `json:"code"`
-	Name     string `json:"name"`
-	Text     string `json:"text"`
-	RealText string `json:"real_text"`
-	BackText string `json:"back_text"`
-}
-
-type CardEntry struct {
-	CardCode    string
-	CardName    string
-	IsBack      bool
-	EnglishText string
-	Translations map[string]string // Language code -> translated text
-}
-
 var (
-	dataDir        = flag.String("data", ".data/arkhamdb-json-data", "Path to arkhamdb-json-data directory")
+	configPath     = flag.String("config", "", "Path to optional YAML config file")
+	dataDir        = flag.String("data", ".data/arkhamdb-json-data", "Path to arkhamdb-json-data directory, .zip archive or https:// archive URL (or use ARKHAM_DATA_DIR env var)")
 	openAIKey      = flag.String("openai-key", "", "OpenAI API key (or use OPENAI_API_KEY env var)")
 	embeddingModel = flag.String("embedding-model", "text-embedding-3-small", "OpenAI embedding model")
 	batchSize      = flag.Int("batch-size", 50, "Batch size for embeddings")
+	workers        = flag.Int("workers", 0, "Concurrent embedding requests per batch (0 = batch size)")
 	clearDB        = flag.Bool("clear", false, "Clear existing data before ingestion")
+	includeFlavor  = flag.Bool("include-flavor", false, "Also ingest flavor text as separate entries, for flavor-specific context")
+	includeNames   = flag.Bool("include-names", false, "Also ingest card names (with subtitles) as separate entries, for name-specific context")
+	reembed        = flag.Bool("reembed", false, "Re-embed rows made with another embedding model instead of ingesting (resumable)")
+	full           = flag.Bool("full", false, "Reprocess all source files, not only those changed since the last ingest")
+	strict         = flag.Bool("strict", false, "Fail on card files that can't be parsed or miss expected fields")
+	embedTrans     = flag.Bool("embed-translations", false, "Also embed translated texts to enable target-language retrieval (more API calls)")
+	metric         = flag.String("metric", "cosine", "Distance metric of the vector indexes: cosine, ip or l2 (or use SIMILARITY_METRIC env var)")
+	vectorStore    = flag.String("vector-store", "postgres", "Backend the embeddings are written to (or use VECTOR_STORE env var)")
+	priorities     = flag.String("card-priorities", options.DefaultCardPriorities, "Priority stored with each card by code prefix, e.g. 01=1,02=0.5 (or use CARD_PRIORITIES env var)")
+	fieldMap       = flag.String("card-field-map", "", "Card fields read from other JSON names in non-arkhamdb card files, e.g. text=textEn,name=title (or use CARD_FIELD_MAP env var)")
+	truncateInput  = flag.Int("truncate-embedding-input", 0, "Truncate embedding inputs longer than this, in -truncate-unit, instead of failing (0 = disabled, or use EMBEDDING_MAX_INPUT env var)")
+	truncateUnit   = flag.String("truncate-unit", "tokens", "Unit of -truncate-embedding-input: tokens (estimated) or chars (or use EMBEDDING_TRUNCATE_UNIT env var)")
+	quiet          = flag.Bool("quiet", false, "Don't print progress lines (warnings and summaries are still printed)")
+	jsonProgress   = flag.Bool("json-progress", false, "Print progress as one JSON object per line, for tooling")
+	excludePacks   = flag.String("exclude-packs", "", "Comma-separated pack directory names not to ingest, e.g. promo,parallel")
+	duplicates     = flag.String("duplicates", ingest.DuplicatesFirst, "Entry kept when pack files repeat a card side: first (in pack file path order) or latest (latest released pack, from packs.json)")
 	limitEntries   = flag.Int("limit", 0, "Limit number of entries to process (0 = all, useful for testing)")
 	dbHost         = flag.String("db-host", "localhost", "PostgreSQL host")
 	dbPort         = flag.Int("db-port", 5432, "PostgreSQL port")
@@ -43,33 +50,90 @@ var (
 	dbName         = flag.String("db-name", "arkham_localize", "PostgreSQL database name")
 )
 
+// flagConfigKeys maps flags to the config keys they override when set explicitly
+var flagConfigKeys = map[string]string{
+	"data":                     "ingest.data_dir",
+	"openai-key":               "openai.api_key",
+	"embedding-model":          "openai.embedding_model",
+	"metric":                   "retrieval.metric",
+	"vector-store":             "retrieval.vector_store",
+	"card-priorities":          "ingest.card_priorities",
+	"card-field-map":           "ingest.field_map",
+	"truncate-embedding-input": "openai.embedding_max_input",
+	"truncate-unit":            "openai.embedding_truncate_unit",
+	"db-host":                  "database.host",
+	"db-port":                  "database.port",
+	"db-user":                  "database.user",
+	"db-password":              "database.password",
+	"db-name":                  "database.name",
+}
+
 func main() {
 	flag.Parse()
 
 	// Load .env file if exists
 	godotenv.Load()
 
-	// Get OpenAI key from flag or env
-	apiKey := *openAIKey
-	if apiKey == "" {
-		apiKey = os.Getenv("OPENAI_API_KEY")
+	// Config file < env vars < explicitly set flags
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	var flagErr error
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok && flagErr == nil {
+			flagErr = cfg.Set(key, f.Value.String(), config.SourceFlag)
+		}
+	})
+	if flagErr != nil {
+		log.Fatalf("Invalid flag: %v", flagErr)
 	}
-	if apiKey == "" {
-		log.Fatal("OpenAI API key required. Set OPENAI_API_KEY env var or use -openai-key flag")
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v\nSet OPENAI_API_KEY env var or use -openai-key flag", err)
 	}
-
-	// Resolve data directory
-	dataPath, err := filepath.Abs(*dataDir)
+	if !ingest.ValidDuplicates(*duplicates) {
+		log.Fatalf("Unsupported -duplicates: %s (supported: first, latest)", *duplicates)
+	}
+	if *quiet && *jsonProgress {
+		log.Fatalf("-quiet and -json-progress are mutually exclusive")
+	}
+	progressMode := ingest.ProgressText
+	if *quiet {
+		progressMode = ingest.ProgressQuiet
+	} else if *jsonProgress {
+		progressMode = ingest.ProgressJSON
+	}
+	reporter := ingest.NewProgressReporter(os.Stdout, progressMode)
+
+	apiKey := cfg.OpenAI.APIKey
+	similarityMetric, _ := rag.ParseMetric(cfg.Retrieval.Metric)                // Validated above
+	cardPriorities, _ := options.ParseCardPriorities(cfg.Ingest.CardPriorities) // Validated above
+	cardFields, _ := ingest.ParseFieldMap(cfg.Ingest.FieldMap)                  // Validated above
+	openai.BaseURL = cfg.OpenAI.BaseURL
+	openai.Organization = cfg.OpenAI.Organization
+	openai.Project = cfg.OpenAI.Project
+	embeddings.MaxInput = cfg.OpenAI.EmbeddingMaxInput
+	embeddings.TruncateUnit = cfg.OpenAI.EmbeddingTruncateUnit
+	openai.MaxRetries = cfg.OpenAI.MaxRetries
+	openai.RetryBaseDelay = cfg.OpenAI.RetryBaseDelay
+	embeddings.Timeout = cfg.OpenAI.EmbeddingTimeout
+
+	// Resolve data directory, downloading or extracting an archive
+	dataPath, cleanup, err := ingest.OpenDataSource(context.Background(), cfg.Ingest.DataDir)
 	if err != nil {
-		log.Fatalf("Failed to resolve data directory: %v", err)
+		log.Fatalf("Failed to open data source: %v", err)
 	}
+	defer cleanup()
 
 	fmt.Println("=" + strings.Repeat("=", 59))
 	fmt.Println("Arkham Localize - Data Ingestion Pipeline (Go)")
 	fmt.Println("=" + strings.Repeat("=", 59))
 	fmt.Printf("\nData directory: %s\n", dataPath)
-	fmt.Printf("Embedding model: %s\n", *embeddingModel)
 	fmt.Printf("Batch size: %d\n", *batchSize)
+	fmt.Println("Configuration:")
+	for _, line := range cfg.Report() {
+		fmt.Printf("  %s\n", line)
+	}
 
 	// Validate data directory
 	if _, err := os.Stat(dataPath); os.IsNotExist(err) {
@@ -77,74 +141,61 @@ func main() {
 	}
 
 	// Connect to database
-	dbURL := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		*dbUser, *dbPassword, *dbHost, *dbPort, *dbName)
-
-	db, err := sql.Open("postgres", dbURL)
+	database, err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
-	}
-	defer db.Close()
-
-	// Test connection
-	if err := db.Ping(); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	defer database.Close()
 
-	// Setup database schema
-	if err := setupDatabase(db); err != nil {
-		log.Fatalf("Failed to setup database: %v", err)
-	}
-
-	// Clear existing data if requested
-	if *clearDB {
-		if err := clearDatabase(db); err != nil {
-			log.Fatalf("Failed to clear database: %v", err)
-		}
+	store, err := rag.NewVectorStore(cfg.Retrieval.VectorStore, database)
+	if err != nil {
+		log.Fatalf("Failed to open vector store: %v", err)
 	}
 
-	// Load translations for all supported languages
-	fmt.Println("\nLoading translations for all supported languages...")
-	allTranslations := make(map[string]TranslationDict) // language -> TranslationDict
-	for _, lang := range []string{"it", "fr", "de", "es"} {
-		fmt.Printf("Loading %s translations...\n", lang)
-		translations, err := loadTranslations(dataPath, lang)
+	if *reembed {
+		err = ingest.Reembed(database, ingest.Options{
+			APIKey:            apiKey,
+			EmbeddingModel:    cfg.OpenAI.EmbeddingModel,
+			BatchSize:         *batchSize,
+			Workers:           *workers,
+			EmbedTranslations: *embedTrans,
+			Reporter:          reporter,
+			Metric:            similarityMetric,
+		})
 		if err != nil {
-			log.Printf("Warning: Failed to load %s translations: %v\n", lang, err)
-			continue
+			log.Fatalf("Re-embedding failed: %v", err)
 		}
-		allTranslations[lang] = translations
-		fmt.Printf("✓ Loaded %d card translations for %s\n", len(translations), lang)
+		return
 	}
 
-	// Process card files
-	fmt.Println("\nExtracting card data...")
-	entries, err := processCardFiles(dataPath, allTranslations)
+	err = ingest.Run(database, ingest.Options{
+		DataPath:          dataPath,
+		APIKey:            apiKey,
+		EmbeddingModel:    cfg.OpenAI.EmbeddingModel,
+		BatchSize:         *batchSize,
+		Workers:           *workers,
+		EmbedTranslations: *embedTrans,
+		Clear:             *clearDB,
+		Limit:             *limitEntries,
+		Strict:            *strict,
+		Full:              *full,
+		IncludeFlavor:     *includeFlavor,
+		IncludeNames:      *includeNames,
+		ExcludePacks:      splitList(*excludePacks),
+		Duplicates:        *duplicates,
+		Reporter:          reporter,
+		Metric:            similarityMetric,
+		Store:             store,
+		Priorities:        cardPriorities,
+		Fields:            cardFields,
+	})
 	if err != nil {
-		log.Fatalf("Failed to process card files: %v", err)
-	}
-
-	if len(entries) == 0 {
-		log.Fatal("No cards found to process")
-	}
-
-	fmt.Printf("✓ Extracted %d card entries\n", len(entries))
-
-	// Limit entries if requested (useful for testing)
-	if *limitEntries > 0 && *limitEntries < len(entries) {
-		entries = entries[:*limitEntries]
-		fmt.Printf("⚠️  Limited to first %d entries for testing\n", *limitEntries)
-	}
-
-	// Generate embeddings and ingest
-	fmt.Printf("\nGenerating embeddings using %s...\n", *embeddingModel)
-	if err := ingestCards(db, entries, apiKey, *embeddingModel, *batchSize); err != nil {
-		log.Fatalf("Failed to ingest cards: %v", err)
+		log.Fatalf("Ingestion failed: %v", err)
 	}
 
 	// Print summary
 	var count int
-	if err := db.QueryRow("SELECT COUNT(*) FROM card_embeddings").Scan(&count); err != nil {
+	if err := database.QueryRow("SELECT COUNT(*) FROM card_embeddings").Scan(&count); err != nil {
 		log.Printf("Warning: Failed to count entries: %v", err)
 	} else {
 		fmt.Println("\n" + strings.Repeat("=", 60))
@@ -152,3 +203,14 @@ func main() {
 		fmt.Println(strings.Repeat("=", 60))
 	}
 }
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
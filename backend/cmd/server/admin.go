@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// Ingest job statuses
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job kinds
+const (
+	JobIngest  = "ingest"
+	JobReembed = "reembed"
+	JobReindex = "reindex"
+	JobCard    = "card" // Deletion or re-ingest of a single card, run in the request
+)
+
+// maxJobErrors bounds the number of errors kept per ingest job
+const maxJobErrors = 50
+
+type IngestRequest struct {
+	Clear             bool     `json:"clear"`
+	Limit             int      `json:"limit"`
+	BatchSize         int      `json:"batch_size"`
+	Workers           int      `json:"workers"`
+	EmbedTranslations bool     `json:"embed_translations"`
+	Strict            bool     `json:"strict"`
+	Full              bool     `json:"full"`
+	IncludeFlavor     bool     `json:"include_flavor"`
+	IncludeNames      bool     `json:"include_names"`
+	ExcludePacks      []string `json:"exclude_packs"` // Pack directory names not to ingest
+	Duplicates        string   `json:"duplicates"`    // Entry kept when pack files repeat one: "first" (default) or "latest" released
+}
+
+type ReembedRequest struct {
+	BatchSize    int  `json:"batch_size"`
+	Workers      int  `json:"workers"`
+	Translations bool `json:"translations"` // Also re-embed translation embeddings
+}
+
+// CardReingestRequest selects the text types re-ingested for a single card,
+// as in IngestRequest
+type CardReingestRequest struct {
+	EmbedTranslations bool `json:"embed_translations"`
+	IncludeFlavor     bool `json:"include_flavor"`
+	IncludeNames      bool `json:"include_names"`
+}
+
+// CardResponse reports a single-card admin operation
+type CardResponse struct {
+	CardCode string `json:"card_code"`
+	Deleted  int    `json:"deleted,omitempty"`  // Entries removed
+	Ingested int    `json:"ingested,omitempty"` // Entries embedded and stored
+}
+
+type IngestJob struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"` // JobIngest, JobReembed, JobReindex or JobCard
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Failed     int        `json:"failed"`
+	Errors     []string   `json:"errors"`
+	Error      string     `json:"error,omitempty"` // Fatal error that stopped the job
+}
+
+// ingestJobs tracks background ingest jobs. Only one job runs at a time.
+type ingestJobs struct {
+	mu      sync.Mutex
+	jobs    map[string]*IngestJob
+	running string // ID of the running job, if any
+}
+
+var jobs = &ingestJobs{jobs: make(map[string]*IngestJob)}
+
+var (
+	adminAPIKey    string
+	ingestDataDir  string
+	cardPriorities options.CardPriorities
+	cardFields     ingest.FieldMap
+)
+
+// requireAdminKey protects admin endpoints with the ADMIN_API_KEY bearer token.
+// Admin endpoints are disabled when no key is configured.
+func requireAdminKey(next http.HandlerFunc) http.HandlerFunc {
+	return corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if adminAPIKey == "" {
+			writeJSONError(w, http.StatusForbidden, codeForbidden, "Admin endpoints are disabled (set ADMIN_API_KEY)")
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminAPIKey)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+// startIngestHandler starts an ingest job in the background and returns its ID
+func startIngestHandler(database *sql.DB, store rag.VectorStore) http.HandlerFunc {
+	return requireMethod(http.MethodPost, requireJSON(func(w http.ResponseWriter, r *http.Request) {
+		var req IngestRequest
+		if r.ContentLength != 0 {
+			if err := decodeJSONBody(w, r, &req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+				return
+			}
+		}
+		if req.Duplicates != "" && !ingest.ValidDuplicates(req.Duplicates) {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Unsupported duplicates: %s (supported: first, latest)", req.Duplicates))
+			return
+		}
+
+		opts := ingest.Options{
+			APIKey:            openAIKey,
+			EmbeddingModel:    embeddingModel,
+			BatchSize:         req.BatchSize,
+			Workers:           req.Workers,
+			EmbedTranslations: req.EmbedTranslations,
+			Clear:             req.Clear,
+			Limit:             req.Limit,
+			Strict:            req.Strict,
+			Full:              req.Full,
+			IncludeFlavor:     req.IncludeFlavor,
+			IncludeNames:      req.IncludeNames,
+			ExcludePacks:      req.ExcludePacks,
+			Duplicates:        req.Duplicates,
+			Metric:            rag.SimilarityMetric,
+			Store:             store,
+			Priorities:        cardPriorities,
+			Fields:            cardFields,
+		}
+
+		runJob(w, JobIngest, func(progress ingest.ProgressFunc) error {
+			// An archive or URL data source is downloaded in the job, not in the request
+			dataPath, cleanup, err := ingest.OpenDataSource(context.Background(), ingestDataDir)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			opts.DataPath = dataPath
+			opts.Progress = progress
+			return ingest.Run(database, opts)
+		})
+	}))
+}
+
+// startReembedHandler starts a background job regenerating the embeddings
+// made with another model than the configured one, and returns its ID
+func startReembedHandler(database *sql.DB) http.HandlerFunc {
+	return requireMethod(http.MethodPost, requireJSON(func(w http.ResponseWriter, r *http.Request) {
+		var req ReembedRequest
+		if r.ContentLength != 0 {
+			if err := decodeJSONBody(w, r, &req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+				return
+			}
+		}
+
+		opts := ingest.Options{
+			APIKey:            openAIKey,
+			EmbeddingModel:    embeddingModel,
+			BatchSize:         req.BatchSize,
+			Workers:           req.Workers,
+			EmbedTranslations: req.Translations,
+			Metric:            rag.SimilarityMetric,
+		}
+
+		runJob(w, JobReembed, func(progress ingest.ProgressFunc) error {
+			opts.Progress = progress
+			return ingest.Reembed(database, opts)
+		})
+	}))
+}
+
+// cardHandler updates the stored entries of a single card without a full
+// ingest: DELETE /admin/card/{code} removes them, and POST
+// /admin/card/{code}/reingest re-reads the card from the data directory,
+// embeds it and replaces them. Both run in the request, as a job that
+// never overlaps another one (see runCardJob).
+func cardHandler(store rag.VectorStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/admin/card/")
+		code, action, _ := strings.Cut(path, "/")
+		if code == "" || (action != "" && action != "reingest") {
+			writeJSONError(w, http.StatusNotFound, codeNotFound, "Not found (use /admin/card/{code} or /admin/card/{code}/reingest)")
+			return
+		}
+
+		switch {
+		case action == "" && r.Method == http.MethodDelete:
+			runCardJob(w, func() error {
+				return deleteCard(w, store, code)
+			})
+		case action == "reingest" && r.Method == http.MethodPost:
+			requireJSON(func(w http.ResponseWriter, r *http.Request) {
+				runCardJob(w, func() error {
+					return reingestCard(w, r, store, code)
+				})
+			})(w, r)
+		default:
+			if action == "" {
+				w.Header().Set("Allow", http.MethodDelete)
+			} else {
+				w.Header().Set("Allow", http.MethodPost)
+			}
+			writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+// runCardJob runs fn in the request as a JobCard job, or responds with 409
+// if another job is running: a full ingest or re-embed writes the same rows
+func runCardJob(w http.ResponseWriter, fn func() error) {
+	job, err := jobs.start(JobCard)
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, codeConflict, err.Error())
+		return
+	}
+	jobs.finish(job.ID, fn())
+}
+
+// deleteCard removes the stored entries of a card. It returns the error
+// responded with, if any.
+func deleteCard(w http.ResponseWriter, store rag.VectorStore, code string) error {
+	deleted, err := store.Delete(code)
+	if err != nil {
+		log.Printf("Error deleting card %s: %v", code, err)
+		writeJSONError(w, http.StatusInternalServerError, codeInternal, fmt.Sprintf("Failed to delete card: %v", err))
+		return err
+	}
+	if deleted == 0 {
+		err := fmt.Errorf("No entries stored for card %s", code)
+		writeJSONError(w, http.StatusNotFound, codeNotFound, err.Error())
+		return err
+	}
+
+	log.Printf("🗑️  Deleted %d entries of card %s", deleted, code)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CardResponse{CardCode: code, Deleted: deleted})
+	return nil
+}
+
+// reingestCard embeds a card from the data directory and upserts its
+// entries. It returns the error responded with, if any.
+func reingestCard(w http.ResponseWriter, r *http.Request, store rag.VectorStore, code string) error {
+	var req CardReingestRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSONBody(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return err
+		}
+	}
+
+	dataPath, cleanup, err := ingest.OpenDataSource(r.Context(), ingestDataDir)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, codeInternal, fmt.Sprintf("Failed to open data source: %v", err))
+		return err
+	}
+	defer cleanup()
+
+	opts := ingest.Options{
+		DataPath:          dataPath,
+		APIKey:            openAIKey,
+		EmbeddingModel:    embeddingModel,
+		EmbedTranslations: req.EmbedTranslations,
+		IncludeFlavor:     req.IncludeFlavor,
+		IncludeNames:      req.IncludeNames,
+		Metric:            rag.SimilarityMetric,
+		Store:             store,
+		Priorities:        cardPriorities,
+		Fields:            cardFields,
+	}
+	entries, err := ingest.IngestCard(nil, opts, code)
+	if errors.Is(err, ingest.ErrCardNotFound) {
+		writeJSONError(w, http.StatusNotFound, codeNotFound, err.Error())
+		return err
+	}
+	if err != nil {
+		log.Printf("Error re-ingesting card %s: %v", code, err)
+		writeJSONError(w, http.StatusInternalServerError, codeInternal, fmt.Sprintf("Failed to re-ingest card: %v", err))
+		return err
+	}
+
+	log.Printf("✅ Re-ingested %d entries of card %s", len(entries), code)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CardResponse{CardCode: code, Ingested: len(entries)})
+	return nil
+}
+
+// runJob starts fn as a tracked background job and responds with its ID, or
+// with 409 if another job is running
+func runJob(w http.ResponseWriter, kind string, fn func(progress ingest.ProgressFunc) error) {
+	job, err := startJob(kind, fn)
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, codeConflict, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"id": job.ID})
+}
+
+// startJob runs fn in the background as a tracked job, failing if another
+// job is running
+func startJob(kind string, fn func(progress ingest.ProgressFunc) error) (*IngestJob, error) {
+	job, err := jobs.start(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		log.Printf("📊 %s job %s started", kind, job.ID)
+		err := fn(func(processed, failed, total int, batchErrors []error) {
+			jobs.progress(job.ID, processed, failed, total, batchErrors)
+		})
+		jobs.finish(job.ID, err)
+		if err != nil {
+			log.Printf("%s job %s failed: %v", kind, job.ID, err)
+		} else {
+			log.Printf("✅ %s job %s completed", kind, job.ID)
+		}
+	}()
+	return job, nil
+}
+
+// ingestStatusHandler returns the progress of an ingest or re-embed job (GET /admin/ingest/{id})
+func ingestStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/admin/ingest/")
+	job, ok := jobs.get(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, codeNotFound, fmt.Sprintf("Ingest job not found: %s", id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// start registers a new running job, failing if another one is still running
+func (j *ingestJobs) start(kind string) (*IngestJob, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.running != "" {
+		return nil, fmt.Errorf("Job %s (%s) is already running", j.running, j.jobs[j.running].Kind)
+	}
+
+	job := &IngestJob{
+		ID:        newJobID(),
+		Kind:      kind,
+		Status:    JobRunning,
+		StartedAt: time.Now(),
+		Errors:    []string{},
+	}
+	j.jobs[job.ID] = job
+	j.running = job.ID
+	return job, nil
+}
+
+func (j *ingestJobs) progress(id string, processed, failed, total int, batchErrors []error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job := j.jobs[id]
+	job.Processed = processed
+	job.Failed = failed
+	job.Total = total
+	for _, err := range batchErrors {
+		if len(job.Errors) >= maxJobErrors {
+			break
+		}
+		job.Errors = append(job.Errors, err.Error())
+	}
+}
+
+func (j *ingestJobs) finish(id string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job := j.jobs[id]
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = JobCompleted
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+	}
+	j.running = ""
+}
+
+// get returns a snapshot of a job, safe to encode without holding the lock
+func (j *ingestJobs) get(id string) (IngestJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return IngestJob{}, false
+	}
+	snapshot := *job
+	snapshot.Errors = append([]string{}, job.Errors...)
+	return snapshot, true
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// maxCompareModels bounds the number of models per compare request
+const maxCompareModels = 4
+
+type CompareRequest struct {
+	TranslateRequest
+	Models []string `json:"models"` // e.g. ["gpt-4o", "gpt-4o-mini"]
+}
+
+type CompareResult struct {
+	Translation string    `json:"translation,omitempty"`
+	Usage       rag.Usage `json:"usage"`
+	LatencyMs   int64     `json:"latency_ms"`
+	Error       string    `json:"error,omitempty"`
+	Cleaned     bool      `json:"cleaned,omitempty"`
+	Retried     bool      `json:"retried,omitempty"`
+	Notes       string    `json:"notes,omitempty"` // Warnings from the model (JSON mode only)
+	Draft       string    `json:"draft,omitempty"` // Translation before the review pass, with review
+	Raw         string    `json:"raw,omitempty"`   // The model's untouched answer, with include_raw
+	// Explanation is the model's rationale for its choices, with explain
+	Explanation string `json:"explanation,omitempty"`
+}
+
+type CompareResponse struct {
+	Results          map[string]CompareResult `json:"results"` // Model -> result
+	Context          []rag.ContextCard        `json:"context"`
+	ContextRetrieved int                      `json:"context_retrieved"` // Context cards found, see TranslateResponse
+	Warning          string                   `json:"warning,omitempty"`
+	NormalizedText   string                   `json:"normalized_text,omitempty"` // Same for every model, with include_normalized
+}
+
+// compareHandler translates one text with several chat models concurrently,
+// using the same retrieved context, so their outputs can be compared
+func compareHandler(store rag.VectorStore, providers Providers) http.HandlerFunc {
+	return corsMiddleware(requireMethod(http.MethodPost, requireJSON(func(w http.ResponseWriter, r *http.Request) {
+		var req CompareRequest
+		if err := decodeJSONBody(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		if err := validateTranslateRequest(&req.TranslateRequest); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		providers := providers.withSymbolFormat(req.SymbolFormat)
+
+		if req.RetrieveOnly {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, "retrieve_only is not supported when comparing models (use /translate)")
+			return
+		}
+
+		if req.Candidates > 1 {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, "candidates is not supported when comparing models (use /translate)")
+			return
+		}
+
+		if len(req.Languages) > 0 {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, "languages is not supported when comparing models (use /translate)")
+			return
+		}
+
+		models, err := validateCompareModels(req.Models)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		contextCards, retrieved, degraded, err := retrieveContext(r.Context(), store, providers.Embedder, req.TranslateRequest, nil)
+		if err != nil {
+			writePipelineError(w, err.Error(), err)
+			return
+		}
+
+		// Run each model concurrently against the same context
+		results := make([]CompareResult, len(models))
+		var wg sync.WaitGroup
+		for i, model := range models {
+			wg.Add(1)
+			go func(idx int, model string) {
+				defer wg.Done()
+				start := time.Now()
+				translation, err := providers.Translator.Translate(req.generationContext(r.Context()), req.Text, contextCards, model, req.Language)
+				result := CompareResult{
+					Translation: translation.Translation,
+					Usage:       translation.Usage,
+					LatencyMs:   time.Since(start).Milliseconds(),
+					Cleaned:     translation.Cleaned,
+					Retried:     translation.Retried,
+					Notes:       translation.Notes,
+					Explanation: translation.Explanation,
+					Draft:       translation.Draft,
+					Raw:         req.raw(translation.Raw),
+				}
+				if err != nil {
+					log.Printf("Error generating translation with %s: %v", model, err)
+					result.Error = err.Error()
+				}
+				results[idx] = result
+			}(i, model)
+		}
+		wg.Wait()
+
+		response := CompareResponse{
+			Results:          make(map[string]CompareResult, len(models)),
+			Context:          contextCards,
+			ContextRetrieved: retrieved,
+			Warning:          contextWarning(req.TranslateRequest, contextCards, degraded),
+		}
+		for i, model := range models {
+			response.Results[model] = results[i]
+		}
+		if req.IncludeNormalized {
+			response.NormalizedText = rag.PrepareSourceFor(req.generationContext(r.Context()), rag.ConvertSymbols(req.Text, req.SymbolFormat), req.Language)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})))
+}
+
+// validateCompareModels checks the requested models and removes duplicates
+func validateCompareModels(models []string) ([]string, error) {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, model := range models {
+		if model == "" {
+			return nil, fmt.Errorf("Model names must not be empty")
+		}
+		if !seen[model] {
+			seen[model] = true
+			unique = append(unique, model)
+		}
+	}
+
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("Models field is required (e.g. [\"gpt-4o\", \"gpt-4o-mini\"])")
+	}
+	if len(unique) > maxCompareModels {
+		return nil, fmt.Errorf("Too many models: %d (maximum %d per request)", len(unique), maxCompareModels)
+	}
+
+	return unique, nil
+}
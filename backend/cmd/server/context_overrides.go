@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// Modes of the context_overrides of a request
+const (
+	contextOverridePrepend = "prepend" // Pinned cards first, then the retrieved ones (default)
+	contextOverrideReplace = "replace" // Pinned cards only, no similarity search
+)
+
+// contextOverrideError reports context_overrides codes without a usable
+// entry; it is the client's mistake, so it answers 400
+type contextOverrideError struct {
+	Codes    []string
+	TextType string
+	Language string
+}
+
+func (e *contextOverrideError) Error() string {
+	return fmt.Sprintf("context_overrides: no %s entry with a %s translation stored for %s", e.TextType, e.Language, strings.Join(e.Codes, ", "))
+}
+
+// validateContextOverrides trims and deduplicates the context_overrides of
+// req and defaults its context_override_mode
+func validateContextOverrides(req *TranslateRequest) error {
+	if req.ContextOverrideMode == "" {
+		req.ContextOverrideMode = contextOverridePrepend
+	}
+	if req.ContextOverrideMode != contextOverridePrepend && req.ContextOverrideMode != contextOverrideReplace {
+		return fmt.Errorf("Unsupported context_override_mode: %s (supported: prepend, replace)", req.ContextOverrideMode)
+	}
+	if req.ContextOverrideMode == contextOverrideReplace && len(req.ContextOverrides) == 0 {
+		return fmt.Errorf("context_override_mode replace requires context_overrides")
+	}
+
+	codes := make([]string, 0, len(req.ContextOverrides))
+	seen := make(map[string]bool, len(req.ContextOverrides))
+	for _, code := range req.ContextOverrides {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			return fmt.Errorf("context_overrides must not contain empty card codes")
+		}
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) > contextCardLimit {
+		return fmt.Errorf("context_overrides accepts at most %d cards, got %d", contextCardLimit, len(codes))
+	}
+	req.ContextOverrides = codes
+	return nil
+}
+
+// loadContextOverrides returns the stored entries of the context_overrides
+// cards for query, or a *contextOverrideError naming the cards without one
+func loadContextOverrides(ctx context.Context, store rag.VectorStore, codes []string, query rag.SearchQuery) ([]rag.ContextCard, error) {
+	cards, err := store.Cards(ctx, codes, query)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load context_overrides: %w", err)
+	}
+
+	found := make(map[string]bool, len(cards))
+	usable := make([]rag.ContextCard, 0, len(cards))
+	for _, card := range cards {
+		if strings.TrimSpace(card.TranslatedText) == "" {
+			continue
+		}
+		found[card.CardCode] = true
+		usable = append(usable, card)
+	}
+	var missing []string
+	for _, code := range codes {
+		if !found[code] {
+			missing = append(missing, code)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &contextOverrideError{Codes: missing, TextType: query.TextType, Language: query.Language}
+	}
+	return usable, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+type DebugPromptResponse struct {
+	Model            string            `json:"model"`
+	Temperature      float64           `json:"temperature"`
+	ResponseFormat   string            `json:"response_format,omitempty"` // "json_object" when JSON_OUTPUT is set
+	Messages         []rag.Message     `json:"messages"`
+	Context          []rag.ContextCard `json:"context"`
+	ContextRetrieved int               `json:"context_retrieved"` // Context cards found, see TranslateResponse
+	Warning          string            `json:"warning,omitempty"`
+}
+
+// debugPromptHandler runs embedding and retrieval like /translate and returns
+// the chat request that would be sent, without calling the chat model, so
+// prompt regressions can be diagnosed
+func debugPromptHandler(store rag.VectorStore, providers Providers) http.HandlerFunc {
+	return corsMiddleware(requireMethod(http.MethodPost, requireJSON(func(w http.ResponseWriter, r *http.Request) {
+		var req TranslateRequest
+		if err := decodeJSONBody(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		if err := validateTranslateRequest(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		if req.RetrieveOnly {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, "retrieve_only is not supported when debugging the prompt (use /translate)")
+			return
+		}
+
+		if len(req.Languages) > 0 {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, "languages is not supported when debugging the prompt (use /translate)")
+			return
+		}
+
+		contextCards, retrieved, degraded, err := retrieveContext(r.Context(), store, providers.Embedder, req, nil)
+		if err != nil {
+			writePipelineError(w, err.Error(), err)
+			return
+		}
+
+		messages, err := rag.BuildMessages(req.generationContext(r.Context()), rag.ConvertSymbols(req.Text, req.SymbolFormat), contextCards, req.Language)
+		if err != nil {
+			writePipelineError(w, err.Error(), err)
+			return
+		}
+
+		response := DebugPromptResponse{
+			Model:            req.model,
+			Temperature:      rag.TranslationTemperature,
+			Messages:         messages,
+			Context:          contextCards,
+			ContextRetrieved: retrieved,
+			Warning:          contextWarning(req, contextCards, degraded),
+		}
+		if rag.JSONOutput {
+			response.ResponseFormat = "json_object"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})))
+}
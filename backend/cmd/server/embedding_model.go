@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// storedModels lists the embedding models of the stored entries for the
+// embedding_model check; nil skips that part of the check
+var storedModels *modelGuard
+
+// queryableEmbeddingModels returns the embedding models a request can ask
+// for with embedding_model. The embedding columns are sized for a single
+// model, the configured one the entries are ingested and queries embedded
+// with, so it is the only one until embeddings are stored per model.
+func queryableEmbeddingModels() []string {
+	return []string{embeddingModel}
+}
+
+// validateEmbeddingModel checks the embedding_model of a request against
+// queryableEmbeddingModels and the models of the stored entries, so a model
+// no entry was embedded with is rejected rather than finding no context;
+// empty means the configured model
+func validateEmbeddingModel(model string) error {
+	if model == "" {
+		return nil
+	}
+	models := queryableEmbeddingModels()
+	queryable := false
+	for _, candidate := range models {
+		if model == candidate {
+			queryable = true
+			break
+		}
+	}
+	if !queryable {
+		return fmt.Errorf("Unsupported embedding_model: %s (this server stores and queries %s embeddings only; one embedding model per database)", model, strings.Join(models, ", "))
+	}
+	if stored, ok := storedModels.models(); ok && !hasEmbeddingModel(stored, model) {
+		return fmt.Errorf("Unsupported embedding_model: %s (no entry is embedded with it; stored: %s)", model, describeModels(stored))
+	}
+	return nil
+}
+
+// hasEmbeddingModel reports whether a search filtered on model can match
+// the entries of the stored models: those embedded with it or with an
+// unknown model, which the filter keeps
+func hasEmbeddingModel(stored []string, model string) bool {
+	for _, candidate := range stored {
+		if candidate == model || candidate == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// describeModels lists the stored models for an error message
+func describeModels(stored []string) string {
+	if len(stored) == 0 {
+		return "none, the cards are not ingested"
+	}
+	return strings.Join(stored, ", ")
+}
+
+// modelGuard lists the embedding models of the card_embeddings rows at most
+// once per rowGuardInterval, so an ingest with another model shows up
+// within that interval
+type modelGuard struct {
+	list func(ctx context.Context) ([]string, error)
+
+	mu      sync.Mutex
+	stored  []string
+	ok      bool
+	checked time.Time
+}
+
+// models returns the stored embedding models, listing them again once the
+// last list is older than rowGuardInterval. ok is false for a nil guard or
+// when they could not be listed.
+func (g *modelGuard) models() (stored []string, ok bool) {
+	if g == nil {
+		return nil, false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if time.Since(g.checked) < rowGuardInterval {
+		return g.stored, g.ok
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+	stored, err := g.list(ctx)
+	g.checked = time.Now()
+	if err != nil {
+		// Leave database errors to the retrieval itself
+		log.Printf("⚠️  Could not list the stored embedding models: %v", err)
+		g.stored, g.ok = nil, false
+		return nil, false
+	}
+	g.stored, g.ok = stored, true
+	return stored, true
+}
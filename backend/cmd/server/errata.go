@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+type ErrataRequest struct {
+	TranslateRequest        // Text is the English text after the errata
+	OldText          string `json:"old_text"`        // English text before the errata
+	OldTranslation   string `json:"old_translation"` // Reviewed translation of old_text, kept where the text is unchanged
+}
+
+type ErrataResponse struct {
+	Translation      string              `json:"translation"`
+	Segments         []rag.ErrataSegment `json:"segments"`
+	Usage            rag.Usage           `json:"usage"`
+	Context          []rag.ContextCard   `json:"context"`
+	ContextRetrieved int                 `json:"context_retrieved"` // Context cards found, see TranslateResponse
+	Warning          string              `json:"warning,omitempty"`
+	PackMatched      *bool               `json:"pack_matched,omitempty"` // See TranslateResponse
+}
+
+// errataHandler updates a reviewed translation after an errata: only the
+// sentences of text that differ from old_text are translated, and the rest
+// of old_translation is kept verbatim
+func errataHandler(store rag.VectorStore, providers Providers) http.HandlerFunc {
+	return corsMiddleware(requireMethod(http.MethodPost, requireJSON(func(w http.ResponseWriter, r *http.Request) {
+		var req ErrataRequest
+		if err := decodeJSONBody(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		if err := validateErrataRequest(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		providers := providers.withSymbolFormat(req.SymbolFormat)
+
+		contextCards, retrieved, degraded, err := retrieveContext(r.Context(), store, providers.Embedder, req.TranslateRequest, nil)
+		if err != nil {
+			writePipelineError(w, err.Error(), err)
+			return
+		}
+
+		result, err := rag.TranslateErrata(req.generationContext(r.Context()), providers.Translator, req.OldText, req.OldTranslation, req.Text, contextCards, req.model, req.Language)
+		if errors.Is(err, rag.ErrErrataMisaligned) {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Cannot keep the unchanged sentences: %v (translate the whole text with /translate)", err))
+			return
+		}
+		if err != nil {
+			log.Printf("Error generating errata translation: %v", err)
+			writePipelineError(w, fmt.Sprintf("Failed to generate translation: %v", err), err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ErrataResponse{
+			Translation:      result.Translation,
+			Segments:         result.Segments,
+			Usage:            result.Usage,
+			Context:          contextCards,
+			ContextRetrieved: retrieved,
+			Warning:          contextWarning(req.TranslateRequest, contextCards, degraded),
+			PackMatched:      packMatched(req.TranslateRequest, contextCards),
+		})
+	})))
+}
+
+// validateErrataRequest validates the translation fields like
+// validateTranslateRequest, and the previous version of the text
+func validateErrataRequest(req *ErrataRequest) error {
+	if err := validateTranslateRequest(&req.TranslateRequest); err != nil {
+		return err
+	}
+	if req.OldText == "" || req.OldTranslation == "" {
+		return fmt.Errorf("old_text and old_translation are required")
+	}
+	if req.RetrieveOnly || req.Candidates > 1 || len(req.Languages) > 0 {
+		return fmt.Errorf("retrieve_only, candidates and languages are not supported for errata (use /translate)")
+	}
+	return nil
+}
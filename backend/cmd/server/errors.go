@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes of ErrorResponse, for clients to tell errors apart without
+// parsing the message
+const (
+	codeInvalidRequest       = "invalid_request"        // 400: malformed or invalid request
+	codeUnauthorized         = "unauthorized"           // 401: missing or wrong admin key
+	codeForbidden            = "forbidden"              // 403: admin endpoints disabled
+	codeNotFound             = "not_found"              // 404: unknown path, card or job
+	codeMethodNotAllowed     = "method_not_allowed"     // 405
+	codeConflict             = "conflict"               // 409: a job is already running
+	codeRequestTooLarge      = "request_too_large"      // 413: upload over MAX_BODY_BYTES
+	codePromptTooLarge       = "prompt_too_large"       // 413: text or prompt over the limits
+	codeUnsupportedMediaType = "unsupported_media_type" // 415: request body that isn't JSON
+	codeRefused              = "translation_refused"    // 422: the model declined or its answer was filtered
+	codeRateLimited          = "rate_limited"           // 429: OpenAI rate limit
+	codeInternal             = "internal_error"         // 500
+	codeUpstream             = "upstream_error"         // 502: OpenAI authentication or server error
+	codeTimeout              = "timeout"                // 503: HANDLER_TIMEOUT exceeded
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    string `json:"code"`    // One of the code constants, e.g. "invalid_request"
+	Message string `json:"message"` // Human-readable, meant to be shown to the user
+	// UpstreamCode is the code (or else type) of the OpenAI error behind a
+	// pipeline error, e.g. "rate_limit_exceeded" or "invalid_api_key"
+	UpstreamCode string `json:"upstream_code,omitempty"`
+}
+
+// writeJSONError writes an ErrorResponse with the status, in place of
+// http.Error's plain text, so clients parse every response as JSON
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorDetail(w, status, ErrorDetail{Code: code, Message: message})
+}
+
+// writeErrorDetail is writeJSONError for a detail with optional fields
+func writeErrorDetail(w http.ResponseWriter, status int, detail ErrorDetail) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: detail})
+}
+
+// timeoutBody is the ErrorResponse sent by withHandlerTimeout
+var timeoutBody = func() string {
+	body, _ := json.Marshal(ErrorResponse{Error: ErrorDetail{Code: codeTimeout, Message: "Request timed out"}})
+	return string(body)
+}()
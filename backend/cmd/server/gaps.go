@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+type GapsResponse struct {
+	Gaps []ingest.CoverageGap `json:"gaps"`
+	db.PageInfo
+}
+
+// gapsHandler lists the ingested entries without a translation (GET /gaps),
+// a page at a time, like the gaps tool. The language and text_type query
+// parameters select the translations, limit and cursor the page.
+func gapsHandler(database *sql.DB) http.HandlerFunc {
+	return corsMiddleware(requireMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		page, err := parsePage(params)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		language := params.Get("language")
+		if language == "" {
+			language = "it"
+		}
+		if !options.ValidLanguage(language) {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Unsupported language: %s (supported: %s)", language, strings.Join(options.SupportedLanguages, ", ")))
+			return
+		}
+		textType := params.Get("text_type")
+		if textType == "" {
+			textType = rag.TextRules
+		}
+		if !rag.ValidTextType(textType) {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Unsupported text_type: %s (supported: rules, flavor, name)", textType))
+			return
+		}
+
+		gaps, info, err := ingest.CoverageGaps(r.Context(), database, language, textType, page)
+		if err != nil {
+			log.Printf("Error listing coverage gaps: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, codeInternal, fmt.Sprintf("Failed to list coverage gaps: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(GapsResponse{Gaps: gaps, PageInfo: info})
+	}))
+}
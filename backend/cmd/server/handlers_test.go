@@ -2,11 +2,43 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+	"github.com/ventrosky/arkham-localize/backend/internal/ragtest"
+	"github.com/ventrosky/arkham-localize/backend/internal/testdb"
 )
 
 func setupTestHandlers() {
@@ -16,6 +48,12 @@ func setupTestHandlers() {
 	}
 	openAIKey = os.Getenv("OPENAI_API_KEY")
 	embeddingModel = "text-embedding-3-small"
+	chatModel = "gpt-4o"
+}
+
+// fakeProviders returns the offline embedding and translation providers
+func fakeProviders() Providers {
+	return Providers{Embedder: ragtest.Embedder{}, Translator: ragtest.Translator{}}
 }
 
 func TestHealthHandler(t *testing.T) {
@@ -33,6 +71,72 @@ func TestHealthHandler(t *testing.T) {
 	if status := rr.Code; status != http.StatusOK {
 		t.Errorf("Expected status %d, got %d", http.StatusOK, status)
 	}
+	var response map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response["version"] != serviceVersion() {
+		t.Errorf("Expected version %q, got %q", serviceVersion(), response["version"])
+	}
+}
+
+func TestVersion(t *testing.T) {
+	defer func(v, c, d string) { version, commit, buildDate = v, c, d }(version, commit, buildDate)
+	version, commit, buildDate = "1.4.0", "3f9a1c2", "2026-01-02T03:04:05Z"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", corsMiddleware(requireMethod(http.MethodGet, versionHandler)))
+	rr := httptest.NewRecorder()
+	withVersionHeader(mux).ServeHTTP(rr, httptest.NewRequest("GET", "/version", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if header := rr.Header().Get("X-Service-Version"); header != "1.4.0 (3f9a1c2)" {
+		t.Errorf("Expected X-Service-Version %q, got %q", "1.4.0 (3f9a1c2)", header)
+	}
+	var response VersionResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := VersionResponse{Version: "1.4.0", Commit: "3f9a1c2", BuildDate: "2026-01-02T03:04:05Z"}
+	if response != expected {
+		t.Errorf("Expected %+v, got %+v", expected, response)
+	}
+
+	// Error responses carry the header too
+	rr = httptest.NewRecorder()
+	withVersionHeader(mux).ServeHTTP(rr, httptest.NewRequest("POST", "/version", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("X-Service-Version") == "" {
+		t.Errorf("Expected 405 with X-Service-Version, got %d %q", rr.Code, rr.Header().Get("X-Service-Version"))
+	}
+}
+
+func TestDetailedHealthHandler_DatabaseDown(t *testing.T) {
+	// Nothing listens on port 1, so the ping fails right away
+	database, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=arkham dbname=arkham_localize sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	rr := httptest.NewRecorder()
+	detailedHealthHandler(database).ServeHTTP(rr, httptest.NewRequest("GET", "/health/detailed", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	var response ReadinessResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != statusDBDown || response.Checks["database"].OK || response.Checks["database"].Error == "" {
+		t.Errorf("Expected db_down with a database error, got %+v", response)
+	}
+	if _, ok := response.Checks["card_embeddings"]; ok {
+		t.Errorf("Expected the later checks to be skipped, got %+v", response.Checks)
+	}
 }
 
 func TestTranslateHandler_MethodNotAllowed(t *testing.T) {
@@ -46,7 +150,7 @@ func TestTranslateHandler_MethodNotAllowed(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := translateHandler(db)
+	handler := translateHandler(rag.NewPostgresStore(db), fakeProviders())
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusMethodNotAllowed {
@@ -65,7 +169,7 @@ func TestTranslateHandler_EmptyBody(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := translateHandler(db)
+	handler := translateHandler(rag.NewPostgresStore(db), fakeProviders())
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusBadRequest {
@@ -73,6 +177,32 @@ func TestTranslateHandler_EmptyBody(t *testing.T) {
 	}
 }
 
+// decodeError decodes the ErrorResponse of a recorded error response
+func decodeError(t *testing.T, rr *httptest.ResponseRecorder) ErrorDetail {
+	t.Helper()
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected a JSON error, got content type %q", contentType)
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	return response.Error
+}
+
+func TestWriteJSONError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeJSONError(rr, http.StatusNotFound, codeNotFound, "No entries stored for card 01020")
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+	expected := ErrorDetail{Code: codeNotFound, Message: "No entries stored for card 01020"}
+	if detail := decodeError(t, rr); detail != expected {
+		t.Errorf("Expected %+v, got %+v", expected, detail)
+	}
+}
+
 func TestTranslateHandler_InvalidJSON(t *testing.T) {
 	setupTestHandlers()
 
@@ -84,10 +214,2372 @@ func TestTranslateHandler_InvalidJSON(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := translateHandler(db)
+	handler := translateHandler(rag.NewPostgresStore(db), fakeProviders())
 	handler.ServeHTTP(rr, req)
 
 	if status := rr.Code; status != http.StatusBadRequest {
 		t.Errorf("Expected status %d for invalid JSON, got %d", http.StatusBadRequest, status)
 	}
 }
+
+func TestTranslateHandler_BodyLimits(t *testing.T) {
+	setupTestHandlers()
+
+	var db *sql.DB
+
+	oversized := `{"text": "` + strings.Repeat("a", int(maxBodyBytes)) + `"}`
+	testCases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"oversized", oversized, "Request body too large"},
+		{"unknown field", `{"text": "Draw 1 card.", "langauge": "it"}`, `unknown field "langauge"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/translate", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			translateHandler(rag.NewPostgresStore(db), fakeProviders()).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+			detail := decodeError(t, rr)
+			if detail.Code != codeInvalidRequest {
+				t.Errorf("Expected code %s, got %s", codeInvalidRequest, detail.Code)
+			}
+			if !strings.Contains(detail.Message, tc.expected) {
+				t.Errorf("Expected message to contain %q, got %q", tc.expected, detail.Message)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_InvalidRetrievalMode(t *testing.T) {
+	setupTestHandlers()
+
+	var db *sql.DB
+
+	body := []byte(`{"text": "Draw 1 card.", "language": "it", "retrieval_mode": "klingon"}`)
+	req, err := http.NewRequest("POST", "/translate", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := translateHandler(rag.NewPostgresStore(db), fakeProviders())
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid retrieval mode, got %d", http.StatusBadRequest, status)
+	}
+}
+
+func TestValidateTranslateRequest_TextType(t *testing.T) {
+	req := TranslateRequest{Text: "Draw 1 card."}
+	if err := validateTranslateRequest(&req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if req.TextType != rag.TextRules {
+		t.Errorf("Expected default text_type %s, got %s", rag.TextRules, req.TextType)
+	}
+
+	req = TranslateRequest{Text: "Roland Banks\nThe Fed", TextType: rag.TextName}
+	if err := validateTranslateRequest(&req); err != nil {
+		t.Errorf("Unexpected error for text_type %s: %v", rag.TextName, err)
+	}
+
+	req = TranslateRequest{Text: "Draw 1 card.", TextType: "lore"}
+	if err := validateTranslateRequest(&req); err == nil {
+		t.Error("Expected error for unsupported text_type, got nil")
+	}
+}
+
+func TestValidateTranslateRequest_MinSimilarity(t *testing.T) {
+	for _, minSimilarity := range []float64{-0.1, 1.5} {
+		req := TranslateRequest{Text: "Draw 1 card.", MinSimilarity: minSimilarity}
+		if err := validateTranslateRequest(&req); err == nil {
+			t.Errorf("Expected error for min_similarity %g, got nil", minSimilarity)
+		}
+	}
+}
+
+func TestValidateTranslateRequest_Deck(t *testing.T) {
+	for _, tt := range []struct {
+		deck  string
+		valid bool
+	}{
+		{"", true},
+		{rag.DeckPlayer, true},
+		{rag.DeckEncounter, true},
+		{"scenario", false},
+	} {
+		req := TranslateRequest{Text: "Draw 1 card.", Deck: tt.deck}
+		if err := validateTranslateRequest(&req); (err == nil) != tt.valid {
+			t.Errorf("deck %q: expected valid=%v, got %v", tt.deck, tt.valid, err)
+		}
+	}
+}
+
+func TestTranslateHandler_EmbeddingModel(t *testing.T) {
+	setupTestHandlers()
+
+	testCases := []struct {
+		name          string
+		body          string
+		expectedCode  int
+		expectedModel string
+	}{
+		{"Default", `{"text": "Fight.", "retrieve_only": true}`, http.StatusOK, ""},
+		{"Configured", `{"text": "Fight.", "retrieve_only": true, "embedding_model": "text-embedding-3-small"}`, http.StatusOK, "text-embedding-3-small"},
+		{"NotIngested", `{"text": "Fight.", "retrieve_only": true, "embedding_model": "text-embedding-3-large"}`, http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &fakeStore{}
+			rr := httptest.NewRecorder()
+			translateHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(tc.body)))
+			if rr.Code != tc.expectedCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedCode, rr.Code, rr.Body.String())
+			}
+			if tc.expectedCode != http.StatusOK {
+				if message := decodeError(t, rr).Message; !strings.Contains(message, "text-embedding-3-small embeddings only") {
+					t.Errorf("Expected the error to name the queryable model, got %q", message)
+				}
+				return
+			}
+			// Naming the model restricts the search to its entries
+			if len(store.queries) != 1 || store.queries[0].EmbeddingModel != tc.expectedModel {
+				t.Errorf("Expected a search filtered on %q, got %+v", tc.expectedModel, store.queries)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_EmbeddingModelNotStored(t *testing.T) {
+	setupTestHandlers()
+	defer func() { storedModels = nil }()
+
+	testCases := []struct {
+		name         string
+		stored       []string
+		expectedCode int
+	}{
+		{"Stored", []string{"text-embedding-3-small"}, http.StatusOK},
+		{"UnknownModelRows", []string{"", "text-embedding-ada-002"}, http.StatusOK},
+		{"OtherModel", []string{"text-embedding-ada-002"}, http.StatusBadRequest},
+		{"NotIngested", nil, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storedModels = &modelGuard{list: func(ctx context.Context) ([]string, error) { return tc.stored, nil }}
+			body := `{"text": "Fight.", "retrieve_only": true, "embedding_model": "text-embedding-3-small"}`
+			rr := httptest.NewRecorder()
+			translateHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+			if rr.Code != tc.expectedCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedCode, rr.Code, rr.Body.String())
+			}
+			if tc.expectedCode != http.StatusOK {
+				if message := decodeError(t, rr).Message; !strings.Contains(message, "no entry is embedded with it") {
+					t.Errorf("Expected the error to report the stored models, got %q", message)
+				}
+			}
+		})
+	}
+
+	// Without an embedding_model the stored models are not checked
+	storedModels = &modelGuard{list: func(ctx context.Context) ([]string, error) { return nil, nil }}
+	rr := httptest.NewRecorder()
+	translateHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(`{"text": "Fight.", "retrieve_only": true}`)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 without embedding_model, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestModelGuard_ListError(t *testing.T) {
+	guard := &modelGuard{list: func(ctx context.Context) ([]string, error) { return nil, errors.New("connection refused") }}
+	if _, ok := guard.models(); ok {
+		t.Error("Expected no models when they could not be listed")
+	}
+	var disabled *modelGuard
+	if _, ok := disabled.models(); ok {
+		t.Error("Expected a nil guard to list no models")
+	}
+}
+
+func TestValidateTranslateRequest_Candidates(t *testing.T) {
+	tests := []struct {
+		candidates int
+		valid      bool
+	}{
+		{0, true},
+		{1, true},
+		{rag.MaxCandidates, true},
+		{-1, false},
+		{rag.MaxCandidates + 1, false},
+	}
+	for _, tt := range tests {
+		req := TranslateRequest{Text: "Draw 1 card.", Candidates: tt.candidates}
+		if err := validateTranslateRequest(&req); (err == nil) != tt.valid {
+			t.Errorf("candidates %d: expected valid=%v, got %v", tt.candidates, tt.valid, err)
+		}
+	}
+}
+
+func TestValidateTranslateRequest_Languages(t *testing.T) {
+	tests := []struct {
+		name string
+		req  TranslateRequest
+		want []string
+	}{
+		{"Deduplicated", TranslateRequest{Languages: []string{"it", "fr", "it"}}, []string{"it", "fr"}},
+		{"Unsupported", TranslateRequest{Languages: []string{"it", "xx"}}, nil},
+		{"TooMany", TranslateRequest{Languages: []string{"it", "fr", "de", "es", "pt"}}, nil},
+		{"WithLanguage", TranslateRequest{Language: "it", Languages: []string{"fr"}}, nil},
+		{"WithCandidates", TranslateRequest{Languages: []string{"fr"}, Candidates: 2}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.Text = "Draw 1 card."
+			err := validateTranslateRequest(&req)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("Expected error, got languages %v", req.Languages)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(req.Languages, tt.want) {
+				t.Errorf("Expected languages %v, got %v", tt.want, req.Languages)
+			}
+		})
+	}
+}
+
+func TestContextWarning(t *testing.T) {
+	req := TranslateRequest{MinSimilarity: 0.8}
+	if warning := contextWarning(req, []rag.ContextCard{}, false); warning != unguidedWarning {
+		t.Errorf("Expected unguided warning, got %q", warning)
+	}
+	if warning := contextWarning(req, []rag.ContextCard{{CardCode: "01001"}}, false); warning != "" {
+		t.Errorf("Expected no warning with context, got %q", warning)
+	}
+	if warning := contextWarning(TranslateRequest{}, []rag.ContextCard{}, false); warning != "" {
+		t.Errorf("Expected no warning without a threshold, got %q", warning)
+	}
+	if warning := contextWarning(req, []rag.ContextCard{}, true); warning != degradedWarning {
+		t.Errorf("Expected degraded warning, got %q", warning)
+	}
+}
+
+func TestTranslateHandler_ContextTokenBudget(t *testing.T) {
+	setupTestHandlers()
+	defer func(budget int) { rag.ContextTokenBudget = budget }(rag.ContextTokenBudget)
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it"},
+		{CardCode: "01016", EnglishText: strings.Repeat("Uses (4 ammo). ", 200), TranslatedText: strings.Repeat("Usi (4 munizioni). ", 200), TranslationLanguage: "it"},
+		{CardCode: "01030", EnglishText: "Investigate.", TranslatedText: "Indagare.", TranslationLanguage: "it"},
+	}}
+
+	tests := []struct {
+		budget    int
+		wantCards int
+	}{
+		{0, 3},
+		{200, 1},
+	}
+
+	for _, tt := range tests {
+		rag.ContextTokenBudget = tt.budget
+		for _, body := range []string{`{"text": "Fight."}`, `{"text": "Fight.", "retrieve_only": true}`} {
+			rr := httptest.NewRecorder()
+			translateHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Context) != tt.wantCards || response.ContextRetrieved != 3 {
+				t.Errorf("Budget %d, %s: expected %d of 3 cards, got %d of %d", tt.budget, body, tt.wantCards, len(response.Context), response.ContextRetrieved)
+			}
+		}
+	}
+}
+
+func TestTranslateHandler_PreferPack(t *testing.T) {
+	setupTestHandlers()
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it", PackCode: "core"},
+		{CardCode: "02186", EnglishText: "Fight. You get +1 [combat].", TranslatedText: "Combattere. Ottieni +1 [combat].", TranslationLanguage: "it", PackCode: "dwl"},
+	}}
+
+	tests := []struct {
+		pack        string
+		wantMatched string // pack_matched, "" when left out
+	}{
+		{"", ""},
+		{"dwl", "true"},
+		{"tmm", "false"}, // Nearest cards of other packs only
+	}
+
+	for _, tt := range tests {
+		store.queries = nil
+		body := fmt.Sprintf(`{"text": "Fight.", "retrieve_only": true, "prefer_pack": %q}`, tt.pack)
+		rr := httptest.NewRecorder()
+		translateHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var response TranslateResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		matched := ""
+		if response.PackMatched != nil {
+			matched = fmt.Sprint(*response.PackMatched)
+		}
+		if matched != tt.wantMatched {
+			t.Errorf("Pack %q: expected pack_matched %q, got %q", tt.pack, tt.wantMatched, matched)
+		}
+		if len(store.queries) != 1 || store.queries[0].PreferPack != tt.pack {
+			t.Errorf("Pack %q: expected the search to prefer it, got %+v", tt.pack, store.queries)
+		}
+	}
+}
+
+func TestTranslateHandler_ModelMismatch(t *testing.T) {
+	setupTestHandlers()
+	defer func(mode string) { modelMismatch = mode }(modelMismatch)
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it", EmbeddingModel: "text-embedding-3-small"},
+		{CardCode: "01016", EnglishText: "Uses (4 ammo).", TranslatedText: "Usi (4 munizioni).", TranslationLanguage: "it", EmbeddingModel: "text-embedding-ada-002"},
+	}}
+
+	tests := []struct {
+		mode        string
+		queryModel  string
+		wantWarning string
+	}{
+		{options.ModelMismatchWarn, "", fmt.Sprintf(modelMismatchWarning, "text-embedding-ada-002", "text-embedding-3-small")},
+		// The store leaves them out; the fake returns them regardless
+		{options.ModelMismatchFilter, "text-embedding-3-small", fmt.Sprintf(modelMismatchWarning, "text-embedding-ada-002", "text-embedding-3-small")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			modelMismatch = tt.mode
+			store.queries = nil
+			rr := httptest.NewRecorder()
+			translateHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(`{"text": "Fight."}`)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			if len(store.queries) != 1 || store.queries[0].EmbeddingModel != tt.queryModel {
+				t.Errorf("Expected a search restricted to model %q, got %+v", tt.queryModel, store.queries)
+			}
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Warning != tt.wantWarning {
+				t.Errorf("Expected warning %q, got %q", tt.wantWarning, response.Warning)
+			}
+		})
+	}
+
+	if warning := contextWarning(TranslateRequest{}, store.cards[:1], false); warning != "" {
+		t.Errorf("Expected no warning when the models match, got %q", warning)
+	}
+}
+
+func TestRowGuard(t *testing.T) {
+	rows, counts := 0, 0
+	guard := &rowGuard{min: 10, count: func(ctx context.Context) (int, error) {
+		counts++
+		return rows, nil
+	}}
+
+	if !guard.lowRows() {
+		t.Error("Expected too few rows on an empty database")
+	}
+	rows = 100
+	if !guard.lowRows() || counts != 1 {
+		t.Errorf("Expected the cached count to be reused, got %d counts", counts)
+	}
+	guard.checked = time.Now().Add(-rowGuardInterval)
+	if guard.lowRows() || counts != 2 {
+		t.Errorf("Expected enough rows after recounting, got %d counts", counts)
+	}
+
+	guard.checked = time.Time{}
+	guard.count = func(ctx context.Context) (int, error) { return 0, fmt.Errorf("connection refused") }
+	if guard.lowRows() {
+		t.Error("Expected a failed count not to report too few rows")
+	}
+
+	var disabled *rowGuard
+	if disabled.lowRows() {
+		t.Error("Expected a nil guard never to report too few rows")
+	}
+}
+
+func TestContextWarning_NotIngested(t *testing.T) {
+	defer func() { ingestGuard, minRowsWarning = nil, false }()
+	ingestGuard = &rowGuard{min: 1, count: func(ctx context.Context) (int, error) { return 0, nil }}
+
+	if warning := contextWarning(TranslateRequest{}, []rag.ContextCard{}, false); warning != "" {
+		t.Errorf("Expected no warning without MIN_ROWS_WARNING, got %q", warning)
+	}
+	minRowsWarning = true
+	if warning := contextWarning(TranslateRequest{}, []rag.ContextCard{}, true); warning != notIngestedWarning {
+		t.Errorf("Expected not ingested warning, got %q", warning)
+	}
+}
+
+func TestTranslateHandler_EndToEnd(t *testing.T) {
+	setupTestHandlers()
+	database := testdb.Start(t)
+
+	providers := fakeProviders()
+	for _, card := range []struct{ code, name, english, italian string }{
+		{"01020", "Machete", "Fight. You get +1 [combat] for this attack.", "Combattere. Ottieni +1 [combat] per questo attacco."},
+		{"01030", "Magnifying Glass", "You get +1 [intellect] while investigating.", "Ottieni +1 [intellect] mentre indaghi."},
+	} {
+		embedding, err := providers.Embedder.Embed(context.Background(), card.english)
+		if err != nil {
+			t.Fatalf("Failed to embed %s: %v", card.name, err)
+		}
+		testdb.InsertCard(t, database, card.code, card.name, rag.TextRules, card.english, embedding, map[string]string{"it": card.italian})
+	}
+
+	text := "Fight. You get +1 [combat] for this attack."
+	rr := httptest.NewRecorder()
+	translateHandler(rag.NewPostgresStore(database), providers).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(`{"text": "`+text+`"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var response TranslateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Context) != 2 || response.Context[0].CardCode != "01020" || response.Context[0].TranslatedText != "Combattere. Ottieni +1 [combat] per questo attacco." {
+		t.Fatalf("Expected Machete as the closest context card, got %+v", response.Context)
+	}
+	if response.Translation != ragtest.Translation(text, "it", 2) {
+		t.Errorf("Expected the fake translation with 2 context cards, got %q", response.Translation)
+	}
+}
+
+// fakeStore is an in-memory VectorStore returning fixed cards
+type fakeStore struct {
+	cards      []rag.ContextCard
+	embeddings map[string][]float32 // Card code -> stored embedding
+	mu         sync.Mutex
+	queries    []rag.SearchQuery
+}
+
+func (s *fakeStore) Upsert(entries []rag.StoreEntry) error { return nil }
+
+func (s *fakeStore) Delete(cardCode string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for _, card := range s.cards {
+		if card.CardCode == cardCode {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *fakeStore) Embedding(ctx context.Context, cardCode string, isBack bool, textType string) ([]float32, error) {
+	embedding, ok := s.embeddings[cardCode]
+	if !ok {
+		return nil, rag.ErrEntryNotFound
+	}
+	return embedding, nil
+}
+
+func (s *fakeStore) Search(ctx context.Context, query rag.SearchQuery) ([]rag.ContextCard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, query)
+	return s.cards, nil
+}
+
+// Cards returns the cards with the given codes, in their order
+func (s *fakeStore) Cards(ctx context.Context, codes []string, query rag.SearchQuery) ([]rag.ContextCard, error) {
+	cards := []rag.ContextCard{}
+	for _, code := range codes {
+		for _, card := range s.cards {
+			if card.CardCode == code {
+				cards = append(cards, card)
+			}
+		}
+	}
+	return cards, nil
+}
+
+func TestTranslateHandler_ContextOverrides(t *testing.T) {
+	setupTestHandlers()
+
+	cards := []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combatti."},
+		{CardCode: "01016", CardName: ".45 Automatic", EnglishText: "Fight. Deal +1 damage.", TranslatedText: "Combatti. Infliggi +1 danno."},
+		{CardCode: "01030", CardName: "Magnifying Glass", EnglishText: "Investigate.", TranslatedText: "Indaga."},
+		{CardCode: "01031", CardName: "Old Book of Lore", EnglishText: "Search.", TranslatedText: ""},
+	}
+	testCases := []struct {
+		name     string
+		body     string
+		status   int
+		expected string // Codes of the context cards, pinned ones marked with *
+		searches int
+	}{
+		{"Prepend", `{"text": "Fight.", "context_overrides": ["01030", " 01016 ", "01030"]}`, http.StatusOK, "01030*,01016*,01020", 1},
+		{"Replace", `{"text": "Fight.", "context_overrides": ["01030"], "context_override_mode": "replace"}`, http.StatusOK, "01030*", 0},
+		{"UnknownCard", `{"text": "Fight.", "context_overrides": ["01030", "99999"]}`, http.StatusBadRequest, "", 0},
+		{"NoTranslation", `{"text": "Fight.", "context_overrides": ["01031"]}`, http.StatusBadRequest, "", 0},
+		{"ReplaceWithoutCards", `{"text": "Fight.", "context_override_mode": "replace"}`, http.StatusBadRequest, "", 0},
+		{"InvalidMode", `{"text": "Fight.", "context_overrides": ["01030"], "context_override_mode": "append"}`, http.StatusBadRequest, "", 0},
+		{"EmptyCode", `{"text": "Fight.", "context_overrides": [""]}`, http.StatusBadRequest, "", 0},
+		{"TooMany", `{"text": "Fight.", "context_overrides": ["1", "2", "3", "4", "5", "6", "7"]}`, http.StatusBadRequest, "", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &fakeStore{cards: cards}
+			rr := httptest.NewRecorder()
+			body := strings.TrimSuffix(tc.body, "}") + `, "retrieve_only": true}`
+			translateHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+			if rr.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			if len(store.queries) != tc.searches {
+				t.Errorf("Expected %d searches, got %d", tc.searches, len(store.queries))
+			}
+			if tc.status != http.StatusOK {
+				if detail := decodeError(t, rr); detail.Code != codeInvalidRequest {
+					t.Errorf("Expected code %s, got %s", codeInvalidRequest, detail.Code)
+				}
+				return
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			var codes []string
+			for _, card := range response.Context {
+				if card.IsPinned {
+					card.CardCode += "*"
+				}
+				codes = append(codes, card.CardCode)
+			}
+			if strings.Join(codes, ",") != tc.expected {
+				t.Errorf("Expected context %s, got %v", tc.expected, codes)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_VectorStore(t *testing.T) {
+	setupTestHandlers()
+	defer func(languages []string) { rag.ReferenceLanguages = languages }(rag.ReferenceLanguages)
+	rag.ReferenceLanguages = []string{"it", "fr"}
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "de", TextType: rag.TextRules},
+	}}
+	body := `{"text": "Fight.", "language": "de", "retrieval_mode": "target", "retrieve_only": true, "type_code": "asset", "faction_code": "guardian", "deck": "player"}`
+	rr := httptest.NewRecorder()
+	translateHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	if len(store.queries) != 1 {
+		t.Fatalf("Expected 1 search, got %d", len(store.queries))
+	}
+	query := store.queries[0]
+	if query.Language != "de" || query.Mode != rag.RetrievalTarget || query.TextType != rag.TextRules || query.Limit < contextCardLimit || len(query.Embedding) == 0 {
+		t.Errorf("Unexpected search query: language %s, mode %s, text type %s, limit %d, %d dimensions",
+			query.Language, query.Mode, query.TextType, query.Limit, len(query.Embedding))
+	}
+	if !reflect.DeepEqual(query.ReferenceLanguages, []string{"it", "fr"}) {
+		t.Errorf("Expected the reference languages it, fr in the search query, got %v", query.ReferenceLanguages)
+	}
+	if query.TypeCode != "asset" || query.FactionCode != "guardian" {
+		t.Errorf("Expected the asset and guardian filters in the search query, got %q and %q", query.TypeCode, query.FactionCode)
+	}
+	if query.Deck != rag.DeckPlayer {
+		t.Errorf("Expected the player deck filter in the search query, got %q", query.Deck)
+	}
+
+	var response TranslateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Context) != 1 || response.Context[0].CardCode != "01020" {
+		t.Errorf("Expected the store's card as context, got %+v", response.Context)
+	}
+}
+
+// slowEmbedder delays the embeddings of another embedder
+type slowEmbedder struct {
+	rag.Embedder
+	delay time.Duration
+}
+
+func (e slowEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	time.Sleep(e.delay)
+	return e.Embedder.Embed(ctx, text)
+}
+
+// countingEmbedder counts the embeddings of another embedder
+type countingEmbedder struct {
+	rag.Embedder
+	mu    sync.Mutex
+	calls int
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	e.mu.Lock()
+	e.calls++
+	e.mu.Unlock()
+	return e.Embedder.Embed(ctx, text)
+}
+
+// failingTranslator fails the translations into one language, with err or
+// else a generic error
+type failingTranslator struct {
+	rag.Translator
+	language string
+	err      error
+}
+
+func (t failingTranslator) Translate(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string) (rag.TranslationResult, error) {
+	if language == t.language {
+		if t.err != nil {
+			return rag.TranslationResult{}, t.err
+		}
+		return rag.TranslationResult{}, fmt.Errorf("model unavailable")
+	}
+	return t.Translator.Translate(ctx, englishText, contextCards, model, language)
+}
+
+func TestTranslateHandler_Refusal(t *testing.T) {
+	setupTestHandlers()
+
+	refusal := &rag.RefusalError{Reason: rag.RefusalContentFilter}
+	providers := Providers{Embedder: ragtest.Embedder{}, Translator: failingTranslator{Translator: ragtest.Translator{}, language: "it", err: refusal}}
+
+	body := `{"text": "Fight.", "language": "it"}`
+	rr := httptest.NewRecorder()
+	translateHandler(&fakeStore{}, providers).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	}
+	detail := decodeError(t, rr)
+	if detail.Code != codeRefused {
+		t.Errorf("Expected code %s, got %s", codeRefused, detail.Code)
+	}
+	if !strings.Contains(detail.Message, "content filter") {
+		t.Errorf("Expected the message to explain the refusal, got %q", detail.Message)
+	}
+}
+
+func TestTranslateHandler_NotCacheable(t *testing.T) {
+	setupTestHandlers()
+
+	for _, target := range []string{"/translate", "/translate?debug=1"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", target, strings.NewReader(`{"text": "Fight.", "language": "it"}`))
+		req.Header.Set("If-None-Match", "*")
+		translateHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d: %s", target, http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "no-store" {
+			t.Errorf("%s: expected Cache-Control: no-store, got %q", target, cacheControl)
+		}
+		if etag := rr.Header().Get("ETag"); etag != "" {
+			t.Errorf("%s: expected no ETag, got %q", target, etag)
+		}
+	}
+}
+
+func TestTranslateHandler_Languages(t *testing.T) {
+	setupTestHandlers()
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it", TextType: rag.TextRules},
+	}}
+	embedder := &countingEmbedder{Embedder: ragtest.Embedder{}}
+	providers := Providers{Embedder: embedder, Translator: failingTranslator{Translator: ragtest.Translator{}, language: "de"}}
+
+	body := `{"text": "Fight.", "languages": ["it", "fr", "de"]}`
+	rr := httptest.NewRecorder()
+	translateHandler(store, providers).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var response LanguagesResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(response.Results))
+	}
+	for _, language := range []string{"it", "fr"} {
+		result := response.Results[language]
+		if expected := ragtest.Translation("Fight.", language, 1); result.Translation != expected {
+			t.Errorf("Expected %s translation %q, got %q (error %q)", language, expected, result.Translation, result.Error)
+		}
+		if len(result.Context) != 1 {
+			t.Errorf("Expected 1 %s context card, got %d", language, len(result.Context))
+		}
+	}
+	if result := response.Results["de"]; result.Error == "" || result.Translation != "" {
+		t.Errorf("Expected a de error without translation, got %+v", result)
+	}
+
+	if embedder.calls != 1 {
+		t.Errorf("Expected the text to be embedded once, got %d calls", embedder.calls)
+	}
+	searched := map[string]bool{}
+	for _, query := range store.queries {
+		searched[query.Language] = true
+	}
+	if len(searched) != 3 {
+		t.Errorf("Expected a search per language, got %v", searched)
+	}
+}
+
+// The languages of a request search the store concurrently, through the
+// ?debug=1 search recorder (run with -race)
+func TestTranslateHandler_LanguagesDebug(t *testing.T) {
+	setupTestHandlers()
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it", TextType: rag.TextRules},
+	}}
+	handler := translateHandler(store, fakeProviders())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"text": "Fight.", "languages": ["it", "fr", "de", "es"]}`
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("POST", "/translate?debug=1", strings.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTranslateHandler_DebugTimings(t *testing.T) {
+	setupTestHandlers()
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it", TextType: rag.TextRules},
+	}}
+	providers := fakeProviders()
+	providers.Embedder = slowEmbedder{Embedder: providers.Embedder, delay: 20 * time.Millisecond}
+
+	testCases := []struct {
+		name   string
+		target string
+		body   string
+	}{
+		{"Translate", "/translate?debug=1", `{"text": "Fight."}`},
+		{"RetrieveOnly", "/translate?debug=1", `{"text": "Fight.", "retrieve_only": true}`},
+		{"Candidates", "/translate?debug=1", `{"text": "Fight.", "candidates": 2}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			translateHandler(store, providers).ServeHTTP(rr, httptest.NewRequest("POST", tc.target, strings.NewReader(tc.body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			timings := response.Timings
+			if timings == nil {
+				t.Fatal("Expected timings with debug=1, got none")
+			}
+			if timings.Embedding < 20 {
+				t.Errorf("Expected the embedding to take at least 20ms, got %g", timings.Embedding)
+			}
+			if timings.Total < timings.Embedding+timings.Retrieval+timings.Rerank+timings.Generation {
+				t.Errorf("Expected the total to cover every stage, got %+v", timings)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	translateHandler(store, providers).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(`{"text": "Fight."}`)))
+	if strings.Contains(rr.Body.String(), "timings") {
+		t.Errorf("Expected no timings without debug=1, got %s", rr.Body.String())
+	}
+}
+
+func TestTranslateHandler_DebugRetrieved(t *testing.T) {
+	setupTestHandlers()
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it", TextType: rag.TextRules, Similarity: 0.9},
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it", TextType: rag.TextRules, Similarity: 0.9},
+		{CardCode: "01016", CardName: ".45 Automatic", EnglishText: "Fight. +1 damage.", TranslatedText: "Combattere. +1 danno.", TranslationLanguage: "it", TextType: rag.TextRules, Similarity: 0.5},
+		{CardCode: "01030", CardName: "Magnifying Glass", EnglishText: "+1 intellect.", TranslationLanguage: "it", TextType: rag.TextRules, Similarity: 0.8},
+	}}
+	body := `{"text": "Fight.", "min_similarity": 0.7}`
+
+	for _, target := range []string{"/translate", "/translate?debug=1"} {
+		t.Run(target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			translateHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", target, strings.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			// The duplicate, the card without translation and the weak match are not in the prompt
+			if len(response.Context) != 1 || response.Context[0].CardCode != "01020" {
+				t.Errorf("Expected only Machete as context, got %+v", response.Context)
+			}
+
+			expected := 0
+			if strings.Contains(target, "debug=1") {
+				expected = len(store.cards)
+			}
+			if len(response.Retrieved) != expected {
+				t.Errorf("Expected %d retrieved cards, got %+v", expected, response.Retrieved)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_Tracing(t *testing.T) {
+	setupTestHandlers()
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	store := tracedStore{VectorStore: &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere.", TranslationLanguage: "it", TextType: rag.TextRules},
+	}}}
+	handler := withTracing(translateHandler(store, tracedProviders(fakeProviders())))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/translate", strings.NewReader(`{"text": "Fight."}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	root, ok := spans["POST /translate"]
+	if !ok {
+		t.Fatalf("Expected a request span, got %v", reflect.ValueOf(spans).MapKeys())
+	}
+	if got := root.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("Expected the request span to continue trace %s, got %s", traceID, got)
+	}
+	for _, name := range []string{"GetEmbedding", "RetrieveSimilarCards", "GenerateTranslation"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("Expected a %s span, got none", name)
+			continue
+		}
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("Expected %s to be a child of the request span", name)
+		}
+	}
+
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range spans["RetrieveSimilarCards"].Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	if got := attributes["retrieval.results"].AsInt64(); got != 1 {
+		t.Errorf("Expected 1 retrieved card on the span, got %d", got)
+	}
+	if got := attributes["translation.language"].AsString(); got != "it" {
+		t.Errorf("Expected language it on the span, got %q", got)
+	}
+}
+
+func TestTranslateHandler_RetrievalFailOpen(t *testing.T) {
+	defer func(failOpen bool) { retrievalFailOpen = failOpen }(retrievalFailOpen)
+
+	// Nothing listens on port 1, so retrieval fails right away
+	database, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=arkham dbname=arkham_localize sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	body := `{"text": "Draw 1 card."}`
+
+	testCases := []struct {
+		name     string
+		failOpen bool
+		expected int
+	}{
+		{"FailClosed", false, http.StatusInternalServerError},
+		{"FailOpen", true, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retrievalFailOpen = tc.failOpen
+
+			rr := httptest.NewRecorder()
+			translateHandler(rag.NewPostgresStore(database), fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+
+			if rr.Code != tc.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expected, rr.Code, rr.Body.String())
+			}
+			if !tc.failOpen {
+				return
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Translation != ragtest.Translation("Draw 1 card.", "it", 0) || len(response.Context) != 0 || response.Warning != degradedWarning {
+				t.Errorf("Expected an unguided translation with the degraded warning, got %+v", response)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_Candidates(t *testing.T) {
+	defer func(failOpen bool) { retrievalFailOpen = failOpen }(retrievalFailOpen)
+	retrievalFailOpen = true
+
+	// Nothing listens on port 1: retrieval fails open, so no database is needed
+	database, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=arkham dbname=arkham_localize sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	body := `{"text": "Draw 1 card.", "candidates": 3}`
+	rr := httptest.NewRecorder()
+	translateHandler(rag.NewPostgresStore(database), fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var response TranslateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Translation != "" {
+		t.Errorf("Expected no single translation with candidates, got %q", response.Translation)
+	}
+	if len(response.Candidates) != 3 {
+		t.Fatalf("Expected 3 candidates, got %+v", response.Candidates)
+	}
+	if response.Candidates[0].Translation != ragtest.Translation("Draw 1 card.", "it", 0) {
+		t.Errorf("Expected the fake translation first, got %q", response.Candidates[0].Translation)
+	}
+}
+
+func TestTranslateHandler_Review(t *testing.T) {
+	setupTestHandlers()
+
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedDraft  string
+	}{
+		{"NoReview", `{"text": "Draw 1 card."}`, http.StatusOK, ""},
+		{"Review", `{"text": "Draw 1 card.", "review": true}`, http.StatusOK, ragtest.Translation("Draw 1 card.", "it", 0)},
+		{"ReviewCandidates", `{"text": "Draw 1 card.", "review": true, "candidates": 2}`, http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			translateHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(tc.body)))
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Draft != tc.expectedDraft {
+				t.Errorf("Expected draft %q, got %q", tc.expectedDraft, response.Draft)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_IncludeRaw(t *testing.T) {
+	setupTestHandlers()
+
+	translation := ragtest.Translation("Draw 1 card.", "it", 0)
+	testCases := []struct {
+		name        string
+		body        string
+		expectedRaw string
+	}{
+		{"Default", `{"text": "Draw 1 card."}`, ""},
+		{"IncludeRaw", `{"text": "Draw 1 card.", "include_raw": true}`, translation},
+		{"CandidatesDefault", `{"text": "Draw 1 card.", "candidates": 2}`, ""},
+		{"CandidatesIncludeRaw", `{"text": "Draw 1 card.", "candidates": 2, "include_raw": true}`, translation},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			translateHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(tc.body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			raw := response.Raw
+			if len(response.Candidates) > 0 {
+				raw = response.Candidates[0].Raw
+			}
+			if raw != tc.expectedRaw {
+				t.Errorf("Expected raw %q, got %q", tc.expectedRaw, raw)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_Explain(t *testing.T) {
+	setupTestHandlers()
+	defer func(jsonOutput bool) { rag.JSONOutput = jsonOutput }(rag.JSONOutput)
+
+	testCases := []struct {
+		name       string
+		body       string
+		jsonOutput bool
+		status     int
+		expected   string
+	}{
+		{"Default", `{"text": "Draw 1 card."}`, true, http.StatusOK, ""},
+		{"Explain", `{"text": "Draw 1 card.", "explain": true}`, true, http.StatusOK, ragtest.Explanation},
+		{"PlainText", `{"text": "Draw 1 card.", "explain": true}`, false, http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rag.JSONOutput = tc.jsonOutput
+			rr := httptest.NewRecorder()
+			translateHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(tc.body)))
+			if rr.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			if present := strings.Contains(rr.Body.String(), `"explanation"`); present != (tc.expected != "") {
+				t.Errorf("Expected an explanation field: %v, got %s", tc.expected != "", rr.Body.String())
+			}
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Explanation != tc.expected {
+				t.Errorf("Expected explanation %q, got %q", tc.expected, response.Explanation)
+			}
+			if response.Translation != ragtest.Translation("Draw 1 card.", "it", 0) {
+				t.Errorf("Expected the translation alone, got %q", response.Translation)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_IncludeNormalized(t *testing.T) {
+	defer func(failOpen bool) { retrievalFailOpen = failOpen }(retrievalFailOpen)
+	retrievalFailOpen = true
+
+	// Nothing listens on port 1: retrieval fails open, so no database is needed
+	database, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=arkham dbname=arkham_localize sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	text := "<eld>: Draw 1 card."
+	normalized := "<b>Effetto di</b> <eld>: Draw 1 card."
+
+	testCases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"NotRequested", `{"text": "<eld>: Draw 1 card."}`, ""},
+		{"Translation", `{"text": "<eld>: Draw 1 card.", "include_normalized": true}`, normalized},
+		{"Candidates", `{"text": "<eld>: Draw 1 card.", "include_normalized": true, "candidates": 2}`, normalized},
+		{"Normalize", `{"text": "<eld>: Draw 1 card.", "include_normalized": true, "normalize": true}`, normalized},
+		{"Literal", `{"text": "<eld>: Draw 1 card.", "include_normalized": true, "normalize": false}`, text},
+		{"LiteralCandidates", `{"text": "<eld>: Draw 1 card.", "include_normalized": true, "normalize": false, "candidates": 2}`, text},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			translateHandler(rag.NewPostgresStore(database), fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(tc.body)))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.NormalizedText != tc.expected {
+				t.Errorf("Expected normalized text %q for %q, got %q", tc.expected, text, response.NormalizedText)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_SymbolFormat(t *testing.T) {
+	setupTestHandlers()
+
+	testCases := []struct {
+		format   string
+		text     string
+		expected string
+	}{
+		{"", "<eld>: +1. [free] Draw 1 card.", "<eld>: +1. [free] Draw 1 card."},
+		{"preserve", "<eld>: +1. [free] Draw 1 card.", "<eld>: +1. [free] Draw 1 card."},
+		{"arkhamdb", "<eld>: +1. <fre> Draw 1 card.", "[elder_sign]: +1. [free] Draw 1 card."},
+		{"strange-eons", "[elder_sign]: +1. [free] Draw 1 card.", "<eld>: +1. <fre> Draw 1 card."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]any{"text": tc.text, "language": "de", "symbol_format": tc.format, "include_normalized": true})
+			rr := httptest.NewRecorder()
+			translateHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", bytes.NewReader(body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			// The fake translation echoes the text the model received
+			if expected := ragtest.Translation(tc.expected, "de", 0); response.Translation != expected {
+				t.Errorf("Expected translation %q, got %q", expected, response.Translation)
+			}
+			if response.NormalizedText != tc.expected {
+				t.Errorf("Expected normalized text %q, got %q", tc.expected, response.NormalizedText)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	translateHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(`{"text": "<eld>", "symbol_format": "octgn"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown symbol format, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestSymbolFormatTranslator_Output(t *testing.T) {
+	// A model answering in the other notation is converted all the same
+	translator := symbolFormatTranslator{Translator: echoTranslator{translation: "<eld>: +1"}, format: rag.SymbolFormatArkhamDB}
+
+	result, err := translator.Translate(context.Background(), "[elder_sign]: +1", nil, "gpt-4o", "it")
+	if err != nil || result.Translation != "[elder_sign]: +1" {
+		t.Errorf("Expected the translation in arkhamdb format, got %q (%v)", result.Translation, err)
+	}
+	candidates, err := translator.TranslateCandidates(context.Background(), "[elder_sign]: +1", nil, "gpt-4o", "it", 2)
+	if err != nil || len(candidates.Candidates) != 1 || candidates.Candidates[0].Translation != "[elder_sign]: +1" {
+		t.Errorf("Expected the candidates in arkhamdb format, got %+v (%v)", candidates, err)
+	}
+}
+
+// echoTranslator answers every request with the same translation
+type echoTranslator struct {
+	translation string
+}
+
+func (t echoTranslator) Translate(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string) (rag.TranslationResult, error) {
+	return rag.TranslationResult{Translation: t.translation}, nil
+}
+
+func (t echoTranslator) TranslateCandidates(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string, n int) (rag.CandidatesResult, error) {
+	return rag.CandidatesResult{Candidates: []rag.Candidate{{Translation: t.translation}}}, nil
+}
+
+func TestTranslateHandler_EmbeddingDimensionMismatch(t *testing.T) {
+	setupTestHandlers()
+
+	var db *sql.DB
+
+	body := []byte(`{"text": "Draw 1 card.", "embedding": [0.1, 0.2, 0.3]}`)
+	req, err := http.NewRequest("POST", "/translate", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := translateHandler(rag.NewPostgresStore(db), fakeProviders())
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status %d for embedding dimension mismatch, got %d", http.StatusBadRequest, status)
+	}
+	if !strings.Contains(rr.Body.String(), "1536") {
+		t.Errorf("Expected error to mention the expected dimensions, got %s", rr.Body.String())
+	}
+}
+
+func TestCompareHandler_Validation(t *testing.T) {
+	setupTestHandlers()
+
+	var db *sql.DB
+
+	testCases := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"MethodNotAllowed", "GET", "", http.StatusMethodNotAllowed},
+		{"MissingModels", "POST", `{"text": "Draw 1 card."}`, http.StatusBadRequest},
+		{"EmptyText", "POST", `{"models": ["gpt-4o"]}`, http.StatusBadRequest},
+		{"TooManyModels", "POST", `{"text": "Draw 1 card.", "models": ["a", "b", "c", "d", "e"]}`, http.StatusBadRequest},
+		{"RetrieveOnly", "POST", `{"text": "Draw 1 card.", "models": ["gpt-4o"], "retrieve_only": true}`, http.StatusBadRequest},
+		{"Candidates", "POST", `{"text": "Draw 1 card.", "models": ["gpt-4o"], "candidates": 2}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "/translate/compare", bytes.NewBufferString(tc.body))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := compareHandler(rag.NewPostgresStore(db), fakeProviders())
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, status)
+			}
+		})
+	}
+}
+
+func TestDebugPromptHandler_Validation(t *testing.T) {
+	setupTestHandlers()
+
+	var db *sql.DB
+
+	testCases := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"MethodNotAllowed", "GET", "", http.StatusMethodNotAllowed},
+		{"EmptyText", "POST", `{"language": "it"}`, http.StatusBadRequest},
+		{"InvalidLanguage", "POST", `{"text": "Draw 1 card.", "language": "xx"}`, http.StatusBadRequest},
+		{"RetrieveOnly", "POST", `{"text": "Draw 1 card.", "retrieve_only": true}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/translate/debug-prompt", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			debugPromptHandler(rag.NewPostgresStore(db), fakeProviders()).ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, status)
+			}
+		})
+	}
+}
+
+func TestValidateCompareModels_Deduplicates(t *testing.T) {
+	models, err := validateCompareModels([]string{"gpt-4o", "gpt-4o-mini", "gpt-4o"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(models) != 2 {
+		t.Errorf("Expected 2 unique models, got %v", models)
+	}
+}
+
+func TestTranslateHandler_OversizedInput(t *testing.T) {
+	setupTestHandlers()
+
+	var db *sql.DB
+
+	body := []byte(`{"text": "` + strings.Repeat("a", rag.MaxInputChars+1) + `", "language": "it"}`)
+	req, err := http.NewRequest("POST", "/translate", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := translateHandler(rag.NewPostgresStore(db), fakeProviders())
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for oversized input, got %d", http.StatusRequestEntityTooLarge, status)
+	}
+}
+
+func TestTranslateHandler_OpenAIErrors(t *testing.T) {
+	setupTestHandlers()
+	defer func(base string) { openai.BaseURL = base }(openai.BaseURL)
+	// The final error is under test, not the retries
+	defer func(retries int) { openai.MaxRetries = retries }(openai.MaxRetries)
+	openai.MaxRetries = 0
+
+	var db *sql.DB
+
+	testCases := []struct {
+		name         string
+		status       int
+		retryAfter   string
+		body         string
+		expected     int
+		expectedCode string
+		upstreamCode string
+	}{
+		{"RateLimited", http.StatusTooManyRequests, "7", `{"error": {"message": "test", "type": "requests", "code": "rate_limit_exceeded"}}`,
+			http.StatusTooManyRequests, codeRateLimited, "rate_limit_exceeded"},
+		{"Unauthorized", http.StatusUnauthorized, "", `{"error": {"message": "test", "type": "invalid_request_error", "code": "invalid_api_key"}}`,
+			http.StatusBadGateway, codeUpstream, "invalid_api_key"},
+		{"ServerError", http.StatusServiceUnavailable, "", `upstream unavailable`, http.StatusBadGateway, codeUpstream, ""},
+		{"BadRequest", http.StatusBadRequest, "", `{"error": {"message": "test", "type": "invalid_request_error", "code": null}}`,
+			http.StatusInternalServerError, codeInternal, "invalid_request_error"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Fake OpenAI server failing the embeddings call
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				http.Error(w, tc.body, tc.status)
+			}))
+			defer server.Close()
+			openai.BaseURL = server.URL
+
+			req, err := http.NewRequest("POST", "/translate", bytes.NewBufferString(`{"text": "Draw 1 card."}`))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := translateHandler(rag.NewPostgresStore(db), openAIProviders())
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, status)
+			}
+			if retryAfter := rr.Header().Get("Retry-After"); retryAfter != tc.retryAfter {
+				t.Errorf("Expected Retry-After %q, got %q", tc.retryAfter, retryAfter)
+			}
+			detail := decodeError(t, rr)
+			if detail.Code != tc.expectedCode {
+				t.Errorf("Expected code %s, got %s", tc.expectedCode, detail.Code)
+			}
+			if detail.UpstreamCode != tc.upstreamCode {
+				t.Errorf("Expected upstream code %q, got %q", tc.upstreamCode, detail.UpstreamCode)
+			}
+		})
+	}
+}
+
+func TestWithHandlerTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { handlerTimeout = timeout }(handlerTimeout)
+	handlerTimeout = 20 * time.Millisecond
+
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}
+
+	req, err := http.NewRequest("POST", "/translate", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	withHandlerTimeout(slow).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d on timeout, got %d", http.StatusServiceUnavailable, status)
+	}
+	if origin := rr.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+		t.Errorf("Expected CORS headers on timeout, got %q", origin)
+	}
+	if code := decodeError(t, rr).Code; code != codeTimeout {
+		t.Errorf("Expected code %s on timeout, got %s", codeTimeout, code)
+	}
+}
+
+func TestWithGzip(t *testing.T) {
+	defer func(minBytes int) { gzipMinBytes = minBytes }(gzipMinBytes)
+	gzipMinBytes = 256
+
+	large, err := json.Marshal(map[string]string{"translation": strings.Repeat("Scopri 1 indizio nel tuo luogo. ", 40)})
+	if err != nil {
+		t.Fatalf("Failed to marshal payload: %v", err)
+	}
+	small := []byte(`{"translation":"Scopri 1 indizio."}`)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           []byte
+		wantGzip       bool
+	}{
+		{"Large JSON", "gzip, deflate, br", "application/json", large, true},
+		{"Charset parameter", "gzip", "application/json; charset=utf-8", large, true},
+		{"Small JSON", "gzip", "application/json", small, false},
+		{"Gzip not accepted", "", "application/json", large, false},
+		{"Gzip refused", "gzip;q=0", "application/json", large, false},
+		{"Event stream", "gzip", "text/event-stream", large, false},
+		{"Plain text", "gzip", "text/plain; charset=utf-8", large, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := withGzip(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(http.StatusCreated)
+				w.Write(tt.body)
+			})
+
+			req := httptest.NewRequest("GET", "/translate", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusCreated {
+				t.Errorf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+			}
+			if vary := rr.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", vary)
+			}
+
+			body := rr.Body.Bytes()
+			if !tt.wantGzip {
+				if encoding := rr.Header().Get("Content-Encoding"); encoding != "" {
+					t.Errorf("Expected no Content-Encoding, got %q", encoding)
+				}
+				if !bytes.Equal(body, tt.body) {
+					t.Errorf("Expected the body unchanged, got %q", body)
+				}
+				return
+			}
+
+			if encoding := rr.Header().Get("Content-Encoding"); encoding != "gzip" {
+				t.Fatalf("Expected Content-Encoding gzip, got %q", encoding)
+			}
+			if length := rr.Header().Get("Content-Length"); length != strconv.Itoa(len(body)) {
+				t.Errorf("Expected Content-Length %d, got %s", len(body), length)
+			}
+			if len(body) >= len(tt.body) {
+				t.Errorf("Expected the compressed body to be smaller than %d bytes, got %d", len(tt.body), len(body))
+			}
+
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("Failed to open gzip body: %v", err)
+			}
+			decompressed, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Failed to decompress body: %v", err)
+			}
+			if !bytes.Equal(decompressed, tt.body) {
+				t.Errorf("Expected the decompressed body to match the original, got %q", decompressed)
+			}
+		})
+	}
+}
+
+func TestWithGzip_FlushPassesThrough(t *testing.T) {
+	defer func(minBytes int) { gzipMinBytes = minBytes }(gzipMinBytes)
+	gzipMinBytes = 1
+
+	handler := withGzip(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"progress":`))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(`50}`))
+	})
+
+	req := httptest.NewRequest("GET", "/admin/ingest/1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if !rr.Flushed {
+		t.Error("Expected the response to be flushed")
+	}
+	if encoding := rr.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Expected no Content-Encoding after a flush, got %q", encoding)
+	}
+	if body := rr.Body.String(); body != `{"progress":50}` {
+		t.Errorf("Expected the body unchanged, got %q", body)
+	}
+}
+
+func TestAdminIngest_Auth(t *testing.T) {
+	setupTestHandlers()
+
+	var db *sql.DB
+
+	testCases := []struct {
+		name     string
+		adminKey string
+		header   string
+		status   int
+	}{
+		{"Disabled", "", "Bearer anything", http.StatusForbidden},
+		{"MissingToken", "secret", "", http.StatusUnauthorized},
+		{"WrongToken", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"ValidToken_MethodNotAllowed", "secret", "Bearer secret", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			adminAPIKey = tc.adminKey
+			defer func() { adminAPIKey = "" }()
+
+			req, err := http.NewRequest("GET", "/admin/ingest", nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := requireAdminKey(startIngestHandler(db, rag.NewPostgresStore(db)))
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, status)
+			}
+		})
+	}
+}
+
+func TestAdminReembed_MethodNotAllowed(t *testing.T) {
+	var db *sql.DB
+
+	req, err := http.NewRequest("GET", "/admin/reembed", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := startReembedHandler(db)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, status)
+	}
+}
+
+func TestAdminIngest_Metric_Container(t *testing.T) {
+	database := testdb.Start(t)
+
+	embedding, err := json.Marshal(testdb.Embedding(1, 0))
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": [{"embedding": %s}]}`, embedding)
+	}))
+	defer server.Close()
+
+	defer func(baseURL, key, model, dataDir string, metric rag.Metric) {
+		openai.BaseURL, openAIKey, embeddingModel, ingestDataDir, rag.SimilarityMetric = baseURL, key, model, dataDir, metric
+	}(openai.BaseURL, openAIKey, embeddingModel, ingestDataDir, rag.SimilarityMetric)
+	openai.BaseURL = server.URL
+	openAIKey = "test-key"
+	embeddingModel = "text-embedding-3-small"
+	ingestDataDir = t.TempDir()
+	rag.SimilarityMetric = rag.MetricL2
+
+	for path, content := range map[string]string{
+		"pack/core/core.json":                 `[{"code": "01020", "name": "Machete", "text": "Fight."}]`,
+		"translations/it/pack/core/core.json": `[{"code": "01020", "text": "Combattere."}]`,
+	} {
+		path = filepath.Join(ingestDataDir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create data directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write data file: %v", err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	startIngestHandler(database, rag.NewPostgresStore(database)).ServeHTTP(rr, httptest.NewRequest("POST", "/admin/ingest", nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	var started map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&started); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		job, _ := jobs.get(started["id"])
+		if job.Status == JobCompleted {
+			break
+		}
+		if job.Status == JobFailed || time.Now().After(deadline) {
+			t.Fatalf("Expected the ingest job to complete, got %+v", job)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	opClass, err := db.IndexOpClass(database, "card_embeddings_embedding_idx")
+	if err != nil {
+		t.Fatalf("Failed to read the index operator class: %v", err)
+	}
+	if opClass != rag.MetricL2.OpClass() {
+		t.Errorf("Expected the index rebuilt with %s, got %s", rag.MetricL2.OpClass(), opClass)
+	}
+}
+
+func TestAdminReindex(t *testing.T) {
+	var db *sql.DB
+
+	rr := httptest.NewRecorder()
+	startReindexHandler(db).ServeHTTP(rr, httptest.NewRequest("GET", "/admin/reindex", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+
+	// Never overlaps another job
+	job, err := jobs.start(JobIngest)
+	if err != nil {
+		t.Fatalf("Failed to start job: %v", err)
+	}
+	defer jobs.finish(job.ID, nil)
+
+	rr = httptest.NewRecorder()
+	startReindexHandler(db).ServeHTTP(rr, httptest.NewRequest("POST", "/admin/reindex", nil))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d while a job runs, got %d", http.StatusConflict, rr.Code)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	embedder := &countingEmbedder{Embedder: ragtest.Embedder{}}
+	chatCalls := 0
+	warmup(context.Background(), embedder, func(ctx context.Context) error {
+		chatCalls++
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("Expected the warmup requests to have a deadline")
+		}
+		return fmt.Errorf("model unavailable")
+	})
+
+	if embedder.calls != 1 || chatCalls != 1 {
+		t.Errorf("Expected one embeddings and one chat request, got %d and %d", embedder.calls, chatCalls)
+	}
+	if !strings.Contains(output.String(), "Embedding model warmed up") {
+		t.Errorf("Expected the embedding model to be reported ready, got %q", output.String())
+	}
+	if !strings.Contains(output.String(), "Warmup chat request failed: model unavailable") {
+		t.Errorf("Expected the chat failure to be logged as a warning, got %q", output.String())
+	}
+}
+
+func TestReindexLoop_SkipsWhileJobRuns(t *testing.T) {
+	job, err := jobs.start(JobReembed)
+	if err != nil {
+		t.Fatalf("Failed to start job: %v", err)
+	}
+	defer jobs.finish(job.ID, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	var runs atomic.Int32
+	reindexLoop(ctx, 5*time.Millisecond, func(progress ingest.ProgressFunc) error {
+		runs.Add(1)
+		return nil
+	})
+	if n := runs.Load(); n != 0 {
+		t.Errorf("Expected no reindex while a re-embed job runs, got %d", n)
+	}
+}
+
+func TestReindexLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		reindexLoop(ctx, 5*time.Millisecond, func(progress ingest.ProgressFunc) error {
+			select {
+			case runs <- struct{}{}:
+			default:
+			}
+			return nil
+		})
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a reindex every interval, got %d", i)
+		}
+	}
+	cancel()
+	<-done
+
+	// Let the last job finish so it doesn't block the next tests' jobs
+	deadline := time.Now().Add(time.Second)
+	for {
+		jobs.mu.Lock()
+		running := jobs.running
+		jobs.mu.Unlock()
+		if running == "" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdminIngestStatus_NotFound(t *testing.T) {
+	adminAPIKey = "secret"
+	defer func() { adminAPIKey = "" }()
+
+	req, err := http.NewRequest("GET", "/admin/ingest/unknown", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+
+	rr := httptest.NewRecorder()
+	handler := requireAdminKey(ingestStatusHandler)
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestIngestJobs_OneAtATime(t *testing.T) {
+	tracker := &ingestJobs{jobs: make(map[string]*IngestJob)}
+
+	job, err := tracker.start(JobIngest)
+	if err != nil {
+		t.Fatalf("Failed to start job: %v", err)
+	}
+
+	if _, err := tracker.start(JobReembed); err == nil {
+		t.Error("Expected error when starting a second job, got nil")
+	}
+
+	tracker.progress(job.ID, 10, 1, 20, []error{fmt.Errorf("embedding failed")})
+	tracker.finish(job.ID, nil)
+
+	snapshot, ok := tracker.get(job.ID)
+	if !ok {
+		t.Fatalf("Job %s not found", job.ID)
+	}
+	if snapshot.Status != JobCompleted || snapshot.Processed != 10 || snapshot.Failed != 1 || len(snapshot.Errors) != 1 {
+		t.Errorf("Unexpected job state: %+v", snapshot)
+	}
+
+	if _, err := tracker.start(JobIngest); err != nil {
+		t.Errorf("Expected a new job to start after the previous one finished, got %v", err)
+	}
+}
+
+func TestAdminCard(t *testing.T) {
+	defer func(dir string) { ingestDataDir = dir }(ingestDataDir)
+	ingestDataDir = t.TempDir()
+
+	store := &fakeStore{cards: []rag.ContextCard{{CardCode: "01020", CardName: "Machete"}}}
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"Delete", "DELETE", "/admin/card/01020", http.StatusOK},
+		{"DeleteUnknown", "DELETE", "/admin/card/99999", http.StatusNotFound},
+		{"ReingestUnknown", "POST", "/admin/card/99999/reingest", http.StatusNotFound},
+		{"NoCode", "DELETE", "/admin/card/", http.StatusNotFound},
+		{"UnknownAction", "POST", "/admin/card/01020/translate", http.StatusNotFound},
+		{"WrongMethod", "GET", "/admin/card/01020", http.StatusMethodNotAllowed},
+		{"WrongReingestMethod", "DELETE", "/admin/card/01020/reingest", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			cardHandler(store).ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if rr.Code != tc.status {
+				t.Errorf("Expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	cardHandler(store).ServeHTTP(rr, httptest.NewRequest("DELETE", "/admin/card/01020", nil))
+	var response CardResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.CardCode != "01020" || response.Deleted != 1 {
+		t.Errorf("Expected 1 deleted entry of 01020, got %+v", response)
+	}
+
+	// A browser may preflight the deletion
+	rr = httptest.NewRecorder()
+	requireAdminKey(cardHandler(store)).ServeHTTP(rr, httptest.NewRequest("OPTIONS", "/admin/card/01020", nil))
+	if methods := rr.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(methods, "DELETE") {
+		t.Errorf("Expected DELETE in the allowed CORS methods, got %q", methods)
+	}
+
+	// Never overlaps a job writing the same rows
+	job, err := jobs.start(JobIngest)
+	if err != nil {
+		t.Fatalf("Failed to start job: %v", err)
+	}
+	for _, tc := range []struct{ method, path string }{{"DELETE", "/admin/card/01020"}, {"POST", "/admin/card/01020/reingest"}} {
+		request := httptest.NewRequest(tc.method, tc.path, nil)
+		request.Header.Set("Content-Type", "application/json")
+		rr = httptest.NewRecorder()
+		cardHandler(store).ServeHTTP(rr, request)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("%s %s: expected status %d while a job runs, got %d", tc.method, tc.path, http.StatusConflict, rr.Code)
+		}
+	}
+	jobs.finish(job.ID, nil)
+}
+
+// csvUpload builds a multipart /translate/file request with the CSV and form fields
+func csvUpload(t *testing.T, content string, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	part, err := writer.CreateFormFile("file", "cards.csv")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/translate/file", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestSimilarHandler(t *testing.T) {
+	store := &fakeStore{
+		cards: []rag.ContextCard{
+			{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere.", Similarity: 1},
+			{CardCode: "01016", CardName: ".45 Automatic", EnglishText: "Fight. Deal +1 damage.", TranslatedText: "Combattere. Infliggi +1 danno.", Similarity: 0.9},
+			{CardCode: "01017", CardName: "Physical Training", EnglishText: "You get +1 [combat].", TranslatedText: "Ottieni +1 [combat].", Similarity: 0.8},
+		},
+		embeddings: map[string][]float32{"01020": {1, 0, 0}},
+	}
+
+	testCases := []struct {
+		name           string
+		method         string
+		target         string
+		expectedStatus int
+		expectedCodes  []string
+	}{
+		{"Neighbors", "GET", "/similar/01020", http.StatusOK, []string{"01016", "01017"}},
+		{"Limit", "GET", "/similar/01020?limit=1", http.StatusOK, []string{"01016"}},
+		{"NoEmbedding", "GET", "/similar/99999", http.StatusNotFound, nil},
+		{"InvalidLimit", "GET", "/similar/01020?limit=0", http.StatusBadRequest, nil},
+		{"InvalidLanguage", "GET", "/similar/01020?language=xx", http.StatusBadRequest, nil},
+		{"NoCode", "GET", "/similar/", http.StatusNotFound, nil},
+		{"MethodNotAllowed", "POST", "/similar/01020", http.StatusMethodNotAllowed, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			similarHandler(store).ServeHTTP(rr, httptest.NewRequest(tc.method, tc.target, nil))
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response SimilarResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			codes := []string{}
+			for _, card := range response.Similar {
+				codes = append(codes, card.CardCode)
+			}
+			if !reflect.DeepEqual(codes, tc.expectedCodes) {
+				t.Errorf("Expected similar cards %v, got %v", tc.expectedCodes, codes)
+			}
+		})
+	}
+}
+
+func TestGapsHandler(t *testing.T) {
+	// Nothing listens on port 1: only requests rejected before the query succeed
+	database, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=arkham dbname=arkham_localize sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+
+	testCases := []struct {
+		name           string
+		method         string
+		target         string
+		expectedStatus int
+	}{
+		{"InvalidLimit", "GET", "/gaps?limit=0", http.StatusBadRequest},
+		{"LimitTooHigh", "GET", fmt.Sprintf("/gaps?limit=%d", maxPageLimit+1), http.StatusBadRequest},
+		{"InvalidCursor", "GET", "/gaps?cursor=abc", http.StatusBadRequest},
+		{"InvalidLanguage", "GET", "/gaps?language=xx", http.StatusBadRequest},
+		{"InvalidTextType", "GET", "/gaps?text_type=xx", http.StatusBadRequest},
+		{"DatabaseDown", "GET", "/gaps?limit=10&cursor=42", http.StatusInternalServerError},
+		{"MethodNotAllowed", "POST", "/gaps", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			gapsHandler(database).ServeHTTP(rr, httptest.NewRequest(tc.method, tc.target, nil))
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTranslateFileHandler(t *testing.T) {
+	setupTestHandlers()
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Kämpfen.", TranslationLanguage: "de", TextType: rag.TextRules},
+	}}
+	content := "\ufeffName,Text\nMachete,Fight.\nBlank,\n\"Quoted, Card\",\"Draw 1 card.\nDiscard 1 card.\"\n"
+	rr := httptest.NewRecorder()
+	translateFileHandler(store, fakeProviders()).ServeHTTP(rr, csvUpload(t, content, map[string]string{"language": "de"}))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Expected a CSV response, got %q", contentType)
+	}
+	if disposition := rr.Header().Get("Content-Disposition"); !strings.Contains(disposition, `"cards_de.csv"`) {
+		t.Errorf("Expected the cards_de.csv file name, got %q", disposition)
+	}
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read the response CSV: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected a header and 3 rows, got %q", records)
+	}
+	if !reflect.DeepEqual(records[0], []string{"Name", "Text", "text_de", "translation_error"}) {
+		t.Errorf("Unexpected header %q", records[0])
+	}
+	for i, text := range []string{"Fight.", "", "Draw 1 card.\nDiscard 1 card."} {
+		record := records[i+1]
+		if record[1] != text || record[3] != "" {
+			t.Errorf("Row %d: expected text %q and no error, got %q", i+1, text, record)
+		}
+		if text == "" {
+			if record[2] != "" {
+				t.Errorf("Row %d: expected no translation of an empty text, got %q", i+1, record[2])
+			}
+			continue
+		}
+		if !strings.HasPrefix(record[2], "[de:") || !strings.HasSuffix(record[2], text) {
+			t.Errorf("Row %d: expected the German fake translation of %q, got %q", i+1, text, record[2])
+		}
+	}
+	if len(store.queries) != 2 {
+		t.Errorf("Expected a search per non-empty row, got %d", len(store.queries))
+	}
+}
+
+func TestTranslateFileHandler_Validation(t *testing.T) {
+	setupTestHandlers()
+	defer func(rows int) { maxFileRows = rows }(maxFileRows)
+	maxFileRows = 2
+
+	testCases := []struct {
+		name    string
+		content string
+		fields  map[string]string
+	}{
+		{"Empty", "", nil},
+		{"MissingTextColumn", "Name,Rules\nMachete,Fight.\n", nil},
+		{"UnsupportedLanguage", "Name,Rules\nMachete,Fight.\n", map[string]string{"text_column": "rules", "language": "xx"}},
+		{"OutputColumnExists", "Text,text_it\nFight.,Combatti.\n", nil},
+		{"EmptyHeader", "Text,\nFight.,x\n", nil},
+		{"RaggedRow", "Name,Text\nMachete\n", nil},
+		{"TooManyRows", "Text\nFight.\nDraw 1 card.\nDiscard 1 card.\n", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &fakeStore{}
+			rr := httptest.NewRecorder()
+			translateFileHandler(store, fakeProviders()).ServeHTTP(rr, csvUpload(t, tc.content, tc.fields))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+			if len(store.queries) != 0 {
+				t.Errorf("Expected no row to be translated, got %d searches", len(store.queries))
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	translateFileHandler(&fakeStore{}, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate/file", strings.NewReader(`{"text": "Fight."}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a JSON body, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestRequireJSON(t *testing.T) {
+	store := &fakeStore{}
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{"Plain text", translateHandler(store, fakeProviders()), "/translate", "text/plain", `{"text": "Fight."}`, http.StatusUnsupportedMediaType},
+		{"Form", translateHandler(store, fakeProviders()), "/translate", "application/x-www-form-urlencoded", `text=Fight.`, http.StatusUnsupportedMediaType},
+		{"Malformed", translateHandler(store, fakeProviders()), "/translate", "application/", `{"text": "Fight."}`, http.StatusUnsupportedMediaType},
+		{"Compare", compareHandler(store, fakeProviders()), "/translate/compare", "text/plain", `{"text": "Fight.", "models": ["gpt-4o"]}`, http.StatusUnsupportedMediaType},
+		{"Debug prompt", debugPromptHandler(store, fakeProviders()), "/translate/debug-prompt", "text/plain", `{"text": "Fight."}`, http.StatusUnsupportedMediaType},
+		{"Ingest", startIngestHandler(nil, store), "/admin/ingest", "text/plain", `{"limit": 1}`, http.StatusUnsupportedMediaType},
+		{"Card reingest", cardHandler(store), "/admin/card/01020/reingest", "text/plain", `{}`, http.StatusUnsupportedMediaType},
+		{"JSON", translateHandler(store, fakeProviders()), "/translate", "application/json", `{"text": "Fight."}`, http.StatusOK},
+		{"Charset", translateHandler(store, fakeProviders()), "/translate", "application/json; charset=utf-8", `{"text": "Fight."}`, http.StatusOK},
+		{"No Content-Type", translateHandler(store, fakeProviders()), "/translate", "", `{"text": "Fight."}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus == http.StatusUnsupportedMediaType {
+				if code := decodeError(t, rr).Code; code != codeUnsupportedMediaType {
+					t.Errorf("Expected code %s, got %s", codeUnsupportedMediaType, code)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireMethod(t *testing.T) {
+	called := false
+	handler := corsMiddleware(requireMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	tests := []struct {
+		method     string
+		wantStatus int
+		wantCalled bool
+	}{
+		{"POST", http.StatusOK, true},
+		{"GET", http.StatusMethodNotAllowed, false},
+		{"DELETE", http.StatusMethodNotAllowed, false},
+		{"OPTIONS", http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		called = false
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, "/translate", nil))
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.method, tt.wantStatus, rr.Code)
+		}
+		if called != tt.wantCalled {
+			t.Errorf("%s: expected handler called %v, got %v", tt.method, tt.wantCalled, called)
+		}
+		if tt.wantStatus == http.StatusMethodNotAllowed {
+			if allow := rr.Header().Get("Allow"); allow != "POST" {
+				t.Errorf("%s: expected Allow: POST, got %q", tt.method, allow)
+			}
+			if code := decodeError(t, rr).Code; code != codeMethodNotAllowed {
+				t.Errorf("%s: expected code %s, got %s", tt.method, codeMethodNotAllowed, code)
+			}
+		}
+		if origin := rr.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+			t.Errorf("%s: expected CORS headers, got %q", tt.method, origin)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	setupTestHandlers()
+	t.Cleanup(func() { rag.LoadPromptTemplates("") })
+
+	current := config.Default()
+	current.OpenAI.ChatModel = "gpt-4o"
+	next := config.Default()
+	next.OpenAI.ChatModel = "gpt-4o-mini"
+	next.Server.WriteTimeout = current.Server.WriteTimeout * 2
+
+	// A request validated before the reload keeps its model
+	req := TranslateRequest{Text: "Fight."}
+	if err := validateTranslateRequest(&req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A broken template applies nothing
+	next.Translation.PromptTemplateDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(next.Translation.PromptTemplateDir, "system.tmpl"), []byte("{{.Lang}}"), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if err := reload(current, next); err == nil {
+		t.Fatal("Expected error for the broken template, got nil")
+	}
+	if model := currentChatModel(); model != "gpt-4o" {
+		t.Errorf("Expected the chat model to be kept after a failed reload, got %s", model)
+	}
+
+	next.Translation.PromptTemplateDir = ""
+	if err := reload(current, next); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if model := currentChatModel(); model != "gpt-4o-mini" {
+		t.Errorf("Expected the reloaded chat model, got %s", model)
+	}
+	if req.model != "gpt-4o" {
+		t.Errorf("Expected the request validated before the reload to keep gpt-4o, got %s", req.model)
+	}
+	// Only the reloadable keys are applied
+	if current.OpenAI.ChatModel != "gpt-4o-mini" || current.Server.WriteTimeout == next.Server.WriteTimeout {
+		t.Errorf("Expected only the chat model to be applied, got %s and write timeout %s", current.OpenAI.ChatModel, current.Server.WriteTimeout)
+	}
+}
+
+func TestSuggestMatch(t *testing.T) {
+	defer func(threshold float64) { matchThreshold = threshold }(matchThreshold)
+	matchThreshold = 0.95
+
+	machete := rag.ContextCard{CardCode: "01020", CardName: "Machete", EnglishText: "[action]: Fight. You get +1 [combat].", TranslatedText: "[action]: Combatti. Ottieni +1 [combat].", TranslationLanguage: "it", Similarity: 0.8}
+	fallback := machete
+	fallback.TranslationLanguage, fallback.IsFallback = "fr", true
+
+	testCases := []struct {
+		name      string
+		text      string
+		cards     []rag.ContextCard
+		threshold float64
+		exact     bool
+		found     bool
+	}{
+		{"SameText", "[action]: Fight.  You get +1 [combat].", []rag.ContextCard{machete}, 0.95, true, true},
+		{"StrangeEonsSymbols", "<act>: Fight. You get +1 <com>.", []rag.ContextCard{machete}, 0.95, true, true},
+		{"NearText", "[action]: Fight. You get +2 [combat].", []rag.ContextCard{machete}, 0.95, false, true},
+		{"OtherText", "[action]: Investigate.", []rag.ContextCard{machete}, 0.95, false, false},
+		{"FallbackLanguage", "[action]: Fight. You get +1 [combat].", []rag.ContextCard{fallback}, 0.95, false, false},
+		{"Disabled", "[action]: Fight. You get +1 [combat].", []rag.ContextCard{machete}, 0, false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matchThreshold = tc.threshold
+			match := suggestMatch(tc.text, tc.cards, "it", rag.SymbolFormatPreserve)
+			if (match != nil) != tc.found {
+				t.Fatalf("Expected a match: %v, got %+v", tc.found, match)
+			}
+			if match == nil {
+				return
+			}
+			if match.Exact != tc.exact || match.CardCode != "01020" || match.Translation != machete.TranslatedText {
+				t.Errorf("Expected Machete as exact=%v match, got %+v", tc.exact, match)
+			}
+		})
+	}
+}
+
+func TestTranslateHandler_PreferMatch(t *testing.T) {
+	setupTestHandlers()
+	defer func(threshold float64) { matchThreshold = threshold }(matchThreshold)
+	matchThreshold = 0.95
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combatti.", TranslationLanguage: "it", TextType: rag.TextRules, Similarity: 0.99},
+	}}
+
+	for _, tc := range []struct {
+		name      string
+		body      string
+		generated bool
+	}{
+		{"Suggested", `{"text": "Fight."}`, true},
+		{"Preferred", `{"text": "Fight.", "prefer_match": true}`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			translateHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate", strings.NewReader(tc.body)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response TranslateResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.SuggestedMatch == nil || !response.SuggestedMatch.Exact || response.SuggestedMatch.Translation != "Combatti." {
+				t.Fatalf("Expected Machete as exact suggested match, got %+v", response.SuggestedMatch)
+			}
+			if generated := response.Translation != "Combatti."; generated != tc.generated {
+				t.Errorf("Expected a generated translation: %v, got %q", tc.generated, response.Translation)
+			}
+		})
+	}
+}
+
+func TestErrataHandler(t *testing.T) {
+	setupTestHandlers()
+
+	store := &fakeStore{cards: []rag.ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combatti.", TranslationLanguage: "it", TextType: rag.TextRules, Similarity: 0.9},
+	}}
+
+	testCases := []struct {
+		name     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"MissingOldTranslation", `{"text": "Fight. Take 2 damage.", "old_text": "Fight. Take 1 damage."}`, http.StatusBadRequest, ""},
+		{"Candidates", `{"text": "Fight. Take 2 damage.", "old_text": "Fight. Take 1 damage.", "old_translation": "Combatti. Subisci 1 danno.", "candidates": 2}`, http.StatusBadRequest, ""},
+		{"Misaligned", `{"text": "Fight.", "old_text": "Fight.\nTake 1 damage.", "old_translation": "Combatti e subisci 1 danno."}`, http.StatusBadRequest, ""},
+		{"Updated", `{"text": "Fight. Take 2 damage.", "old_text": "Fight. Take 1 damage.", "old_translation": "Combatti. Subisci 1 danno."}`, http.StatusOK, "Combatti. [it:1] Take 2 damage."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			errataHandler(store, fakeProviders()).ServeHTTP(rr, httptest.NewRequest("POST", "/translate/errata", strings.NewReader(tc.body)))
+			if rr.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var response ErrataResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Translation != tc.expected {
+				t.Errorf("Expected translation %q, got %q", tc.expected, response.Translation)
+			}
+			if len(response.Segments) != 2 || response.Segments[0].Changed || !response.Segments[1].Changed {
+				t.Errorf("Expected an unchanged and a changed segment, got %+v", response.Segments)
+			}
+			if len(response.Context) != 1 {
+				t.Errorf("Expected 1 context card, got %d", len(response.Context))
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Readiness statuses reported by /health/detailed
+const (
+	statusReady       = "ready"        // Database up, pgvector installed, cards ingested
+	statusNotIngested = "not_ingested" // Database up but the schema or the card data is missing
+	statusDBDown      = "db_down"      // Database unreachable
+)
+
+// readinessTimeout bounds the database checks of /health/detailed
+const readinessTimeout = 5 * time.Second
+
+type ReadinessCheck struct {
+	OK      bool   `json:"ok"`
+	Version string `json:"version,omitempty"` // pgvector extension version
+	Rows    *int   `json:"rows,omitempty"`    // card_embeddings row count
+	Error   string `json:"error,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status string                    `json:"status"`
+	Checks map[string]ReadinessCheck `json:"checks"` // database, pgvector, card_embeddings
+}
+
+// detailedHealthHandler reports whether the server can actually translate:
+// the database must be reachable, have the vector extension and hold
+// ingested cards. It answers 503 unless the status is ready.
+func detailedHealthHandler(database *sql.DB) http.HandlerFunc {
+	return corsMiddleware(requireMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		response := checkReadiness(ctx, database)
+
+		w.Header().Set("Content-Type", "application/json")
+		if response.Status != statusReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+// checkReadiness runs the database, pgvector and card_embeddings checks.
+// Later checks are skipped when the database is down.
+func checkReadiness(ctx context.Context, database *sql.DB) ReadinessResponse {
+	response := ReadinessResponse{Status: statusReady, Checks: make(map[string]ReadinessCheck)}
+
+	if err := database.PingContext(ctx); err != nil {
+		response.Status = statusDBDown
+		response.Checks["database"] = ReadinessCheck{Error: err.Error()}
+		return response
+	}
+	response.Checks["database"] = ReadinessCheck{OK: true}
+
+	var pgvector ReadinessCheck
+	err := database.QueryRowContext(ctx, "SELECT extversion FROM pg_extension WHERE extname = 'vector'").Scan(&pgvector.Version)
+	switch {
+	case err == sql.ErrNoRows:
+		pgvector.Error = "vector extension is not installed (run the ingest tool)"
+	case err != nil:
+		pgvector.Error = err.Error()
+	default:
+		pgvector.OK = true
+	}
+	response.Checks["pgvector"] = pgvector
+
+	var cards ReadinessCheck
+	var exists bool
+	if err := database.QueryRowContext(ctx, "SELECT to_regclass('card_embeddings') IS NOT NULL").Scan(&exists); err != nil {
+		cards.Error = err.Error()
+	} else if !exists {
+		cards.Error = "card_embeddings table does not exist (run the ingest tool)"
+	} else {
+		var rows int
+		if err := database.QueryRowContext(ctx, "SELECT COUNT(*) FROM card_embeddings").Scan(&rows); err != nil {
+			cards.Error = err.Error()
+		} else {
+			cards.Rows = &rows
+			cards.OK = rows > 0
+			if rows == 0 {
+				cards.Error = "card_embeddings is empty (run the ingest tool)"
+			}
+		}
+	}
+	response.Checks["card_embeddings"] = cards
+
+	if !pgvector.OK || !cards.OK {
+		response.Status = statusNotIngested
+	}
+	return response
+}
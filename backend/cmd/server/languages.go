@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// maxLanguages bounds the target languages per /translate request
+const maxLanguages = 4
+
+// languageWorkers bounds the languages of one request translated at a time
+const languageWorkers = 2
+
+// LanguageResult is the translation of a request into one of its languages
+type LanguageResult struct {
+	Translation      string            `json:"translation,omitempty"`
+	Context          []rag.ContextCard `json:"context"`
+	ContextRetrieved int               `json:"context_retrieved"` // Context cards found, see TranslateResponse
+	Warning          string            `json:"warning,omitempty"`
+	Error            string            `json:"error,omitempty"`
+	Cleaned          bool              `json:"cleaned,omitempty"`
+	Retried          bool              `json:"retried,omitempty"`
+	Notes            string            `json:"notes,omitempty"` // Warnings from the model (JSON mode only)
+	Draft            string            `json:"draft,omitempty"` // Translation before the review pass, with review
+	Raw              string            `json:"raw,omitempty"`   // The model's untouched answer, with include_raw
+	// Explanation is the model's rationale for its choices, with explain
+	Explanation string `json:"explanation,omitempty"`
+}
+
+type LanguagesResponse struct {
+	Results map[string]LanguageResult `json:"results"` // Language -> result
+}
+
+// validateLanguages checks the requested target languages and removes
+// duplicates
+func validateLanguages(languages []string) ([]string, error) {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, language := range languages {
+		if !options.ValidLanguage(language) {
+			return nil, fmt.Errorf("Unsupported language: %s (supported: %s)", language, strings.Join(options.SupportedLanguages, ", "))
+		}
+		if !seen[language] {
+			seen[language] = true
+			unique = append(unique, language)
+		}
+	}
+
+	if len(unique) > maxLanguages {
+		return nil, fmt.Errorf("Too many languages: %d (maximum %d per request)", len(unique), maxLanguages)
+	}
+
+	return unique, nil
+}
+
+// translateLanguages answers a /translate request with languages: the text
+// is embedded once, then each language gets its own retrieval and
+// translation, up to languageWorkers at a time. A language that fails
+// reports its error without failing the others.
+func translateLanguages(w http.ResponseWriter, r *http.Request, store rag.VectorStore, providers Providers, req TranslateRequest) {
+	// The text is the same for every language, so one check will do before
+	// the shared embedding
+	if err := rag.CheckPromptSize(req.Text, nil, req.Languages[0]); err != nil {
+		writePipelineError(w, err.Error(), err)
+		return
+	}
+	if req.Embedding == nil {
+		embedding, err := providers.Embedder.Embed(r.Context(), req.Text)
+		if err != nil {
+			log.Printf("Error generating embedding: %v", err)
+			writePipelineError(w, fmt.Sprintf("Failed to generate embedding: %v", err), err)
+			return
+		}
+		req.Embedding = embedding
+	}
+
+	results := make([]LanguageResult, len(req.Languages))
+	slots := make(chan struct{}, languageWorkers)
+	var wg sync.WaitGroup
+	for i, language := range req.Languages {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(idx int, language string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			languageReq := req
+			languageReq.Language = language
+			results[idx] = translateLanguage(r, store, providers, languageReq)
+		}(i, language)
+	}
+	wg.Wait()
+
+	response := LanguagesResponse{Results: make(map[string]LanguageResult, len(req.Languages))}
+	for i, language := range req.Languages {
+		response.Results[language] = results[i]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// translateLanguage retrieves the context and translates req into
+// req.Language, reporting a failure in the result
+func translateLanguage(r *http.Request, store rag.VectorStore, providers Providers, req TranslateRequest) LanguageResult {
+	contextCards, retrieved, degraded, err := retrieveContext(r.Context(), store, providers.Embedder, req, nil)
+	if err != nil {
+		return LanguageResult{Context: []rag.ContextCard{}, Error: err.Error()}
+	}
+
+	result := LanguageResult{Context: contextCards, ContextRetrieved: retrieved, Warning: contextWarning(req, contextCards, degraded)}
+	if req.RetrieveOnly {
+		return result
+	}
+
+	translation, err := providers.Translator.Translate(req.generationContext(r.Context()), req.Text, contextCards, req.model, req.Language)
+	if err != nil {
+		log.Printf("Error generating %s translation: %v", req.Language, err)
+		result.Error = fmt.Sprintf("Failed to generate translation: %v", err)
+		return result
+	}
+	result.Translation = translation.Translation
+	result.Cleaned = translation.Cleaned
+	result.Retried = translation.Retried
+	result.Notes = translation.Notes
+	result.Explanation = translation.Explanation
+	result.Draft = translation.Draft
+	result.Raw = req.raw(translation.Raw)
+	return result
+}
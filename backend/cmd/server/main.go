@@ -1,173 +1,905 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
 	"github.com/ventrosky/arkham-localize/backend/internal/db"
 	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
 	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+	"github.com/ventrosky/arkham-localize/backend/internal/tracing"
 )
 
 type TranslateRequest struct {
-	Text     string `json:"text"`
-	Language string `json:"language"` // "it", "fr", "de", "es"
+	Text              string    `json:"text"`
+	Language          string    `json:"language"`           // One of options.SupportedLanguages, e.g. "it"
+	RetrievalMode     string    `json:"retrieval_mode"`     // "english" (default) or "target"
+	RetrieveOnly      bool      `json:"retrieve_only"`      // Return the context cards without generating a translation
+	TextType          string    `json:"text_type"`          // "rules" (default) or "flavor"
+	MinSimilarity     float64   `json:"min_similarity"`     // Drop context cards below this cosine similarity (0 disables)
+	Embedding         []float32 `json:"embedding"`          // Optional pre-computed embedding of Text, skips the embeddings call
+	EmbeddingModel    string    `json:"embedding_model"`    // Embedding model to retrieve with, the configured one if stored (empty for it)
+	IsBack            bool      `json:"is_back"`            // Text comes from a card back (encounter/story side); back references are preferred
+	Candidates        int       `json:"candidates"`         // Return up to rag.MaxCandidates alternative translations instead of one (0 or 1 for a single one)
+	IncludeNormalized bool      `json:"include_normalized"` // Echo the source text after the deterministic structure fixes
+	Languages         []string  `json:"languages"`          // Translate into each of these instead of language, e.g. ["it", "fr"]
+	TypeCode          string    `json:"type_code"`          // Only use context cards of this ArkhamDB type, e.g. "asset" (empty for any)
+	FactionCode       string    `json:"faction_code"`       // Only use context cards of this ArkhamDB faction, e.g. "guardian" (empty for any)
+	Deck              string    `json:"deck"`               // Only use "player" or "encounter" (scenario, story, encounter deck) context cards (empty for any)
+	SymbolFormat      string    `json:"symbol_format"`      // "preserve" (default), "arkhamdb" ([elder_sign]) or "strange-eons" (<eld>)
+	Normalize         *bool     `json:"normalize"`          // Normalize the wording before translating (default true); false translates literally
+	Review            bool      `json:"review"`             // Have the model review its draft for structural errors, doubling the cost
+	IncludeRaw        bool      `json:"include_raw"`        // Also return the model's untouched answer, for auditing
+	Explain           bool      `json:"explain"`            // Also return the model's short rationale for its choices (JSON mode only)
+	PreferMatch       bool      `json:"prefer_match"`       // Return an exact suggested_match's official translation instead of generating one
+	// ContextOverrides pins these cards (by code) as context, ahead of the
+	// retrieved ones, or instead of them with context_override_mode "replace"
+	ContextOverrides    []string `json:"context_overrides"`
+	ContextOverrideMode string   `json:"context_override_mode"` // "prepend" (default) or "replace"
+	// PreferPack ranks the context cards of this ArkhamDB pack, e.g. "dwl",
+	// above closer ones of other packs (see PACK_WEIGHT)
+	PreferPack string `json:"prefer_pack"`
+
+	// model is the chat model configured when the request was validated, so
+	// that a reload (SIGHUP) doesn't switch models halfway through it
+	model string
+}
+
+// generationContext returns ctx, marked for a literal translation when the
+// request turns normalization off, and for a review pass and an explanation
+// when it asks for them
+func (req TranslateRequest) generationContext(ctx context.Context) context.Context {
+	if req.Normalize != nil && !*req.Normalize {
+		ctx = rag.WithLiteral(ctx)
+	}
+	if req.Review {
+		ctx = rag.WithReview(ctx)
+	}
+	if req.Explain {
+		ctx = rag.WithExplanation(ctx)
+	}
+	return ctx
+}
+
+// raw returns the model's untouched answer when the request includes it
+func (req TranslateRequest) raw(answer string) string {
+	if !req.IncludeRaw {
+		return ""
+	}
+	return answer
 }
 
 type TranslateResponse struct {
-	Translation string            `json:"translation"`
-	Context     []rag.ContextCard `json:"context"`
+	Translation         string            `json:"translation,omitempty"`
+	Context             []rag.ContextCard `json:"context"` // Cards of the prompt, after the threshold, reranking and trimming
+	Warning             string            `json:"warning,omitempty"`
+	Cleaned             bool              `json:"cleaned,omitempty"`               // Scaffolding was stripped from the model output
+	Retried             bool              `json:"retried,omitempty"`               // The model was asked again after a non-translation answer
+	Candidates          []rag.Candidate   `json:"candidates,omitempty"`            // Alternatives, when more than one was requested (replaces translation)
+	NormalizedText      string            `json:"normalized_text,omitempty"`       // Source text as sent to the model, with include_normalized
+	ModelNormalizedText string            `json:"model_normalized_text,omitempty"` // The model's own normalization (JSON mode only), with include_normalized
+	ContextRetrieved    int               `json:"context_retrieved"`               // Context cards found, before the token budget and prompt size limit
+	Notes               string            `json:"notes,omitempty"`                 // Warnings from the model (JSON mode only)
+	Draft               string            `json:"draft,omitempty"`                 // Translation before the review pass, with review
+	Raw                 string            `json:"raw,omitempty"`                   // The model's answer before any post-processing, with include_raw
+	Timings             *Timings          `json:"timings,omitempty"`               // Time spent per stage, with ?debug=1
+	Explanation         string            `json:"explanation,omitempty"`           // The model's rationale for its choices, with explain
+	Retrieved           []rag.ContextCard `json:"retrieved,omitempty"`             // Store results before any filtering, with ?debug=1
+	SuggestedMatch      *SuggestedMatch   `json:"suggested_match,omitempty"`       // Context card reaching MATCH_THRESHOLD, reusable as it is
+	PackMatched         *bool             `json:"pack_matched,omitempty"`          // Whether the context holds a card of prefer_pack
+}
+
+// packMatched returns whether contextCards holds a card of the pack req
+// prefers, or nil when it prefers none
+func packMatched(req TranslateRequest, contextCards []rag.ContextCard) *bool {
+	if req.PreferPack == "" {
+		return nil
+	}
+	matched := false
+	for _, card := range contextCards {
+		if card.PackCode == req.PreferPack {
+			matched = true
+			break
+		}
+	}
+	return &matched
+}
+
+// Timings is the time spent in each stage of a /translate request, in
+// milliseconds, to tell whether slowness comes from the database or OpenAI
+type Timings struct {
+	Embedding  float64 `json:"embedding_ms"`  // Embeddings call (0 when the client sent the embedding)
+	Retrieval  float64 `json:"retrieval_ms"`  // Vector store search
+	Rerank     float64 `json:"rerank_ms"`     // Reranking, a chat call with RERANK_MODE=llm
+	Generation float64 `json:"generation_ms"` // Chat call(s) generating the translation
+	Total      float64 `json:"total_ms"`      // Whole request, decoding included
+}
+
+// searchRecorder keeps the results of the searches of its VectorStore, for
+// the retrieved cards of ?debug=1. The languages of a request search it
+// concurrently.
+type searchRecorder struct {
+	rag.VectorStore
+	mu    sync.Mutex
+	cards []rag.ContextCard
+}
+
+func (s *searchRecorder) Search(ctx context.Context, query rag.SearchQuery) ([]rag.ContextCard, error) {
+	cards, err := s.VectorStore.Search(ctx, query)
+	s.mu.Lock()
+	s.cards = append(s.cards, cards...)
+	s.mu.Unlock()
+	return cards, err
+}
+
+// retrieved returns the recorded cards, or nil without a recorder
+func (s *searchRecorder) retrieved() []rag.ContextCard {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cards
+}
+
+// milliseconds returns the time since start in milliseconds
+func milliseconds(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
 }
 
+// unguidedWarning is returned when no context card passed the similarity threshold
+const unguidedWarning = "No context card reached min_similarity; the translation is unguided"
+
+// modelMismatchWarning is returned when context cards were embedded with
+// another model than the query (MODEL_MISMATCH=warn)
+const modelMismatchWarning = "Some context cards were embedded with %s, not %s; their similarity is meaningless. Re-embed them (POST /admin/reembed) or set MODEL_MISMATCH=filter"
+
+// degradedWarning is returned when retrieval failed and the translation
+// went ahead without context (RETRIEVAL_FAIL_OPEN)
+const degradedWarning = "Context retrieval failed; the translation is unguided"
+
 var (
+	configPath = flag.String("config", "", "Path to optional YAML config file")
+
 	openAIKey      string
 	embeddingModel string
+	chatModel      string
+	rerankMode     string
+
+	autoTrimContext bool
+
+	// retrievalFailOpen degrades a retrieval failure to an empty context
+	// instead of failing the request
+	retrievalFailOpen bool
+
+	// modelMismatch handles the context cards embedded with another model
+	// than embeddingModel (options.ModelMismatchWarn or options.ModelMismatchFilter)
+	modelMismatch = options.ModelMismatchWarn
+
+	handlerTimeout time.Duration
+
+	// maxBodyBytes caps the size of JSON request bodies
+	maxBodyBytes int64 = 1 << 20
 )
 
-func init() {
+// contextCardLimit is the number of context cards included in the prompt
+const contextCardLimit = 6
+
+// Providers are the embedding and translation steps of the pipeline, passed
+// to the handlers: the OpenAI ones in production, fakes in tests
+type Providers struct {
+	Embedder   rag.Embedder
+	Translator rag.Translator
+}
+
+// openAIProviders returns the providers calling the OpenAI API with the
+// configured key and embedding model
+func openAIProviders() Providers {
+	return Providers{
+		Embedder:   rag.OpenAIEmbedder{APIKey: openAIKey, Model: embeddingModel},
+		Translator: rag.OpenAITranslator{APIKey: openAIKey},
+	}
+}
+
+func main() {
+	flag.Parse()
+
 	// Load .env file if exists
 	godotenv.Load()
 
-	// Get OpenAI API key
-	openAIKey = os.Getenv("OPENAI_API_KEY")
-	if openAIKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is required")
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	// Get embedding model (default: text-embedding-3-small)
-	embeddingModel = os.Getenv("EMBEDDING_MODEL")
-	if embeddingModel == "" {
-		embeddingModel = "text-embedding-3-small"
+	log.Printf("⚙️  Configuration:")
+	for _, line := range cfg.Report() {
+		log.Printf("   %s", line)
 	}
-}
 
-func main() {
-	// Database connection
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnvInt("DB_PORT", 5432)
-	dbUser := getEnv("DB_USER", "arkham")
-	dbPassword := getEnv("DB_PASSWORD", "arkham")
-	dbName := getEnv("DB_NAME", "arkham_localize")
+	openAIKey = cfg.OpenAI.APIKey
+	embeddingModel = cfg.OpenAI.EmbeddingModel
+	chatModel = cfg.OpenAI.ChatModel
+	openai.BaseURL = cfg.OpenAI.BaseURL
+	openai.Organization = cfg.OpenAI.Organization
+	openai.Project = cfg.OpenAI.Project
+	embeddings.MaxInput = cfg.OpenAI.EmbeddingMaxInput
+	embeddings.TruncateUnit = cfg.OpenAI.EmbeddingTruncateUnit
+	openai.MaxRetries = cfg.OpenAI.MaxRetries
+	openai.RetryBaseDelay = cfg.OpenAI.RetryBaseDelay
+	embeddings.Timeout = cfg.OpenAI.EmbeddingTimeout
+	rag.TranslationTimeout = cfg.OpenAI.TranslationTimeout
+	rerankMode = cfg.Retrieval.Rerank
+	autoTrimContext = cfg.Translation.AutoTrimContext
+	retrievalFailOpen = cfg.Retrieval.FailOpen
+	modelMismatch = cfg.Retrieval.ModelMismatch
+	handlerTimeout = cfg.Server.HandlerTimeout
+	maxBodyBytes = int64(cfg.Server.MaxBodyBytes)
+	gzipMinBytes = cfg.Server.GzipMinBytes
+	maxFileRows = cfg.Server.MaxFileRows
+	adminAPIKey = cfg.Server.AdminAPIKey
+	ingestDataDir = cfg.Ingest.DataDir
+	cardPriorities, _ = options.ParseCardPriorities(cfg.Ingest.CardPriorities) // Validated above
+	cardFields, _ = ingest.ParseFieldMap(cfg.Ingest.FieldMap)                  // Validated above
+	rag.PriorityWeight = cfg.Retrieval.PriorityWeight
+	rag.PackWeight = cfg.Retrieval.PackWeight
+	rag.LanguageFallbacks, _ = options.ParseLanguageFallbacks(cfg.Retrieval.LanguageFallbacks)    // Validated above
+	rag.ReferenceLanguages, _ = options.ParseReferenceLanguages(cfg.Retrieval.ReferenceLanguages) // Validated above
+	rag.MaxInputChars = cfg.Translation.MaxInputChars
+	rag.MaxPromptTokens = cfg.Translation.MaxPromptTokens
+	rag.ContextTokenBudget = cfg.Translation.ContextTokenBudget
+	matchThreshold = cfg.Translation.MatchThreshold
+	if err := rag.LoadPromptTemplates(cfg.Translation.PromptTemplateDir); err != nil {
+		log.Fatalf("Invalid prompt templates: %v", err)
+	}
+	rag.JSONOutput = cfg.Translation.JSONOutput
+	rag.ContextOrder = cfg.Translation.ContextOrder
+	rag.BackFallback = cfg.Retrieval.BackFallback
+	rag.PostProcessors, _ = options.ParsePostProcessors(cfg.Translation.PostProcessors)    // Validated above
+	rag.PreservedTokens, _ = options.ParsePreservedTokens(cfg.Translation.PreservedTokens) // Validated above
+	if err := rag.LoadGlossaries(cfg.Translation.GlossaryDir); err != nil {
+		log.Fatalf("Invalid glossary: %v", err)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Endpoint, cfg.Tracing.ServiceName)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	providers := openAIProviders()
 
-	database, err := db.Connect(dbHost, dbPort, dbUser, dbPassword, dbName)
+	// Validate OpenAI key and embedding model before accepting requests
+	probedDimensions := 0
+	if cfg.OpenAI.SkipPreflight {
+		log.Printf("⚠️  Skipping OpenAI preflight check (SKIP_OPENAI_PREFLIGHT is set)")
+	} else if probedDimensions, err = preflightCheck(providers.Embedder); err != nil {
+		log.Fatalf("OpenAI preflight check failed (check OPENAI_API_KEY, EMBEDDING_MODEL and OPENAI_BASE_URL): %v", err)
+	}
+
+	// Database connection
+	database, err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer database.Close()
 
+	store, err := rag.NewVectorStore(cfg.Retrieval.VectorStore, database)
+	if err != nil {
+		log.Fatalf("Failed to open vector store: %v", err)
+	}
+
+	if dimensions, err := db.EmbeddingDimensions(database, "card_embeddings"); err != nil {
+		log.Printf("⚠️  Could not read the embedding dimensions, assuming %d: %v", embeddings.Dimensions, err)
+	} else {
+		// Query embeddings of another size can't be compared with the stored ones
+		if err := embeddings.CheckDimensions(embeddingModel, probedDimensions, dimensions); err != nil {
+			log.Fatalf("Embedding model doesn't match the database: %v", err)
+		}
+		embeddings.Dimensions = dimensions
+	}
+
+	// Make a database that was never ingested obvious rather than silently
+	// translating without context
+	if cfg.Retrieval.MinRows > 0 {
+		ingestGuard = &rowGuard{
+			min: cfg.Retrieval.MinRows,
+			count: func(ctx context.Context) (int, error) {
+				return db.EmbeddingRows(ctx, database)
+			},
+		}
+		minRowsWarning = cfg.Retrieval.MinRowsWarning
+		ingestGuard.lowRows() // First count, logged if too low
+	}
+
+	// Reject an embedding_model no entry was embedded with rather than
+	// retrieving no context
+	storedModels = &modelGuard{
+		list: func(ctx context.Context) ([]string, error) {
+			return db.EmbeddingModels(ctx, database)
+		},
+	}
+
+	// Record a span per pipeline step (no-ops unless tracing is enabled)
+	providers = tracedProviders(providers)
+	store = tracedStore{VectorStore: store}
+
+	// Query with the metric the index was built with, or the index can't be used
+	rag.SimilarityMetric, _ = rag.ParseMetric(cfg.Retrieval.Metric) // Validated above
+	if opClass, err := db.IndexOpClass(database, "card_embeddings_embedding_idx"); err != nil {
+		log.Printf("⚠️  Could not read the index metric, assuming %s: %v", rag.SimilarityMetric, err)
+	} else if metric, err := rag.MetricForOpClass(opClass); err != nil {
+		log.Printf("⚠️  %v, assuming %s", err, rag.SimilarityMetric)
+	} else if metric != rag.SimilarityMetric {
+		log.Printf("⚠️  SIMILARITY_METRIC is %s but the index uses %s; using %s (re-run the ingest tool to rebuild the index)", rag.SimilarityMetric, metric, metric)
+		rag.SimilarityMetric = metric
+	}
+
+	// Keep the ivfflat clusters in step with incrementally added rows
+	if cfg.Server.ReindexInterval > 0 {
+		log.Printf("🔄 Rebuilding the ivfflat indexes every %s", cfg.Server.ReindexInterval)
+		go reindexLoop(context.Background(), cfg.Server.ReindexInterval, reindexJob(database))
+	}
+
+	// Open the OpenAI connections before the first request needs them
+	if cfg.Server.Warmup {
+		go warmup(context.Background(), providers.Embedder, func(ctx context.Context) error {
+			return rag.WarmUpChat(ctx, openAIKey, currentChatModel())
+		})
+	}
+
+	// Tune the prompts, glossaries and chat model without a restart
+	reloadOnSIGHUP(cfg)
+
 	// HTTP handlers
-	http.HandleFunc("/translate", translateHandler(database))
+	http.HandleFunc("/translate", withTracing(withGzip(withHandlerTimeout(translateHandler(store, providers)))))
+	http.HandleFunc("/translate/compare", withTracing(withGzip(withHandlerTimeout(compareHandler(store, providers)))))
+	http.HandleFunc("/translate/debug-prompt", withTracing(withGzip(withHandlerTimeout(debugPromptHandler(store, providers)))))
+	http.HandleFunc("/translate/errata", withTracing(withGzip(withHandlerTimeout(errataHandler(store, providers)))))
+	// Streams its CSV row by row, so no handler timeout (rows have their own)
+	http.HandleFunc("/translate/file", withTracing(translateFileHandler(store, providers)))
+	http.HandleFunc("/admin/ingest", withGzip(requireAdminKey(startIngestHandler(database, store))))
+	http.HandleFunc("/admin/ingest/", withGzip(requireAdminKey(requireMethod(http.MethodGet, ingestStatusHandler))))
+	http.HandleFunc("/admin/reembed", withGzip(requireAdminKey(startReembedHandler(database))))
+	http.HandleFunc("/admin/reindex", withGzip(requireAdminKey(startReindexHandler(database))))
+	http.HandleFunc("/admin/card/", withGzip(requireAdminKey(cardHandler(store))))
+	http.HandleFunc("/similar/", withGzip(similarHandler(store)))
+	http.HandleFunc("/gaps", withGzip(gapsHandler(database)))
 	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/version", corsMiddleware(requireMethod(http.MethodGet, versionHandler)))
+	http.HandleFunc("/health/detailed", withGzip(detailedHealthHandler(database)))
 
 	// Start server
-	port := getEnv("PORT", "3001")
-	log.Printf("🚀 Server starting on http://localhost:%s", port)
+	port := cfg.Server.Port
+	log.Printf("🚀 Server %s starting on http://localhost:%s", serviceVersion(), port)
 	log.Printf("📝 POST /translate - Translate English text to Italian")
+	log.Printf("⚖️  POST /translate/compare - Compare translations across models")
+	log.Printf("🔍 POST /translate/debug-prompt - Show the prompt without translating")
+	log.Printf("✏️  POST /translate/errata - Update a translation after an errata, keeping unchanged sentences")
+	log.Printf("📄 POST /translate/file - Translate the text column of an uploaded CSV")
+	log.Printf("🔗 GET  /similar/{code} - Cards most similar to a stored card")
 	log.Printf("💚 GET  /health - Health check")
+	log.Printf("💚 GET  /health/detailed - Readiness: database, pgvector and ingested cards")
+	log.Printf("🏷️  GET  /version - Build version, commit and date")
+	if adminAPIKey != "" {
+		log.Printf("🔐 POST /admin/ingest - Start a background ingest job")
+		log.Printf("🔐 POST /admin/reembed - Re-embed rows after switching embedding models")
+		log.Printf("🔐 POST /admin/reindex - Rebuild the ivfflat indexes")
+		log.Printf("🔐 GET  /admin/ingest/{id} - Ingest, re-embed or reindex job progress")
+		log.Printf("🔐 DELETE /admin/card/{code} - Remove a card's entries")
+		log.Printf("🔐 POST /admin/card/{code}/reingest - Re-embed a card from the data directory")
+	}
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	// WriteTimeout bounds the whole response, so it is kept above the handler
+	// deadline of the slow translation endpoints rather than short and global
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           withVersionHeader(http.DefaultServeMux),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
-// enableCORS sets CORS headers for all responses
-func enableCORS(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	w.Header().Set("Access-Control-Max-Age", "3600")
+// preflightCheck makes a tiny embeddings call to validate the OpenAI key
+// and the selected embedding model
+func preflightCheck(embedder rag.Embedder) (int, error) {
+	embedding, err := embedder.Embed(context.Background(), "preflight")
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("✅ OpenAI preflight check passed (model: %s, %d dimensions)", embeddingModel, len(embedding))
+	return len(embedding), nil
 }
 
-// corsMiddleware wraps handlers with CORS support
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		enableCORS(w, r)
+// withHandlerTimeout gives a handler a deadline of handlerTimeout, after which
+// the client gets a 503 with a timeout error. The response is buffered until
+// the handler returns, so streaming handlers must not be wrapped.
+func withHandlerTimeout(next http.HandlerFunc) http.HandlerFunc {
+	if handlerTimeout <= 0 {
+		return next
+	}
+	timeout := http.TimeoutHandler(next, handlerTimeout, timeoutBody)
+	// Set CORS headers outside the timeout handler so they survive a timeout,
+	// and the content type of the timeout body (the handler's own replaces it)
+	return corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		timeout.ServeHTTP(w, r)
+	})
+}
 
-		// Handle preflight OPTIONS request
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
+// decodeJSONBody decodes the JSON request body into dst, rejecting bodies
+// larger than maxBodyBytes and unknown fields. The error message is meant
+// for the client.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("Request body too large (limit %d bytes)", tooLarge.Limit)
 		}
-
-		next(w, r)
+		return fmt.Errorf("Invalid JSON in request body: %v", err)
 	}
+	return nil
 }
 
-func translateHandler(database *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		enableCORS(w, r)
+func translateHandler(store rag.VectorStore, providers Providers) http.HandlerFunc {
+	return corsMiddleware(requireMethod(http.MethodPost, requireJSON(func(w http.ResponseWriter, r *http.Request) {
+		// Translations are sampled and not cached, so a response must not be
+		// reused for the same request
+		w.Header().Set("Cache-Control", "no-store")
+
+		// ?debug=1 reports the time spent in each stage and the cards
+		// retrieved before filtering
+		start := time.Now()
+		var timings *Timings
+		var recorder *searchRecorder
+		store := store
+		if r.URL.Query().Get("debug") == "1" {
+			timings = &Timings{}
+			recorder = &searchRecorder{VectorStore: store}
+			store = recorder
+		}
 
-		// Handle preflight OPTIONS request
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
+		var req TranslateRequest
+		if err := decodeJSONBody(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
 			return
 		}
 
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		if err := validateTranslateRequest(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
 			return
 		}
+		providers := providers.withSymbolFormat(req.SymbolFormat)
 
-		var req TranslateRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		// Several languages share the embedding and get a result each
+		if len(req.Languages) > 0 {
+			translateLanguages(w, r, store, providers, req)
 			return
 		}
 
-		if req.Text == "" {
-			http.Error(w, "Text field is required", http.StatusBadRequest)
+		// Steps 1-2: Embed the query text and retrieve context cards
+		contextCards, retrieved, degraded, err := retrieveContext(r.Context(), store, providers.Embedder, req, timings)
+		if err != nil {
+			writePipelineError(w, err.Error(), err)
 			return
 		}
 
-		// Validate language (default to "it" if not provided)
-		if req.Language == "" {
-			req.Language = "it"
-		}
-		validLanguages := map[string]bool{"it": true, "fr": true, "de": true, "es": true}
-		if !validLanguages[req.Language] {
-			http.Error(w, fmt.Sprintf("Unsupported language: %s (supported: it, fr, de, es)", req.Language), http.StatusBadRequest)
+		// Step 2d: Look for a card whose official translation can be reused
+		match := suggestMatch(req.Text, contextCards, req.Language, req.SymbolFormat)
+
+		// Retrieval only: return the nearest official translations, skipping the LLM
+		if req.RetrieveOnly {
+			response := TranslateResponse{Context: contextCards, ContextRetrieved: retrieved, Timings: timings, Retrieved: recorder.retrieved(), SuggestedMatch: match, PackMatched: packMatched(req, contextCards)}
+			if timings != nil {
+				timings.Total = milliseconds(start)
+			}
+			if req.IncludeNormalized {
+				// Deterministic, so it needs no model call either
+				response.NormalizedText = rag.PrepareSourceFor(req.generationContext(r.Context()), rag.ConvertSymbols(req.Text, req.SymbolFormat), req.Language)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
 			return
 		}
 
-		// Step 1: Generate embedding for the query text
-		queryEmbedding, err := embeddings.GetEmbedding(req.Text, openAIKey, embeddingModel)
-		if err != nil {
-			log.Printf("Error generating embedding: %v", err)
-			http.Error(w, fmt.Sprintf("Failed to generate embedding: %v", err), http.StatusInternalServerError)
+		// An exact match already has an official translation
+		if req.PreferMatch && match != nil && match.Exact {
+			response := TranslateResponse{
+				Translation:      match.Translation,
+				Context:          contextCards,
+				ContextRetrieved: retrieved,
+				Warning:          contextWarning(req, contextCards, degraded),
+				Timings:          timings,
+				Retrieved:        recorder.retrieved(),
+				SuggestedMatch:   match,
+				PackMatched:      packMatched(req, contextCards),
+			}
+			if timings != nil {
+				timings.Total = milliseconds(start)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
 			return
 		}
 
-		// Step 2: Retrieve similar cards from database (filtered by language)
-		contextCards, err := rag.RetrieveSimilarCards(database, queryEmbedding, 6, req.Language)
-		if err != nil {
-			log.Printf("Error retrieving similar cards: %v", err)
-			http.Error(w, fmt.Sprintf("Failed to retrieve context: %v", err), http.StatusInternalServerError)
+		// Step 3: Generate translation with context, or several alternatives
+		generationStart := time.Now()
+		if req.Candidates > 1 {
+			result, err := providers.Translator.TranslateCandidates(req.generationContext(r.Context()), req.Text, contextCards, req.model, req.Language, req.Candidates)
+			if timings != nil {
+				timings.Generation = milliseconds(generationStart)
+			}
+			if err != nil {
+				log.Printf("Error generating translation candidates: %v", err)
+				writePipelineError(w, fmt.Sprintf("Failed to generate translation: %v", err), err)
+				return
+			}
+
+			for i := range result.Candidates {
+				result.Candidates[i].Raw = req.raw(result.Candidates[i].Raw)
+			}
+			response := TranslateResponse{
+				Candidates:       result.Candidates,
+				Context:          contextCards,
+				ContextRetrieved: retrieved,
+				Warning:          contextWarning(req, contextCards, degraded),
+				Timings:          timings,
+				Retrieved:        recorder.retrieved(),
+				SuggestedMatch:   match,
+				PackMatched:      packMatched(req, contextCards),
+			}
+			if req.IncludeNormalized {
+				response.NormalizedText = result.Normalized
+			}
+			if timings != nil {
+				timings.Total = milliseconds(start)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
 			return
 		}
 
-		// Step 3: Generate translation with context
-		translation, err := rag.GenerateTranslation(req.Text, contextCards, openAIKey, req.Language)
+		result, err := providers.Translator.Translate(req.generationContext(r.Context()), req.Text, contextCards, req.model, req.Language)
+		if timings != nil {
+			timings.Generation = milliseconds(generationStart)
+		}
 		if err != nil {
 			log.Printf("Error generating translation: %v", err)
-			http.Error(w, fmt.Sprintf("Failed to generate translation: %v", err), http.StatusInternalServerError)
+			writePipelineError(w, fmt.Sprintf("Failed to generate translation: %v", err), err)
 			return
 		}
 
 		// Step 4: Return response
 		response := TranslateResponse{
-			Translation: translation,
-			Context:     contextCards,
+			Translation:      result.Translation,
+			Context:          contextCards,
+			ContextRetrieved: retrieved,
+			Warning:          contextWarning(req, contextCards, degraded),
+			Cleaned:          result.Cleaned,
+			Retried:          result.Retried,
+			Notes:            result.Notes,
+			Explanation:      result.Explanation,
+			Draft:            result.Draft,
+			Raw:              req.raw(result.Raw),
+			Timings:          timings,
+			Retrieved:        recorder.retrieved(),
+			SuggestedMatch:   match,
+			PackMatched:      packMatched(req, contextCards),
+		}
+		if req.IncludeNormalized {
+			response.NormalizedText = result.Normalized
+			response.ModelNormalizedText = result.ModelNormalized
+		}
+		if timings != nil {
+			timings.Total = milliseconds(start)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
+	})))
+}
+
+// validateTranslateRequest applies defaults to the request and validates it.
+// The returned error is meant to be shown to the client.
+func validateTranslateRequest(req *TranslateRequest) error {
+	if req.Text == "" {
+		return fmt.Errorf("Text field is required")
+	}
+	req.model = currentChatModel()
+
+	if len(req.Languages) > 0 {
+		if req.Language != "" {
+			return fmt.Errorf("Set either language or languages, not both")
+		}
+		languages, err := validateLanguages(req.Languages)
+		if err != nil {
+			return err
+		}
+		req.Languages = languages
+		if req.Candidates > 1 {
+			return fmt.Errorf("candidates is not supported with languages")
+		}
+		req.Language = languages[0] // Validated with the other fields below
+	}
+
+	// Validate language (default to "it" if not provided)
+	if req.Language == "" {
+		req.Language = "it"
+	}
+	if !options.ValidLanguage(req.Language) {
+		return fmt.Errorf("Unsupported language: %s (supported: %s)", req.Language, strings.Join(options.SupportedLanguages, ", "))
+	}
+
+	if req.RetrievalMode == "" {
+		req.RetrievalMode = rag.RetrievalEnglish
+	}
+	if req.RetrievalMode != rag.RetrievalEnglish && req.RetrievalMode != rag.RetrievalTarget {
+		return fmt.Errorf("Unsupported retrieval_mode: %s (supported: english, target)", req.RetrievalMode)
+	}
+
+	if err := validateEmbeddingModel(req.EmbeddingModel); err != nil {
+		return err
+	}
+	if req.Embedding != nil && len(req.Embedding) != embeddings.Dimensions {
+		return fmt.Errorf("Embedding must have %d dimensions, got %d", embeddings.Dimensions, len(req.Embedding))
+	}
+
+	if req.MinSimilarity < 0 || req.MinSimilarity > 1 {
+		return fmt.Errorf("min_similarity must be between 0 and 1, got %g", req.MinSimilarity)
+	}
+
+	if req.TextType == "" {
+		req.TextType = rag.TextRules
+	}
+	if !rag.ValidTextType(req.TextType) {
+		return fmt.Errorf("Unsupported text_type: %s (supported: rules, flavor, name)", req.TextType)
+	}
+
+	if req.Deck != "" && !rag.ValidDeck(req.Deck) {
+		return fmt.Errorf("Unsupported deck: %s (supported: player, encounter)", req.Deck)
+	}
+
+	if req.Candidates < 0 || req.Candidates > rag.MaxCandidates {
+		return fmt.Errorf("candidates must be between 1 and %d, got %d", rag.MaxCandidates, req.Candidates)
+	}
+	if req.Review && req.Candidates > 1 {
+		return fmt.Errorf("review is not supported with candidates")
+	}
+	if req.Explain && !rag.JSONOutput {
+		return fmt.Errorf("explain requires JSON output (JSON_OUTPUT=true)")
+	}
+
+	if req.SymbolFormat == "" {
+		req.SymbolFormat = rag.SymbolFormatPreserve
+	}
+	if !rag.ValidSymbolFormat(req.SymbolFormat) {
+		return fmt.Errorf("Unsupported symbol_format: %s (supported: preserve, arkhamdb, strange-eons)", req.SymbolFormat)
+	}
+
+	return validateContextOverrides(req)
+}
+
+// retrieveContext embeds the request text and retrieves (and optionally
+// reranks) the context cards used in the translation prompt. With
+// retrievalFailOpen, a failed database lookup returns no cards and reports
+// degraded instead of an error, unless only the context was requested.
+// retrieved is the number of cards found before CONTEXT_TOKEN_BUDGET and
+// AUTO_TRIM_CONTEXT dropped some. The time spent in each step is recorded in
+// timings unless it is nil.
+func retrieveContext(ctx context.Context, store rag.VectorStore, embedder rag.Embedder, req TranslateRequest, timings *Timings) (contextCards []rag.ContextCard, retrieved int, degraded bool, err error) {
+	if timings == nil {
+		timings = &Timings{} // Measured and dropped
+	}
+
+	// Reject oversized input before spending an embeddings call on it
+	if err := rag.CheckPromptSize(req.Text, nil, req.Language); err != nil {
+		return nil, 0, false, err
+	}
+
+	// Step 1: Generate embedding for the query text, unless the client sent one
+	queryEmbedding := req.Embedding
+	if queryEmbedding == nil {
+		var err error
+		embeddingStart := time.Now()
+		queryEmbedding, err = embedder.Embed(ctx, req.Text)
+		timings.Embedding = milliseconds(embeddingStart)
+		if err != nil {
+			log.Printf("Error generating embedding: %v", err)
+			return nil, 0, false, fmt.Errorf("Failed to generate embedding: %w", err)
+		}
+	}
+
+	// Step 2: Retrieve similar cards from the vector store (filtered by language),
+	// matching against the English or the target-language embeddings, without
+	// the unusable ones. Ask for more when reranking so deduplication still
+	// fills every slot
+	retrieveLimit := contextCardLimit
+	if rerankMode != options.RerankNone {
+		retrieveLimit = contextCardLimit * 2
 	}
+	query := rag.SearchQuery{
+		Embedding:          queryEmbedding,
+		Limit:              retrieveLimit,
+		Language:           req.Language,
+		TextType:           req.TextType,
+		Mode:               req.RetrievalMode,
+		ReferenceLanguages: rag.ReferenceLanguages,
+		TypeCode:           req.TypeCode,
+		FactionCode:        req.FactionCode,
+		Deck:               req.Deck,
+		IsBack:             req.IsBack,
+		PreferPack:         req.PreferPack,
+	}
+	// Query embeddings sent by the client are assumed to be made with the
+	// configured model too. A model the request names explicitly only
+	// matches the entries embedded with it.
+	if modelMismatch == options.ModelMismatchFilter {
+		query.EmbeddingModel = embeddingModel
+	}
+	if req.EmbeddingModel != "" {
+		query.EmbeddingModel = req.EmbeddingModel
+	}
+	retrievalStart := time.Now()
+	var pinned []rag.ContextCard
+	if len(req.ContextOverrides) > 0 {
+		if pinned, err = loadContextOverrides(ctx, store, req.ContextOverrides, query); err != nil {
+			return nil, 0, false, err
+		}
+	}
+	if req.ContextOverrideMode == contextOverrideReplace {
+		contextCards = []rag.ContextCard{} // Pinned cards only
+	} else {
+		contextCards, err = rag.RetrieveContext(ctx, store, query)
+	}
+	timings.Retrieval = milliseconds(retrievalStart)
+	if err != nil {
+		log.Printf("Error retrieving similar cards: %v", err)
+		// A translation without context beats no translation
+		if retrievalFailOpen && !req.RetrieveOnly {
+			log.Printf("Retrieval failed open, translating without context")
+			return []rag.ContextCard{}, 0, true, nil
+		}
+		return nil, 0, false, fmt.Errorf("Failed to retrieve context: %v", err)
+	}
+	if len(contextCards) < contextCardLimit && req.ContextOverrideMode != contextOverrideReplace {
+		log.Printf("Found %d of %d context cards for %s %s text", len(contextCards), contextCardLimit, req.Language, req.TextType)
+	}
+	if models := rag.MismatchedModels(contextCards, embeddingModel); len(models) > 0 {
+		log.Printf("⚠️  Context cards embedded with %s, not %s: re-embed them or set MODEL_MISMATCH=filter", strings.Join(models, ", "), embeddingModel)
+	}
+
+	// Drop weak matches so they don't mislead the model
+	if req.MinSimilarity > 0 {
+		contextCards = rag.FilterBySimilarity(contextCards, req.MinSimilarity)
+	}
+
+	// Step 2b: Optionally rerank the retrieved cards (falls back to the deduplicated order on error)
+	rerankStart := time.Now()
+	contextCards, err = rag.RerankCards(req.Text, contextCards, contextCardLimit, rerankMode, openAIKey, req.model)
+	timings.Rerank = milliseconds(rerankStart)
+	if err != nil {
+		log.Printf("Error reranking context cards: %v", err)
+	}
+
+	// Put references from the same side first so trimming drops the others
+	if req.IsBack {
+		contextCards = rag.PreferSide(contextCards, true)
+		pinned = rag.PreferSide(pinned, true)
+	}
+	if len(pinned) > 0 {
+		contextCards = rag.PinCards(pinned, contextCards, contextCardLimit)
+	}
+
+	// Step 2c: Keep the cards that fit the context budget, then make sure the
+	// prompt fits, dropping the least similar cards if allowed
+	retrieved = len(contextCards)
+	contextCards = rag.BudgetContextCards(contextCards, req.Language, rag.ContextTokenBudget)
+	if len(contextCards) < retrieved {
+		log.Printf("Included %d of %d context cards within the %d token context budget", len(contextCards), retrieved, rag.ContextTokenBudget)
+	}
+	// No prompt is built when only retrieving
+	if req.RetrieveOnly {
+		return contextCards, retrieved, false, nil
+	}
+	if autoTrimContext {
+		fitted, err := rag.FitContextCards(req.Text, contextCards, req.Language)
+		if len(fitted) < len(contextCards) {
+			log.Printf("Trimmed context from %d to %d cards to fit the prompt budget", len(contextCards), len(fitted))
+		}
+		return fitted, retrieved, false, err
+	}
+	if err := rag.CheckPromptSize(req.Text, contextCards, req.Language); err != nil {
+		return nil, 0, false, err
+	}
+
+	return contextCards, retrieved, false, nil
+}
+
+// contextWarning returns a warning for the client when the cards are not
+// ingested (see rowGuard), retrieval failed open, the similarity threshold
+// filtered out every context card or some were embedded with another model
+func contextWarning(req TranslateRequest, contextCards []rag.ContextCard, degraded bool) string {
+	// An empty database explains the other warnings
+	if ingestGuard.lowRows() && minRowsWarning {
+		return notIngestedWarning
+	}
+	if degraded {
+		return degradedWarning
+	}
+	if req.MinSimilarity > 0 && len(contextCards) == 0 {
+		return unguidedWarning
+	}
+	if models := rag.MismatchedModels(contextCards, embeddingModel); len(models) > 0 {
+		return fmt.Sprintf(modelMismatchWarning, strings.Join(models, ", "), embeddingModel)
+	}
+	return ""
+}
+
+// pipelineErrorStatus maps translation pipeline errors to HTTP status codes
+// and error codes
+func pipelineErrorStatus(err error) (int, string) {
+	var tooLarge *rag.PromptTooLargeError
+	var refusal *rag.RefusalError
+	var override *contextOverrideError
+	switch {
+	case errors.As(err, &override):
+		return http.StatusBadRequest, codeInvalidRequest
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, codePromptTooLarge
+	case errors.As(err, &refusal):
+		return http.StatusUnprocessableEntity, codeRefused
+	case errors.Is(err, openai.ErrRateLimited):
+		return http.StatusTooManyRequests, codeRateLimited
+	case errors.Is(err, openai.ErrAuth), errors.Is(err, openai.ErrServer):
+		return http.StatusBadGateway, codeUpstream
+	}
+	return http.StatusInternalServerError, codeInternal
+}
+
+// writePipelineError writes a translation pipeline error with the matching
+// status code and the code of the OpenAI error behind it, passing through
+// Retry-After on OpenAI rate limits
+func writePipelineError(w http.ResponseWriter, message string, err error) {
+	status, code := pipelineErrorStatus(err)
+	detail := ErrorDetail{Code: code, Message: message}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		detail.UpstreamCode = apiErr.Kind()
+		if errors.Is(err, openai.ErrRateLimited) && apiErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(apiErr.RetryAfter.Seconds()))))
+		}
+	}
+	writeErrorDetail(w, status, detail)
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -183,21 +915,6 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "ok",
 		"service": "arkham-localize-backend",
+		"version": serviceVersion(),
 	})
 }
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
-}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// enableCORS sets CORS headers for all responses
+func enableCORS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Max-Age", "3600")
+	w.Header().Set("Access-Control-Expose-Headers", versionHeader)
+}
+
+// corsMiddleware wraps handlers with CORS support
+func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		enableCORS(w, r)
+
+		// Handle preflight OPTIONS request
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requireMethod answers 405, with an Allow header, to requests of another
+// method than the handler's. Wrap it in corsMiddleware, which answers the
+// preflight OPTIONS requests.
+func requireMethod(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireJSON answers 415 to requests with a body whose Content-Type isn't
+// application/json (a charset parameter is fine). Bodyless requests and ones
+// without a Content-Type, as sent by scripts, get through.
+func requireJSON(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		if r.ContentLength != 0 && contentType != "" {
+			mediaType, _, err := mime.ParseMediaType(contentType)
+			if err != nil || mediaType != "application/json" {
+				writeJSONError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType,
+					fmt.Sprintf("Unsupported Content-Type %q (use application/json)", contentType))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
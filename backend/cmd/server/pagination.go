@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+)
+
+// Bounds of the limit parameter of the paginated listings
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// parsePage reads the limit and cursor query parameters of a paginated
+// listing, the cursor being the next field of the previous page. The
+// returned error is meant for the client.
+func parsePage(params url.Values) (db.Page, error) {
+	page := db.Page{Limit: defaultPageLimit}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d, got %q", maxPageLimit, value)
+		}
+		page.Limit = limit
+	}
+
+	after, err := db.ParseCursor(params.Get("cursor"))
+	if err != nil {
+		return page, fmt.Errorf("%v (use the next field of the previous page)", err)
+	}
+	page.After = after
+	return page, nil
+}
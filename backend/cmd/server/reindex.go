@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/ingest"
+)
+
+// reindexJob rebuilds the ivfflat indexes (db.ReindexEmbeddings), logging
+// how long it took. It runs as a tracked job, so it never overlaps an
+// ingest, a re-embed or another reindex.
+func reindexJob(database *sql.DB) func(progress ingest.ProgressFunc) error {
+	return func(progress ingest.ProgressFunc) error {
+		start := time.Now()
+		indexes, err := db.ReindexEmbeddings(context.Background(), database)
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			log.Printf("⚠️  Reindex failed after %s: %v", elapsed, err)
+			return err
+		}
+		progress(len(indexes), 0, len(indexes), nil)
+		log.Printf("🔄 Reindexed %s in %s", strings.Join(indexes, ", "), elapsed)
+		return nil
+	}
+}
+
+// startReindexHandler starts a reindex job in the background and returns
+// its ID (POST /admin/reindex)
+func startReindexHandler(database *sql.DB) http.HandlerFunc {
+	return requireMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		runJob(w, JobReindex, reindexJob(database))
+	})
+}
+
+// reindexLoop starts a reindex job every interval until ctx is done,
+// skipping a turn while another job runs
+func reindexLoop(ctx context.Context, interval time.Duration, reindex func(progress ingest.ProgressFunc) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := startJob(JobReindex, reindex); err != nil {
+				log.Printf("Skipping the scheduled reindex: %v", err)
+			}
+		}
+	}
+}
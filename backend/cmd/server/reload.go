@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/config"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// chatModelMu guards chatModel, which a reload swaps while requests read it
+var chatModelMu sync.RWMutex
+
+// currentChatModel returns the configured chat model
+func currentChatModel() string {
+	chatModelMu.RLock()
+	defer chatModelMu.RUnlock()
+	return chatModel
+}
+
+// reloadableKeys are the config keys a reload applies; the others need a
+// restart
+var reloadableKeys = map[string]bool{
+	"openai.chat_model":               true,
+	"translation.prompt_template_dir": true,
+	"translation.glossary_dir":        true,
+}
+
+// reloadOnSIGHUP reloads the configuration file, prompt templates and
+// glossaries (see reload) each time the process receives SIGHUP. current is
+// the configuration in use, updated with what each reload applies.
+func reloadOnSIGHUP(current *config.Config) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			log.Printf("🔄 SIGHUP received, reloading the configuration")
+			next, err := config.Load(*configPath)
+			if err == nil {
+				err = next.Validate()
+			}
+			if err == nil {
+				err = reload(current, next)
+			}
+			if err != nil {
+				log.Printf("⚠️  Reload failed, keeping the current settings: %v", err)
+			}
+		}
+	}()
+}
+
+// reload puts the prompt templates and glossaries of next in use, read again
+// even if their directories are unchanged, then its chat model, and copies
+// the applied keys to current. Requests validated before keep their chat
+// model. Nothing is applied if a template or glossary fails to load; other
+// changed keys are logged as needing a restart.
+func reload(current, next *config.Config) error {
+	changes, err := rag.ReloadPrompts(next.Translation.PromptTemplateDir, next.Translation.GlossaryDir)
+	if err != nil {
+		return err
+	}
+
+	chatModelMu.Lock()
+	previousModel := chatModel
+	chatModel = next.OpenAI.ChatModel
+	chatModelMu.Unlock()
+
+	if previousModel != next.OpenAI.ChatModel {
+		log.Printf("   Chat model: %s -> %s", previousModel, next.OpenAI.ChatModel)
+	}
+	if len(changes.Prompts) > 0 {
+		log.Printf("   Prompt templates changed for: %s", strings.Join(changes.Prompts, ", "))
+	}
+	if len(changes.Glossaries) > 0 {
+		log.Printf("   Glossaries changed for: %s", strings.Join(changes.Glossaries, ", "))
+	}
+	if previousModel == next.OpenAI.ChatModel && len(changes.Prompts) == 0 && len(changes.Glossaries) == 0 {
+		log.Printf("   No reloadable setting changed")
+	}
+	for _, key := range current.Changed(next) {
+		if !reloadableKeys[key] {
+			log.Printf("⚠️  %s changed; restart the server to apply it", key)
+		}
+	}
+
+	current.OpenAI.ChatModel = next.OpenAI.ChatModel
+	current.Translation.PromptTemplateDir = next.Translation.PromptTemplateDir
+	current.Translation.GlossaryDir = next.Translation.GlossaryDir
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// notIngestedWarning is returned while card_embeddings has fewer rows than
+// MIN_EMBEDDING_ROWS, with MIN_ROWS_WARNING
+const notIngestedWarning = "The card database is not ingested (too few embeddings); translations get little or no context. Run the ingest tool"
+
+// rowGuardInterval is how long a card_embeddings row count is reused
+const rowGuardInterval = time.Minute
+
+var (
+	// ingestGuard checks that the cards were ingested; nil disables the check
+	ingestGuard *rowGuard
+
+	// minRowsWarning adds notIngestedWarning to the responses while
+	// ingestGuard reports too few rows
+	minRowsWarning bool
+)
+
+// rowGuard detects a database that was never (fully) ingested, where
+// retrieval silently finds nothing: it counts the card_embeddings rows at
+// most once per rowGuardInterval and logs a warning while they are fewer
+// than min
+type rowGuard struct {
+	min   int
+	count func(ctx context.Context) (int, error)
+
+	mu      sync.Mutex
+	low     bool
+	checked time.Time
+}
+
+// lowRows reports whether the card_embeddings rows are too few, counting
+// them again (and logging a warning while too few) once the last count is
+// older than rowGuardInterval. A nil guard never reports too few rows.
+func (g *rowGuard) lowRows() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if time.Since(g.checked) < rowGuardInterval {
+		return g.low
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+	rows, err := g.count(ctx)
+	g.checked = time.Now()
+	if err != nil {
+		// Leave database errors to the retrieval itself
+		log.Printf("⚠️  Could not count the card_embeddings rows: %v", err)
+		g.low = false
+		return false
+	}
+	g.low = rows < g.min
+	if g.low {
+		log.Printf("⚠️⚠️⚠️  card_embeddings has %d rows, fewer than MIN_EMBEDDING_ROWS (%d): retrieval finds little or no context. Run the ingest tool (go run ./cmd/ingest) or POST /admin/ingest", rows, g.min)
+	}
+	return g.low
+}
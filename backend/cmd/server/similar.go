@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// Bounds of the /similar limit parameter
+const (
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 50
+)
+
+type SimilarResponse struct {
+	CardCode string            `json:"card_code"`
+	Similar  []rag.ContextCard `json:"similar"` // Most similar first, without the card itself
+}
+
+// similarHandler lists the cards most similar to a stored card
+// (/similar/{code}), searching with its stored embedding, so no embeddings
+// call is made. The language, text_type and is_back query parameters select
+// the entry and the translations returned, like in /translate.
+func similarHandler(store rag.VectorStore) http.HandlerFunc {
+	return corsMiddleware(requireMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimPrefix(r.URL.Path, "/similar/")
+		if code == "" || strings.Contains(code, "/") {
+			writeJSONError(w, http.StatusNotFound, codeNotFound, "Not found (use /similar/{code})")
+			return
+		}
+
+		query, isBack, err := parseSimilarQuery(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		embedding, err := store.Embedding(r.Context(), code, isBack, query.TextType)
+		if errors.Is(err, rag.ErrEntryNotFound) {
+			writeJSONError(w, http.StatusNotFound, codeNotFound, fmt.Sprintf("No %s embedding stored for card %s", query.TextType, code))
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading the embedding of card %s: %v", code, err)
+			writeJSONError(w, http.StatusInternalServerError, codeInternal, fmt.Sprintf("Failed to load the card embedding: %v", err))
+			return
+		}
+
+		// One more for the card itself, which is its own closest match
+		limit := query.Limit
+		query.Embedding = embedding
+		query.Limit++
+		cards, err := rag.RetrieveContext(r.Context(), store, query)
+		if err != nil {
+			log.Printf("Error retrieving cards similar to %s: %v", code, err)
+			writeJSONError(w, http.StatusInternalServerError, codeInternal, fmt.Sprintf("Failed to retrieve similar cards: %v", err))
+			return
+		}
+
+		similar := []rag.ContextCard{}
+		for _, card := range cards {
+			if card.CardCode != code && len(similar) < limit {
+				similar = append(similar, card)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SimilarResponse{CardCode: code, Similar: similar})
+	}))
+}
+
+// parseSimilarQuery reads the /similar query parameters into a search
+// query (without its embedding) and the card side to start from. The
+// returned error is meant for the client.
+func parseSimilarQuery(r *http.Request) (rag.SearchQuery, bool, error) {
+	params := r.URL.Query()
+	query := rag.SearchQuery{
+		Limit:              defaultSimilarLimit,
+		Language:           params.Get("language"),
+		TextType:           params.Get("text_type"),
+		Mode:               rag.RetrievalEnglish,
+		ReferenceLanguages: rag.ReferenceLanguages,
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSimilarLimit {
+			return query, false, fmt.Errorf("limit must be between 1 and %d, got %q", maxSimilarLimit, value)
+		}
+		query.Limit = limit
+	}
+
+	if query.Language == "" {
+		query.Language = "it"
+	}
+	if !options.ValidLanguage(query.Language) {
+		return query, false, fmt.Errorf("Unsupported language: %s (supported: %s)", query.Language, strings.Join(options.SupportedLanguages, ", "))
+	}
+
+	if query.TextType == "" {
+		query.TextType = rag.TextRules
+	}
+	if !rag.ValidTextType(query.TextType) {
+		return query, false, fmt.Errorf("Unsupported text_type: %s (supported: rules, flavor, name)", query.TextType)
+	}
+
+	isBack := false
+	if value := params.Get("is_back"); value != "" {
+		var err error
+		if isBack, err = strconv.ParseBool(value); err != nil {
+			return query, false, fmt.Errorf("is_back must be true or false, got %q", value)
+		}
+	}
+
+	return query, isBack, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/eval"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// matchThreshold is the similarity from which the closest context card is
+// returned as the suggested match of a request (0 disables it)
+var matchThreshold float64
+
+// SuggestedMatch is a context card whose English text is (nearly) the text
+// to translate, so that its official translation may be reused as it is
+type SuggestedMatch struct {
+	CardCode       string  `json:"card_code"`
+	CardName       string  `json:"card_name"`
+	IsBack         bool    `json:"is_back"`
+	EnglishText    string  `json:"english_text"`
+	Translation    string  `json:"translation"`     // Official translation, in the request's symbol_format
+	Similarity     float64 `json:"similarity"`      // Embedding similarity, as retrieved
+	TextSimilarity float64 `json:"text_similarity"` // Edit similarity of the English texts (1 = same text)
+	Exact          bool    `json:"exact"`           // Same English text, ignoring whitespace and symbol notation
+}
+
+// suggestMatch returns the context card closest to text, by the higher of
+// its embedding and edit similarity, if that reaches matchThreshold. Only
+// official translations into language count: a fallback-language reference
+// is no translation of the text.
+func suggestMatch(text string, cards []rag.ContextCard, language, symbolFormat string) *SuggestedMatch {
+	if matchThreshold <= 0 {
+		return nil
+	}
+
+	source := matchText(text)
+	var best *SuggestedMatch
+	bestScore := 0.0
+	for _, card := range cards {
+		if card.IsFallback || card.TranslationLanguage != language || strings.TrimSpace(card.TranslatedText) == "" {
+			continue
+		}
+		textSimilarity := eval.EditSimilarity(source, matchText(card.EnglishText))
+		score := max(card.Similarity, textSimilarity)
+		if score < matchThreshold || (best != nil && score <= bestScore) {
+			continue
+		}
+		bestScore = score
+		best = &SuggestedMatch{
+			CardCode:       card.CardCode,
+			CardName:       card.CardName,
+			IsBack:         card.IsBack,
+			EnglishText:    card.EnglishText,
+			Translation:    rag.ConvertSymbols(card.TranslatedText, symbolFormat),
+			Similarity:     card.Similarity,
+			TextSimilarity: textSimilarity,
+			Exact:          textSimilarity == 1,
+		}
+	}
+	return best
+}
+
+// matchText returns text as compared for a suggested match: in the
+// ArkhamDB symbol notation of the stored texts, with collapsed whitespace
+func matchText(text string) string {
+	return strings.Join(strings.Fields(rag.ConvertSymbols(text, rag.SymbolFormatArkhamDB)), " ")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// symbolFormatTranslator converts the game symbols of the text to translate
+// and of the translations to one notation (rag.ConvertSymbols). The prompt
+// tells the model to keep the input's notation, so converting the input
+// asks for the format and converting the output enforces it.
+type symbolFormatTranslator struct {
+	rag.Translator
+	format string
+}
+
+// withSymbolFormat returns the providers with the translator converting to
+// format; rag.SymbolFormatPreserve keeps them as they are
+func (p Providers) withSymbolFormat(format string) Providers {
+	if format != rag.SymbolFormatPreserve {
+		p.Translator = symbolFormatTranslator{Translator: p.Translator, format: format}
+	}
+	return p
+}
+
+// Translate implements rag.Translator
+func (t symbolFormatTranslator) Translate(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string) (rag.TranslationResult, error) {
+	result, err := t.Translator.Translate(ctx, rag.ConvertSymbols(englishText, t.format), contextCards, model, language)
+	result.Translation = rag.ConvertSymbols(result.Translation, t.format)
+	if result.Draft != "" {
+		result.Draft = rag.ConvertSymbols(result.Draft, t.format)
+	}
+	return result, err
+}
+
+// TranslateCandidates implements rag.Translator
+func (t symbolFormatTranslator) TranslateCandidates(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string, n int) (rag.CandidatesResult, error) {
+	result, err := t.Translator.TranslateCandidates(ctx, rag.ConvertSymbols(englishText, t.format), contextCards, model, language, n)
+	for i, candidate := range result.Candidates {
+		result.Candidates[i].Translation = rag.ConvertSymbols(candidate.Translation, t.format)
+	}
+	return result, err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+	"github.com/ventrosky/arkham-localize/backend/internal/tracing"
+)
+
+// withTracing runs the handler in the root span of the request. The
+// pipeline steps add their spans under it through the request context.
+func withTracing(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.StartRequest(r)
+		defer span.End()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// tracedEmbedder records a GetEmbedding span per embedding
+type tracedEmbedder struct {
+	rag.Embedder
+	model string
+}
+
+// Embed implements rag.Embedder
+func (e tracedEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	ctx, span := tracing.Start(ctx, "GetEmbedding",
+		attribute.String("embedding.model", e.model),
+		attribute.Int("embedding.input_chars", len(text)))
+	embedding, err := e.Embedder.Embed(ctx, text)
+	tracing.End(span, err)
+	return embedding, err
+}
+
+// tracedStore records a RetrieveSimilarCards span per search
+type tracedStore struct {
+	rag.VectorStore
+}
+
+// Search implements rag.VectorStore
+func (s tracedStore) Search(ctx context.Context, query rag.SearchQuery) ([]rag.ContextCard, error) {
+	ctx, span := tracing.Start(ctx, "RetrieveSimilarCards",
+		attribute.String("translation.language", query.Language),
+		attribute.String("retrieval.text_type", query.TextType),
+		attribute.String("retrieval.mode", query.Mode),
+		attribute.Int("retrieval.top_k", query.Limit))
+	cards, err := s.VectorStore.Search(ctx, query)
+	span.SetAttributes(attribute.Int("retrieval.results", len(cards)))
+	tracing.End(span, err)
+	return cards, err
+}
+
+// tracedTranslator records a GenerateTranslation span per translation, with
+// the token usage
+type tracedTranslator struct {
+	rag.Translator
+}
+
+// Translate implements rag.Translator
+func (t tracedTranslator) Translate(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string) (rag.TranslationResult, error) {
+	ctx, span := tracing.Start(ctx, "GenerateTranslation", generationAttributes(model, language, contextCards, 1)...)
+	result, err := t.Translator.Translate(ctx, englishText, contextCards, model, language)
+	span.SetAttributes(usageAttributes(result.Usage)...)
+	span.SetAttributes(attribute.Bool("translation.retried", result.Retried))
+	tracing.End(span, err)
+	return result, err
+}
+
+// TranslateCandidates implements rag.Translator
+func (t tracedTranslator) TranslateCandidates(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string, n int) (rag.CandidatesResult, error) {
+	ctx, span := tracing.Start(ctx, "GenerateTranslation", generationAttributes(model, language, contextCards, n)...)
+	result, err := t.Translator.TranslateCandidates(ctx, englishText, contextCards, model, language, n)
+	span.SetAttributes(usageAttributes(result.Usage)...)
+	tracing.End(span, err)
+	return result, err
+}
+
+// tracedProviders wraps the providers so each call records a span
+func tracedProviders(providers Providers) Providers {
+	return Providers{
+		Embedder:   tracedEmbedder{Embedder: providers.Embedder, model: embeddingModel},
+		Translator: tracedTranslator{Translator: providers.Translator},
+	}
+}
+
+func generationAttributes(model, language string, contextCards []rag.ContextCard, n int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("llm.model", model),
+		attribute.String("translation.language", language),
+		attribute.Int("translation.context_cards", len(contextCards)),
+		attribute.Int("translation.candidates", n),
+	}
+}
+
+func usageAttributes(usage rag.Usage) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int("llm.usage.prompt_tokens", usage.PromptTokens),
+		attribute.Int("llm.usage.completion_tokens", usage.CompletionTokens),
+		attribute.Int("llm.usage.total_tokens", usage.TotalTokens),
+	}
+}
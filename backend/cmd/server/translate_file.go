@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// maxFileRows caps the rows of an uploaded CSV, as each row is a translation
+var maxFileRows = 200
+
+// translateFileWorkers bounds the rows of one upload translated at a time
+const translateFileWorkers = 4
+
+// Defaults of the /translate/file form fields
+const (
+	defaultTextColumn = "text"
+	errorColumn       = "translation_error"
+)
+
+// fileRowResult is the outcome of translating one CSV row
+type fileRowResult struct {
+	translation string
+	err         string
+}
+
+// translateFileHandler translates a CSV uploaded as the multipart field
+// "file" (e.g. exported from Strange Eons). Each row's text column goes
+// through the same pipeline as /translate, with up to translateFileWorkers
+// rows at a time. The response is the same CSV with the translation and
+// translation_error columns added, streamed row by row in the input order.
+// It must not be wrapped in withHandlerTimeout, which buffers the response;
+// each row gets handlerTimeout instead.
+func translateFileHandler(store rag.VectorStore, providers Providers) http.HandlerFunc {
+	return corsMiddleware(requireMethod(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, codeRequestTooLarge, fmt.Sprintf("Request body too large (limit %d bytes)", tooLarge.Limit))
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("A CSV file is required in the multipart field \"file\": %v", err))
+			return
+		}
+		defer file.Close()
+
+		// The fields shared by every row, validated with the /translate rules
+		// (and a placeholder text) to apply their defaults
+		template := TranslateRequest{
+			Text:         "-",
+			Language:     r.FormValue("language"),
+			TextType:     r.FormValue("text_type"),
+			SymbolFormat: r.FormValue("symbol_format"),
+		}
+		if err := validateTranslateRequest(&template); err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		providers := providers.withSymbolFormat(template.SymbolFormat)
+		textColumn := strings.TrimSpace(r.FormValue("text_column"))
+		if textColumn == "" {
+			textColumn = defaultTextColumn
+		}
+		outputColumn := strings.TrimSpace(r.FormValue("output_column"))
+		if outputColumn == "" {
+			outputColumn = "text_" + template.Language
+		}
+
+		headers, rows, err := readTranslationCSV(file)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		textIndex, err := checkCSVHeaders(headers, textColumn, outputColumn)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		results := make([]chan fileRowResult, len(rows))
+		for i := range results {
+			results[i] = make(chan fileRowResult, 1)
+		}
+		go func() {
+			slots := make(chan struct{}, translateFileWorkers)
+			for i, row := range rows {
+				slots <- struct{}{}
+				go func(i int, text string) {
+					defer func() { <-slots }()
+					results[i] <- translateFileRow(r.Context(), store, providers, template, text)
+				}(i, row[textIndex])
+			}
+		}()
+
+		name := strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+		if name == "" || name == "." {
+			name = "cards"
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"_"+template.Language+".csv"))
+
+		flusher, _ := w.(http.Flusher)
+		writer := csv.NewWriter(w)
+		writer.Write(append(headers, outputColumn, errorColumn))
+		failed := 0
+		for i, row := range rows {
+			result := <-results[i]
+			if result.err != "" {
+				failed++
+			}
+			writer.Write(append(row, result.translation, result.err))
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err := writer.Error(); err != nil {
+			log.Printf("Error writing translated CSV: %v", err)
+		}
+		log.Printf("Translated %s: %d rows, %d failed", header.Filename, len(rows), failed)
+	}))
+}
+
+// readTranslationCSV reads the header and rows of an uploaded CSV, refusing
+// more than maxFileRows rows. A UTF-8 byte order mark (as written by Excel)
+// is dropped.
+func readTranslationCSV(file io.Reader) ([]string, [][]string, error) {
+	reader := csv.NewReader(file)
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("The CSV file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid CSV: %v", err)
+	}
+	headers[0] = strings.TrimPrefix(headers[0], "\ufeff")
+
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid CSV: %v", err)
+		}
+		if len(rows) == maxFileRows {
+			return nil, nil, fmt.Errorf("The CSV file has more than %d rows", maxFileRows)
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows, nil
+}
+
+// checkCSVHeaders returns the index of the text column (matched ignoring
+// case and surrounding spaces), checking that the columns to add don't exist
+func checkCSVHeaders(headers []string, textColumn, outputColumn string) (int, error) {
+	textIndex := -1
+	for i, column := range headers {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			return 0, fmt.Errorf("CSV column %d has no header", i+1)
+		}
+		if strings.EqualFold(column, textColumn) && textIndex < 0 {
+			textIndex = i
+		}
+		if strings.EqualFold(column, outputColumn) || strings.EqualFold(column, errorColumn) {
+			return 0, fmt.Errorf("The CSV file already has a %s column (set output_column to another name)", column)
+		}
+	}
+	if textIndex < 0 {
+		return 0, fmt.Errorf("The CSV file has no %s column (set text_column to the column holding the English text; found: %s)", textColumn, strings.Join(headers, ", "))
+	}
+	return textIndex, nil
+}
+
+// translateFileRow runs one row's text through the /translate pipeline.
+// Empty texts are left untranslated.
+func translateFileRow(ctx context.Context, store rag.VectorStore, providers Providers, template TranslateRequest, text string) fileRowResult {
+	if strings.TrimSpace(text) == "" {
+		return fileRowResult{}
+	}
+	if handlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, handlerTimeout)
+		defer cancel()
+	}
+
+	req := template
+	req.Text = text
+	contextCards, _, _, err := retrieveContext(ctx, store, providers.Embedder, req, nil)
+	if err != nil {
+		return fileRowResult{err: err.Error()}
+	}
+	result, err := providers.Translator.Translate(ctx, req.Text, contextCards, req.model, req.Language)
+	if err != nil {
+		log.Printf("Error translating CSV row: %v", err)
+		return fileRowResult{err: fmt.Sprintf("Failed to generate translation: %v", err)}
+	}
+	return fileRowResult{translation: result.Translation}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Build information, set with -ldflags at build time, e.g.
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// versionHeader carries serviceVersion on every response, to tell which
+// build produced a translation
+const versionHeader = "X-Service-Version"
+
+type VersionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// serviceVersion returns the version and commit of the build, e.g.
+// "1.4.0 (3f9a1c2)"
+func serviceVersion() string {
+	return fmt.Sprintf("%s (%s)", version, commit)
+}
+
+// withVersionHeader sets the X-Service-Version header of all responses
+func withVersionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(versionHeader, serviceVersion())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// versionHandler returns the build information
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionResponse{Version: version, Commit: commit, BuildDate: buildDate})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// warmupTimeout bounds the warmup requests together
+const warmupTimeout = time.Minute
+
+// warmupText is embedded by the warmup, short to cost next to nothing
+const warmupText = "Draw 1 card."
+
+// warmup sends one tiny embeddings request through embedder and one tiny
+// chat request through chat, so the first /translate doesn't pay for the
+// TLS handshakes of the shared OpenAI client and the models' cold start
+// (WARMUP). It runs in the background at startup; failures are logged as
+// warnings, as the requests that follow would simply be slower.
+func warmup(ctx context.Context, embedder rag.Embedder, chat func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := embedder.Embed(ctx, warmupText); err != nil {
+		log.Printf("⚠️  Warmup embeddings request failed: %v", err)
+	} else {
+		log.Printf("🔥 Embedding model warmed up in %s", time.Since(start).Round(time.Millisecond))
+	}
+
+	start = time.Now()
+	if err := chat(ctx); err != nil {
+		log.Printf("⚠️  Warmup chat request failed: %v", err)
+	} else {
+		log.Printf("🔥 Chat model warmed up in %s", time.Since(start).Round(time.Millisecond))
+	}
+}
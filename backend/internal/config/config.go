@@ -0,0 +1,681 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources a configuration value can come from, in increasing priority
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Config is the configuration shared by the server and the ingest tool
+type Config struct {
+	Database    DatabaseConfig    `yaml:"database"`
+	OpenAI      OpenAIConfig      `yaml:"openai"`
+	Server      ServerConfig      `yaml:"server"`
+	Retrieval   RetrievalConfig   `yaml:"retrieval"`
+	Translation TranslationConfig `yaml:"translation"`
+	Ingest      IngestConfig      `yaml:"ingest"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+
+	sources map[string]string // key -> source the value came from
+}
+
+// DatabaseConfig holds the PostgreSQL connection settings
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+}
+
+// OpenAIConfig holds the OpenAI API settings
+type OpenAIConfig struct {
+	APIKey         string `yaml:"api_key"`
+	EmbeddingModel string `yaml:"embedding_model"`
+	ChatModel      string `yaml:"chat_model"`
+	BaseURL        string `yaml:"base_url"`     // OpenAI-compatible API endpoint
+	Organization   string `yaml:"organization"` // Sent as OpenAI-Organization (empty omits it)
+	Project        string `yaml:"project"`      // Sent as OpenAI-Project (empty omits it)
+
+	EmbeddingMaxInput     int    `yaml:"embedding_max_input"`     // Truncate longer embedding inputs (0 disables)
+	EmbeddingTruncateUnit string `yaml:"embedding_truncate_unit"` // Unit of embedding_max_input: "tokens" or "chars"
+
+	MaxRetries     int           `yaml:"max_retries"`      // Retries of rate limited (429) or failed (5xx) calls
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay"` // Wait before the first retry, doubled on each further one
+
+	EmbeddingTimeout   time.Duration `yaml:"embedding_timeout"`   // Per attempt of an embeddings call
+	TranslationTimeout time.Duration `yaml:"translation_timeout"` // Per attempt of a chat completion call
+
+	// SkipPreflight skips the startup embeddings call validating the key and
+	// embedding model, for offline environments with a dummy key
+	SkipPreflight bool `yaml:"skip_preflight"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port           string        `yaml:"port"`
+	AdminAPIKey    string        `yaml:"admin_api_key"`   // Enables /admin endpoints when set
+	ReadTimeout    time.Duration `yaml:"read_timeout"`    // Reading the request, headers included
+	WriteTimeout   time.Duration `yaml:"write_timeout"`   // From the end of the request headers to the end of the response
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`    // Keep-alive connections
+	HandlerTimeout time.Duration `yaml:"handler_timeout"` // Deadline for translation handlers (0 disables)
+	MaxBodyBytes   int           `yaml:"max_body_bytes"`  // Largest accepted JSON request body
+	GzipMinBytes   int           `yaml:"gzip_min_bytes"`  // Gzip JSON responses at least this large (0 disables)
+	MaxFileRows    int           `yaml:"max_file_rows"`   // Rows accepted by POST /translate/file
+	// ReindexInterval rebuilds the ivfflat indexes this often, so rows added
+	// since the last build are matched reliably (0 disables)
+	ReindexInterval time.Duration `yaml:"reindex_interval"`
+	// Warmup sends a tiny embeddings and chat request at startup, so the
+	// first translation doesn't pay for the connection and model cold start
+	Warmup bool `yaml:"warmup"`
+}
+
+// RetrievalConfig holds the context retrieval settings
+type RetrievalConfig struct {
+	Rerank             string `yaml:"rerank"`              // "none", "dedupe" or "llm"
+	LanguageFallbacks  string `yaml:"language_fallbacks"`  // e.g. "de=it,en;es=it,en"
+	ReferenceLanguages string `yaml:"reference_languages"` // e.g. "it,fr": show these translations of each context card too (empty = off)
+	Metric             string `yaml:"metric"`              // "cosine", "ip" or "l2"; the ingest tool builds the indexes with it
+	FailOpen           bool   `yaml:"fail_open"`           // Translate without context when retrieval fails instead of returning an error
+	VectorStore        string `yaml:"vector_store"`        // Backend storing and searching the embeddings: "postgres"
+	// MinRows is the card_embeddings row count below which the database is
+	// assumed not (fully) ingested and a warning is logged (0 disables)
+	MinRows        int  `yaml:"min_rows"`
+	MinRowsWarning bool `yaml:"min_rows_warning"` // Also warn in /translate responses
+	// PriorityWeight ranks cards with a higher priority (see
+	// IngestConfig.CardPriorities) above closer ones; 0 orders by distance
+	PriorityWeight float64 `yaml:"priority_weight"`
+	// PackWeight ranks the cards of the pack a request prefers (prefer_pack)
+	// above closer ones of other packs; 0 ignores prefer_pack
+	PackWeight float64 `yaml:"pack_weight"`
+	// ModelMismatch handles the context cards embedded with another model
+	// than openai.embedding_model: "warn" or "filter"
+	ModelMismatch string `yaml:"model_mismatch"`
+	// BackFallback selects the context of a card back without enough back
+	// references: "front" (fronts fill in) or "none"
+	BackFallback string `yaml:"back_fallback"`
+}
+
+// TranslationConfig holds the prompt settings
+type TranslationConfig struct {
+	MaxInputChars   int  `yaml:"max_input_chars"`   // 0 disables the check
+	MaxPromptTokens int  `yaml:"max_prompt_tokens"` // 0 disables the check
+	AutoTrimContext bool `yaml:"auto_trim_context"` // Drop context cards instead of rejecting large prompts
+	// ContextTokenBudget caps the estimated tokens of the context cards,
+	// keeping the most similar ones that fit (0 disables the budget)
+	ContextTokenBudget int    `yaml:"context_token_budget"`
+	PromptTemplateDir  string `yaml:"prompt_template_dir"` // Custom system prompt templates (empty uses the embedded ones)
+	GlossaryDir        string `yaml:"glossary_dir"`        // Per-language glossaries added to the system prompt (empty disables them)
+	JSONOutput         bool   `yaml:"json_output"`         // Request structured JSON answers, falling back to plain text for models without JSON mode
+	ContextOrder       string `yaml:"context_order"`       // Context cards in the prompt: "closest-first" or "closest-last"
+	PostProcessors     string `yaml:"post_processors"`     // Output cleanup steps in order, e.g. "strip_quotes,collapse_spaces" ("none" disables them)
+	PreservedTokens    string `yaml:"preserved_tokens"`    // Extra regexps of tokens to keep verbatim, space-separated, e.g. `\{[a-z_]+\}`
+	// MatchThreshold is the similarity from which the closest context card
+	// is suggested as a translation-memory match (0 disables it)
+	MatchThreshold float64 `yaml:"match_threshold"`
+}
+
+// IngestConfig holds the data ingestion settings
+type IngestConfig struct {
+	DataDir        string `yaml:"data_dir"`        // Path to the arkhamdb-json-data directory, a .zip archive of it or an https:// archive URL
+	CardPriorities string `yaml:"card_priorities"` // Priority stored per card code prefix, e.g. "01=1,02=0.5"
+	// FieldMap reads card fields from other JSON names, for card files not
+	// following arkhamdb's schema, e.g. "text=textEn,name=title"
+	FieldMap string `yaml:"field_map"`
+}
+
+// TracingConfig holds the OpenTelemetry tracing settings
+type TracingConfig struct {
+	Endpoint    string `yaml:"otlp_endpoint"` // OTLP/HTTP collector URL (empty disables tracing)
+	ServiceName string `yaml:"service_name"`  // Service name of the exported spans
+}
+
+// Keys lists all configuration keys in display order
+var Keys = []string{
+	"database.host",
+	"database.port",
+	"database.user",
+	"database.password",
+	"database.name",
+	"openai.api_key",
+	"openai.embedding_model",
+	"openai.chat_model",
+	"openai.base_url",
+	"openai.organization",
+	"openai.project",
+	"openai.embedding_max_input",
+	"openai.embedding_truncate_unit",
+	"openai.max_retries",
+	"openai.retry_base_delay",
+	"openai.embedding_timeout",
+	"openai.translation_timeout",
+	"openai.skip_preflight",
+	"server.port",
+	"server.admin_api_key",
+	"server.read_timeout",
+	"server.write_timeout",
+	"server.idle_timeout",
+	"server.handler_timeout",
+	"server.max_body_bytes",
+	"server.gzip_min_bytes",
+	"server.max_file_rows",
+	"server.reindex_interval",
+	"server.warmup",
+	"retrieval.rerank",
+	"retrieval.language_fallbacks",
+	"retrieval.reference_languages",
+	"retrieval.metric",
+	"retrieval.fail_open",
+	"retrieval.vector_store",
+	"retrieval.min_rows",
+	"retrieval.min_rows_warning",
+	"retrieval.priority_weight",
+	"retrieval.pack_weight",
+	"retrieval.model_mismatch",
+	"retrieval.back_fallback",
+	"translation.max_input_chars",
+	"translation.max_prompt_tokens",
+	"translation.auto_trim_context",
+	"translation.context_token_budget",
+	"translation.prompt_template_dir",
+	"translation.glossary_dir",
+	"translation.json_output",
+	"translation.context_order",
+	"translation.post_processors",
+	"translation.preserved_tokens",
+	"translation.match_threshold",
+	"ingest.data_dir",
+	"ingest.card_priorities",
+	"ingest.field_map",
+	"tracing.otlp_endpoint",
+	"tracing.service_name",
+}
+
+// envVars maps configuration keys to the environment variables that override them
+var envVars = map[string]string{
+	"database.host":                    "DB_HOST",
+	"database.port":                    "DB_PORT",
+	"database.user":                    "DB_USER",
+	"database.password":                "DB_PASSWORD",
+	"database.name":                    "DB_NAME",
+	"openai.api_key":                   "OPENAI_API_KEY",
+	"openai.embedding_model":           "EMBEDDING_MODEL",
+	"openai.chat_model":                "CHAT_MODEL",
+	"openai.base_url":                  "OPENAI_BASE_URL",
+	"openai.organization":              "OPENAI_ORG",
+	"openai.project":                   "OPENAI_PROJECT",
+	"openai.embedding_max_input":       "EMBEDDING_MAX_INPUT",
+	"openai.embedding_truncate_unit":   "EMBEDDING_TRUNCATE_UNIT",
+	"openai.max_retries":               "OPENAI_MAX_RETRIES",
+	"openai.retry_base_delay":          "OPENAI_RETRY_BASE_DELAY",
+	"openai.embedding_timeout":         "EMBEDDING_TIMEOUT",
+	"openai.translation_timeout":       "TRANSLATION_TIMEOUT",
+	"openai.skip_preflight":            "SKIP_OPENAI_PREFLIGHT",
+	"server.port":                      "PORT",
+	"server.admin_api_key":             "ADMIN_API_KEY",
+	"server.read_timeout":              "READ_TIMEOUT",
+	"server.write_timeout":             "WRITE_TIMEOUT",
+	"server.idle_timeout":              "IDLE_TIMEOUT",
+	"server.handler_timeout":           "HANDLER_TIMEOUT",
+	"server.max_body_bytes":            "MAX_BODY_BYTES",
+	"server.gzip_min_bytes":            "GZIP_MIN_BYTES",
+	"server.max_file_rows":             "MAX_FILE_ROWS",
+	"server.reindex_interval":          "REINDEX_INTERVAL",
+	"server.warmup":                    "WARMUP",
+	"retrieval.rerank":                 "RERANK_MODE",
+	"retrieval.language_fallbacks":     "LANGUAGE_FALLBACKS",
+	"retrieval.reference_languages":    "REFERENCE_LANGUAGES",
+	"retrieval.metric":                 "SIMILARITY_METRIC",
+	"retrieval.fail_open":              "RETRIEVAL_FAIL_OPEN",
+	"retrieval.vector_store":           "VECTOR_STORE",
+	"retrieval.min_rows":               "MIN_EMBEDDING_ROWS",
+	"retrieval.min_rows_warning":       "MIN_ROWS_WARNING",
+	"retrieval.priority_weight":        "PRIORITY_WEIGHT",
+	"retrieval.pack_weight":            "PACK_WEIGHT",
+	"retrieval.model_mismatch":         "MODEL_MISMATCH",
+	"retrieval.back_fallback":          "BACK_FALLBACK",
+	"translation.max_input_chars":      "MAX_INPUT_CHARS",
+	"translation.max_prompt_tokens":    "MAX_PROMPT_TOKENS",
+	"translation.auto_trim_context":    "AUTO_TRIM_CONTEXT",
+	"translation.context_token_budget": "CONTEXT_TOKEN_BUDGET",
+	"translation.prompt_template_dir":  "PROMPT_TEMPLATE_DIR",
+	"translation.glossary_dir":         "GLOSSARY_DIR",
+	"translation.json_output":          "JSON_OUTPUT",
+	"translation.context_order":        "CONTEXT_ORDER",
+	"translation.post_processors":      "POST_PROCESSORS",
+	"translation.preserved_tokens":     "PRESERVED_TOKENS",
+	"translation.match_threshold":      "MATCH_THRESHOLD",
+	"ingest.data_dir":                  "ARKHAM_DATA_DIR",
+	"ingest.card_priorities":           "CARD_PRIORITIES",
+	"ingest.field_map":                 "CARD_FIELD_MAP",
+	"tracing.otlp_endpoint":            "OTEL_EXPORTER_OTLP_ENDPOINT",
+	"tracing.service_name":             "OTEL_SERVICE_NAME",
+}
+
+// secretKeys are masked when reporting values
+var secretKeys = map[string]bool{
+	"database.password":    true,
+	"openai.api_key":       true,
+	"server.admin_api_key": true,
+}
+
+// Default returns a Config populated with the built-in defaults
+func Default() *Config {
+	cfg := &Config{
+		Database: DatabaseConfig{
+			Host:     "localhost",
+			Port:     5432,
+			User:     "arkham",
+			Password: "arkham",
+			Name:     "arkham_localize",
+		},
+		OpenAI: OpenAIConfig{
+			EmbeddingModel: "text-embedding-3-small",
+			ChatModel:      "gpt-4o",
+			BaseURL:        openai.DefaultBaseURL,
+
+			EmbeddingTruncateUnit: embeddings.TruncateTokens,
+
+			MaxRetries:     3,
+			RetryBaseDelay: time.Second,
+
+			EmbeddingTimeout:   30 * time.Second,
+			TranslationTimeout: 60 * time.Second,
+		},
+		Server: ServerConfig{
+			Port:         "3001",
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 150 * time.Second,
+			IdleTimeout:  120 * time.Second,
+			// Room for an embeddings call, an LLM rerank and a GPT-4o translation
+			HandlerTimeout: 120 * time.Second,
+			MaxBodyBytes:   1 << 20, // 1 MiB, far above the largest pre-computed embedding
+			MaxFileRows:    200,
+		},
+		Retrieval: RetrievalConfig{
+			Rerank:        "none",
+			Metric:        options.MetricCosine,
+			VectorStore:   options.StorePostgres,
+			MinRows:       1, // Warn on an empty database
+			PackWeight:    options.DefaultPackWeight,
+			ModelMismatch: options.ModelMismatchWarn,
+			BackFallback:  options.BackFallbackFront,
+		},
+		Translation: TranslationConfig{
+			MaxInputChars:   4000,
+			MaxPromptTokens: 12000,
+			JSONOutput:      true,
+			ContextOrder:    options.ContextClosestFirst,
+			PostProcessors:  options.DefaultPostProcessors,
+			MatchThreshold:  0.95,
+		},
+		Ingest: IngestConfig{
+			DataDir:        ".data/arkhamdb-json-data",
+			CardPriorities: options.DefaultCardPriorities,
+		},
+		Tracing: TracingConfig{
+			ServiceName: tracing.DefaultServiceName,
+		},
+		sources: make(map[string]string),
+	}
+	for _, key := range Keys {
+		cfg.sources[key] = SourceDefault
+	}
+	return cfg
+}
+
+// Load builds a Config from the defaults, the optional YAML file at path
+// (skipped if path is empty) and the environment, in that order of priority
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, key := range Keys {
+		if value := os.Getenv(envVars[key]); value != "" {
+			if err := cfg.Set(key, value, SourceEnv); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", envVars[key], err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// loadFile overlays the values found in a YAML file. Unknown keys are
+// rejected so that typos don't go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file map[string]map[string]any
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	fields := c.fields()
+	for section, values := range file {
+		for name, value := range values {
+			key := section + "." + name
+			if _, ok := fields[key]; !ok {
+				return fmt.Errorf("unknown key %s in config file %s", key, path)
+			}
+			if value == nil {
+				continue
+			}
+			if err := c.Set(key, fmt.Sprint(value), SourceFile); err != nil {
+				return fmt.Errorf("invalid value in config file %s: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// fields maps configuration keys to pointers into the struct
+func (c *Config) fields() map[string]any {
+	return map[string]any{
+		"database.host":                    &c.Database.Host,
+		"database.port":                    &c.Database.Port,
+		"database.user":                    &c.Database.User,
+		"database.password":                &c.Database.Password,
+		"database.name":                    &c.Database.Name,
+		"openai.api_key":                   &c.OpenAI.APIKey,
+		"openai.embedding_model":           &c.OpenAI.EmbeddingModel,
+		"openai.chat_model":                &c.OpenAI.ChatModel,
+		"openai.base_url":                  &c.OpenAI.BaseURL,
+		"openai.organization":              &c.OpenAI.Organization,
+		"openai.project":                   &c.OpenAI.Project,
+		"openai.embedding_max_input":       &c.OpenAI.EmbeddingMaxInput,
+		"openai.embedding_truncate_unit":   &c.OpenAI.EmbeddingTruncateUnit,
+		"openai.max_retries":               &c.OpenAI.MaxRetries,
+		"openai.retry_base_delay":          &c.OpenAI.RetryBaseDelay,
+		"openai.embedding_timeout":         &c.OpenAI.EmbeddingTimeout,
+		"openai.translation_timeout":       &c.OpenAI.TranslationTimeout,
+		"openai.skip_preflight":            &c.OpenAI.SkipPreflight,
+		"server.port":                      &c.Server.Port,
+		"server.admin_api_key":             &c.Server.AdminAPIKey,
+		"server.read_timeout":              &c.Server.ReadTimeout,
+		"server.write_timeout":             &c.Server.WriteTimeout,
+		"server.idle_timeout":              &c.Server.IdleTimeout,
+		"server.handler_timeout":           &c.Server.HandlerTimeout,
+		"server.max_body_bytes":            &c.Server.MaxBodyBytes,
+		"server.gzip_min_bytes":            &c.Server.GzipMinBytes,
+		"server.max_file_rows":             &c.Server.MaxFileRows,
+		"server.reindex_interval":          &c.Server.ReindexInterval,
+		"server.warmup":                    &c.Server.Warmup,
+		"retrieval.rerank":                 &c.Retrieval.Rerank,
+		"retrieval.language_fallbacks":     &c.Retrieval.LanguageFallbacks,
+		"retrieval.reference_languages":    &c.Retrieval.ReferenceLanguages,
+		"retrieval.metric":                 &c.Retrieval.Metric,
+		"retrieval.fail_open":              &c.Retrieval.FailOpen,
+		"retrieval.vector_store":           &c.Retrieval.VectorStore,
+		"retrieval.min_rows":               &c.Retrieval.MinRows,
+		"retrieval.min_rows_warning":       &c.Retrieval.MinRowsWarning,
+		"retrieval.priority_weight":        &c.Retrieval.PriorityWeight,
+		"retrieval.pack_weight":            &c.Retrieval.PackWeight,
+		"retrieval.model_mismatch":         &c.Retrieval.ModelMismatch,
+		"retrieval.back_fallback":          &c.Retrieval.BackFallback,
+		"translation.max_input_chars":      &c.Translation.MaxInputChars,
+		"translation.max_prompt_tokens":    &c.Translation.MaxPromptTokens,
+		"translation.auto_trim_context":    &c.Translation.AutoTrimContext,
+		"translation.context_token_budget": &c.Translation.ContextTokenBudget,
+		"translation.prompt_template_dir":  &c.Translation.PromptTemplateDir,
+		"translation.glossary_dir":         &c.Translation.GlossaryDir,
+		"translation.json_output":          &c.Translation.JSONOutput,
+		"translation.context_order":        &c.Translation.ContextOrder,
+		"translation.post_processors":      &c.Translation.PostProcessors,
+		"translation.preserved_tokens":     &c.Translation.PreservedTokens,
+		"translation.match_threshold":      &c.Translation.MatchThreshold,
+		"ingest.data_dir":                  &c.Ingest.DataDir,
+		"ingest.card_priorities":           &c.Ingest.CardPriorities,
+		"ingest.field_map":                 &c.Ingest.FieldMap,
+		"tracing.otlp_endpoint":            &c.Tracing.Endpoint,
+		"tracing.service_name":             &c.Tracing.ServiceName,
+	}
+}
+
+// Set assigns a value to a configuration key and records its source
+func (c *Config) Set(key, value, source string) error {
+	switch field := c.fields()[key].(type) {
+	case *string:
+		*field = value
+	case *int:
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer: %q", key, value)
+		}
+		*field = intValue
+	case *float64:
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a number: %q", key, value)
+		}
+		*field = floatValue
+	case *bool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a boolean: %q", key, value)
+		}
+		*field = boolValue
+	case *time.Duration:
+		durationValue, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration such as 30s or 2m: %q", key, value)
+		}
+		*field = durationValue
+	default:
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[key] = source
+	return nil
+}
+
+// Source returns where the value of a configuration key came from
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// Validate checks that all required fields are set
+func (c *Config) Validate() error {
+	if c.OpenAI.APIKey == "" {
+		return fmt.Errorf("openai.api_key is required (set OPENAI_API_KEY or add it to the config file)")
+	}
+	if c.OpenAI.EmbeddingModel == "" {
+		return fmt.Errorf("openai.embedding_model is required")
+	}
+	if c.OpenAI.ChatModel == "" {
+		return fmt.Errorf("openai.chat_model is required")
+	}
+	if u, err := url.Parse(c.OpenAI.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("openai.base_url must be an http(s) URL, got %q", c.OpenAI.BaseURL)
+	}
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("tracing.otlp_endpoint must be an http(s) URL, got %q", c.Tracing.Endpoint)
+		}
+	}
+	if c.OpenAI.EmbeddingMaxInput < 0 {
+		return fmt.Errorf("openai.embedding_max_input must not be negative, got %d", c.OpenAI.EmbeddingMaxInput)
+	}
+	if !embeddings.ValidTruncateUnit(c.OpenAI.EmbeddingTruncateUnit) {
+		return fmt.Errorf("openai.embedding_truncate_unit must be tokens or chars, got %q", c.OpenAI.EmbeddingTruncateUnit)
+	}
+	if c.OpenAI.MaxRetries < 0 || c.OpenAI.RetryBaseDelay < 0 {
+		return fmt.Errorf("openai.max_retries and openai.retry_base_delay must not be negative")
+	}
+	if c.OpenAI.EmbeddingTimeout <= 0 || c.OpenAI.TranslationTimeout <= 0 {
+		return fmt.Errorf("openai.embedding_timeout and openai.translation_timeout must be positive")
+	}
+	if err := c.ValidateDatabase(); err != nil {
+		return err
+	}
+	if c.Server.Port == "" {
+		return fmt.Errorf("server.port is required")
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 || c.Server.HandlerTimeout < 0 {
+		return fmt.Errorf("server timeouts must not be negative")
+	}
+	if c.Server.ReindexInterval < 0 {
+		return fmt.Errorf("server.reindex_interval must not be negative, got %s", c.Server.ReindexInterval)
+	}
+	if c.Server.WriteTimeout > 0 && c.Server.HandlerTimeout >= c.Server.WriteTimeout {
+		// Otherwise the connection is cut before the handler can report the timeout
+		return fmt.Errorf("server.write_timeout (%s) must be longer than server.handler_timeout (%s)", c.Server.WriteTimeout, c.Server.HandlerTimeout)
+	}
+	if request := c.OpenAI.EmbeddingTimeout + c.OpenAI.TranslationTimeout; c.Server.WriteTimeout > 0 && c.Server.HandlerTimeout == 0 && request >= c.Server.WriteTimeout {
+		// Without a handler deadline, a slow translation outlives the
+		// connection and the client gets no response at all
+		return fmt.Errorf("server.write_timeout (%s) must be longer than openai.embedding_timeout + openai.translation_timeout (%s) when server.handler_timeout is 0; raise it or set a handler_timeout", c.Server.WriteTimeout, request)
+	}
+	if c.Server.MaxBodyBytes <= 0 {
+		return fmt.Errorf("server.max_body_bytes must be positive, got %d", c.Server.MaxBodyBytes)
+	}
+	if c.Server.GzipMinBytes < 0 {
+		return fmt.Errorf("server.gzip_min_bytes must not be negative, got %d", c.Server.GzipMinBytes)
+	}
+	if c.Server.MaxFileRows <= 0 {
+		return fmt.Errorf("server.max_file_rows must be positive, got %d", c.Server.MaxFileRows)
+	}
+	if c.Translation.MaxInputChars < 0 || c.Translation.MaxPromptTokens < 0 {
+		return fmt.Errorf("translation.max_input_chars and translation.max_prompt_tokens must not be negative")
+	}
+	if c.Translation.ContextTokenBudget < 0 {
+		return fmt.Errorf("translation.context_token_budget must not be negative, got %d", c.Translation.ContextTokenBudget)
+	}
+	if !options.Valid(c.Translation.ContextOrder, options.ContextOrders) {
+		return fmt.Errorf("translation.context_order must be one of %s, got %q", strings.Join(options.ContextOrders, ", "), c.Translation.ContextOrder)
+	}
+	if _, err := options.ParsePostProcessors(c.Translation.PostProcessors); err != nil {
+		return fmt.Errorf("translation.post_processors: %w", err)
+	}
+	if _, err := options.ParsePreservedTokens(c.Translation.PreservedTokens); err != nil {
+		return fmt.Errorf("translation.preserved_tokens: %w", err)
+	}
+	if c.Translation.MatchThreshold < 0 || c.Translation.MatchThreshold > 1 {
+		return fmt.Errorf("translation.match_threshold must be between 0 and 1, got %g", c.Translation.MatchThreshold)
+	}
+	if !options.Valid(c.Retrieval.Rerank, options.RerankModes) {
+		return fmt.Errorf("retrieval.rerank must be one of %s, got %q", strings.Join(options.RerankModes, ", "), c.Retrieval.Rerank)
+	}
+	if !options.Valid(c.Retrieval.Metric, options.Metrics) {
+		return fmt.Errorf("retrieval.metric must be one of %s, got %q", strings.Join(options.Metrics, ", "), c.Retrieval.Metric)
+	}
+	if !options.Valid(c.Retrieval.VectorStore, options.VectorStores) {
+		return fmt.Errorf("retrieval.vector_store must be one of %s, got %q", strings.Join(options.VectorStores, ", "), c.Retrieval.VectorStore)
+	}
+	if _, err := options.ParseLanguageFallbacks(c.Retrieval.LanguageFallbacks); err != nil {
+		return fmt.Errorf("retrieval.language_fallbacks: %w", err)
+	}
+	if _, err := options.ParseReferenceLanguages(c.Retrieval.ReferenceLanguages); err != nil {
+		return fmt.Errorf("retrieval.reference_languages: %w", err)
+	}
+	if c.Retrieval.MinRows < 0 {
+		return fmt.Errorf("retrieval.min_rows must not be negative, got %d", c.Retrieval.MinRows)
+	}
+	if c.Retrieval.PriorityWeight < 0 {
+		return fmt.Errorf("retrieval.priority_weight must not be negative, got %g", c.Retrieval.PriorityWeight)
+	}
+	if c.Retrieval.PackWeight < 0 {
+		return fmt.Errorf("retrieval.pack_weight must not be negative, got %g", c.Retrieval.PackWeight)
+	}
+	if !options.Valid(c.Retrieval.ModelMismatch, options.ModelMismatches) {
+		return fmt.Errorf("retrieval.model_mismatch must be one of %s, got %q", strings.Join(options.ModelMismatches, ", "), c.Retrieval.ModelMismatch)
+	}
+	if !options.Valid(c.Retrieval.BackFallback, options.BackFallbacks) {
+		return fmt.Errorf("retrieval.back_fallback must be one of %s, got %q", strings.Join(options.BackFallbacks, ", "), c.Retrieval.BackFallback)
+	}
+	if _, err := options.ParseCardPriorities(c.Ingest.CardPriorities); err != nil {
+		return fmt.Errorf("ingest.card_priorities: %w", err)
+	}
+	if _, err := options.ParseFieldMap(c.Ingest.FieldMap); err != nil {
+		return fmt.Errorf("ingest.field_map: %w", err)
+	}
+	return nil
+}
+
+// ValidateDatabase checks the database settings only, for tools that don't
+// call OpenAI
+func (c *Config) ValidateDatabase() error {
+	if c.Database.Host == "" || c.Database.User == "" || c.Database.Name == "" {
+		return fmt.Errorf("database.host, database.user and database.name are required")
+	}
+	if c.Database.Port <= 0 || c.Database.Port > 65535 {
+		return fmt.Errorf("database.port must be between 1 and 65535, got %d", c.Database.Port)
+	}
+	return nil
+}
+
+// Report returns one line per configuration key with its value and source.
+// Secret values are masked.
+func (c *Config) Report() []string {
+	fields := c.fields()
+	lines := make([]string, 0, len(Keys))
+	for _, key := range Keys {
+		value := formatValue(fields[key])
+		if secretKeys[key] && value != "" {
+			value = "****"
+		}
+		lines = append(lines, fmt.Sprintf("%s = %s (%s)", key, value, c.Source(key)))
+	}
+	return lines
+}
+
+// Changed returns the keys whose value differs in other, in Keys order
+func (c *Config) Changed(other *Config) []string {
+	fields, otherFields := c.fields(), other.fields()
+	var changed []string
+	for _, key := range Keys {
+		if formatValue(fields[key]) != formatValue(otherFields[key]) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
+// formatValue formats a field pointer of fields() as Report shows it
+func formatValue(field any) string {
+	switch v := field.(type) {
+	case *string:
+		return *v
+	case *int:
+		return strconv.Itoa(*v)
+	case *float64:
+		return strconv.FormatFloat(*v, 'g', -1, 64)
+	case *bool:
+		return strconv.FormatBool(*v)
+	case *time.Duration:
+		return v.String()
+	}
+	return ""
+}
@@ -0,0 +1,509 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	for _, envVar := range envVars {
+		t.Setenv(envVar, "")
+	}
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Database.Host != "localhost" || cfg.Database.Port != 5432 {
+		t.Errorf("Expected default database localhost:5432, got %s:%d", cfg.Database.Host, cfg.Database.Port)
+	}
+	if cfg.OpenAI.ChatModel != "gpt-4o" {
+		t.Errorf("Expected default chat model gpt-4o, got %s", cfg.OpenAI.ChatModel)
+	}
+	if source := cfg.Source("database.host"); source != SourceDefault {
+		t.Errorf("Expected source %s, got %s", SourceDefault, source)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	for _, envVar := range envVars {
+		t.Setenv(envVar, "")
+	}
+
+	path := writeConfigFile(t, `
+database:
+  host: db.internal
+  port: 6543
+openai:
+  api_key: file-key
+  embedding_model: text-embedding-3-large
+server:
+  port: "8080"
+`)
+	t.Setenv("DB_HOST", "env-host")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.Set("server.port", "9090", SourceFlag); err != nil {
+		t.Fatalf("Failed to set flag value: %v", err)
+	}
+
+	testCases := []struct {
+		key    string
+		value  string
+		source string
+	}{
+		{"database.host", "env-host", SourceEnv},
+		{"database.port", "6543", SourceFile},
+		{"database.user", "arkham", SourceDefault},
+		{"openai.embedding_model", "text-embedding-3-large", SourceFile},
+		{"server.port", "9090", SourceFlag},
+	}
+
+	report := strings.Join(cfg.Report(), "\n")
+	for _, tc := range testCases {
+		if source := cfg.Source(tc.key); source != tc.source {
+			t.Errorf("Expected %s to come from %s, got %s", tc.key, tc.source, source)
+		}
+		expectedLine := tc.key + " = " + tc.value + " (" + tc.source + ")"
+		if !strings.Contains(report, expectedLine) {
+			t.Errorf("Expected report to contain '%s', got:\n%s", expectedLine, report)
+		}
+	}
+
+	if strings.Contains(report, "file-key") {
+		t.Errorf("Report should mask the API key, got:\n%s", report)
+	}
+}
+
+func TestLoad_InvalidEnvPort(t *testing.T) {
+	t.Setenv("DB_PORT", "not-a-number")
+
+	if _, err := Load(""); err == nil {
+		t.Error("Expected error for non-integer DB_PORT, got nil")
+	}
+}
+
+func TestValidate_RequiresAPIKey(t *testing.T) {
+	cfg := Default()
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for missing API key, got nil")
+	}
+
+	cfg.OpenAI.APIKey = "test-key"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got: %v", err)
+	}
+}
+
+func TestValidate_BaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		valid   bool
+	}{
+		{"https://api.openai.com", true},
+		{"http://localhost:1234/v1", true},
+		{"localhost:1234", false},
+		{"ftp://example.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.OpenAI.BaseURL = tt.baseURL
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with base URL %q: got error %v, expected valid=%v", tt.baseURL, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_EmbeddingTruncation(t *testing.T) {
+	tests := []struct {
+		maxInput int
+		unit     string
+		valid    bool
+	}{
+		{0, "tokens", true},
+		{8000, "tokens", true},
+		{30000, "chars", true},
+		{-1, "tokens", false},
+		{8000, "words", false},
+	}
+
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.OpenAI.EmbeddingMaxInput = tt.maxInput
+		cfg.OpenAI.EmbeddingTruncateUnit = tt.unit
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with max input %d %s: got error %v, expected valid=%v", tt.maxInput, tt.unit, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_VectorStore(t *testing.T) {
+	tests := []struct {
+		store string
+		valid bool
+	}{
+		{"postgres", true},
+		{"qdrant", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Retrieval.VectorStore = tt.store
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with vector store %q: got error %v, expected valid=%v", tt.store, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_PreservedTokens(t *testing.T) {
+	for _, tt := range []struct {
+		spec  string
+		valid bool
+	}{{"", true}, {`\{[a-z_]+\} <hb:[a-z]+>`, true}, {`\{[a-z`, false}} {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Translation.PreservedTokens = tt.spec
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with preserved tokens %q: got error %v, expected valid=%v", tt.spec, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_ContextOrder(t *testing.T) {
+	tests := []struct {
+		order string
+		valid bool
+	}{
+		{"closest-first", true},
+		{"closest-last", true},
+		{"random", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Translation.ContextOrder = tt.order
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with context order %q: got error %v, expected valid=%v", tt.order, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_BackFallback(t *testing.T) {
+	for _, tt := range []struct {
+		fallback string
+		valid    bool
+	}{{"front", true}, {"none", true}, {"english", false}, {"", false}} {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Retrieval.BackFallback = tt.fallback
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with back fallback %q: got error %v, expected valid=%v", tt.fallback, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_PostProcessors(t *testing.T) {
+	for _, tt := range []struct {
+		spec  string
+		valid bool
+	}{{"strip_quotes", true}, {"strip_quotes,bracket_spacing", true}, {"none", true}, {"lowercase", false}} {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Translation.PostProcessors = tt.spec
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with post-processors %q: got error %v, expected valid=%v", tt.spec, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_ModelMismatch(t *testing.T) {
+	for _, tt := range []struct {
+		mode  string
+		valid bool
+	}{{"warn", true}, {"filter", true}, {"", false}, {"ignore", false}} {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Retrieval.ModelMismatch = tt.mode
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with model mismatch %q: got error %v, expected valid=%v", tt.mode, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_ContextTokenBudget(t *testing.T) {
+	for _, tt := range []struct {
+		budget int
+		valid  bool
+	}{{0, true}, {3000, true}, {-1, false}} {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Translation.ContextTokenBudget = tt.budget
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with context token budget %d: got error %v, expected valid=%v", tt.budget, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_MatchThreshold(t *testing.T) {
+	for _, tt := range []struct {
+		threshold float64
+		valid     bool
+	}{{0, true}, {0.95, true}, {1, true}, {-0.1, false}, {1.5, false}} {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Translation.MatchThreshold = tt.threshold
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with match threshold %g: got error %v, expected valid=%v", tt.threshold, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_OpenAITimeouts(t *testing.T) {
+	for _, tt := range []struct {
+		embedding   time.Duration
+		translation time.Duration
+		valid       bool
+	}{
+		{30 * time.Second, 60 * time.Second, true},
+		{5 * time.Minute, 2 * time.Second, true},
+		{0, 60 * time.Second, false},
+		{30 * time.Second, -time.Second, false},
+	} {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.OpenAI.EmbeddingTimeout = tt.embedding
+		cfg.OpenAI.TranslationTimeout = tt.translation
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with timeouts %s and %s: got error %v, expected valid=%v", tt.embedding, tt.translation, err, tt.valid)
+		}
+	}
+}
+
+func TestValidate_MinRows(t *testing.T) {
+	for _, tt := range []struct {
+		minRows int
+		valid   bool
+	}{{0, true}, {1000, true}, {-1, false}} {
+		cfg := Default()
+		cfg.OpenAI.APIKey = "sk-test"
+		cfg.Retrieval.MinRows = tt.minRows
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with min rows %d: got error %v, expected valid=%v", tt.minRows, err, tt.valid)
+		}
+	}
+}
+
+func TestLoad_PackWeight(t *testing.T) {
+	for _, envVar := range envVars {
+		t.Setenv(envVar, "")
+	}
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Retrieval.PackWeight != 0.1 {
+		t.Errorf("Expected default pack weight 0.1, got %g", cfg.Retrieval.PackWeight)
+	}
+
+	t.Setenv("PACK_WEIGHT", "-1")
+	if cfg, err = Load(""); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.OpenAI.APIKey = "sk-test"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "retrieval.pack_weight") {
+		t.Errorf("Expected error for a negative pack weight, got %v", err)
+	}
+}
+
+func TestLoad_PriorityWeight(t *testing.T) {
+	for _, envVar := range envVars {
+		t.Setenv(envVar, "")
+	}
+	t.Setenv("PRIORITY_WEIGHT", "0.05")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Retrieval.PriorityWeight != 0.05 {
+		t.Errorf("Expected priority weight 0.05, got %g", cfg.Retrieval.PriorityWeight)
+	}
+
+	cfg.OpenAI.APIKey = "sk-test"
+	cfg.Ingest.CardPriorities = "01"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for invalid card priorities, got nil")
+	}
+	cfg.Ingest.CardPriorities = "01=1"
+	cfg.Ingest.FieldMap = "rules=textEn"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a field map of an unknown card field, got nil")
+	}
+
+	t.Setenv("PRIORITY_WEIGHT", "high")
+	if _, err := Load(""); err == nil {
+		t.Error("Expected error for a non-numeric priority weight, got nil")
+	}
+}
+
+func TestLoad_Durations(t *testing.T) {
+	for _, envVar := range envVars {
+		t.Setenv(envVar, "")
+	}
+	t.Setenv("HANDLER_TIMEOUT", "90s")
+
+	path := writeConfigFile(t, "server:\n  write_timeout: 2m\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Server.WriteTimeout != 2*time.Minute {
+		t.Errorf("Expected write timeout 2m from file, got %s", cfg.Server.WriteTimeout)
+	}
+	if cfg.Server.HandlerTimeout != 90*time.Second {
+		t.Errorf("Expected handler timeout 90s from env, got %s", cfg.Server.HandlerTimeout)
+	}
+
+	t.Setenv("READ_TIMEOUT", "15")
+	if _, err := Load(""); err == nil {
+		t.Error("Expected error for duration without unit, got nil")
+	}
+}
+
+func TestValidate_HandlerTimeoutWithinWriteTimeout(t *testing.T) {
+	cfg := Default()
+	cfg.OpenAI.APIKey = "sk-test"
+	cfg.Server.WriteTimeout = 60 * time.Second
+	cfg.Server.HandlerTimeout = 120 * time.Second
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error when handler timeout exceeds write timeout, got nil")
+	}
+
+	cfg.Server.WriteTimeout = 0 // Disabled
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config with no write timeout, got: %v", err)
+	}
+}
+
+func TestValidate_WriteTimeoutWithoutHandlerTimeout(t *testing.T) {
+	cfg := Default()
+	cfg.OpenAI.APIKey = "sk-test"
+	cfg.Server.HandlerTimeout = 0
+	cfg.Server.WriteTimeout = 60 * time.Second // Below the 30s + 60s of one embeddings and chat attempt
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "handler_timeout is 0") {
+		t.Errorf("Expected error when a translation can outlive the write timeout, got %v", err)
+	}
+
+	cfg.Server.WriteTimeout = 150 * time.Second
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got: %v", err)
+	}
+}
+
+func TestLoad_SkipPreflight(t *testing.T) {
+	t.Setenv("SKIP_OPENAI_PREFLIGHT", "true")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.OpenAI.SkipPreflight || cfg.Source("openai.skip_preflight") != SourceEnv {
+		t.Errorf("Expected openai.skip_preflight from env, got %v (%s)", cfg.OpenAI.SkipPreflight, cfg.Source("openai.skip_preflight"))
+	}
+
+	// Used to be ignored, silently running the preflight check
+	t.Setenv("SKIP_OPENAI_PREFLIGHT", "yes please")
+	if _, err := Load(""); err == nil {
+		t.Error("Expected error for an invalid SKIP_OPENAI_PREFLIGHT, got nil")
+	}
+}
+
+func TestLoad_FileZeroAndBoolValues(t *testing.T) {
+	for _, envVar := range envVars {
+		t.Setenv(envVar, "")
+	}
+
+	path := writeConfigFile(t, `
+translation:
+  max_prompt_tokens: 0
+  auto_trim_context: true
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Translation.MaxPromptTokens != 0 || cfg.Source("translation.max_prompt_tokens") != SourceFile {
+		t.Errorf("Expected max_prompt_tokens 0 from file, got %d (%s)", cfg.Translation.MaxPromptTokens, cfg.Source("translation.max_prompt_tokens"))
+	}
+	if !cfg.Translation.AutoTrimContext {
+		t.Error("Expected auto_trim_context to be true")
+	}
+}
+
+func TestLoad_UnknownFileKey(t *testing.T) {
+	path := writeConfigFile(t, `
+database:
+  hostname: typo
+`)
+
+	if _, err := Load(path); err == nil {
+		t.Error("Expected error for unknown config key, got nil")
+	}
+}
+
+func TestKeys_HaveFieldsAndEnvVars(t *testing.T) {
+	cfg := Default()
+	fields := cfg.fields()
+	for _, key := range Keys {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("Key %s has no struct field", key)
+		}
+		if envVars[key] == "" {
+			t.Errorf("Key %s has no environment variable", key)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	cfg, other := Default(), Default()
+	if changed := cfg.Changed(other); len(changed) != 0 {
+		t.Errorf("Expected no changes between defaults, got %v", changed)
+	}
+
+	other.OpenAI.ChatModel = "gpt-4o-mini"
+	other.Server.WriteTimeout = cfg.Server.WriteTimeout * 2
+	changed := cfg.Changed(other)
+	if strings.Join(changed, ",") != "openai.chat_model,server.write_timeout" {
+		t.Errorf("Expected openai.chat_model and server.write_timeout to change, got %v", changed)
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -24,3 +25,104 @@ func Connect(host string, port int, user, password, dbName string) (*sql.DB, err
 	return db, nil
 }
 
+// EmbeddingDimensions returns the declared dimensions of the embedding
+// column of a table (the N in vector(N))
+func EmbeddingDimensions(db *sql.DB, table string) (int, error) {
+	var dimensions int
+	err := db.QueryRow(`
+		SELECT atttypmod FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attname = 'embedding'
+	`, table).Scan(&dimensions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read embedding dimensions of %s: %w", table, err)
+	}
+	return dimensions, nil
+}
+
+// IndexOpClass returns the operator class of an index's first column, e.g.
+// vector_cosine_ops. It returns sql.ErrNoRows (wrapped) if the index does
+// not exist.
+func IndexOpClass(db *sql.DB, index string) (string, error) {
+	var opClass string
+	err := db.QueryRow(`
+		SELECT opc.opcname
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_opclass opc ON opc.oid = i.indclass[0]
+		WHERE c.relname = $1
+	`, index).Scan(&opClass)
+	if err != nil {
+		return "", fmt.Errorf("failed to read operator class of %s: %w", index, err)
+	}
+	return opClass, nil
+}
+
+// EmbeddingRows returns the number of rows in card_embeddings, 0 when the
+// table does not exist yet
+func EmbeddingRows(ctx context.Context, db *sql.DB) (int, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('card_embeddings') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, fmt.Errorf("failed to look up card_embeddings: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var rows int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM card_embeddings").Scan(&rows); err != nil {
+		return 0, fmt.Errorf("failed to count card_embeddings rows: %w", err)
+	}
+	return rows, nil
+}
+
+// EmbeddingModels returns the distinct embedding models of the
+// card_embeddings rows, "" standing for the rows of an unknown model, and
+// none when the table does not exist yet
+func EmbeddingModels(ctx context.Context, db *sql.DB) ([]string, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('card_embeddings') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up card_embeddings: %w", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT COALESCE(embedding_model, '') FROM card_embeddings ORDER BY 1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the embedding models: %w", err)
+	}
+	defer rows.Close()
+	var models []string
+	for rows.Next() {
+		var model string
+		if err := rows.Scan(&model); err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+	return models, rows.Err()
+}
+
+// EmbeddingIndexes are the ivfflat indexes of the embedding columns
+var EmbeddingIndexes = []string{"card_embeddings_embedding_idx", "card_translations_embedding_idx"}
+
+// ReindexEmbeddings rebuilds the EmbeddingIndexes that exist with REINDEX
+// and returns their names. The ivfflat clusters are computed when an index
+// is built, so rows added since then are matched less reliably until it is
+// rebuilt. REINDEX blocks writes to the table and queries using the index
+// while it runs.
+func ReindexEmbeddings(ctx context.Context, db *sql.DB) ([]string, error) {
+	var reindexed []string
+	for _, index := range EmbeddingIndexes {
+		var exists bool
+		if err := db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", index).Scan(&exists); err != nil {
+			return reindexed, fmt.Errorf("failed to look up %s: %w", index, err)
+		}
+		if !exists {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "REINDEX INDEX "+index); err != nil {
+			return reindexed, fmt.Errorf("failed to reindex %s: %w", index, err)
+		}
+		reindexed = append(reindexed, index)
+	}
+	return reindexed, nil
+}
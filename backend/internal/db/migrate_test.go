@@ -0,0 +1,61 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != 1 {
+		t.Fatalf("Expected migrations starting at version 1, got %+v", migrations)
+	}
+	if !strings.Contains(migrations[0].SQL, "CREATE TABLE IF NOT EXISTS card_embeddings") {
+		t.Errorf("Expected the initial migration to create card_embeddings")
+	}
+}
+
+func TestLoadMigrations_Order(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0010_later.sql":  {Data: []byte("SELECT 10;")},
+		"migrations/0002_second.sql": {Data: []byte("SELECT 2;")},
+		"migrations/0001_first.sql":  {Data: []byte("SELECT 1;")},
+	}
+
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []int{1, 2, 10}
+	for i, migration := range migrations {
+		if migration.Version != expected[i] {
+			t.Errorf("Expected version %d at position %d, got %d", expected[i], i, migration.Version)
+		}
+	}
+	if migrations[1].Name != "second" {
+		t.Errorf("Expected name 'second', got %s", migrations[1].Name)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	testCases := map[string]fstest.MapFS{
+		"NoVersion": {"migrations/initial.sql": {Data: []byte("")}},
+		"Duplicate": {
+			"migrations/0001_a.sql": {Data: []byte("")},
+			"migrations/1_b.sql":    {Data: []byte("")},
+		},
+	}
+
+	for name, fsys := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadMigrations(fsys); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+-- Initial schema. Statements are idempotent so that databases created before
+-- migrations were tracked can adopt this version as is.
+
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE IF NOT EXISTS card_embeddings (
+	id SERIAL PRIMARY KEY,
+	card_code TEXT NOT NULL,
+	card_name TEXT NOT NULL,
+	is_back BOOLEAN DEFAULT FALSE,
+	english_text TEXT NOT NULL,
+	it_text TEXT,
+	fr_text TEXT,
+	de_text TEXT,
+	es_text TEXT,
+	embedding vector(1536),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS card_embeddings_embedding_idx
+	ON card_embeddings
+	USING ivfflat (embedding vector_cosine_ops)
+	WITH (lists = 100);
+
+-- Per-language embeddings of the translated text, for target-language retrieval
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS it_embedding vector(1536);
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS fr_embedding vector(1536);
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS de_embedding vector(1536);
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS es_embedding vector(1536);
+
+-- Rules text or flavor text; retrieval only matches entries of the requested type
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS text_type TEXT NOT NULL DEFAULT 'rules';
+
+CREATE INDEX IF NOT EXISTS card_embeddings_card_code_idx ON card_embeddings(card_code);
+CREATE INDEX IF NOT EXISTS card_embeddings_card_name_idx ON card_embeddings(card_name);
+CREATE INDEX IF NOT EXISTS card_embeddings_is_back_idx ON card_embeddings(is_back);
+
+CREATE INDEX IF NOT EXISTS card_embeddings_it_embedding_idx
+	ON card_embeddings USING ivfflat (it_embedding vector_cosine_ops) WITH (lists = 100);
+CREATE INDEX IF NOT EXISTS card_embeddings_fr_embedding_idx
+	ON card_embeddings USING ivfflat (fr_embedding vector_cosine_ops) WITH (lists = 100);
+CREATE INDEX IF NOT EXISTS card_embeddings_de_embedding_idx
+	ON card_embeddings USING ivfflat (de_embedding vector_cosine_ops) WITH (lists = 100);
+CREATE INDEX IF NOT EXISTS card_embeddings_es_embedding_idx
+	ON card_embeddings USING ivfflat (es_embedding vector_cosine_ops) WITH (lists = 100);
+
+-- Hashes of the processed source files, for incremental ingest
+CREATE TABLE IF NOT EXISTS source_files (
+	path TEXT PRIMARY KEY,
+	hash TEXT NOT NULL,
+	ingested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
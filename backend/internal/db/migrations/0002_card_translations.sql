@@ -0,0 +1,52 @@
+-- Store translations as one row per language, so that supporting a new
+-- language needs no schema change. card_embeddings keeps the English text
+-- and embedding; translations are joined on (card_code, is_back, text_type).
+
+CREATE TABLE IF NOT EXISTS card_translations (
+	card_code TEXT NOT NULL,
+	is_back BOOLEAN NOT NULL DEFAULT FALSE,
+	text_type TEXT NOT NULL DEFAULT 'rules',
+	language TEXT NOT NULL,
+	text TEXT NOT NULL,
+	embedding vector(1536), -- Only set when ingested with -embed-translations
+	PRIMARY KEY (card_code, is_back, text_type, language)
+);
+
+INSERT INTO card_translations (card_code, is_back, text_type, language, text, embedding)
+SELECT card_code, COALESCE(is_back, FALSE), text_type, 'it', it_text, it_embedding
+FROM card_embeddings WHERE it_text IS NOT NULL AND it_text <> ''
+ON CONFLICT DO NOTHING;
+
+INSERT INTO card_translations (card_code, is_back, text_type, language, text, embedding)
+SELECT card_code, COALESCE(is_back, FALSE), text_type, 'fr', fr_text, fr_embedding
+FROM card_embeddings WHERE fr_text IS NOT NULL AND fr_text <> ''
+ON CONFLICT DO NOTHING;
+
+INSERT INTO card_translations (card_code, is_back, text_type, language, text, embedding)
+SELECT card_code, COALESCE(is_back, FALSE), text_type, 'de', de_text, de_embedding
+FROM card_embeddings WHERE de_text IS NOT NULL AND de_text <> ''
+ON CONFLICT DO NOTHING;
+
+INSERT INTO card_translations (card_code, is_back, text_type, language, text, embedding)
+SELECT card_code, COALESCE(is_back, FALSE), text_type, 'es', es_text, es_embedding
+FROM card_embeddings WHERE es_text IS NOT NULL AND es_text <> ''
+ON CONFLICT DO NOTHING;
+
+-- Dropping the columns also drops their per-language indexes
+ALTER TABLE card_embeddings
+	DROP COLUMN IF EXISTS it_text,
+	DROP COLUMN IF EXISTS fr_text,
+	DROP COLUMN IF EXISTS de_text,
+	DROP COLUMN IF EXISTS es_text,
+	DROP COLUMN IF EXISTS it_embedding,
+	DROP COLUMN IF EXISTS fr_embedding,
+	DROP COLUMN IF EXISTS de_embedding,
+	DROP COLUMN IF EXISTS es_embedding;
+
+CREATE INDEX IF NOT EXISTS card_embeddings_card_key_idx
+	ON card_embeddings(card_code, is_back, text_type);
+
+CREATE INDEX IF NOT EXISTS card_translations_embedding_idx
+	ON card_translations
+	USING ivfflat (embedding vector_cosine_ops)
+	WITH (lists = 100);
@@ -0,0 +1,9 @@
+-- Track the model that produced each embedding, so that switching embedding
+-- models can re-embed the stale rows (resumably) with the ingest tool's
+-- -reembed flag or POST /admin/reembed. Existing rows have an unknown model.
+
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+ALTER TABLE card_translations ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+
+-- Lets translations be processed in id order like card_embeddings
+ALTER TABLE card_translations ADD COLUMN IF NOT EXISTS id BIGSERIAL;
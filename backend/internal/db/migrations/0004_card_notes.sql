@@ -0,0 +1,13 @@
+-- Optional translation hints for context cards, e.g. why an official
+-- translation departs from a literal rendering after an errata. Written by
+-- hand; when a retrieved card has a note, it is shown under the card in the
+-- prompt. An empty language applies to every target language.
+
+CREATE TABLE IF NOT EXISTS card_notes (
+	card_code TEXT NOT NULL,
+	is_back BOOLEAN NOT NULL DEFAULT FALSE,
+	text_type TEXT NOT NULL DEFAULT 'rules',
+	language TEXT NOT NULL DEFAULT '',
+	note TEXT NOT NULL,
+	PRIMARY KEY (card_code, is_back, text_type, language)
+);
@@ -0,0 +1,4 @@
+-- Priority of each card entry (e.g. 1 for the core set, whose translations
+-- are the canonical terminology), set by the ingest tool from CARD_PRIORITIES.
+-- Retrieval subtracts PRIORITY_WEIGHT times it from the vector distance.
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS priority REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- ArkhamDB type (asset, event, treachery, ...) and faction (guardian,
+-- neutral, mythos, ...) of each card entry, set by the ingest tool. Retrieval
+-- can be restricted to them, e.g. to translate an asset using other assets.
+-- Empty for entries ingested before these columns existed.
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS type_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS faction_code TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS card_embeddings_type_code_idx ON card_embeddings(type_code);
+CREATE INDEX IF NOT EXISTS card_embeddings_faction_code_idx ON card_embeddings(faction_code);
@@ -0,0 +1,8 @@
+-- ArkhamDB encounter set of each card entry (e.g. "the_gathering"), empty
+-- for player cards. Scenario, act, agenda, location and story cards all come
+-- from the *_encounter.json pack files and carry one, so retrieval can be
+-- restricted to encounter text. Empty for entries ingested before this
+-- column existed.
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS encounter_code TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS card_embeddings_encounter_code_idx ON card_embeddings(encounter_code);
@@ -0,0 +1,4 @@
+-- ArkhamDB pack of each card entry (e.g. "core", "dwl"), so retrieval can
+-- prefer the references of the pack being translated. Empty for entries
+-- ingested before this column existed.
+ALTER TABLE card_embeddings ADD COLUMN IF NOT EXISTS pack_code TEXT NOT NULL DEFAULT '';
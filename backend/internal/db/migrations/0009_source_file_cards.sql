@@ -0,0 +1,4 @@
+-- Card codes read from each source file, so that an incremental ingest can
+-- delete the entries of cards whose file was removed or that left a changed
+-- file. Empty for files recorded before this column existed.
+ALTER TABLE source_files ADD COLUMN IF NOT EXISTS card_codes TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Page selects one page of a listing in id order (keyset pagination): up to
+// Limit rows with an id above After, 0 for the first page. Unlike an
+// offset, the cursor stays valid when rows are added or removed between
+// pages.
+type Page struct {
+	Limit int
+	After int64
+}
+
+// PageInfo describes a page of a listing: the number of rows across all
+// pages and the cursor of the next page, empty on the last one
+type PageInfo struct {
+	Total int    `json:"total"`
+	Next  string `json:"next,omitempty"`
+}
+
+// Cursor returns the cursor of the page after the row with this id
+func Cursor(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// ParseCursor returns the Page.After of a cursor returned in PageInfo.Next,
+// 0 for an empty cursor (the first page)
+func ParseCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return id, nil
+}
+
+// QueryPage runs query, a SELECT whose first column is the row id and whose
+// arguments are args, for one page of its rows, in id order. It fetches one
+// row more than page.Limit to tell whether there is a next page (see
+// Paginate), and returns the number of rows of query across all pages.
+func QueryPage(ctx context.Context, db *sql.DB, query string, page Page, args ...any) (*sql.Rows, int, error) {
+	query = strings.TrimSpace(query)
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+query+") AS listing", args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+
+	n := len(args)
+	paged := fmt.Sprintf("SELECT * FROM (%s) AS listing WHERE listing.id > $%d ORDER BY listing.id LIMIT $%d", query, n+1, n+2)
+	rows, err := db.QueryContext(ctx, paged, append(args, page.After, page.Limit+1)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query page: %w", err)
+	}
+	return rows, total, nil
+}
+
+// Paginate trims the rows read from QueryPage to page.Limit and describes
+// the page; id returns the id of a row
+func Paginate[T any](page Page, total int, rows []T, id func(T) int64) ([]T, PageInfo) {
+	info := PageInfo{Total: total}
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+		info.Next = Cursor(id(rows[len(rows)-1]))
+	}
+	return rows, info
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		cursor   string
+		expected int64
+		valid    bool
+	}{
+		{"", 0, true},
+		{"42", 42, true},
+		{Cursor(1234), 1234, true},
+		{"-1", 0, false},
+		{"abc", 0, false},
+	}
+	for _, tt := range tests {
+		after, err := ParseCursor(tt.cursor)
+		if (err == nil) != tt.valid {
+			t.Errorf("cursor %q: expected valid=%v, got %v", tt.cursor, tt.valid, err)
+		}
+		if after != tt.expected {
+			t.Errorf("cursor %q: expected %d, got %d", tt.cursor, tt.expected, after)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	id := func(row int64) int64 { return row }
+
+	testCases := []struct {
+		name         string
+		rows         []int64
+		expectedRows []int64
+		expectedNext string
+	}{
+		{"Empty", nil, nil, ""},
+		{"LastPage", []int64{3, 5}, []int64{3, 5}, ""},
+		{"FullLastPage", []int64{3, 5, 8}, []int64{3, 5, 8}, ""},
+		{"NextPage", []int64{3, 5, 8, 13}, []int64{3, 5, 8}, "8"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rows, info := Paginate(Page{Limit: 3}, 10, tc.rows, id)
+			if !reflect.DeepEqual(rows, tc.expectedRows) {
+				t.Errorf("Expected rows %v, got %v", tc.expectedRows, rows)
+			}
+			if info.Next != tc.expectedNext {
+				t.Errorf("Expected next %q, got %q", tc.expectedNext, info.Next)
+			}
+			if info.Total != 10 {
+				t.Errorf("Expected total 10, got %d", info.Total)
+			}
+		})
+	}
+}
@@ -1,17 +1,77 @@
 package embeddings
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"log"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+// Dimensions is the embedding size stored in the database. The server reads
+// it from the schema at startup; it changes when re-embedding with a model
+// of another size.
+var Dimensions = 1536
+
+// Units of MaxInput
+const (
+	TruncateChars  = "chars"
+	TruncateTokens = "tokens" // Estimated at about 4 characters per token
 )
 
-// GetEmbedding generates an embedding for the given text using OpenAI API
+// MaxInput caps the length of embedded texts, in TruncateUnit: longer texts
+// are truncated (and logged) rather than rejected by the API. 0 disables
+// truncation, so oversized texts fail.
+var (
+	MaxInput     = 0
+	TruncateUnit = TruncateTokens
+)
+
+// Timeout bounds each attempt of an embeddings call; set at startup
+var Timeout = 30 * time.Second
+
+// ValidTruncateUnit reports whether unit is a supported unit of MaxInput
+func ValidTruncateUnit(unit string) bool {
+	return unit == TruncateChars || unit == TruncateTokens
+}
+
+// truncateInput cuts text to MaxInput on a character boundary, reporting
+// whether it did
+func truncateInput(text string) (string, bool) {
+	if MaxInput <= 0 {
+		return text, false
+	}
+	maxChars := MaxInput
+	if TruncateUnit == TruncateTokens {
+		maxChars = MaxInput * 4
+	}
+	if utf8.RuneCountInString(text) <= maxChars {
+		return text, false
+	}
+	return strings.TrimSpace(string([]rune(text)[:maxChars])), true
+}
+
+// GetEmbedding generates an embedding for the given text using OpenAI API;
+// texts longer than MaxInput are truncated first. Rate limits and server
+// errors are retried (see openai.WithRetry).
 func GetEmbedding(text, apiKey, model string) ([]float32, error) {
-	url := "https://api.openai.com/v1/embeddings"
+	return GetEmbeddingContext(context.Background(), text, apiKey, model)
+}
+
+// GetEmbeddingContext is GetEmbedding giving up when ctx is done, retries
+// included
+func GetEmbeddingContext(ctx context.Context, text, apiKey, model string) ([]float32, error) {
+	url := openai.URL("/v1/embeddings")
+
+	if truncated, ok := truncateInput(text); ok {
+		log.Printf("Truncated embedding input from %d to %d characters (max %d %s): %.40q...",
+			utf8.RuneCountInString(text), utf8.RuneCountInString(truncated), MaxInput, TruncateUnit, text)
+		text = truncated
+	}
 
 	reqBody := struct {
 		Model string `json:"model"`
@@ -26,34 +86,17 @@ func GetEmbedding(text, apiKey, model string) ([]float32, error) {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("OpenAI API error: %s - %s", resp.Status, string(body))
-	}
-
 	var result struct {
 		Data []struct {
 			Embedding []float64 `json:"embedding"`
 		} `json:"data"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err = openai.WithRetry(ctx, func() error {
+		return openai.PostJSON(ctx, url, apiKey, jsonData, Timeout, &result)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	if len(result.Data) == 0 {
@@ -68,4 +111,3 @@ func GetEmbedding(text, apiKey, model string) ([]float32, error) {
 
 	return embedding, nil
 }
-
@@ -0,0 +1,64 @@
+package embeddings
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+func TestTruncateInput(t *testing.T) {
+	defer func(maxInput int, unit string) { MaxInput, TruncateUnit = maxInput, unit }(MaxInput, TruncateUnit)
+
+	tests := []struct {
+		maxInput  int
+		unit      string
+		text      string
+		expected  string
+		truncated bool
+	}{
+		{0, TruncateTokens, strings.Repeat("a", 100), strings.Repeat("a", 100), false},
+		{5, TruncateChars, "Città di Arkham", "Città", true},
+		{5, TruncateChars, "Draw", "Draw", false},
+		{2, TruncateTokens, "Draw 1 card. Discover 1 clue.", "Draw 1 c", true},
+		{2, TruncateTokens, "Draw 1 c", "Draw 1 c", false},
+	}
+
+	for _, tt := range tests {
+		MaxInput, TruncateUnit = tt.maxInput, tt.unit
+		text, truncated := truncateInput(tt.text)
+		if text != tt.expected || truncated != tt.truncated {
+			t.Errorf("truncateInput(%q) with max %d %s: got %q (%v), expected %q (%v)",
+				tt.text, tt.maxInput, tt.unit, text, truncated, tt.expected, tt.truncated)
+		}
+	}
+}
+
+func TestGetEmbedding_TruncatesInput(t *testing.T) {
+	defer func(maxInput int, unit string) { MaxInput, TruncateUnit = maxInput, unit }(MaxInput, TruncateUnit)
+	defer func(base string) { openai.BaseURL = base }(openai.BaseURL)
+
+	var input string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		input = req.Input
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2]}]}`))
+	}))
+	defer server.Close()
+	openai.BaseURL = server.URL
+
+	MaxInput, TruncateUnit = 10, TruncateChars
+	if _, err := GetEmbedding("Investigate. You get +2 [intellect] for this investigation.", "test-key", "text-embedding-3-small"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if input != "Investigat" {
+		t.Errorf("Expected the truncated input to be sent, got %q", input)
+	}
+}
@@ -0,0 +1,36 @@
+package embeddings
+
+import "fmt"
+
+// ModelDimensions maps the known embedding models to the size of their
+// embeddings, for when no probe embedding is available. Models missing here
+// (e.g. on OpenAI-compatible servers) can only be checked with a probe.
+var ModelDimensions = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+	"text-embedding-ada-002": 1536,
+}
+
+// ExpectedDimensions returns the embedding size of model: probed (the length
+// of an embedding the model returned, 0 if none) or else the registered one.
+// ok is false when neither is available.
+func ExpectedDimensions(model string, probed int) (dimensions int, ok bool) {
+	if probed > 0 {
+		return probed, true
+	}
+	dimensions, ok = ModelDimensions[model]
+	return dimensions, ok
+}
+
+// CheckDimensions reports an error when the embeddings of model can't be
+// stored in (or compared with) a vector column of columnDimensions. probed is
+// as in ExpectedDimensions; a model of unknown size passes.
+func CheckDimensions(model string, probed, columnDimensions int) error {
+	expected, ok := ExpectedDimensions(model, probed)
+	if !ok || expected == columnDimensions {
+		return nil
+	}
+	return fmt.Errorf("embedding model %s produces %d-dimensional embeddings but the database stores %d; "+
+		"re-embed the cards with the new model (go run ./cmd/ingest -reembed) or set EMBEDDING_MODEL back to a %d-dimensional model",
+		model, expected, columnDimensions, columnDimensions)
+}
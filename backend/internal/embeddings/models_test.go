@@ -0,0 +1,35 @@
+package embeddings
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDimensions(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   string
+		probed  int
+		column  int
+		wantErr bool
+	}{
+		{"KnownMatch", "text-embedding-3-small", 0, 1536, false},
+		{"KnownMismatch", "text-embedding-3-large", 0, 1536, true},
+		{"UnknownUnprobed", "nomic-embed-text", 0, 1536, false},
+		{"UnknownProbedMatch", "nomic-embed-text", 768, 768, false},
+		{"UnknownProbedMismatch", "nomic-embed-text", 768, 1536, true},
+		{"ProbeOverridesRegistry", "text-embedding-3-large", 1536, 1536, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckDimensions(tt.model, tt.probed, tt.column)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "-reembed") {
+				t.Errorf("Expected the error to explain how to fix it, got: %v", err)
+			}
+		})
+	}
+}
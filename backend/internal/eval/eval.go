@@ -0,0 +1,244 @@
+// Package eval measures translation quality by translating cards that have
+// an official translation and comparing the output with it
+package eval
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// Sample is an ingested card entry with its official translation
+type Sample struct {
+	CardCode    string
+	CardName    string
+	IsBack      bool
+	EnglishText string
+	Official    string    // Official translation in the evaluated language
+	Embedding   []float32 // Stored embedding of EnglishText, reused for retrieval
+}
+
+// LoadSample picks up to size entries of textType with an official
+// translation in language. The order is a hash of the card code and seed, so
+// runs with the same seed evaluate the same cards while prompts or models
+// change.
+func LoadSample(db *sql.DB, language, textType string, size int, seed int64) ([]Sample, error) {
+	rows, err := db.Query(`
+		SELECT e.card_code, e.card_name, e.is_back, e.english_text, t.text, e.embedding
+		FROM card_embeddings e
+		JOIN card_translations t
+			ON t.card_code = e.card_code AND t.is_back = e.is_back AND t.text_type = e.text_type
+		WHERE t.language = $1 AND e.text_type = $2 AND e.embedding IS NOT NULL AND t.text <> ''
+		ORDER BY md5(e.card_code || e.is_back::text || $3::text)
+		LIMIT $4`, language, textType, seed, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sample: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []Sample
+	for rows.Next() {
+		var sample Sample
+		var embedding pgvector.Vector
+		if err := rows.Scan(&sample.CardCode, &sample.CardName, &sample.IsBack, &sample.EnglishText, &sample.Official, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan sample: %w", err)
+		}
+		sample.Embedding = embedding.Slice()
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return samples, nil
+}
+
+// ExcludeSelf drops the context cards that would leak the answer: the
+// sampled card itself and any reprint with the same English text
+func ExcludeSelf(cards []rag.ContextCard, sample Sample) []rag.ContextCard {
+	kept := make([]rag.ContextCard, 0, len(cards))
+	for _, card := range cards {
+		if card.CardCode == sample.CardCode || normalize(card.EnglishText) == normalize(sample.EnglishText) {
+			continue
+		}
+		kept = append(kept, card)
+	}
+	return kept
+}
+
+// Result is the evaluation of one sampled card
+type Result struct {
+	CardCode       string   `json:"card_code"`
+	CardName       string   `json:"card_name"`
+	IsBack         bool     `json:"is_back"`
+	EnglishText    string   `json:"english_text"`
+	Official       string   `json:"official"`
+	Translation    string   `json:"translation,omitempty"`
+	ContextCards   int      `json:"context_cards"`
+	ExactMatch     bool     `json:"exact_match"`
+	MissingSymbols []string `json:"missing_symbols,omitempty"` // Symbols and tags of the English text the translation dropped
+	Similarity     float64  `json:"similarity"`                // Character edit similarity to the official translation (1 = identical)
+	Error          string   `json:"error,omitempty"`
+}
+
+// Score compares a generated translation with the official one
+func Score(sample Sample, translation string) Result {
+	return Result{
+		CardCode:       sample.CardCode,
+		CardName:       sample.CardName,
+		IsBack:         sample.IsBack,
+		EnglishText:    sample.EnglishText,
+		Official:       sample.Official,
+		Translation:    translation,
+		ExactMatch:     normalize(translation) == normalize(sample.Official),
+		MissingSymbols: rag.MissingSymbols(sample.EnglishText, translation),
+		Similarity:     EditSimilarity(normalize(translation), normalize(sample.Official)),
+	}
+}
+
+// Options configure Run
+type Options struct {
+	Language     string
+	TextType     string
+	Model        string
+	ContextLimit int // Context cards per prompt, as in the server
+	Rerank       string
+	APIKey       string // For the llm rerank mode
+	// Progress, if set, is called after each card
+	Progress func(done, total int, result Result)
+}
+
+// Run translates each sample with the translator, using context retrieved
+// from store without the sample itself, and scores the output. A failed card
+// is recorded in its Result and does not stop the run.
+func Run(ctx context.Context, store rag.VectorStore, translator rag.Translator, samples []Sample, opts Options) []Result {
+	results := make([]Result, 0, len(samples))
+	for i, sample := range samples {
+		result := runSample(ctx, store, translator, sample, opts)
+		results = append(results, result)
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(samples), result)
+		}
+	}
+	return results
+}
+
+func runSample(ctx context.Context, store rag.VectorStore, translator rag.Translator, sample Sample, opts Options) Result {
+	failed := func(err error) Result {
+		result := Score(sample, "")
+		result.Error = err.Error()
+		return result
+	}
+
+	// Over-fetch so the excluded cards (and deduplication) don't leave slots empty
+	cards, err := rag.RetrieveContext(ctx, store, rag.SearchQuery{
+		Embedding:          sample.Embedding,
+		Limit:              opts.ContextLimit*2 + 2,
+		Language:           opts.Language,
+		TextType:           opts.TextType,
+		ReferenceLanguages: rag.ReferenceLanguages,
+		IsBack:             sample.IsBack,
+	})
+	if err != nil {
+		return failed(err)
+	}
+	cards = ExcludeSelf(cards, sample)
+	cards, _ = rag.RerankCards(sample.EnglishText, cards, opts.ContextLimit, opts.Rerank, opts.APIKey, opts.Model) // Falls back to the deduplicated order
+	if sample.IsBack {
+		cards = rag.PreferSide(cards, true)
+	}
+	cards = rag.BudgetContextCards(cards, opts.Language, rag.ContextTokenBudget)
+	cards, err = rag.FitContextCards(sample.EnglishText, cards, opts.Language)
+	if err != nil {
+		return failed(err)
+	}
+
+	translation, err := translator.Translate(ctx, sample.EnglishText, cards, opts.Model, opts.Language)
+	if err != nil {
+		return failed(err)
+	}
+	result := Score(sample, translation.Translation)
+	result.ContextCards = len(cards)
+	return result
+}
+
+// Report summarizes the results of a run
+type Report struct {
+	Cards      int `json:"cards"`
+	Translated int `json:"translated"`
+	Failed     int `json:"failed"`
+	// Rates and the mean are over the translated cards
+	ExactMatchRate         float64 `json:"exact_match_rate"`
+	SymbolPreservationRate float64 `json:"symbol_preservation_rate"` // Translations that kept every symbol and tag
+	MeanSimilarity         float64 `json:"mean_similarity"`
+}
+
+// Summarize computes the report of a run
+func Summarize(results []Result) Report {
+	report := Report{Cards: len(results)}
+	var exact, preserved int
+	var similarity float64
+	for _, result := range results {
+		if result.Error != "" {
+			report.Failed++
+			continue
+		}
+		report.Translated++
+		if result.ExactMatch {
+			exact++
+		}
+		if len(result.MissingSymbols) == 0 {
+			preserved++
+		}
+		similarity += result.Similarity
+	}
+	if report.Translated > 0 {
+		n := float64(report.Translated)
+		report.ExactMatchRate = float64(exact) / n
+		report.SymbolPreservationRate = float64(preserved) / n
+		report.MeanSimilarity = similarity / n
+	}
+	return report
+}
+
+// normalize collapses whitespace so layout differences don't count as errors
+func normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// EditSimilarity returns 1 minus the Levenshtein distance between a and b
+// (in characters) divided by the length of the longer one: 1 for identical
+// texts, 0 for texts with nothing in common
+func EditSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the edit distance between a and b, keeping two rows
+// of the dynamic programming table
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,129 @@
+package eval
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+	"github.com/ventrosky/arkham-localize/backend/internal/ragtest"
+	"github.com/ventrosky/arkham-localize/backend/internal/testdb"
+)
+
+func TestEditSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"", "", 1},
+		{"Pesca 1 carta.", "Pesca 1 carta.", 1},
+		{"abc", "xyz", 0},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"città", "citta", 0.8}, // Counted in characters, not bytes
+	}
+
+	for _, tt := range tests {
+		if got := EditSimilarity(tt.a, tt.b); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("EditSimilarity(%q, %q) = %f, expected %f", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	sample := Sample{
+		CardCode:    "01020",
+		EnglishText: "[action]: <b>Fight.</b> You get +1 [combat] for this attack.",
+		Official:    "[action]: <b>Combatti.</b> Ricevi +1 [combat] in questo attacco.",
+	}
+
+	exact := Score(sample, "[action]: <b>Combatti.</b>  Ricevi +1 [combat]\nin questo attacco.")
+	if !exact.ExactMatch || exact.Similarity != 1 || len(exact.MissingSymbols) != 0 {
+		t.Errorf("Expected an exact match ignoring whitespace, got %+v", exact)
+	}
+
+	dropped := Score(sample, "[action]: <b>Combatti.</b> Ricevi +1 in questo attacco.")
+	if dropped.ExactMatch || dropped.Similarity >= 1 || len(dropped.MissingSymbols) != 1 {
+		t.Errorf("Expected a partial match missing [combat], got %+v", dropped)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []Result{
+		{ExactMatch: true, Similarity: 1},
+		{Similarity: 0.5, MissingSymbols: []string{"[combat]"}},
+		{Error: "OpenAI rate limit exceeded"},
+	}
+
+	report := Summarize(results)
+	if report.Cards != 3 || report.Translated != 2 || report.Failed != 1 {
+		t.Errorf("Expected 3 cards, 2 translated and 1 failed, got %+v", report)
+	}
+	if report.ExactMatchRate != 0.5 || report.SymbolPreservationRate != 0.5 || report.MeanSimilarity != 0.75 {
+		t.Errorf("Expected rates over the translated cards only, got %+v", report)
+	}
+
+	if empty := Summarize(nil); empty.MeanSimilarity != 0 || empty.Cards != 0 {
+		t.Errorf("Expected an empty report, got %+v", empty)
+	}
+}
+
+func TestExcludeSelf(t *testing.T) {
+	sample := Sample{CardCode: "01020", EnglishText: "Draw 1 card."}
+	cards := []rag.ContextCard{
+		{CardCode: "01020", EnglishText: "Draw 1 card."},
+		{CardCode: "50001", EnglishText: "Draw  1 card."}, // Reprint
+		{CardCode: "01030", EnglishText: "Draw 2 cards."},
+	}
+
+	kept := ExcludeSelf(cards, sample)
+	if len(kept) != 1 || kept[0].CardCode != "01030" {
+		t.Errorf("Expected only 01030 to be kept, got %+v", kept)
+	}
+}
+
+func TestRun_Container(t *testing.T) {
+	database := testdb.Start(t)
+
+	testdb.InsertCard(t, database, "01020", "Machete", rag.TextRules, "Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(1, 0.1), map[string]string{"it": "Combatti. Ricevi +1 [combat] in questo attacco."})
+	testdb.InsertCard(t, database, "01016", ".45 Automatic", rag.TextRules, "Fight. You get +1 [combat] and deal +1 damage.",
+		testdb.Embedding(1, 0.2), map[string]string{"it": "Combatti. Ricevi +1 [combat] e infliggi +1 danno."})
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", rag.TextRules, "You get +1 [intellect] while investigating.",
+		testdb.Embedding(0, 1), nil)
+
+	samples, err := LoadSample(database, "it", rag.TextRules, 10, 1)
+	if err != nil {
+		t.Fatalf("LoadSample failed: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("Expected the 2 entries with an Italian translation, got %d", len(samples))
+	}
+	again, err := LoadSample(database, "it", rag.TextRules, 10, 1)
+	if err != nil || again[0].CardCode != samples[0].CardCode {
+		t.Errorf("Expected the same seed to give the same order, got %v", err)
+	}
+
+	var progress int
+	results := Run(context.Background(), rag.NewPostgresStore(database), ragtest.Translator{}, samples, Options{
+		Language:     "it",
+		TextType:     rag.TextRules,
+		Model:        "gpt-4o",
+		ContextLimit: 6,
+		Rerank:       options.RerankNone,
+		Progress:     func(done, total int, result Result) { progress = done },
+	})
+
+	if progress != 2 || len(results) != 2 {
+		t.Fatalf("Expected 2 results and progress, got %d results, progress %d", len(results), progress)
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			t.Errorf("%s failed: %s", result.CardCode, result.Error)
+		}
+		// The card itself is excluded and 01030 has no Italian reference, leaving the other weapon
+		if result.ContextCards != 1 {
+			t.Errorf("%s: expected 1 context card without itself, got %d", result.CardCode, result.ContextCards)
+		}
+	}
+}
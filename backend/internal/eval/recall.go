@@ -0,0 +1,95 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// RecallResult is the self-retrieval of one sampled card
+type RecallResult struct {
+	CardCode string `json:"card_code"`
+	CardName string `json:"card_name"`
+	IsBack   bool   `json:"is_back"`
+	// Rank of the card in the results of its own embedding, from 1, or 0
+	// if it is not among them
+	Rank int `json:"rank"`
+}
+
+// SelfRecall queries store with each sample's own stored embedding and
+// records where the sample ranks among the first depth context cards. With
+// an exact search every card should come first, so misses measure what the
+// index (e.g. the ivfflat lists and probes) loses. A reprint with the same
+// English text counts as the card itself, since retrieval keeps only one of
+// them.
+func SelfRecall(ctx context.Context, store rag.VectorStore, samples []Sample, language, textType string, depth int) ([]RecallResult, error) {
+	results := make([]RecallResult, 0, len(samples))
+	for _, sample := range samples {
+		cards, err := rag.RetrieveContext(ctx, store, rag.SearchQuery{
+			Embedding: sample.Embedding,
+			Limit:     depth,
+			Language:  language,
+			TextType:  textType,
+			IsBack:    sample.IsBack,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve %s: %w", sample.CardCode, err)
+		}
+		results = append(results, RecallResult{
+			CardCode: sample.CardCode,
+			CardName: sample.CardName,
+			IsBack:   sample.IsBack,
+			Rank:     selfRank(cards, sample),
+		})
+	}
+	return results, nil
+}
+
+// selfRank returns the rank of the sample in cards, from 1, or 0 if it is
+// missing
+func selfRank(cards []rag.ContextCard, sample Sample) int {
+	for i, card := range cards {
+		sameSide := card.CardCode == sample.CardCode && card.IsBack == sample.IsBack
+		if sameSide || normalize(card.EnglishText) == normalize(sample.EnglishText) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// RecallReport summarizes a SelfRecall run
+type RecallReport struct {
+	Cards     int     `json:"cards"`
+	RecallAt1 float64 `json:"recall_at_1"` // Cards ranked first
+	RecallAt5 float64 `json:"recall_at_5"` // Cards ranked in the first 5
+	// MRR is the mean reciprocal rank, a missing card counting 0
+	MRR float64 `json:"mrr"`
+}
+
+// SummarizeRecall computes the report of a SelfRecall run
+func SummarizeRecall(results []RecallResult) RecallReport {
+	report := RecallReport{Cards: len(results)}
+	if len(results) == 0 {
+		return report
+	}
+	var at1, at5 int
+	var reciprocal float64
+	for _, result := range results {
+		if result.Rank == 0 {
+			continue
+		}
+		if result.Rank == 1 {
+			at1++
+		}
+		if result.Rank <= 5 {
+			at5++
+		}
+		reciprocal += 1 / float64(result.Rank)
+	}
+	n := float64(len(results))
+	report.RecallAt1 = float64(at1) / n
+	report.RecallAt5 = float64(at5) / n
+	report.MRR = reciprocal / n
+	return report
+}
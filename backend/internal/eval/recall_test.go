@@ -0,0 +1,57 @@
+package eval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// rankedStore returns its cards for every search, as if they were ranked by
+// similarity
+type rankedStore struct {
+	rag.VectorStore
+	cards []rag.ContextCard
+}
+
+func (s rankedStore) Search(ctx context.Context, query rag.SearchQuery) ([]rag.ContextCard, error) {
+	return s.cards, nil
+}
+
+func TestSelfRecall(t *testing.T) {
+	store := rankedStore{cards: []rag.ContextCard{
+		{CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Combatti."},
+		{CardCode: "01016", EnglishText: "Fight. Deal +1 damage.", TranslatedText: "Combatti. Infliggi +1 danno."},
+		{CardCode: "01030", EnglishText: "Investigate.", TranslatedText: "Indaga."},
+	}}
+	samples := []Sample{
+		{CardCode: "01020", EnglishText: "Fight."},
+		{CardCode: "01016", EnglishText: "Fight. Deal +1 damage."},
+		{CardCode: "50001", EnglishText: "Investigate."}, // Reprint of 01030
+		{CardCode: "01020", IsBack: true, EnglishText: "Resolution."},
+	}
+
+	results, err := SelfRecall(context.Background(), store, samples, "it", rag.TextRules, 5)
+	if err != nil {
+		t.Fatalf("SelfRecall failed: %v", err)
+	}
+	for i, expected := range []int{1, 2, 3, 0} {
+		if results[i].Rank != expected {
+			t.Errorf("Sample %d: expected rank %d, got %d", i, expected, results[i].Rank)
+		}
+	}
+}
+
+func TestSummarizeRecall(t *testing.T) {
+	report := SummarizeRecall([]RecallResult{{Rank: 1}, {Rank: 2}, {Rank: 8}, {Rank: 0}})
+	if report.Cards != 4 || report.RecallAt1 != 0.25 || report.RecallAt5 != 0.5 {
+		t.Errorf("Expected 4 cards with recall@1 0.25 and recall@5 0.5, got %+v", report)
+	}
+	if report.MRR != (1+0.5+0.125)/4 {
+		t.Errorf("Expected MRR %v, got %v", (1+0.5+0.125)/4, report.MRR)
+	}
+
+	if empty := SummarizeRecall(nil); empty.Cards != 0 || empty.MRR != 0 {
+		t.Errorf("Expected an empty report, got %+v", empty)
+	}
+}
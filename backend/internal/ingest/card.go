@@ -0,0 +1,92 @@
+package ingest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrCardNotFound is returned by IngestCard when the data directory has no
+// translated text for the card
+var ErrCardNotFound = errors.New("card not found")
+
+// IngestCard re-ingests a single card, e.g. after its official translation
+// was corrected upstream: the card is read from the pack files of
+// opts.DataPath, and each side and text type (see Options) with a
+// translation is embedded and upserted, replacing the stored entry. Stored
+// entries of other text types are left as they are. It returns the ingested
+// entries.
+func IngestCard(db *sql.DB, opts Options, code string) ([]CardEntry, error) {
+	if _, err := os.Stat(opts.DataPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("data directory not found: %s", opts.DataPath)
+	}
+
+	report := &FileReport{Strict: opts.Strict, Reporter: opts.Reporter, Fields: opts.Fields}
+	card, sourceFile, err := findCard(opts.DataPath, code, report)
+	if err != nil {
+		return nil, err
+	}
+
+	allTranslations := make(map[string]TranslationDict)
+	for _, lang := range SupportedLanguages {
+		translations, err := LoadTranslations(opts.DataPath, lang, report)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s translations: %w", lang, err)
+		}
+		allTranslations[lang] = translations
+	}
+
+	var entries []CardEntry
+	for _, isBack := range []bool{false, true} {
+		for _, textType := range opts.textTypes() {
+			if entry, ok := buildEntry(card, isBack, textType, allTranslations); ok {
+				entry.setSource(sourceFile)
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s has no translated text in the data directory", ErrCardNotFound, code)
+	}
+
+	var embedErrors []error
+	opts.Progress = func(_, _, _ int, batchErrors []error) {
+		embedErrors = append(embedErrors, batchErrors...)
+	}
+	if _, err := IngestCards(db, entries, opts); err != nil {
+		return nil, fmt.Errorf("failed to ingest card %s: %w", code, err)
+	}
+	if len(embedErrors) > 0 {
+		return nil, fmt.Errorf("failed to embed card %s: %w", code, errors.Join(embedErrors...))
+	}
+	return entries, nil
+}
+
+// findCard returns the English card with the given code from the pack files,
+// along with its file path relative to the data directory
+func findCard(dataPath, code string, report *FileReport) (Card, string, error) {
+	jsonFiles, err := filepath.Glob(filepath.Join(dataPath, "pack", "*", "*.json"))
+	if err != nil {
+		return Card{}, "", err
+	}
+
+	for _, jsonFile := range jsonFiles {
+		cards, err := report.readCardFile(jsonFile)
+		if err != nil {
+			return Card{}, "", err
+		}
+		for _, card := range cards {
+			if card.Code != code {
+				continue
+			}
+			sourceFile, err := filepath.Rel(dataPath, jsonFile)
+			if err != nil {
+				return Card{}, "", err
+			}
+			return card, filepath.ToSlash(sourceFile), nil
+		}
+	}
+	return Card{}, "", fmt.Errorf("%w: no card %s in the pack files", ErrCardNotFound, code)
+}
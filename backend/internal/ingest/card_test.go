@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// recordingStore is a VectorStore keeping the upserted entries
+type recordingStore struct {
+	entries []rag.StoreEntry
+}
+
+func (s *recordingStore) Upsert(entries []rag.StoreEntry) error {
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+func (s *recordingStore) Search(ctx context.Context, query rag.SearchQuery) ([]rag.ContextCard, error) {
+	return nil, nil
+}
+
+func (s *recordingStore) Delete(cardCode string) (int, error) { return 0, nil }
+
+func (s *recordingStore) Embedding(ctx context.Context, cardCode string, isBack bool, textType string) ([]float32, error) {
+	return nil, rag.ErrEntryNotFound
+}
+
+func (s *recordingStore) Cards(ctx context.Context, codes []string, query rag.SearchQuery) ([]rag.ContextCard, error) {
+	return nil, nil
+}
+
+func TestIngestCard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2]}]}`))
+	}))
+	defer server.Close()
+	defaultBaseURL := openai.BaseURL
+	openai.BaseURL = server.URL
+	defer func() { openai.BaseURL = defaultBaseURL }()
+
+	dataPath := t.TempDir()
+	writeDataFile(t, dataPath, "pack/core/core.json", `[
+		{"code": "01020", "name": "Machete", "text": "Fight. You get +1 [combat] for this attack.", "flavor": "Sharp."},
+		{"code": "01030", "name": "Magnifying Glass", "text": "You get +1 [intellect] while investigating."}
+	]`)
+	writeDataFile(t, dataPath, "translations/it/pack/core/core.json", `[
+		{"code": "01020", "name": "Machete", "text": "Combattere. Ottieni +1 [combat] per questo attacco.", "flavor": "Affilato."}
+	]`)
+
+	store := &recordingStore{}
+	opts := Options{DataPath: dataPath, APIKey: "test-key", EmbeddingModel: "test-model", IncludeFlavor: true, Store: store}
+
+	entries, err := IngestCard(nil, opts, "01020")
+	if err != nil {
+		t.Fatalf("Failed to ingest card: %v", err)
+	}
+	if len(entries) != 2 || len(store.entries) != 2 {
+		t.Fatalf("Expected the rules and flavor entries, got %d ingested and %d stored", len(entries), len(store.entries))
+	}
+	rules := store.entries[0]
+	if rules.CardCode != "01020" || rules.TextType != rag.TextRules || rules.Translations["it"] != "Combattere. Ottieni +1 [combat] per questo attacco." || len(rules.Embedding) != 2 {
+		t.Errorf("Unexpected rules entry: %+v", rules)
+	}
+	if entries[0].SourceFile != "pack/core/core.json" {
+		t.Errorf("Expected source file pack/core/core.json, got %s", entries[0].SourceFile)
+	}
+
+	// Untranslated and unknown cards are not found
+	for _, code := range []string{"01030", "99999"} {
+		if _, err := IngestCard(nil, opts, code); !errors.Is(err, ErrCardNotFound) {
+			t.Errorf("Expected ErrCardNotFound for %s, got %v", code, err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package ingest
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxArchiveBytes caps the download and the extracted size of a card data
+// archive (the arkhamdb-json-data archive is about 30 MB extracted)
+var MaxArchiveBytes int64 = 512 << 20
+
+// archiveClient downloads card data archives; tests replace it
+var archiveClient = http.DefaultClient
+
+// OpenDataSource returns the arkhamdb-json-data directory of source, which
+// is either a local directory (returned as is), a .zip archive, or the
+// https:// URL of one, e.g. a GitHub archive of the repository. Archives are
+// downloaded and extracted to a temporary directory, which must contain
+// pack/ and translations/ at its root or in a single top-level folder.
+// cleanup removes the temporary files, and does nothing for a directory.
+func OpenDataSource(ctx context.Context, source string) (dataPath string, cleanup func(), err error) {
+	cleanup = func() {}
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return openRemoteArchive(ctx, source)
+	}
+
+	dataPath, err = filepath.Abs(source)
+	if err != nil {
+		return "", cleanup, fmt.Errorf("failed to resolve data directory: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(dataPath), ".zip") {
+		return openArchive(dataPath)
+	}
+	return dataPath, cleanup, nil
+}
+
+// openRemoteArchive downloads the zip archive at rawURL and extracts it
+func openRemoteArchive(ctx context.Context, rawURL string) (string, func(), error) {
+	noop := func() {}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return "", noop, fmt.Errorf("invalid data URL %q", rawURL)
+	}
+	if parsed.Scheme != "https" {
+		return "", noop, fmt.Errorf("data URL must use https, got %q", rawURL)
+	}
+
+	file, err := os.CreateTemp("", "arkham-data-*.zip")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	fmt.Printf("Downloading card data from %s...\n", rawURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := archiveClient.Do(req)
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to download card data: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", noop, fmt.Errorf("failed to download card data: %s", resp.Status)
+	}
+
+	written, err := io.Copy(file, io.LimitReader(resp.Body, MaxArchiveBytes+1))
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to download card data: %w", err)
+	}
+	if written > MaxArchiveBytes {
+		return "", noop, fmt.Errorf("card data archive is larger than %d bytes", MaxArchiveBytes)
+	}
+	if err := file.Close(); err != nil {
+		return "", noop, fmt.Errorf("failed to write archive file: %w", err)
+	}
+
+	return openArchive(file.Name())
+}
+
+// openArchive extracts the zip archive at path to a temporary directory and
+// returns its card data directory
+func openArchive(path string) (string, func(), error) {
+	noop := func() {}
+	dir, err := os.MkdirTemp("", "arkham-data-")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if err := extractArchive(path, dir); err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	dataPath, err := findDataRoot(dir)
+	if err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("invalid card data archive %s: %w", filepath.Base(path), err)
+	}
+	return dataPath, cleanup, nil
+}
+
+// extractArchive extracts the regular files of the zip archive at path into
+// dir, refusing entries that would land outside of it and archives that
+// extract to more than MaxArchiveBytes
+func extractArchive(path, dir string) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer archive.Close()
+
+	remaining := MaxArchiveBytes
+	for _, entry := range archive.File {
+		if !entry.Mode().IsRegular() {
+			continue // Directories are created with their files; links are skipped
+		}
+		target := filepath.Join(dir, filepath.FromSlash(entry.Name))
+		if !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %q is outside of the archive", entry.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", entry.Name, err)
+		}
+
+		written, err := extractFile(entry, target, remaining)
+		if err != nil {
+			return err
+		}
+		remaining -= written
+	}
+	return nil
+}
+
+// extractFile writes an archive entry to target, failing once it exceeds
+// limit bytes
+func extractFile(entry *zip.File, target string, limit int64) (int64, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract %s: %w", entry.Name, err)
+	}
+	defer reader.Close()
+
+	file, err := os.Create(target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract %s: %w", entry.Name, err)
+	}
+	defer file.Close()
+
+	written, err := io.Copy(file, io.LimitReader(reader, limit+1))
+	if err != nil {
+		return written, fmt.Errorf("failed to extract %s: %w", entry.Name, err)
+	}
+	if written > limit {
+		return written, fmt.Errorf("card data archive extracts to more than %d bytes", MaxArchiveBytes)
+	}
+	return written, file.Close()
+}
+
+// findDataRoot returns dir when it has the pack/ and translations/
+// directories of arkhamdb-json-data, or else its single top-level folder
+// that has them (GitHub archives wrap the repository in one)
+func findDataRoot(dir string) (string, error) {
+	if isDataRoot(dir) {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		if root := filepath.Join(dir, entries[0].Name()); isDataRoot(root) {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("expected the pack/ and translations/ directories of arkhamdb-json-data")
+}
+
+// isDataRoot reports whether dir has pack/ and translations/ subdirectories
+func isDataRoot(dir string) bool {
+	for _, name := range []string{"pack", "translations"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package ingest
+
+import (
+	"archive/zip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeZip writes an archive of files (name to content) and returns its path
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	for name, content := range files {
+		entry, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var dataFiles = map[string]string{
+	"pack/core/core.json":                 `[{"code": "01020"}]`,
+	"translations/it/pack/core/core.json": `[{"code": "01020"}]`,
+	"translations/fr/pack/core/core.json": `[]`,
+	"packs.json":                          `[]`,
+}
+
+// withPrefix returns files under a top-level folder
+func withPrefix(prefix string, files map[string]string) map[string]string {
+	prefixed := make(map[string]string, len(files))
+	for name, content := range files {
+		prefixed[prefix+name] = content
+	}
+	return prefixed
+}
+
+func TestOpenDataSource_Directory(t *testing.T) {
+	dir := t.TempDir()
+	dataPath, cleanup, err := OpenDataSource(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cleanup()
+
+	if dataPath != dir {
+		t.Errorf("Expected %s, got %s", dir, dataPath)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Expected cleanup to keep a data directory, got %v", err)
+	}
+}
+
+func TestOpenDataSource_Archive(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		valid bool
+	}{
+		{"Root", dataFiles, true},
+		{"TopLevelFolder", withPrefix("arkhamdb-json-data-master/", dataFiles), true},
+		{"NoTranslations", map[string]string{"pack/core/core.json": `[]`}, false},
+		{"NestedTwice", withPrefix("a/b/", dataFiles), false},
+		{"ZipSlip", map[string]string{"../pack/core/core.json": `[]`}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dataPath, cleanup, err := OpenDataSource(context.Background(), writeZip(t, tc.files))
+			defer cleanup()
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid=%v, got %v", tc.valid, err)
+			}
+			if !tc.valid {
+				return
+			}
+
+			content, err := os.ReadFile(filepath.Join(dataPath, "translations", "it", "pack", "core", "core.json"))
+			if err != nil {
+				t.Fatalf("Expected the extracted translations, got %v", err)
+			}
+			if string(content) != dataFiles["translations/it/pack/core/core.json"] {
+				t.Errorf("Expected the archived content, got %q", content)
+			}
+
+			cleanup()
+			if _, err := os.Stat(dataPath); !os.IsNotExist(err) {
+				t.Errorf("Expected cleanup to remove %s, got %v", dataPath, err)
+			}
+		})
+	}
+}
+
+func TestOpenDataSource_SizeLimit(t *testing.T) {
+	defer func(limit int64) { MaxArchiveBytes = limit }(MaxArchiveBytes)
+	MaxArchiveBytes = 16
+
+	_, cleanup, err := OpenDataSource(context.Background(), writeZip(t, dataFiles))
+	defer cleanup()
+	if err == nil || !strings.Contains(err.Error(), "more than 16 bytes") {
+		t.Errorf("Expected a size limit error, got %v", err)
+	}
+}
+
+func TestOpenDataSource_URL(t *testing.T) {
+	archive, err := os.ReadFile(writeZip(t, withPrefix("arkhamdb-json-data-master/", dataFiles)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/master.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+	defer func(client *http.Client) { archiveClient = client }(archiveClient)
+	archiveClient = server.Client()
+
+	dataPath, cleanup, err := OpenDataSource(context.Background(), server.URL+"/master.zip")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer cleanup()
+	if filepath.Base(dataPath) != "arkhamdb-json-data-master" {
+		t.Errorf("Expected the archive folder, got %s", dataPath)
+	}
+	if !isDataRoot(dataPath) {
+		t.Errorf("Expected %s to hold the card data", dataPath)
+	}
+
+	for _, source := range []string{server.URL + "/missing.zip", "http://example.com/master.zip"} {
+		if _, cleanup, err := OpenDataSource(context.Background(), source); err == nil {
+			cleanup()
+			t.Errorf("Expected an error for %s", source)
+		}
+	}
+}
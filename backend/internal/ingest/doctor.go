@@ -0,0 +1,149 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+)
+
+// DimensionMismatch is a stored embedding whose size differs from the
+// expected one
+type DimensionMismatch struct {
+	Table      string // card_embeddings or card_translations
+	CardCode   string
+	IsBack     bool
+	TextType   string
+	Language   string // Empty for card_embeddings (English)
+	Dimensions int
+}
+
+// DuplicateEntry is a card side and text type stored more than once in
+// card_embeddings, which Upsert never does; retrieval then returns the card
+// twice and reingests only replace one of the rows
+type DuplicateEntry struct {
+	CardCode string
+	IsBack   bool
+	TextType string
+	Rows     int
+}
+
+// EmbeddingReport is the result of CheckEmbeddings
+type EmbeddingReport struct {
+	Dimensions       int // Expected embedding size
+	ColumnDimensions int // Declared size of card_embeddings.embedding, 0 for an untyped vector column
+	Rows             int // card_embeddings rows
+	NullEmbeddings   int // card_embeddings rows without an embedding, never retrieved
+	WrongDimensions  []DimensionMismatch
+	Duplicates       []DuplicateEntry
+}
+
+// Healthy reports whether the check found no problem
+func (r EmbeddingReport) Healthy() bool {
+	return (r.ColumnDimensions == 0 || r.ColumnDimensions == r.Dimensions) &&
+		r.NullEmbeddings == 0 && len(r.WrongDimensions) == 0 && len(r.Duplicates) == 0
+}
+
+// CheckEmbeddings scans the stored embeddings for the problems left by
+// model migrations or partial ingests: embeddings of another size than
+// dimensions (in card_embeddings and card_translations), entries without an
+// embedding and duplicate entries. Missing translation embeddings are not a
+// problem, as they are only stored with -embed-translations.
+func CheckEmbeddings(ctx context.Context, database *sql.DB, dimensions int) (EmbeddingReport, error) {
+	report := EmbeddingReport{Dimensions: dimensions}
+
+	// atttypmod is -1 for a vector column declared without dimensions
+	if err := database.QueryRowContext(ctx, `
+		SELECT GREATEST(atttypmod, 0) FROM pg_attribute
+		WHERE attrelid = 'card_embeddings'::regclass AND attname = 'embedding'
+	`).Scan(&report.ColumnDimensions); err != nil {
+		return report, fmt.Errorf("failed to read the embedding column: %w", err)
+	}
+
+	if err := database.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE embedding IS NULL) FROM card_embeddings
+	`).Scan(&report.Rows, &report.NullEmbeddings); err != nil {
+		return report, fmt.Errorf("failed to count embeddings: %w", err)
+	}
+
+	rows, err := database.QueryContext(ctx, `
+		SELECT 'card_embeddings', card_code, COALESCE(is_back, FALSE), text_type, '', vector_dims(embedding)
+		FROM card_embeddings
+		WHERE embedding IS NOT NULL AND vector_dims(embedding) <> $1
+		UNION ALL
+		SELECT 'card_translations', card_code, is_back, text_type, language, vector_dims(embedding)
+		FROM card_translations
+		WHERE embedding IS NOT NULL AND vector_dims(embedding) <> $1
+		ORDER BY 1, 2, 3, 4, 5
+	`, dimensions)
+	if err != nil {
+		return report, fmt.Errorf("failed to query embedding dimensions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mismatch DimensionMismatch
+		if err := rows.Scan(&mismatch.Table, &mismatch.CardCode, &mismatch.IsBack, &mismatch.TextType, &mismatch.Language, &mismatch.Dimensions); err != nil {
+			return report, fmt.Errorf("failed to scan embedding dimensions: %w", err)
+		}
+		report.WrongDimensions = append(report.WrongDimensions, mismatch)
+	}
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	duplicates, err := database.QueryContext(ctx, `
+		SELECT card_code, COALESCE(is_back, FALSE), text_type, COUNT(*)
+		FROM card_embeddings
+		GROUP BY card_code, COALESCE(is_back, FALSE), text_type
+		HAVING COUNT(*) > 1
+		ORDER BY 1, 2, 3
+	`)
+	if err != nil {
+		return report, fmt.Errorf("failed to query duplicate entries: %w", err)
+	}
+	defer duplicates.Close()
+	for duplicates.Next() {
+		var duplicate DuplicateEntry
+		if err := duplicates.Scan(&duplicate.CardCode, &duplicate.IsBack, &duplicate.TextType, &duplicate.Rows); err != nil {
+			return report, fmt.Errorf("failed to scan duplicate entry: %w", err)
+		}
+		report.Duplicates = append(report.Duplicates, duplicate)
+	}
+	if err := duplicates.Err(); err != nil {
+		return report, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return report, nil
+}
+
+// Print writes the report, one line per problem
+func (r EmbeddingReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Checked %d entries for %d-dimensional embeddings\n", r.Rows, r.Dimensions)
+	if r.ColumnDimensions != 0 && r.ColumnDimensions != r.Dimensions {
+		fmt.Fprintf(w, "✗ card_embeddings.embedding is declared vector(%d), expected vector(%d)\n", r.ColumnDimensions, r.Dimensions)
+	}
+	if r.NullEmbeddings > 0 {
+		fmt.Fprintf(w, "✗ %d entries have no embedding\n", r.NullEmbeddings)
+	}
+	for _, mismatch := range r.WrongDimensions {
+		entry := fmt.Sprintf("%s (%s, %s)", mismatch.CardCode, sideName(mismatch.IsBack), mismatch.TextType)
+		if mismatch.Language != "" {
+			entry += " " + mismatch.Language
+		}
+		fmt.Fprintf(w, "✗ %s: %s has a %d-dimensional embedding\n", mismatch.Table, entry, mismatch.Dimensions)
+	}
+	for _, duplicate := range r.Duplicates {
+		fmt.Fprintf(w, "✗ card_embeddings: %s (%s, %s) is stored %d times\n", duplicate.CardCode, sideName(duplicate.IsBack), duplicate.TextType, duplicate.Rows)
+	}
+	if r.Healthy() {
+		fmt.Fprintln(w, "✓ All embeddings look healthy")
+	}
+}
+
+// sideName names a card side in reports
+func sideName(isBack bool) string {
+	if isBack {
+		return "back"
+	}
+	return "front"
+}
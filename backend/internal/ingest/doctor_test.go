@@ -0,0 +1,100 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+	"github.com/ventrosky/arkham-localize/backend/internal/testdb"
+)
+
+func TestEmbeddingReport_Print(t *testing.T) {
+	testCases := []struct {
+		name     string
+		report   EmbeddingReport
+		expected []string
+	}{
+		{"Healthy", EmbeddingReport{Dimensions: 1536, ColumnDimensions: 1536, Rows: 10},
+			[]string{"✓ All embeddings look healthy"}},
+		{"UntypedColumn", EmbeddingReport{Dimensions: 1536, Rows: 10},
+			[]string{"✓ All embeddings look healthy"}},
+		{"ColumnDimensions", EmbeddingReport{Dimensions: 3072, ColumnDimensions: 1536},
+			[]string{"declared vector(1536), expected vector(3072)"}},
+		{"NullEmbeddings", EmbeddingReport{Dimensions: 1536, NullEmbeddings: 2},
+			[]string{"✗ 2 entries have no embedding"}},
+		{"WrongDimensions", EmbeddingReport{Dimensions: 1536, WrongDimensions: []DimensionMismatch{
+			{Table: "card_translations", CardCode: "01020", TextType: rag.TextRules, Language: "it", Dimensions: 3072},
+		}}, []string{"card_translations: 01020 (front, rules) it has a 3072-dimensional embedding"}},
+		{"Duplicates", EmbeddingReport{Dimensions: 1536, Duplicates: []DuplicateEntry{
+			{CardCode: "01104", IsBack: true, TextType: rag.TextFlavor, Rows: 2},
+		}}, []string{"01104 (back, flavor) is stored 2 times"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tc.report.Print(&out)
+			for _, expected := range tc.expected {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("Expected %q in the report, got:\n%s", expected, out.String())
+				}
+			}
+			healthy := strings.Contains(out.String(), "✓")
+			if healthy != tc.report.Healthy() || strings.Contains(out.String(), "✗") == healthy {
+				t.Errorf("Expected Healthy() %v to match the report:\n%s", tc.report.Healthy(), out.String())
+			}
+		})
+	}
+}
+
+func TestCheckEmbeddings(t *testing.T) {
+	database := testdb.Start(t)
+
+	testdb.InsertCard(t, database, "01020", "Machete", rag.TextRules, "Fight.", testdb.Embedding(1), map[string]string{"it": "Combatti."})
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", rag.TextRules, "Fast.", testdb.Embedding(0, 1), nil)
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", rag.TextRules, "Fast.", testdb.Embedding(0, 1), nil)
+	if _, err := database.Exec(`INSERT INTO card_embeddings (card_code, card_name, english_text, text_type) VALUES ('01040', 'Unembedded', 'Draw 1 card.', 'rules')`); err != nil {
+		t.Fatalf("Failed to insert entry: %v", err)
+	}
+
+	// Untyped vector columns accept any size, as a half-done migration leaves them
+	if _, err := database.Exec(`
+		DROP INDEX IF EXISTS card_translations_embedding_idx;
+		ALTER TABLE card_translations ALTER COLUMN embedding TYPE vector;
+	`); err != nil {
+		t.Fatalf("Failed to untype the embedding column: %v", err)
+	}
+	if _, err := database.Exec(`UPDATE card_translations SET embedding = $1 WHERE card_code = '01020'`, pgvector.NewVector([]float32{1, 0, 0})); err != nil {
+		t.Fatalf("Failed to store a smaller embedding: %v", err)
+	}
+
+	report, err := CheckEmbeddings(context.Background(), database, embeddings.Dimensions)
+	if err != nil {
+		t.Fatalf("CheckEmbeddings failed: %v", err)
+	}
+
+	if report.Rows != 4 || report.NullEmbeddings != 1 {
+		t.Errorf("Expected 4 rows with 1 without embedding, got %d and %d", report.Rows, report.NullEmbeddings)
+	}
+	if report.ColumnDimensions != embeddings.Dimensions {
+		t.Errorf("Expected column dimensions %d, got %d", embeddings.Dimensions, report.ColumnDimensions)
+	}
+	expectedMismatches := []DimensionMismatch{
+		{Table: "card_translations", CardCode: "01020", TextType: rag.TextRules, Language: "it", Dimensions: 3},
+	}
+	if !reflect.DeepEqual(report.WrongDimensions, expectedMismatches) {
+		t.Errorf("Expected mismatches %+v, got %+v", expectedMismatches, report.WrongDimensions)
+	}
+	expectedDuplicates := []DuplicateEntry{{CardCode: "01030", TextType: rag.TextRules, Rows: 2}}
+	if !reflect.DeepEqual(report.Duplicates, expectedDuplicates) {
+		t.Errorf("Expected duplicates %+v, got %+v", expectedDuplicates, report.Duplicates)
+	}
+	if report.Healthy() {
+		t.Error("Expected the report to be unhealthy")
+	}
+}
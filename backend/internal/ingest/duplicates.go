@@ -0,0 +1,119 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Policies for the entries found in more than one pack file, with the same
+// card code, side and text type
+const (
+	DuplicatesFirst  = "first"  // Keep the entry of the first pack file, in path order (default)
+	DuplicatesLatest = "latest" // Keep the entry of the latest released pack, e.g. a revised set's reprint
+)
+
+// ValidDuplicates reports whether policy is DuplicatesFirst or DuplicatesLatest
+func ValidDuplicates(policy string) bool {
+	return policy == DuplicatesFirst || policy == DuplicatesLatest
+}
+
+// entryKey identifies the stored row of an entry: the vector store keeps
+// one per card code, side and text type
+type entryKey struct {
+	code     string
+	isBack   bool
+	textType string
+}
+
+// packRelease is the release information of a pack in packs.json
+type packRelease struct {
+	Code          string `json:"code"`
+	DateRelease   string `json:"date_release"` // e.g. "2016-08-13", null for unreleased packs
+	CyclePosition int    `json:"cycle_position"`
+	Position      int    `json:"position"`
+}
+
+// readReleaseOrder returns the rank of each pack code of the packs.json of
+// dataPath in release order: by release date, then by cycle and position
+// within the cycle, unreleased packs last
+func readReleaseOrder(dataPath string) (map[string]int, error) {
+	data, err := os.ReadFile(filepath.Join(dataPath, "packs.json"))
+	if err != nil {
+		return nil, err
+	}
+	var packs []packRelease
+	if err := json.Unmarshal(data, &packs); err != nil {
+		return nil, fmt.Errorf("invalid packs.json: %w", err)
+	}
+
+	sort.SliceStable(packs, func(i, j int) bool {
+		a, b := packs[i], packs[j]
+		if (a.DateRelease == "") != (b.DateRelease == "") {
+			return b.DateRelease == ""
+		}
+		if a.DateRelease != b.DateRelease {
+			return a.DateRelease < b.DateRelease
+		}
+		if a.CyclePosition != b.CyclePosition {
+			return a.CyclePosition < b.CyclePosition
+		}
+		return a.Position < b.Position
+	})
+	order := make(map[string]int, len(packs))
+	for i, pack := range packs {
+		order[pack.Code] = i
+	}
+	return order, nil
+}
+
+// releaseRank returns the rank of the pack of an entry in releases, or -1
+// for a pack packs.json doesn't list
+func releaseRank(entry CardEntry, releases map[string]int) int {
+	if rank, ok := releases[sourcePackCode(entry.SourceFile)]; ok {
+		return rank
+	}
+	return -1
+}
+
+// collapseDuplicates keeps one entry per card code, side and text type, at
+// the position of the first one. The policy picks which: the first in path
+// order, or the one of the latest pack in releases (see readReleaseOrder),
+// where packs packs.json doesn't list count as the oldest and ties go to
+// the last in path order.
+//
+// Entries whose English text differs, such as an errata'd reprint, are
+// collapsed too: the store has room for a single row per card code, side
+// and text type, so a second one would only overwrite the first on upsert.
+// Each duplicate is reported to progress, noting when its text differs from
+// the kept entry's. It returns the kept entries and the number dropped.
+func collapseDuplicates(entries []CardEntry, policy string, releases map[string]int, progress *ProgressReporter) ([]CardEntry, int) {
+	positions := make(map[entryKey]int, len(entries))
+	kept := make([]CardEntry, 0, len(entries))
+	collapsed := 0
+	for _, entry := range entries {
+		key := entryKey{entry.CardCode, entry.IsBack, entry.TextType}
+		i, seen := positions[key]
+		if !seen {
+			positions[key] = len(kept)
+			kept = append(kept, entry)
+			continue
+		}
+
+		collapsed++
+		canonical, dropped := kept[i], entry
+		if policy == DuplicatesLatest && releaseRank(entry, releases) >= releaseRank(kept[i], releases) {
+			canonical, dropped = entry, kept[i]
+			kept[i] = entry
+		}
+		difference := "same text"
+		if canonical.EnglishText != dropped.EnglishText {
+			difference = "different text"
+		}
+		progress.Warnf("Duplicate %s entry of %s (%s, %s) in %s dropped, keeping the one in %s (%s)",
+			entry.TextType, entry.CardName, entry.CardCode, sideName(entry.IsBack), dropped.SourceFile, canonical.SourceFile, difference)
+	}
+	return kept, collapsed
+}
@@ -0,0 +1,84 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+func TestCollapseDuplicates(t *testing.T) {
+	entries := []CardEntry{
+		{CardCode: "01020", CardName: "Machete", TextType: rag.TextRules, EnglishText: "Fight.", SourceFile: "pack/core/core.json"},
+		{CardCode: "01020", CardName: "Machete", TextType: rag.TextName, EnglishText: "Machete", SourceFile: "pack/core/core.json"},
+		{CardCode: "01021", CardName: "Guard Dog", TextType: rag.TextRules, EnglishText: "Uses.", SourceFile: "pack/core/core.json"},
+		{CardCode: "01020", CardName: "Machete", TextType: rag.TextRules, EnglishText: "Fight. Errata.", SourceFile: "pack/rcore/rcore.json"},
+		{CardCode: "01020", CardName: "Machete", IsBack: true, TextType: rag.TextRules, EnglishText: "Back.", SourceFile: "pack/rcore/rcore.json"},
+	}
+
+	testCases := []struct {
+		name     string
+		policy   string
+		releases map[string]int
+		expected []string // EnglishText of the kept entries, in order
+		warning  string
+	}{
+		{"First", DuplicatesFirst, nil, []string{"Fight.", "Machete", "Uses.", "Back."}, "in pack/rcore/rcore.json dropped, keeping the one in pack/core/core.json (different text)"},
+		{"Latest", DuplicatesLatest, map[string]int{"core": 0, "rcore": 1}, []string{"Fight. Errata.", "Machete", "Uses.", "Back."}, "in pack/core/core.json dropped, keeping the one in pack/rcore/rcore.json (different text)"},
+		// Release order, not path order
+		{"Latest_Released", DuplicatesLatest, map[string]int{"rcore": 0, "core": 1}, []string{"Fight.", "Machete", "Uses.", "Back."}, "in pack/rcore/rcore.json dropped, keeping the one in pack/core/core.json (different text)"},
+		{"Latest_Unlisted", DuplicatesLatest, map[string]int{"core": 0}, []string{"Fight.", "Machete", "Uses.", "Back."}, "in pack/rcore/rcore.json dropped, keeping the one in pack/core/core.json (different text)"},
+		{"Latest_NoReleases", DuplicatesLatest, nil, []string{"Fight. Errata.", "Machete", "Uses.", "Back."}, "in pack/core/core.json dropped, keeping the one in pack/rcore/rcore.json (different text)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reporter, out, _ := newTestReporter(ProgressText)
+			kept, collapsed := collapseDuplicates(entries, tc.policy, tc.releases, reporter)
+
+			if collapsed != 1 {
+				t.Errorf("Expected 1 collapsed entry, got %d", collapsed)
+			}
+			var texts []string
+			for _, entry := range kept {
+				texts = append(texts, entry.EnglishText)
+			}
+			if strings.Join(texts, "|") != strings.Join(tc.expected, "|") {
+				t.Errorf("Expected entries %v, got %v", tc.expected, texts)
+			}
+			if !strings.Contains(out.String(), tc.warning) {
+				t.Errorf("Expected %q in %q", tc.warning, out.String())
+			}
+		})
+	}
+}
+
+func TestReadReleaseOrder(t *testing.T) {
+	dataPath := t.TempDir()
+	packs := `[
+		{"code": "rcore", "cycle_position": 1, "position": 2, "date_release": "2021-10-01"},
+		{"code": "core", "cycle_position": 1, "position": 1, "date_release": "2016-08-13"},
+		{"code": "fhvp", "cycle_position": 10, "position": 1, "date_release": null},
+		{"code": "dwl", "cycle_position": 2, "position": 1, "date_release": "2016-11-03"},
+		{"code": "tmm", "cycle_position": 2, "position": 2, "date_release": "2016-11-03"}
+	]`
+	if err := os.WriteFile(filepath.Join(dataPath, "packs.json"), []byte(packs), 0o644); err != nil {
+		t.Fatalf("Failed to write packs.json: %v", err)
+	}
+
+	releases, err := readReleaseOrder(dataPath)
+	if err != nil {
+		t.Fatalf("Failed to read the release order: %v", err)
+	}
+	expected := map[string]int{"core": 0, "dwl": 1, "tmm": 2, "rcore": 3, "fhvp": 4}
+	if !reflect.DeepEqual(releases, expected) {
+		t.Errorf("Expected release order %v, got %v", expected, releases)
+	}
+
+	if _, err := readReleaseOrder(t.TempDir()); err == nil {
+		t.Error("Expected error without packs.json, got nil")
+	}
+}
@@ -0,0 +1,58 @@
+package ingest
+
+import (
+	"sync"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+)
+
+// embeddingCache embeds each distinct text once per run. Many cards share
+// their rules text (basic weaknesses, upgraded versions, reprints), so the
+// entries sharing a text reuse a single embedding. It is safe for concurrent
+// use; a text requested while its embedding is in flight waits for it.
+type embeddingCache struct {
+	apiKey string
+	model  string
+
+	mu      sync.Mutex
+	entries map[string]*cachedEmbedding
+	calls   int // Embedding requests made
+	saved   int // Requests avoided by reusing an embedding
+}
+
+type cachedEmbedding struct {
+	ready     chan struct{} // Closed once embedding and err are set
+	embedding []float32
+	err       error
+}
+
+func newEmbeddingCache(apiKey, model string) *embeddingCache {
+	return &embeddingCache{apiKey: apiKey, model: model, entries: make(map[string]*cachedEmbedding)}
+}
+
+// get returns the embedding of text, requesting it only the first time. A
+// failed request is not retried within the run.
+func (c *embeddingCache) get(text string) ([]float32, error) {
+	c.mu.Lock()
+	if cached, ok := c.entries[text]; ok {
+		c.saved++
+		c.mu.Unlock()
+		<-cached.ready
+		return cached.embedding, cached.err
+	}
+	cached := &cachedEmbedding{ready: make(chan struct{})}
+	c.entries[text] = cached
+	c.calls++
+	c.mu.Unlock()
+
+	cached.embedding, cached.err = embeddings.GetEmbedding(text, c.apiKey, c.model)
+	close(cached.ready)
+	return cached.embedding, cached.err
+}
+
+// stats returns the number of embedding requests made and avoided
+func (c *embeddingCache) stats() (calls, saved int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls, c.saved
+}
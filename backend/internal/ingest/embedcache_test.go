@@ -0,0 +1,47 @@
+package ingest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+func TestEmbeddingCache_EmbedsIdenticalTextsOnce(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [{"embedding": [0.1, 0.2]}]}`))
+	}))
+	defer server.Close()
+
+	defaultBaseURL := openai.BaseURL
+	openai.BaseURL = server.URL
+	defer func() { openai.BaseURL = defaultBaseURL }()
+
+	cache := newEmbeddingCache("test-key", "test-model")
+	texts := []string{"Revelation - Lose 1 resource.", "Draw 1 card.", "Revelation - Lose 1 resource.", "Draw 1 card.", "Draw 1 card."}
+
+	var wg sync.WaitGroup
+	for _, text := range texts {
+		wg.Add(1)
+		go func(text string) {
+			defer wg.Done()
+			if embedding, err := cache.get(text); err != nil || len(embedding) != 2 {
+				t.Errorf("Expected a 2-dimensional embedding, got %v (%v)", embedding, err)
+			}
+		}(text)
+	}
+	wg.Wait()
+
+	if requests != 2 {
+		t.Errorf("Expected 2 embedding requests, got %d", requests)
+	}
+	if calls, saved := cache.stats(); calls != 2 || saved != 3 {
+		t.Errorf("Expected 2 calls and 3 saved, got %d and %d", calls, saved)
+	}
+}
@@ -0,0 +1,52 @@
+package ingest
+
+import (
+	"encoding/json"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+// FieldMap maps the JSON field names of Card (arkhamdb's) to the names used
+// by card files of another schema, e.g. "text" to "textEn" in a homebrew
+// export
+type FieldMap map[string]string
+
+// ParseFieldMap parses a comma-separated list of arkhamdb field names and
+// the names to read them from, e.g. "text=textEn,real_text=textEn,name=title"
+// (see options.ParseFieldMap)
+func ParseFieldMap(spec string) (FieldMap, error) {
+	fields, err := options.ParseFieldMap(spec)
+	return FieldMap(fields), err
+}
+
+// decodeCards parses a card file. A field mapped in fields is read from its
+// mapped name, falling back to the standard name for the cards without it.
+func decodeCards(data []byte, fields FieldMap) ([]Card, error) {
+	var cards []Card
+	if len(fields) == 0 {
+		err := json.Unmarshal(data, &cards)
+		return cards, err
+	}
+
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		for field, name := range fields {
+			if value, ok := object[name]; ok {
+				object[field] = value
+			}
+		}
+	}
+
+	// Re-encoded so that Card's field types are checked as for a standard file
+	mapped, err := json.Marshal(objects)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(mapped, &cards); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
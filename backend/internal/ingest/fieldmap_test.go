@@ -0,0 +1,53 @@
+package ingest
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+func TestCardFields(t *testing.T) {
+	var fields []string
+	cardType := reflect.TypeOf(Card{})
+	for i := 0; i < cardType.NumField(); i++ {
+		if name, _, _ := strings.Cut(cardType.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+
+	expected := append([]string(nil), options.CardFields...)
+	sort.Strings(fields)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected options.CardFields to list the JSON fields of Card %v, got %v", fields, expected)
+	}
+}
+
+func TestDecodeCards_FieldMap(t *testing.T) {
+	data := []byte(`[
+		{"code": "90001", "title": "Homebrew Blade", "textEn": "Fight. +1 damage.", "textIt": "Combattere. +1 danno."},
+		{"code": "90002", "name": "Standard", "text": "Investigate."}
+	]`)
+	fields := FieldMap{"name": "title", "text": "textEn"}
+
+	cards, err := decodeCards(data, fields)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cards) != 2 {
+		t.Fatalf("Expected 2 cards, got %d", len(cards))
+	}
+	if cards[0].Name != "Homebrew Blade" || cards[0].Text != "Fight. +1 damage." {
+		t.Errorf("Expected the mapped name and text, got %+v", cards[0])
+	}
+	if cards[1].Name != "Standard" || cards[1].Text != "Investigate." {
+		t.Errorf("Expected the standard name and text as fallback, got %+v", cards[1])
+	}
+
+	if _, err := decodeCards([]byte(`[{"code": "90003", "textEn": 3}]`), fields); err == nil {
+		t.Error("Expected error for a mapped field of the wrong type, got nil")
+	}
+}
@@ -0,0 +1,109 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+)
+
+// gapsHeader is the first row of the coverage gap CSV
+var gapsHeader = []string{"card_code", "card_name", "is_back", "english_text"}
+
+// coverageGapsQuery selects the entries of text type $2 that have English
+// text but no translation in language $1
+const coverageGapsQuery = `
+	SELECT e.id, e.card_code, e.card_name, e.is_back, e.english_text
+	FROM card_embeddings e
+	WHERE e.text_type = $2 AND e.english_text <> ''
+		AND NOT EXISTS (
+			SELECT 1 FROM card_translations t
+			WHERE t.card_code = e.card_code AND t.is_back = e.is_back
+				AND t.text_type = e.text_type AND t.language = $1 AND t.text <> ''
+		)`
+
+// CoverageGap is an ingested entry without a translation
+type CoverageGap struct {
+	ID          int64  `json:"-"` // card_embeddings row, the pagination key
+	CardCode    string `json:"card_code"`
+	CardName    string `json:"card_name"`
+	IsBack      bool   `json:"is_back"`
+	EnglishText string `json:"english_text"`
+}
+
+// scanCoverageGap reads a row of coverageGapsQuery
+func scanCoverageGap(rows *sql.Rows) (CoverageGap, error) {
+	var gap CoverageGap
+	if err := rows.Scan(&gap.ID, &gap.CardCode, &gap.CardName, &gap.IsBack, &gap.EnglishText); err != nil {
+		return gap, fmt.Errorf("failed to scan coverage gap: %w", err)
+	}
+	return gap, nil
+}
+
+// CoverageGaps returns a page of the entries ExportCoverageGaps writes, in
+// ingestion (id) order rather than by card code, so the listing can be paged
+// by id
+func CoverageGaps(ctx context.Context, database *sql.DB, language, textType string, page db.Page) ([]CoverageGap, db.PageInfo, error) {
+	rows, total, err := db.QueryPage(ctx, database, coverageGapsQuery, page, language, textType)
+	if err != nil {
+		return nil, db.PageInfo{}, fmt.Errorf("failed to query coverage gaps: %w", err)
+	}
+	defer rows.Close()
+
+	gaps := []CoverageGap{}
+	for rows.Next() {
+		gap, err := scanCoverageGap(rows)
+		if err != nil {
+			return nil, db.PageInfo{}, err
+		}
+		gaps = append(gaps, gap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, db.PageInfo{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	gaps, info := db.Paginate(page, total, gaps, func(gap CoverageGap) int64 { return gap.ID })
+	return gaps, info, nil
+}
+
+// ExportCoverageGaps writes a CSV of the ingested entries of textType that
+// have English text but no translation in language, ordered by card code,
+// so translators know what is left to translate. It returns the number of
+// entries written.
+func ExportCoverageGaps(database *sql.DB, w io.Writer, language, textType string) (int, error) {
+	rows, err := database.Query(coverageGapsQuery+" ORDER BY e.card_code, e.is_back", language, textType)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query coverage gaps: %w", err)
+	}
+	defer rows.Close()
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(gapsHeader); err != nil {
+		return 0, fmt.Errorf("failed to write coverage gaps: %w", err)
+	}
+
+	count := 0
+	for rows.Next() {
+		gap, err := scanCoverageGap(rows)
+		if err != nil {
+			return count, err
+		}
+		if err := writer.Write([]string{gap.CardCode, gap.CardName, strconv.FormatBool(gap.IsBack), gap.EnglishText}); err != nil {
+			return count, fmt.Errorf("failed to write coverage gaps: %w", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return count, fmt.Errorf("failed to write coverage gaps: %w", err)
+	}
+	return count, nil
+}
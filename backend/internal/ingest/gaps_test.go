@@ -0,0 +1,85 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"reflect"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+	"github.com/ventrosky/arkham-localize/backend/internal/testdb"
+)
+
+func TestExportCoverageGaps(t *testing.T) {
+	database := testdb.Start(t)
+
+	testdb.InsertCard(t, database, "01020", "Machete", rag.TextRules, "Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(1), map[string]string{"it": "Combatti. Ricevi +1 [combat] in questo attacco."})
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", rag.TextRules, "Fast.\nYou get +1 [intellect] while investigating.",
+		testdb.Embedding(0, 1), map[string]string{"fr": "Rapide.\nVous obtenez +1 [intellect] lorsque vous enquêtez."})
+	testdb.InsertCard(t, database, "01020", "Machete", rag.TextFlavor, "A well-worn blade.", testdb.Embedding(0, 0, 1), nil)
+
+	var out bytes.Buffer
+	count, err := ExportCoverageGaps(database, &out, "it", rag.TextRules)
+	if err != nil {
+		t.Fatalf("ExportCoverageGaps failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 gap, got %d", count)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	expected := [][]string{
+		gapsHeader,
+		{"01030", "Magnifying Glass", "false", "Fast.\nYou get +1 [intellect] while investigating."},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected %q, got %q", expected, records)
+	}
+}
+
+func TestCoverageGaps_Pages(t *testing.T) {
+	database := testdb.Start(t)
+
+	for i, code := range []string{"01020", "01030", "01040"} {
+		embedding := make([]float64, i+1)
+		embedding[i] = 1
+		testdb.InsertCard(t, database, code, "Card "+code, rag.TextRules, "Draw 1 card.", testdb.Embedding(embedding...), nil)
+	}
+	testdb.InsertCard(t, database, "01050", "Translated", rag.TextRules, "Draw 1 card.",
+		testdb.Embedding(0, 0, 0, 1), map[string]string{"it": "Pesca 1 carta."})
+
+	var codes []string
+	page := db.Page{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("Expected 2 pages, got more: %v", codes)
+		}
+		gaps, info, err := CoverageGaps(context.Background(), database, "it", rag.TextRules, page)
+		if err != nil {
+			t.Fatalf("CoverageGaps failed: %v", err)
+		}
+		if info.Total != 3 {
+			t.Errorf("Expected a total of 3 gaps, got %d", info.Total)
+		}
+		for _, gap := range gaps {
+			codes = append(codes, gap.CardCode)
+		}
+		if info.Next == "" {
+			break
+		}
+		if page.After, err = db.ParseCursor(info.Next); err != nil {
+			t.Fatalf("Invalid next cursor: %v", err)
+		}
+	}
+
+	expected := []string{"01020", "01030", "01040"}
+	if !reflect.DeepEqual(codes, expected) {
+		t.Errorf("Expected %v, got %v", expected, codes)
+	}
+}
@@ -0,0 +1,831 @@
+package ingest
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	_ "github.com/lib/pq"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+type Card struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	RealName   string `json:"real_name"` // English name, when Name is localized
+	BackName   string `json:"back_name"` // Set when the back has its own name
+	Subname    string `json:"subname"`   // Subtitle, e.g. "The Fed" for Roland Banks
+	Text       string `json:"text"`
+	RealText   string `json:"real_text"`
+	BackText   string `json:"back_text"`
+	Flavor     string `json:"flavor"`
+	BackFlavor string `json:"back_flavor"`
+	// TypeCode and FactionCode are ArkhamDB's card type (asset, event,
+	// treachery, ...) and faction (guardian, neutral, mythos, ...)
+	TypeCode    string `json:"type_code"`
+	FactionCode string `json:"faction_code"`
+	// EncounterCode is the encounter set of the encounter deck, scenario and
+	// story cards of the *_encounter.json pack files (empty for player cards)
+	EncounterCode string `json:"encounter_code"`
+	// PackCode is the pack the card was released in, e.g. "dwl"
+	PackCode string `json:"pack_code"`
+}
+
+type CardEntry struct {
+	CardCode     string
+	CardName     string
+	IsBack       bool
+	TextType     string // rag.TextRules, rag.TextFlavor or rag.TextName
+	EnglishText  string
+	Translations map[string]string // Language code -> translated text
+	SourceFile   string            // Pack file path relative to the data directory
+	TypeCode     string            // Card.TypeCode
+	FactionCode  string            // Card.FactionCode
+	// EncounterCode is Card.EncounterCode, empty for player cards
+	EncounterCode string
+	// PackCode is Card.PackCode, or the pack of SourceFile when the card has
+	// none (see setSource)
+	PackCode string
+}
+
+// ProgressFunc is called after each batch with the number of entries
+// processed so far, how many of them failed, the total number of entries,
+// and the errors from that batch
+type ProgressFunc func(processed, failed, total int, batchErrors []error)
+
+// Options configures an ingestion run
+type Options struct {
+	DataPath          string // Path to the arkhamdb-json-data directory
+	APIKey            string
+	EmbeddingModel    string
+	BatchSize         int
+	Workers           int      // Concurrent embedding requests per batch (0 = one per entry)
+	EmbedTranslations bool     // Also embed translated texts for target-language retrieval
+	Clear             bool     // Clear existing data before ingestion
+	Limit             int      // Limit number of entries to process (0 = all)
+	Strict            bool     // Fail on unparseable or invalid card files instead of skipping them
+	Full              bool     // Reprocess all files, ignoring the recorded source hashes
+	IncludeFlavor     bool     // Also ingest flavor text as separate entries
+	IncludeNames      bool     // Also ingest card names as separate entries
+	ExcludePacks      []string // Pack directory names (e.g. "promo") whose cards are not ingested
+	Duplicates        string   // Entry kept when pack files repeat one: DuplicatesFirst (default) or DuplicatesLatest (by packs.json release order)
+	Progress          ProgressFunc
+	Reporter          *ProgressReporter      // Progress output for the CLI (nil prints only warnings)
+	Metric            rag.Metric             // Distance metric of the ivfflat indexes (empty = cosine)
+	Store             rag.VectorStore        // Where the embedded entries are written (nil = the postgres tables of the ingest database)
+	Priorities        options.CardPriorities // Priority stored with each entry, by card code prefix (nil = 0 for all)
+	Fields            FieldMap               // Alternative JSON field names of the card files (nil = arkhamdb's)
+}
+
+// store returns the configured vector store, defaulting to the postgres
+// tables of db
+func (o Options) store(db *sql.DB) rag.VectorStore {
+	if o.Store != nil {
+		return o.Store
+	}
+	return rag.NewPostgresStore(db)
+}
+
+// textTypes returns the text types to extract from each card side
+func (o Options) textTypes() []string {
+	textTypes := []string{rag.TextRules}
+	if o.IncludeFlavor {
+		textTypes = append(textTypes, rag.TextFlavor)
+	}
+	if o.IncludeNames {
+		textTypes = append(textTypes, rag.TextName)
+	}
+	return textTypes
+}
+
+// metric returns the configured metric, defaulting to cosine
+func (o Options) metric() rag.Metric {
+	if o.Metric == "" {
+		return rag.MetricCosine
+	}
+	return o.Metric
+}
+
+// checkEmbeddingModel fails when the embeddings of a known model don't fit
+// the card_embeddings column, before any embedding is paid for
+func checkEmbeddingModel(database *sql.DB, model string) error {
+	dimensions, err := db.EmbeddingDimensions(database, cardEmbeddingsTable.name)
+	if err != nil {
+		return err
+	}
+	return embeddings.CheckDimensions(model, 0, dimensions)
+}
+
+// Run executes the full ingestion pipeline: schema setup, optional clearing,
+// loading translations and card files, and embedding and storing the entries
+func Run(db *sql.DB, opts Options) error {
+	if _, err := os.Stat(opts.DataPath); os.IsNotExist(err) {
+		return fmt.Errorf("data directory not found: %s", opts.DataPath)
+	}
+
+	// Setup database schema
+	if err := SetupDatabase(db); err != nil {
+		return fmt.Errorf("failed to setup database: %w", err)
+	}
+	if err := checkEmbeddingModel(db, opts.EmbeddingModel); err != nil {
+		return err
+	}
+	if err := EnsureIndexes(db, opts.metric()); err != nil {
+		return fmt.Errorf("failed to setup indexes: %w", err)
+	}
+
+	// Clear existing data if requested
+	if opts.Clear {
+		if err := ClearDatabase(db); err != nil {
+			return err
+		}
+	}
+
+	report := &FileReport{Strict: opts.Strict, Reporter: opts.Reporter, Fields: opts.Fields}
+
+	// Load translations for all supported languages
+	fmt.Println("\nLoading translations for all supported languages...")
+	allTranslations := make(map[string]TranslationDict) // language -> TranslationDict
+	for _, lang := range SupportedLanguages {
+		fmt.Printf("Loading %s translations...\n", lang)
+		translations, err := LoadTranslations(opts.DataPath, lang, report)
+		if err != nil {
+			if opts.Strict {
+				return fmt.Errorf("failed to load %s translations: %w", lang, err)
+			}
+			fmt.Printf("Warning: Failed to load %s translations: %v\n", lang, err)
+			continue
+		}
+		allTranslations[lang] = translations
+		fmt.Printf("✓ Loaded %d card translations for %s\n", len(translations), lang)
+	}
+
+	// Process card files
+	fmt.Println("\nExtracting card data...")
+	entries, err := ProcessCardFiles(opts.DataPath, allTranslations, report, opts.textTypes(), opts.ExcludePacks, opts.Duplicates, opts.Reporter)
+	if err != nil {
+		return fmt.Errorf("failed to process card files: %w", err)
+	}
+	report.Print()
+
+	if len(entries) == 0 {
+		return fmt.Errorf("no cards found to process")
+	}
+
+	// Only reprocess source files that changed since the last run
+	currentHashes, err := HashSourceFiles(opts.DataPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash source files: %w", err)
+	}
+	// Excluded files are not recorded, so they are ingested once no longer excluded
+	for _, pack := range opts.ExcludePacks {
+		for sourceFile := range currentHashes {
+			if sourcePack(sourceFile) == pack {
+				delete(currentHashes, sourceFile)
+			}
+		}
+	}
+	// Files that could not be parsed keep their entries, and are not
+	// recorded so that they are retried next time
+	unreadable := report.skippedSources(opts.DataPath)
+	cards := sourceCards(entries)
+	storedHashes, err := LoadSourceHashes(db)
+	if err != nil {
+		return err
+	}
+	// Unchanged files keep their cards, so this only finds those of removed
+	// or changed files
+	if err := deleteStaleEntries(db, opts, currentHashes, storedHashes, unreadable, entries); err != nil {
+		return err
+	}
+	changed := make(map[string]bool, len(currentHashes))
+	for path := range currentHashes {
+		changed[path] = true
+	}
+	if !opts.Full {
+		changed = changedSourceFiles(currentHashes, storedHashes)
+		fmt.Printf("\n%d of %d source files changed since the last ingest (use -full to reprocess all)\n", len(changed), len(currentHashes))
+
+		var changedEntries []CardEntry
+		for _, entry := range entries {
+			if changed[entry.SourceFile] {
+				changedEntries = append(changedEntries, entry)
+			}
+		}
+		entries = changedEntries
+	}
+	for path := range unreadable {
+		delete(changed, path)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("✓ Nothing to ingest, all source files are up to date")
+		return SaveSourceHashes(db, filterHashes(currentHashes, changed), cards)
+	}
+
+	// Limit entries if requested (useful for testing)
+	limited := false
+	if opts.Limit > 0 && opts.Limit < len(entries) {
+		entries = entries[:opts.Limit]
+		limited = true
+		fmt.Printf("⚠️  Limited to first %d entries for testing\n", opts.Limit)
+	}
+
+	// Generate embeddings and ingest
+	fmt.Printf("\nGenerating embeddings using %s...\n", opts.EmbeddingModel)
+	if opts.EmbedTranslations {
+		fmt.Println("Translated texts will be embedded too")
+	}
+	failedEntries, err := IngestCards(db, entries, opts)
+	if err != nil {
+		return fmt.Errorf("failed to ingest cards: %w", err)
+	}
+
+	// Record the processed files, except those with failed entries so they
+	// are retried next time. Limited runs are partial and not recorded.
+	if limited {
+		return nil
+	}
+	for _, entry := range failedEntries {
+		delete(changed, entry.SourceFile)
+	}
+	if err := SaveSourceHashes(db, filterHashes(currentHashes, changed), cards); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deleteStaleEntries deletes the stored entries of the cards no longer in
+// the source files: the card codes recorded for the current (but not
+// unreadable) and removed files that none of entries (read from all current
+// files) has. It also forgets the removed files.
+func deleteStaleEntries(db *sql.DB, opts Options, current, stored map[string]string, unreadable map[string]bool, entries []CardEntry) error {
+	removed := removedSourceFiles(current, stored, opts.ExcludePacks)
+	recorded, err := LoadSourceCards(db)
+	if err != nil {
+		return err
+	}
+
+	paths := append([]string(nil), removed...)
+	for path := range current {
+		if !unreadable[path] {
+			paths = append(paths, path)
+		}
+	}
+	stale := staleCards(recorded, paths, entries)
+	if len(stale) > 0 {
+		store := opts.store(db)
+		deleted := 0
+		for _, code := range stale {
+			n, err := store.Delete(code)
+			if err != nil {
+				return fmt.Errorf("failed to delete the entries of card %s: %w", code, err)
+			}
+			deleted += n
+		}
+		fmt.Printf("✓ Deleted %d entries of %d cards no longer in the source files\n", deleted, len(stale))
+	}
+
+	if len(removed) > 0 {
+		if err := DeleteSourceFiles(db, removed); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Forgot %d removed source files\n", len(removed))
+	}
+	return nil
+}
+
+// filterHashes returns the hashes of the given paths only
+func filterHashes(hashes map[string]string, paths map[string]bool) map[string]string {
+	filtered := make(map[string]string, len(paths))
+	for path := range paths {
+		if hash, ok := hashes[path]; ok {
+			filtered[path] = hash
+		}
+	}
+	return filtered
+}
+
+// SetupDatabase brings the schema up to date by applying pending migrations
+func SetupDatabase(database *sql.DB) error {
+	applied, err := db.Migrate(database)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	for _, migration := range applied {
+		fmt.Printf("  Applied migration %04d_%s\n", migration.Version, migration.Name)
+	}
+	fmt.Println("✓ Database schema initialized")
+	return nil
+}
+
+// ClearDatabase removes all ingested entries
+func ClearDatabase(db *sql.DB) error {
+	if _, err := db.Exec("TRUNCATE TABLE card_embeddings, card_translations, source_files"); err != nil {
+		return fmt.Errorf("failed to clear database: %w", err)
+	}
+	fmt.Println("✓ Cleared existing data")
+	return nil
+}
+
+func extractCardText(card Card, isBack bool) string {
+	if isBack {
+		return strings.TrimSpace(card.BackText)
+	}
+	if card.Text != "" {
+		return strings.TrimSpace(card.Text)
+	}
+	return strings.TrimSpace(card.RealText)
+}
+
+// extractFlavorText returns the flavor text of one side of a card
+func extractFlavorText(card Card, isBack bool) string {
+	if isBack {
+		return strings.TrimSpace(card.BackFlavor)
+	}
+	return strings.TrimSpace(card.Flavor)
+}
+
+// extractNameText returns the name of one side of a card as a name entry:
+// the name, followed by the subtitle on its own line. A back only has a name
+// entry when it is named differently from the front.
+func extractNameText(card Card, isBack bool) string {
+	if isBack {
+		if card.BackName == "" || card.BackName == card.Name {
+			return ""
+		}
+		return strings.TrimSpace(card.BackName)
+	}
+	name := strings.TrimSpace(card.Name)
+	if subname := strings.TrimSpace(card.Subname); subname != "" && name != "" {
+		name += "\n" + subname
+	}
+	return name
+}
+
+// cardName returns the English name of one side of a card
+func cardName(card Card, isBack bool) string {
+	if isBack && card.BackName != "" {
+		return card.BackName
+	}
+	if card.RealName != "" {
+		return card.RealName
+	}
+	return card.Name
+}
+
+// buildEntry builds the entry for one side and text type of a card, along
+// with the available translations. It reports false if no language has a
+// translation. EnglishText is empty when the card has no such text.
+func buildEntry(card Card, isBack bool, textType string, allTranslations map[string]TranslationDict) (CardEntry, bool) {
+	entry := CardEntry{
+		CardCode:      card.Code,
+		CardName:      cardName(card, isBack),
+		IsBack:        isBack,
+		TextType:      textType,
+		Translations:  make(map[string]string),
+		TypeCode:      card.TypeCode,
+		FactionCode:   card.FactionCode,
+		EncounterCode: card.EncounterCode,
+		PackCode:      card.PackCode,
+	}
+	switch textType {
+	case rag.TextFlavor:
+		entry.EnglishText = extractFlavorText(card, isBack)
+	case rag.TextName:
+		entry.EnglishText = extractNameText(card, isBack)
+	default:
+		entry.EnglishText = extractCardText(card, isBack)
+	}
+	if entry.EnglishText == "" {
+		return entry, false
+	}
+
+	for _, lang := range SupportedLanguages {
+		if transDict, ok := allTranslations[lang]; ok {
+			if transText, found := findTranslation(card.Code, transDict, isBack, textType); found {
+				entry.Translations[lang] = transText
+			}
+		}
+	}
+	return entry, len(entry.Translations) > 0
+}
+
+type TranslationDict map[string]map[string]string
+
+// SupportedLanguages lists the languages translations are ingested for
+var SupportedLanguages = options.SupportedLanguages
+
+// LoadTranslations loads the translated card texts for a language, keyed by card code
+func LoadTranslations(dataPath, language string, report *FileReport) (TranslationDict, error) {
+	translationsDir := filepath.Join(dataPath, "translations", language, "pack")
+	translations := make(TranslationDict)
+
+	if _, err := os.Stat(translationsDir); os.IsNotExist(err) {
+		return translations, nil
+	}
+
+	packDirs, err := filepath.Glob(filepath.Join(translationsDir, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, packDir := range packDirs {
+		if info, err := os.Stat(packDir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		jsonFiles, err := filepath.Glob(filepath.Join(packDir, "*.json"))
+		if err != nil {
+			continue
+		}
+
+		for _, jsonFile := range jsonFiles {
+			cards, err := report.readCardFile(jsonFile)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, card := range cards {
+				if card.Code == "" {
+					continue
+				}
+
+				if translations[card.Code] == nil {
+					translations[card.Code] = make(map[string]string)
+				}
+
+				if name := extractNameText(card, false); name != "" {
+					translations[card.Code]["name"] = name
+				}
+
+				if backName := extractNameText(card, true); backName != "" {
+					translations[card.Code]["back_name"] = backName
+				}
+
+				if text := extractCardText(card, false); text != "" {
+					translations[card.Code]["text"] = text
+				}
+
+				if backText := extractCardText(card, true); backText != "" {
+					translations[card.Code]["back_text"] = backText
+				}
+
+				if flavor := extractFlavorText(card, false); flavor != "" {
+					translations[card.Code]["flavor"] = flavor
+				}
+
+				if backFlavor := extractFlavorText(card, true); backFlavor != "" {
+					translations[card.Code]["back_flavor"] = backFlavor
+				}
+			}
+		}
+	}
+
+	return translations, nil
+}
+
+func findTranslation(code string, translations TranslationDict, isBack bool, textType string) (string, bool) {
+	cardTrans, exists := translations[code]
+	if !exists {
+		return "", false
+	}
+
+	key := "text"
+	switch textType {
+	case rag.TextFlavor:
+		key = "flavor"
+	case rag.TextName:
+		key = "name"
+	}
+	if isBack {
+		key = "back_" + key
+	}
+
+	text, exists := cardTrans[key]
+	if !exists {
+		return "", false
+	}
+
+	return text, true
+}
+
+// ProcessCardFiles extracts the front and back texts of all English cards
+// that have at least one translation, as one entry per text type in
+// textTypes (rag.TextRules, plus rag.TextFlavor or rag.TextName when
+// enabled). The packs in excludePacks (pack directory names, e.g. "promo")
+// are skipped; their entries are only counted, and their files are not
+// validated. Entries repeated across pack files are collapsed to one, by the
+// duplicates policy (see collapseDuplicates). Progress is reported per file.
+func ProcessCardFiles(dataPath string, allTranslations map[string]TranslationDict, report *FileReport, textTypes []string, excludePacks []string, duplicates string, progress *ProgressReporter) ([]CardEntry, error) {
+	packDir := filepath.Join(dataPath, "pack")
+	var entries []CardEntry
+	skipped := 0
+	excluded := 0
+
+	excludedPacks := make(map[string]bool, len(excludePacks))
+	for _, pack := range excludePacks {
+		excludedPacks[pack] = true
+		if info, err := os.Stat(filepath.Join(packDir, pack)); err != nil || !info.IsDir() {
+			progress.Warnf("No pack directory named %q to exclude", pack)
+		}
+	}
+
+	packDirs, err := filepath.Glob(filepath.Join(packDir, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Scanning card files in %s...\n", packDir)
+
+	var jsonFiles []string
+	for _, packSubdir := range packDirs {
+		if info, err := os.Stat(packSubdir); err != nil || !info.IsDir() {
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(packSubdir, "*.json"))
+		if err != nil {
+			continue
+		}
+		jsonFiles = append(jsonFiles, files...)
+	}
+
+	progress.Start("Extracting", len(jsonFiles))
+	for _, jsonFile := range jsonFiles {
+		if excludedPacks[filepath.Base(filepath.Dir(jsonFile))] {
+			// Not validated nor reported: an excluded pack may well be broken
+			data, err := os.ReadFile(jsonFile)
+			if err == nil {
+				if cards, err := decodeCards(data, report.Fields); err == nil {
+					fileEntries, _ := extractEntries(cards, allTranslations, textTypes)
+					excluded += len(fileEntries)
+				}
+			}
+			progress.Add(1, 0)
+			continue
+		}
+
+		cards, err := report.readCardFile(jsonFile)
+		if err != nil {
+			return nil, err
+		}
+
+		sourceFile, err := filepath.Rel(dataPath, jsonFile)
+		if err != nil {
+			return nil, err
+		}
+		sourceFile = filepath.ToSlash(sourceFile)
+
+		fileEntries, fileSkipped := extractEntries(cards, allTranslations, textTypes)
+		for i := range fileEntries {
+			fileEntries[i].setSource(sourceFile)
+		}
+		entries = append(entries, fileEntries...)
+		skipped += fileSkipped
+		progress.Add(1, 0)
+	}
+	progress.Done()
+
+	// The store keeps one row per card side and text type, so embed only one
+	if duplicates == "" {
+		duplicates = DuplicatesFirst
+	}
+	var releases map[string]int
+	if duplicates == DuplicatesLatest {
+		if releases, err = readReleaseOrder(dataPath); err != nil {
+			progress.Warnf("Could not read the pack release order, keeping the last duplicate in path order: %v", err)
+		}
+	}
+	entries, collapsed := collapseDuplicates(entries, duplicates, releases, progress)
+	if collapsed > 0 {
+		fmt.Printf("✓ Collapsed %d duplicate entries, keeping the %s one\n", collapsed, duplicates)
+	}
+
+	encounter := 0
+	for _, entry := range entries {
+		if entry.EncounterCode != "" {
+			encounter++
+		}
+	}
+	fmt.Printf("✓ Extracted %d card entries, %d of them encounter, scenario or story text (skipped %d)\n", len(entries), encounter, skipped)
+	if len(excludePacks) > 0 {
+		fmt.Printf("✓ Excluded %d entries from the packs: %s\n", excluded, strings.Join(excludePacks, ", "))
+	}
+	return entries, nil
+}
+
+// extractEntries returns the entries of cards with at least one
+// translation, and the number of cards and texts skipped
+func extractEntries(cards []Card, allTranslations map[string]TranslationDict, textTypes []string) ([]CardEntry, int) {
+	var entries []CardEntry
+	skipped := 0
+	for _, card := range cards {
+		if card.Code == "" {
+			skipped++
+			continue
+		}
+
+		hasText := false
+		for _, isBack := range []bool{false, true} {
+			for _, textType := range textTypes {
+				entry, ok := buildEntry(card, isBack, textType, allTranslations)
+				if entry.EnglishText != "" && textType == rag.TextRules {
+					hasText = true
+				}
+				if entry.EnglishText == "" {
+					continue
+				}
+				if !ok {
+					skipped++ // No translation in any language
+					continue
+				}
+				entries = append(entries, entry)
+			}
+		}
+		if !hasText {
+			skipped++
+		}
+	}
+	return entries, skipped
+}
+
+// sourcePack returns the pack directory name of a source file path relative
+// to the data directory, e.g. "core" for "pack/core/core.json"
+func sourcePack(sourceFile string) string {
+	return path.Base(path.Dir(sourceFile))
+}
+
+// sourcePackCode returns the pack code of a pack file path: its name without
+// the extension and the _encounter suffix, e.g. "dwl" for
+// "pack/dwl/dwl_encounter.json"
+func sourcePackCode(sourceFile string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(path.Base(sourceFile), ".json"), "_encounter")
+}
+
+// setSource records the pack file the entry was read from, which also gives
+// its pack code when the card has none
+func (e *CardEntry) setSource(sourceFile string) {
+	e.SourceFile = sourceFile
+	if e.PackCode == "" {
+		e.PackCode = sourcePackCode(sourceFile)
+	}
+}
+
+// IngestCards embeds the entries and upserts them into the vector store
+// (opts.Store, or the postgres tables of db), replacing any existing entry
+// for the same card side. When opts.EmbedTranslations is set, each available
+// translation is embedded too, enabling target-language retrieval. Identical
+// texts are embedded once and the vector is shared by every entry (each still
+// gets its own rows). It returns the entries whose embedding failed.
+func IngestCards(db *sql.DB, entries []CardEntry, opts Options) ([]CardEntry, error) {
+	var failedEntries []CardEntry
+	total := len(entries)
+	inserted := 0
+	processed := 0
+	failed := 0
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+
+	cache := newEmbeddingCache(opts.APIKey, opts.EmbeddingModel)
+	store := opts.store(db)
+
+	opts.Reporter.Start("Embedding", total)
+	for i := 0; i < total; i += batchSize {
+		end := i + batchSize
+		if end > total {
+			end = total
+		}
+		batch := entries[i:end]
+
+		// Generate embeddings in parallel with a bounded pool of workers
+		results := make([]batchItem, len(batch))
+		runParallel(len(batch), opts.Workers, func(idx int) {
+			results[idx] = embedEntry(batch[idx], opts, cache)
+			if results[idx].err != nil {
+				opts.Reporter.Add(1, 1)
+			} else {
+				opts.Reporter.Add(1, 0)
+			}
+		})
+
+		// Insert batch
+		succeeded := make([]rag.StoreEntry, 0, len(batch))
+		var batchErrors []error
+		for _, result := range results {
+			if result.err != nil {
+				opts.Reporter.Warnf("Error generating embedding for '%s' (%s): %v",
+					result.entry.CardName, map[bool]string{false: "front", true: "back"}[result.entry.IsBack], result.err)
+				batchErrors = append(batchErrors, fmt.Errorf("%s (%s): %w", result.entry.CardName, result.entry.CardCode, result.err))
+				failedEntries = append(failedEntries, result.entry)
+				continue
+			}
+			succeeded = append(succeeded, result.storeEntry(opts.EmbeddingModel, opts.Priorities))
+		}
+
+		if len(succeeded) > 0 {
+			if err := store.Upsert(succeeded); err != nil {
+				opts.Reporter.Done()
+				return nil, fmt.Errorf("failed to insert batch: %w", err)
+			}
+			inserted += len(succeeded)
+		}
+
+		processed += len(batch)
+		failed += len(batchErrors)
+		if opts.Progress != nil {
+			opts.Progress(processed, failed, total, batchErrors)
+		}
+	}
+
+	opts.Reporter.Done()
+
+	fmt.Printf("✓ Ingested %d card entries into database\n", inserted)
+	if calls, saved := cache.stats(); saved > 0 {
+		fmt.Printf("  Made %d embedding calls, saved %d by reusing the embeddings of identical texts\n", calls, saved)
+	}
+	return failedEntries, nil
+}
+
+type batchItem struct {
+	entry                 CardEntry
+	embedding             []float32
+	translationEmbeddings map[string][]float32 // Language code -> embedding of translated text
+	err                   error
+}
+
+// storeEntry converts a successfully embedded item for the vector store
+func (item batchItem) storeEntry(embeddingModel string, priorities options.CardPriorities) rag.StoreEntry {
+	e := item.entry
+	return rag.StoreEntry{
+		CardCode:              e.CardCode,
+		CardName:              e.CardName,
+		IsBack:                e.IsBack,
+		TextType:              e.TextType,
+		EnglishText:           e.EnglishText,
+		Embedding:             item.embedding,
+		Translations:          e.Translations,
+		TranslationEmbeddings: item.translationEmbeddings,
+		EmbeddingModel:        embeddingModel,
+		Priority:              priorities.Priority(e.CardCode),
+		TypeCode:              e.TypeCode,
+		FactionCode:           e.FactionCode,
+		EncounterCode:         e.EncounterCode,
+		PackCode:              e.PackCode,
+	}
+}
+
+// embedEntry generates the embeddings for a single entry
+func embedEntry(e CardEntry, opts Options, cache *embeddingCache) batchItem {
+	emb, err := cache.get(e.EnglishText)
+	item := batchItem{entry: e, embedding: emb, err: err}
+	if err == nil && opts.EmbedTranslations {
+		item.translationEmbeddings = make(map[string][]float32)
+		for lang, text := range e.Translations {
+			transEmb, err := cache.get(text)
+			if err != nil {
+				opts.Reporter.Warnf("Error generating %s embedding for '%s': %v", lang, e.CardName, err)
+				continue
+			}
+			item.translationEmbeddings[lang] = transEmb
+		}
+	}
+	return item
+}
+
+// runParallel calls fn for each index in [0, n) using at most workers
+// goroutines (n if workers <= 0)
+func runParallel(n, workers int, fn func(idx int)) {
+	if workers <= 0 || workers > n {
+		workers = n
+	}
+
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				fn(idx)
+			}
+		}()
+	}
+	for idx := 0; idx < n; idx++ {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,324 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+	"github.com/ventrosky/arkham-localize/backend/internal/testdb"
+)
+
+func TestBuildEntry_Flavor(t *testing.T) {
+	card := Card{
+		Code:       "01104",
+		Name:       "Lita Chantler",
+		BackName:   "Lita's Back",
+		Text:       "You may spend [action] to investigate.",
+		Flavor:     "She is the last hope.",
+		BackFlavor: "Back flavor.",
+	}
+	translations := map[string]TranslationDict{
+		"it": {"01104": {"text": "Puoi spendere [action] per indagare.", "flavor": "È l'ultima speranza."}},
+	}
+
+	rules, ok := buildEntry(card, false, rag.TextRules, translations)
+	if !ok || rules.EnglishText != card.Text || rules.Translations["it"] != "Puoi spendere [action] per indagare." {
+		t.Errorf("Unexpected rules entry: %+v (ok=%v)", rules, ok)
+	}
+
+	flavor, ok := buildEntry(card, false, rag.TextFlavor, translations)
+	if !ok || flavor.EnglishText != card.Flavor || flavor.Translations["it"] != "È l'ultima speranza." {
+		t.Errorf("Unexpected flavor entry: %+v (ok=%v)", flavor, ok)
+	}
+	if flavor.TextType != rag.TextFlavor {
+		t.Errorf("Expected text type %s, got %s", rag.TextFlavor, flavor.TextType)
+	}
+
+	// The back flavor has no translation in any language
+	backFlavor, ok := buildEntry(card, true, rag.TextFlavor, translations)
+	if ok {
+		t.Errorf("Expected untranslated back flavor to be reported, got %+v", backFlavor)
+	}
+	if backFlavor.CardName != "Lita's Back" {
+		t.Errorf("Expected back name, got %s", backFlavor.CardName)
+	}
+}
+
+func TestBuildEntry_Name(t *testing.T) {
+	card := Card{
+		Code:     "01001",
+		Name:     "Roland Banks",
+		Subname:  "The Fed",
+		BackName: "Roland Banks",
+		Text:     "After you defeat an enemy: Discover 1 clue at your location.",
+	}
+	translations := map[string]TranslationDict{
+		"it": {"01001": {"name": "Roland Banks\nIl Federale"}},
+	}
+
+	name, ok := buildEntry(card, false, rag.TextName, translations)
+	if !ok || name.EnglishText != "Roland Banks\nThe Fed" || name.Translations["it"] != "Roland Banks\nIl Federale" {
+		t.Errorf("Unexpected name entry: %+v (ok=%v)", name, ok)
+	}
+	if name.TextType != rag.TextName {
+		t.Errorf("Expected text type %s, got %s", rag.TextName, name.TextType)
+	}
+
+	// A back named like its front has no name entry of its own
+	if backName := extractNameText(card, true); backName != "" {
+		t.Errorf("Expected no back name entry, got %q", backName)
+	}
+	card.BackName = "The Fed's Files"
+	if backName := extractNameText(card, true); backName != "The Fed's Files" {
+		t.Errorf("Expected back name entry, got %q", backName)
+	}
+}
+
+func TestBuildEntry_Metadata(t *testing.T) {
+	var card Card
+	if err := json.Unmarshal([]byte(`{"code": "01020", "name": "Machete", "text": "Fight.", "type_code": "asset", "faction_code": "guardian"}`), &card); err != nil {
+		t.Fatalf("Failed to decode card: %v", err)
+	}
+	translations := map[string]TranslationDict{
+		"it": {"01020": {"text": "Combattere."}},
+	}
+
+	entry, ok := buildEntry(card, false, rag.TextRules, translations)
+	if !ok || entry.TypeCode != "asset" || entry.FactionCode != "guardian" {
+		t.Fatalf("Expected the type and faction in the entry, got %+v (ok=%v)", entry, ok)
+	}
+	stored := batchItem{entry: entry}.storeEntry("text-embedding-3-small", nil)
+	if stored.TypeCode != "asset" || stored.FactionCode != "guardian" {
+		t.Errorf("Expected the type and faction in the store entry, got %+v", stored)
+	}
+}
+
+func TestExtractEntries_EncounterCards(t *testing.T) {
+	// Shapes of the *_encounter.json pack files: a scenario card with a
+	// back, and an agenda with only back text and flavor
+	var cards []Card
+	data := `[
+		{"code": "01104", "name": "The Gathering", "type_code": "scenario", "faction_code": "mythos", "encounter_code": "torch", "text": "Skull: -X.", "back_text": "Skull: -2."},
+		{"code": "01105", "name": "What's Going On?!", "type_code": "agenda", "faction_code": "mythos", "encounter_code": "torch", "back_flavor": "The walls close in.", "back_text": "Each investigator takes 1 horror."},
+		{"code": "01020", "name": "Machete", "type_code": "asset", "faction_code": "guardian", "text": "Fight."}
+	]`
+	if err := json.Unmarshal([]byte(data), &cards); err != nil {
+		t.Fatalf("Failed to decode cards: %v", err)
+	}
+	translations := map[string]TranslationDict{
+		"it": {
+			"01104": {"text": "Teschio: -X.", "back_text": "Teschio: -2."},
+			"01105": {"back_text": "Ogni investigatore subisce 1 orrore."},
+			"01020": {"text": "Combattere."},
+		},
+	}
+
+	entries, skipped := extractEntries(cards, translations, []string{rag.TextRules})
+	if skipped != 0 || len(entries) != 4 {
+		t.Fatalf("Expected 4 entries and none skipped, got %d and %d skipped: %+v", len(entries), skipped, entries)
+	}
+	for _, entry := range entries {
+		expected := "torch"
+		if entry.CardCode == "01020" {
+			expected = ""
+		}
+		if entry.EncounterCode != expected {
+			t.Errorf("%s (back %v): expected encounter code %q, got %q", entry.CardCode, entry.IsBack, expected, entry.EncounterCode)
+		}
+		if stored := (batchItem{entry: entry}).storeEntry("text-embedding-3-small", nil); stored.EncounterCode != expected {
+			t.Errorf("%s (back %v): expected encounter code %q in the store entry, got %q", entry.CardCode, entry.IsBack, expected, stored.EncounterCode)
+		}
+	}
+}
+
+func TestOptionsTextTypes(t *testing.T) {
+	if types := (Options{}).textTypes(); strings.Join(types, ",") != "rules" {
+		t.Errorf("Expected only rules by default, got %v", types)
+	}
+	if types := (Options{IncludeFlavor: true, IncludeNames: true}).textTypes(); strings.Join(types, ",") != "rules,flavor,name" {
+		t.Errorf("Expected rules, flavor and name, got %v", types)
+	}
+}
+
+func TestCardName_PrefersRealName(t *testing.T) {
+	card := Card{Name: "Machete (IT)", RealName: "Machete"}
+	if name := cardName(card, false); name != "Machete" {
+		t.Errorf("Expected real name Machete, got %s", name)
+	}
+}
+
+func TestCreateIndexStatement_MatchesQueryMetric(t *testing.T) {
+	for _, metric := range []rag.Metric{rag.MetricCosine, rag.MetricInnerProduct, rag.MetricL2} {
+		statement := createIndexStatement(cardEmbeddingsTable, metric)
+		if !strings.Contains(statement, "USING ivfflat (embedding "+metric.OpClass()+")") {
+			t.Errorf("Expected %s index to use %s, got: %s", metric, metric.OpClass(), statement)
+		}
+
+		// The server maps the built index back to the metric it queries with
+		if built, err := rag.MetricForOpClass(metric.OpClass()); err != nil || built != metric {
+			t.Errorf("Expected index built for %s to be queried with %s, got %s (%v)", metric, metric, built, err)
+		}
+	}
+
+	if metric := (Options{}).metric(); metric != rag.MetricCosine {
+		t.Errorf("Expected cosine by default, got %s", metric)
+	}
+}
+
+func TestCheckEmbeddingModel(t *testing.T) {
+	database := testdb.Start(t)
+
+	if err := checkEmbeddingModel(database, "text-embedding-3-small"); err != nil {
+		t.Errorf("Expected text-embedding-3-small to fit the default schema, got %v", err)
+	}
+	if err := checkEmbeddingModel(database, "text-embedding-3-large"); err == nil {
+		t.Error("Expected an error for text-embedding-3-large against 1536-dimensional columns, got nil")
+	}
+}
+
+func TestProcessCardFiles_ExcludePacks(t *testing.T) {
+	dataPath := t.TempDir()
+	writeDataFile(t, dataPath, "pack/core/core.json", `[{"code": "01020", "name": "Machete", "text": "Fight."}]`)
+	writeDataFile(t, dataPath, "pack/promo/promo.json", `[{"code": "98001", "name": "Promo", "text": "Draw 1 card."}, {"code": "98002", "name": "Promo 2", "text": "Investigate."}]`)
+	writeDataFile(t, dataPath, "pack/broken/broken.json", `not json`)
+	translations := map[string]TranslationDict{"it": {
+		"01020": {"text": "Combattere."},
+		"98001": {"text": "Pesca 1 carta."},
+		"98002": {"text": "Indagare."},
+	}}
+
+	testCases := []struct {
+		name     string
+		exclude  []string
+		expected []string
+		skipped  int
+	}{
+		{"None", nil, []string{"01020", "98001", "98002"}, 1},
+		{"Promo", []string{"promo"}, []string{"01020"}, 1},
+		{"Broken", []string{"broken", "unknown"}, []string{"01020", "98001", "98002"}, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			report := &FileReport{}
+			entries, err := ProcessCardFiles(dataPath, translations, report, []string{rag.TextRules}, tc.exclude, DuplicatesFirst, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var codes []string
+			for _, entry := range entries {
+				codes = append(codes, entry.CardCode)
+			}
+			if strings.Join(codes, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected entries %v, got %v", tc.expected, codes)
+			}
+			if len(report.Skipped) != tc.skipped {
+				t.Errorf("Expected %d skipped files, got %+v", tc.skipped, report.Skipped)
+			}
+		})
+	}
+}
+
+func TestSourcePack(t *testing.T) {
+	if pack := sourcePack("pack/promo/promo.json"); pack != "promo" {
+		t.Errorf("Expected promo, got %s", pack)
+	}
+}
+
+func TestCardEntrySetSource(t *testing.T) {
+	testCases := []struct {
+		packCode   string
+		sourceFile string
+		expected   string
+	}{
+		{"", "pack/dwl/dwl.json", "dwl"},
+		{"", "pack/dwl/dwl_encounter.json", "dwl"},
+		{"core", "pack/core/core.json", "core"},
+		{"rcore", "pack/core/core.json", "rcore"}, // The card's own pack code wins
+	}
+	for _, tc := range testCases {
+		entry := CardEntry{PackCode: tc.packCode}
+		entry.setSource(tc.sourceFile)
+		if entry.SourceFile != tc.sourceFile || entry.PackCode != tc.expected {
+			t.Errorf("%s (pack_code %q): expected pack code %q, got %q", tc.sourceFile, tc.packCode, tc.expected, entry.PackCode)
+		}
+		if stored := (batchItem{entry: entry}).storeEntry("text-embedding-3-small", nil); stored.PackCode != tc.expected {
+			t.Errorf("%s: expected pack code %q in the store entry, got %q", tc.sourceFile, tc.expected, stored.PackCode)
+		}
+	}
+}
+
+func TestRun_RemovedSourceFiles(t *testing.T) {
+	database := testdb.Start(t)
+
+	embedding, err := json.Marshal(testdb.Embedding(1, 0))
+	if err != nil {
+		t.Fatalf("Failed to encode embedding: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": [{"embedding": %s}]}`, embedding)
+	}))
+	defer server.Close()
+	defaultBaseURL := openai.BaseURL
+	openai.BaseURL = server.URL
+	defer func() { openai.BaseURL = defaultBaseURL }()
+
+	dataPath := t.TempDir()
+	writeDataFile(t, dataPath, "pack/core/core.json", `[{"code": "01020", "name": "Machete", "text": "Fight."}, {"code": "01030", "name": "Magnifying Glass", "text": "Investigate."}]`)
+	writeDataFile(t, dataPath, "translations/it/pack/core/core.json", `[{"code": "01020", "text": "Combattere."}, {"code": "01030", "text": "Indagare."}]`)
+	writeDataFile(t, dataPath, "pack/dwl/dwl.json", `[{"code": "02001", "name": "Zoey's Cross", "text": "Deal 1 damage."}]`)
+	writeDataFile(t, dataPath, "translations/it/pack/dwl/dwl.json", `[{"code": "02001", "text": "Infliggi 1 danno."}]`)
+
+	opts := Options{DataPath: dataPath, APIKey: "test-key", EmbeddingModel: "text-embedding-3-small", BatchSize: 10}
+	storedCards := func() []string {
+		t.Helper()
+		if err := Run(database, opts); err != nil {
+			t.Fatalf("Failed to ingest: %v", err)
+		}
+		rows, err := database.Query("SELECT card_code FROM card_embeddings ORDER BY card_code")
+		if err != nil {
+			t.Fatalf("Failed to query entries: %v", err)
+		}
+		defer rows.Close()
+		var codes []string
+		for rows.Next() {
+			var code string
+			if err := rows.Scan(&code); err != nil {
+				t.Fatalf("Failed to scan entry: %v", err)
+			}
+			codes = append(codes, code)
+		}
+		return codes
+	}
+
+	if codes := storedCards(); !reflect.DeepEqual(codes, []string{"01020", "01030", "02001"}) {
+		t.Fatalf("Expected all cards after the first run, got %v", codes)
+	}
+
+	// Remove dwl.json, and 01030 from core.json
+	if err := os.RemoveAll(filepath.Join(dataPath, "pack", "dwl")); err != nil {
+		t.Fatalf("Failed to remove pack file: %v", err)
+	}
+	writeDataFile(t, dataPath, "pack/core/core.json", `[{"code": "01020", "name": "Machete", "text": "Fight."}]`)
+
+	if codes := storedCards(); !reflect.DeepEqual(codes, []string{"01020"}) {
+		t.Errorf("Expected only 01020 after the files changed, got %v", codes)
+	}
+	hashes, err := LoadSourceHashes(database)
+	if err != nil {
+		t.Fatalf("Failed to load source hashes: %v", err)
+	}
+	if _, ok := hashes["pack/dwl/dwl.json"]; ok || len(hashes) != 1 {
+		t.Errorf("Expected only pack/core/core.json to be recorded, got %v", hashes)
+	}
+}
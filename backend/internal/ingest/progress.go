@@ -0,0 +1,236 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressMode selects how a ProgressReporter prints progress
+type ProgressMode int
+
+const (
+	ProgressText  ProgressMode = iota // A single updating line for terminals
+	ProgressJSON                      // One JSON object per line, for tooling
+	ProgressQuiet                     // No progress lines, only warnings
+)
+
+const (
+	// progressInterval throttles the updates; the final one is always printed
+	progressInterval = 200 * time.Millisecond
+	// throughputWindow is the span of the rolling throughput used for the ETA
+	throughputWindow = 30 * time.Second
+)
+
+// ProgressReporter prints the progress of a stage (e.g. embedding the
+// entries) with its percentage, ETA and error count. It is safe for
+// concurrent use, so workers can report each finished item. A nil reporter
+// prints nothing but warnings.
+type ProgressReporter struct {
+	mu   sync.Mutex
+	out  io.Writer
+	mode ProgressMode
+	now  func() time.Time
+
+	stage           string
+	total           int
+	processed       int
+	failed          int
+	started         time.Time
+	lastRender      time.Time
+	samples         []progressSample // Within throughputWindow, oldest first
+	lineWidth       int              // Length of the current text line, to clear it
+	lineOutstanding bool             // A text line is waiting for its newline
+}
+
+type progressSample struct {
+	at        time.Time
+	processed int
+}
+
+// progressEvent is a JSON progress line
+type progressEvent struct {
+	Stage          string   `json:"stage"`
+	Processed      int      `json:"processed"`
+	Total          int      `json:"total"`
+	Failed         int      `json:"failed"`
+	Percent        float64  `json:"percent"`
+	ETASeconds     *float64 `json:"eta_seconds"` // null until the throughput is known
+	ElapsedSeconds float64  `json:"elapsed_seconds"`
+	Done           bool     `json:"done"`
+}
+
+// warningEvent is a JSON warning line
+type warningEvent struct {
+	Stage   string `json:"stage"`
+	Warning string `json:"warning"`
+}
+
+// NewProgressReporter returns a reporter printing to out in the given mode
+func NewProgressReporter(out io.Writer, mode ProgressMode) *ProgressReporter {
+	return &ProgressReporter{out: out, mode: mode, now: time.Now}
+}
+
+// Start begins a new stage of total items
+func (p *ProgressReporter) Start(stage string, total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finishLine()
+	now := p.now()
+	p.stage = stage
+	p.total = total
+	p.processed = 0
+	p.failed = 0
+	p.started = now
+	p.lastRender = time.Time{}
+	p.samples = []progressSample{{at: now}}
+	p.render(true)
+}
+
+// Add records processed items, failed of which failed
+func (p *ProgressReporter) Add(processed, failed int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.processed += processed
+	p.failed += failed
+	p.render(p.processed >= p.total)
+}
+
+// Done ends the current stage, printing its final state
+func (p *ProgressReporter) Done() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.mode == ProgressJSON {
+		p.writeJSON(p.event(true))
+		return
+	}
+	p.render(true)
+	p.finishLine()
+}
+
+// Warnf prints a warning without garbling the progress line
+func (p *ProgressReporter) Warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if p == nil {
+		fmt.Printf("  Warning: %s\n", message)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.mode == ProgressJSON {
+		p.writeJSON(warningEvent{Stage: p.stage, Warning: message})
+		return
+	}
+	p.clearLine()
+	fmt.Fprintf(p.out, "  Warning: %s\n", message)
+	p.render(true)
+}
+
+// render prints the current progress, at most once per progressInterval
+// unless force is set. The caller holds p.mu.
+func (p *ProgressReporter) render(force bool) {
+	now := p.now()
+	if p.mode == ProgressQuiet || (!force && now.Sub(p.lastRender) < progressInterval) {
+		return
+	}
+	p.lastRender = now
+
+	p.samples = append(p.samples, progressSample{at: now, processed: p.processed})
+	for len(p.samples) > 2 && now.Sub(p.samples[1].at) > throughputWindow {
+		p.samples = p.samples[1:]
+	}
+
+	event := p.event(false)
+	if p.mode == ProgressJSON {
+		p.writeJSON(event)
+		return
+	}
+
+	line := fmt.Sprintf("  %s: %d/%d (%.1f%%)", p.stage, p.processed, p.total, event.Percent)
+	if event.ETASeconds != nil && p.processed < p.total {
+		eta := time.Duration(*event.ETASeconds * float64(time.Second)).Round(time.Second)
+		line += fmt.Sprintf(", ETA %s", eta)
+	}
+	if p.failed > 0 {
+		line += fmt.Sprintf(", %d errors", p.failed)
+	}
+
+	padding := ""
+	if p.lineWidth > len(line) {
+		padding = strings.Repeat(" ", p.lineWidth-len(line))
+	}
+	fmt.Fprintf(p.out, "\r%s%s", line, padding)
+	p.lineWidth = len(line)
+	p.lineOutstanding = true
+}
+
+// event builds the progress event for the current state. The ETA is based on
+// the throughput over the last throughputWindow. The caller holds p.mu.
+func (p *ProgressReporter) event(done bool) progressEvent {
+	now := p.now()
+	event := progressEvent{
+		Stage:          p.stage,
+		Processed:      p.processed,
+		Total:          p.total,
+		Failed:         p.failed,
+		Percent:        100,
+		ElapsedSeconds: now.Sub(p.started).Seconds(),
+		Done:           done,
+	}
+	if p.total > 0 {
+		event.Percent = float64(p.processed) * 100 / float64(p.total)
+	}
+
+	oldest := p.samples[0]
+	if elapsed := now.Sub(oldest.at).Seconds(); elapsed > 0 && p.processed > oldest.processed {
+		rate := float64(p.processed-oldest.processed) / elapsed
+		eta := float64(p.total-p.processed) / rate
+		if eta < 0 {
+			eta = 0
+		}
+		event.ETASeconds = &eta
+	}
+	return event
+}
+
+// writeJSON prints v as one JSON line. The caller holds p.mu.
+func (p *ProgressReporter) writeJSON(v interface{}) {
+	line, _ := json.Marshal(v) // Plain structs, cannot fail
+	fmt.Fprintf(p.out, "%s\n", line)
+}
+
+// clearLine erases the current text line so another message can take its
+// place. The caller holds p.mu.
+func (p *ProgressReporter) clearLine() {
+	if p.lineOutstanding {
+		fmt.Fprintf(p.out, "\r%s\r", strings.Repeat(" ", p.lineWidth))
+		p.lineOutstanding = false
+		p.lineWidth = 0
+	}
+}
+
+// finishLine ends the current text line, keeping it on screen. The caller
+// holds p.mu.
+func (p *ProgressReporter) finishLine() {
+	if p.lineOutstanding {
+		fmt.Fprintln(p.out)
+		p.lineOutstanding = false
+		p.lineWidth = 0
+	}
+}
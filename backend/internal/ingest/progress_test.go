@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestReporter returns a reporter with a clock advanced by hand
+func newTestReporter(mode ProgressMode) (*ProgressReporter, *bytes.Buffer, *time.Time) {
+	var out bytes.Buffer
+	clock := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	reporter := NewProgressReporter(&out, mode)
+	reporter.now = func() time.Time { return clock }
+	return reporter, &out, &clock
+}
+
+func TestProgressReporter_Text(t *testing.T) {
+	reporter, out, clock := newTestReporter(ProgressText)
+
+	reporter.Start("Embedding", 100)
+	*clock = clock.Add(10 * time.Second)
+	reporter.Add(25, 1)
+	reporter.Warnf("Error generating embedding for '%s'", "Machete")
+
+	output := out.String()
+	if !strings.Contains(output, "Embedding: 25/100 (25.0%), ETA 30s, 1 errors") {
+		t.Errorf("Expected percentage, ETA and errors in %q", output)
+	}
+	if !strings.Contains(output, "\r  Warning: Error generating embedding for 'Machete'\n") {
+		t.Errorf("Expected the warning on its own line in %q", output)
+	}
+
+	reporter.Add(75, 0)
+	reporter.Done()
+	if !strings.HasSuffix(out.String(), "Embedding: 100/100 (100.0%), 1 errors\n") {
+		t.Errorf("Expected the final line to end the output, got %q", out.String())
+	}
+}
+
+func TestProgressReporter_JSON(t *testing.T) {
+	reporter, out, clock := newTestReporter(ProgressJSON)
+
+	reporter.Start("Embedding", 10)
+	*clock = clock.Add(time.Second)
+	reporter.Add(5, 0)
+	reporter.Warnf("boom")
+	*clock = clock.Add(time.Second)
+	reporter.Add(5, 1)
+	reporter.Done()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var last progressEvent
+	for _, line := range lines {
+		if err := json.Unmarshal([]byte(line), &last); err != nil {
+			t.Fatalf("Invalid JSON progress line %q: %v", line, err)
+		}
+	}
+	if !strings.Contains(out.String(), `{"stage":"Embedding","warning":"boom"}`) {
+		t.Errorf("Expected a JSON warning line, got:\n%s", out.String())
+	}
+	if !last.Done || last.Processed != 10 || last.Failed != 1 || last.Percent != 100 || last.ETASeconds == nil || *last.ETASeconds != 0 {
+		t.Errorf("Unexpected final event %+v", last)
+	}
+}
+
+func TestProgressReporter_Quiet(t *testing.T) {
+	reporter, out, _ := newTestReporter(ProgressQuiet)
+
+	reporter.Start("Embedding", 10)
+	reporter.Add(10, 0)
+	reporter.Done()
+
+	if out.Len() != 0 {
+		t.Errorf("Expected no output in quiet mode, got %q", out.String())
+	}
+}
+
+func TestProgressReporter_Concurrent(t *testing.T) {
+	reporter, _, _ := newTestReporter(ProgressJSON)
+	reporter.now = time.Now
+
+	reporter.Start("Embedding", 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reporter.Add(1, i%10/9)
+		}(i)
+	}
+	wg.Wait()
+
+	if reporter.processed != 1000 || reporter.failed != 100 {
+		t.Errorf("Expected 1000 processed and 100 failed, got %d and %d", reporter.processed, reporter.failed)
+	}
+}
+
+func TestProgressReporter_Nil(t *testing.T) {
+	var reporter *ProgressReporter
+	reporter.Start("Embedding", 1)
+	reporter.Add(1, 0)
+	reporter.Done()
+}
@@ -0,0 +1,247 @@
+package ingest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// embeddingTable describes a table whose embeddings Reembed regenerates
+type embeddingTable struct {
+	name       string
+	textColumn string // Column holding the embedded text
+	index      string // ivfflat index on the embedding column
+	// stale selects the rows embedded with another model ($1); for
+	// translations, only rows that were embedded at all
+	stale string
+}
+
+var (
+	cardEmbeddingsTable = embeddingTable{
+		name:       "card_embeddings",
+		textColumn: "english_text",
+		index:      "card_embeddings_embedding_idx",
+		stale:      "embedding_model IS DISTINCT FROM $1",
+	}
+	cardTranslationsTable = embeddingTable{
+		name:       "card_translations",
+		textColumn: "text",
+		index:      "card_translations_embedding_idx",
+		stale:      "(embedding IS NOT NULL OR embedding_model IS NOT NULL) AND embedding_model IS DISTINCT FROM $1",
+	}
+)
+
+// Reembed regenerates the embeddings produced by a model other than
+// opts.EmbeddingModel, in batches of opts.BatchSize. With
+// opts.EmbedTranslations, translation embeddings are regenerated too. If the
+// new model has different dimensions, the embedding columns are resized
+// first. Every updated row records the new model, so an interrupted run
+// resumes where it stopped. The ivfflat indexes are rebuilt at the end, once
+// all rows succeeded, since their clusters depend on the embedded data.
+func Reembed(database *sql.DB, opts Options) error {
+	if err := SetupDatabase(database); err != nil {
+		return err
+	}
+
+	tables := []embeddingTable{cardEmbeddingsTable}
+	if opts.EmbedTranslations {
+		tables = append(tables, cardTranslationsTable)
+	}
+
+	// Probe the model to learn its dimensions
+	probe, err := embeddings.GetEmbedding("Arkham Horror", opts.APIKey, opts.EmbeddingModel)
+	if err != nil {
+		return fmt.Errorf("failed to probe embedding model %s: %w", opts.EmbeddingModel, err)
+	}
+	dimensions := len(probe)
+
+	for _, table := range []embeddingTable{cardEmbeddingsTable, cardTranslationsTable} {
+		current, err := db.EmbeddingDimensions(database, table.name)
+		if err != nil {
+			return err
+		}
+		if current == dimensions {
+			continue
+		}
+		fmt.Printf("Resizing %s.embedding from %d to %d dimensions (existing vectors are cleared)\n", table.name, current, dimensions)
+		if err := resizeEmbeddings(database, table, dimensions); err != nil {
+			return err
+		}
+		if !opts.EmbedTranslations && table == cardTranslationsTable {
+			fmt.Println("⚠️  Translation embeddings were cleared; re-run with translations enabled to restore target-language retrieval")
+		}
+	}
+
+	total := 0
+	for _, table := range tables {
+		var count int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", table.name, table.stale)
+		if err := database.QueryRow(query, opts.EmbeddingModel).Scan(&count); err != nil {
+			return fmt.Errorf("failed to count stale embeddings in %s: %w", table.name, err)
+		}
+		total += count
+	}
+	fmt.Printf("Re-embedding %d rows with %s...\n", total, opts.EmbeddingModel)
+
+	progress := &reembedProgress{total: total, report: opts.Progress}
+	opts.Reporter.Start("Re-embedding", total)
+	for _, table := range tables {
+		if err := reembedTable(database, table, opts, progress); err != nil {
+			opts.Reporter.Done()
+			return err
+		}
+	}
+	opts.Reporter.Done()
+
+	if progress.failed > 0 {
+		return fmt.Errorf("%d rows failed to re-embed; run again to retry them", progress.failed)
+	}
+
+	for _, table := range []embeddingTable{cardEmbeddingsTable, cardTranslationsTable} {
+		if err := rebuildIndex(database, table, opts.metric()); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("✓ Re-embedded %d rows\n", progress.processed)
+	return nil
+}
+
+// reembedProgress accumulates progress across tables
+type reembedProgress struct {
+	total, processed, failed int
+	report                   ProgressFunc
+}
+
+// reembedTable regenerates the stale embeddings of one table in id order
+func reembedTable(database *sql.DB, table embeddingTable, opts Options, progress *reembedProgress) error {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 50
+	}
+
+	query := fmt.Sprintf("SELECT id, %s FROM %s WHERE %s AND id > $2 ORDER BY id LIMIT $3",
+		table.textColumn, table.name, table.stale)
+	update := fmt.Sprintf("UPDATE %s SET embedding = $1, embedding_model = $2 WHERE id = $3", table.name)
+
+	// Failed rows are skipped by moving past them; a later run retries them
+	var lastID int64
+	for {
+		type row struct {
+			id   int64
+			text string
+		}
+		var batch []row
+		rows, err := database.Query(query, opts.EmbeddingModel, lastID, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to query stale embeddings in %s: %w", table.name, err)
+		}
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.text); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan %s row: %w", table.name, err)
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].id
+
+		vectors := make([][]float32, len(batch))
+		errs := make([]error, len(batch))
+		runParallel(len(batch), opts.Workers, func(idx int) {
+			vectors[idx], errs[idx] = embeddings.GetEmbedding(batch[idx].text, opts.APIKey, opts.EmbeddingModel)
+			if errs[idx] != nil {
+				opts.Reporter.Add(1, 1)
+			} else {
+				opts.Reporter.Add(1, 0)
+			}
+		})
+
+		var batchErrors []error
+		for i, r := range batch {
+			if errs[i] != nil {
+				err := fmt.Errorf("%s row %d: %w", table.name, r.id, errs[i])
+				opts.Reporter.Warnf("%v", err)
+				batchErrors = append(batchErrors, err)
+				continue
+			}
+			if _, err := database.Exec(update, pgvector.NewVector(vectors[i]), opts.EmbeddingModel, r.id); err != nil {
+				return fmt.Errorf("failed to update %s row %d: %w", table.name, r.id, err)
+			}
+		}
+
+		progress.processed += len(batch)
+		progress.failed += len(batchErrors)
+		if progress.report != nil {
+			progress.report(progress.processed, progress.failed, progress.total, batchErrors)
+		}
+	}
+}
+
+// resizeEmbeddings changes the dimensions of a table's embedding column,
+// clearing the existing vectors. The model stays recorded on the rows so
+// they are still selected as stale.
+func resizeEmbeddings(database *sql.DB, table embeddingTable, dimensions int) error {
+	queries := []string{
+		fmt.Sprintf("DROP INDEX IF EXISTS %s", table.index),
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN embedding TYPE vector(%d) USING NULL", table.name, dimensions),
+	}
+	for _, query := range queries {
+		if _, err := database.Exec(query); err != nil {
+			return fmt.Errorf("failed to resize %s embeddings: %w", table.name, err)
+		}
+	}
+	return nil
+}
+
+// rebuildIndex recreates a table's ivfflat index over the current embeddings
+func rebuildIndex(database *sql.DB, table embeddingTable, metric rag.Metric) error {
+	queries := []string{
+		fmt.Sprintf("DROP INDEX IF EXISTS %s", table.index),
+		createIndexStatement(table, metric),
+	}
+	for _, query := range queries {
+		if _, err := database.Exec(query); err != nil {
+			return fmt.Errorf("failed to rebuild index %s: %w", table.index, err)
+		}
+	}
+	return nil
+}
+
+// createIndexStatement returns the statement creating a table's ivfflat
+// index with the operator class of metric, matching the retrieval queries
+func createIndexStatement(table embeddingTable, metric rag.Metric) string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s USING ivfflat (embedding %s) WITH (lists = 100)",
+		table.index, table.name, metric.OpClass())
+}
+
+// EnsureIndexes rebuilds the ivfflat indexes whose operator class doesn't
+// match metric, e.g. after switching metrics
+func EnsureIndexes(database *sql.DB, metric rag.Metric) error {
+	for _, table := range []embeddingTable{cardEmbeddingsTable, cardTranslationsTable} {
+		opClass, err := db.IndexOpClass(database, table.index)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if opClass == metric.OpClass() {
+			continue
+		}
+		fmt.Printf("Rebuilding %s with %s (was %q)\n", table.index, metric.OpClass(), opClass)
+		if err := rebuildIndex(database, table, metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pgvector/pgvector-go"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+)
+
+// Snapshots are JSON lines: a snapshotHeader, then one snapshotRecord per
+// row, so that large datasets are streamed rather than held in memory
+const (
+	snapshotFormat  = "arkham-localize-snapshot"
+	snapshotVersion = 1
+)
+
+// snapshotHeader is the first line of a snapshot
+type snapshotHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	Dimensions int       `json:"dimensions"` // Of the embedding columns
+}
+
+// snapshotRecord holds one row; exactly one field is set
+type snapshotRecord struct {
+	CardEmbedding   *snapshotCardEmbedding   `json:"card_embedding,omitempty"`
+	CardTranslation *snapshotCardTranslation `json:"card_translation,omitempty"`
+	SourceFile      *snapshotSourceFile      `json:"source_file,omitempty"`
+}
+
+type snapshotCardEmbedding struct {
+	CardCode       string         `json:"card_code"`
+	CardName       string         `json:"card_name"`
+	IsBack         bool           `json:"is_back"`
+	TextType       string         `json:"text_type"`
+	EnglishText    string         `json:"english_text"`
+	Embedding      snapshotVector `json:"embedding,omitempty"`
+	EmbeddingModel *string        `json:"embedding_model,omitempty"`
+	Priority       float64        `json:"priority,omitempty"`
+	TypeCode       string         `json:"type_code,omitempty"`
+	FactionCode    string         `json:"faction_code,omitempty"`
+	EncounterCode  string         `json:"encounter_code,omitempty"`
+	PackCode       string         `json:"pack_code,omitempty"`
+}
+
+type snapshotCardTranslation struct {
+	CardCode       string         `json:"card_code"`
+	IsBack         bool           `json:"is_back"`
+	TextType       string         `json:"text_type"`
+	Language       string         `json:"language"`
+	Text           string         `json:"text"`
+	Embedding      snapshotVector `json:"embedding,omitempty"` // Only set when ingested with -embed-translations
+	EmbeddingModel *string        `json:"embedding_model,omitempty"`
+}
+
+type snapshotSourceFile struct {
+	Path      string   `json:"path"`
+	Hash      string   `json:"hash"`
+	CardCodes []string `json:"card_codes,omitempty"`
+}
+
+// snapshotVector is an embedding encoded as base64 of its little-endian
+// float32 values, which round-trips exactly and is far smaller than a JSON
+// array of decimals
+type snapshotVector []float32
+
+// MarshalJSON implements json.Marshaler
+func (v snapshotVector) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 4*len(v))
+	for i, value := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(value))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(buf))
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (v *snapshotVector) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid embedding: %w", err)
+	}
+	if len(buf)%4 != 0 {
+		return fmt.Errorf("invalid embedding: %d bytes is not a whole number of float32 values", len(buf))
+	}
+	*v = make(snapshotVector, len(buf)/4)
+	for i := range *v {
+		(*v)[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return nil
+}
+
+// fromVector converts a nullable database vector
+func fromVector(vector *pgvector.Vector) snapshotVector {
+	if vector == nil {
+		return nil
+	}
+	return vector.Slice()
+}
+
+// toVector converts to a nullable database vector
+func (v snapshotVector) toVector() *pgvector.Vector {
+	if v == nil {
+		return nil
+	}
+	vector := pgvector.NewVector(v)
+	return &vector
+}
+
+// SnapshotStats counts the rows of an exported or imported snapshot
+type SnapshotStats struct {
+	CardEmbeddings   int
+	CardTranslations int
+	SourceFiles      int
+}
+
+// ExportSnapshot writes the ingested dataset (entries, translations and the
+// source file hashes, with their embeddings) to w, so it can be restored with
+// ImportSnapshot without calling OpenAI again
+func ExportSnapshot(database *sql.DB, w io.Writer) (SnapshotStats, error) {
+	var stats SnapshotStats
+
+	dimensions, err := db.EmbeddingDimensions(database, cardEmbeddingsTable.name)
+	if err != nil {
+		return stats, err
+	}
+
+	// A single transaction gives a consistent view of the three tables
+	tx, err := database.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return stats, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	header := snapshotHeader{Format: snapshotFormat, Version: snapshotVersion, CreatedAt: time.Now().UTC(), Dimensions: dimensions}
+	if err := encoder.Encode(header); err != nil {
+		return stats, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	err = exportRows(tx, encoder, `
+		SELECT card_code, card_name, is_back, text_type, english_text, embedding, embedding_model, priority, type_code, faction_code, encounter_code, pack_code
+		FROM card_embeddings ORDER BY id
+	`, func(rows *sql.Rows) (snapshotRecord, error) {
+		var row snapshotCardEmbedding
+		var embedding *pgvector.Vector
+		err := rows.Scan(&row.CardCode, &row.CardName, &row.IsBack, &row.TextType, &row.EnglishText, &embedding, &row.EmbeddingModel, &row.Priority, &row.TypeCode, &row.FactionCode, &row.EncounterCode, &row.PackCode)
+		row.Embedding = fromVector(embedding)
+		stats.CardEmbeddings++
+		return snapshotRecord{CardEmbedding: &row}, err
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	err = exportRows(tx, encoder, `
+		SELECT card_code, is_back, text_type, language, text, embedding, embedding_model
+		FROM card_translations ORDER BY id
+	`, func(rows *sql.Rows) (snapshotRecord, error) {
+		var row snapshotCardTranslation
+		var embedding *pgvector.Vector
+		err := rows.Scan(&row.CardCode, &row.IsBack, &row.TextType, &row.Language, &row.Text, &embedding, &row.EmbeddingModel)
+		row.Embedding = fromVector(embedding)
+		stats.CardTranslations++
+		return snapshotRecord{CardTranslation: &row}, err
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	err = exportRows(tx, encoder, "SELECT path, hash, card_codes FROM source_files ORDER BY path", func(rows *sql.Rows) (snapshotRecord, error) {
+		var row snapshotSourceFile
+		err := rows.Scan(&row.Path, &row.Hash, (*pq.StringArray)(&row.CardCodes))
+		stats.SourceFiles++
+		return snapshotRecord{SourceFile: &row}, err
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return stats, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return stats, nil
+}
+
+// exportRows writes one record per row of query
+func exportRows(tx *sql.Tx, encoder *json.Encoder, query string, scan func(*sql.Rows) (snapshotRecord, error)) error {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query rows to export: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan row to export: %w", err)
+		}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows to export: %w", err)
+	}
+	return nil
+}
+
+// ImportSnapshot restores a snapshot written by ExportSnapshot, without any
+// OpenAI calls. The database is migrated first and must be empty unless
+// opts.Clear is set. If the snapshot embeddings have other dimensions than
+// the columns, the (empty) columns are resized. The rows are inserted in one
+// transaction, then the ivfflat indexes are rebuilt with opts.Metric over the
+// restored embeddings.
+func ImportSnapshot(database *sql.DB, r io.Reader, opts Options) (SnapshotStats, error) {
+	var stats SnapshotStats
+
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	var header snapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return stats, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if header.Format != snapshotFormat {
+		return stats, fmt.Errorf("not a snapshot (format %q)", header.Format)
+	}
+	if header.Version != snapshotVersion {
+		return stats, fmt.Errorf("unsupported snapshot version %d (supported: %d)", header.Version, snapshotVersion)
+	}
+
+	if err := SetupDatabase(database); err != nil {
+		return stats, err
+	}
+	if opts.Clear {
+		if err := ClearDatabase(database); err != nil {
+			return stats, err
+		}
+	} else {
+		var count int
+		if err := database.QueryRow("SELECT COUNT(*) FROM card_embeddings").Scan(&count); err != nil {
+			return stats, fmt.Errorf("failed to count existing entries: %w", err)
+		}
+		if count > 0 {
+			return stats, fmt.Errorf("database already has %d entries; clear it first to import a snapshot", count)
+		}
+	}
+
+	for _, table := range []embeddingTable{cardEmbeddingsTable, cardTranslationsTable} {
+		dimensions, err := db.EmbeddingDimensions(database, table.name)
+		if err != nil {
+			return stats, err
+		}
+		if dimensions == header.Dimensions {
+			continue
+		}
+		fmt.Printf("Resizing %s.embedding from %d to %d dimensions\n", table.name, dimensions, header.Dimensions)
+		if err := resizeEmbeddings(database, table, header.Dimensions); err != nil {
+			return stats, err
+		}
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return stats, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	insertEmbedding, err := tx.Prepare(`
+		INSERT INTO card_embeddings (card_code, card_name, is_back, text_type, english_text, embedding, embedding_model, priority, type_code, faction_code, encounter_code, pack_code)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`)
+	if err != nil {
+		return stats, fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	insertTranslation, err := tx.Prepare(`
+		INSERT INTO card_translations (card_code, is_back, text_type, language, text, embedding, embedding_model)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`)
+	if err != nil {
+		return stats, fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	insertSourceFile, err := tx.Prepare("INSERT INTO source_files (path, hash, card_codes) VALUES ($1, $2, $3)")
+	if err != nil {
+		return stats, fmt.Errorf("failed to prepare insert: %w", err)
+	}
+
+	for line := 2; ; line++ {
+		var record snapshotRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("invalid snapshot record on line %d: %w", line, err)
+		}
+
+		switch {
+		case record.CardEmbedding != nil:
+			row := record.CardEmbedding
+			if err = checkDimensions(row.Embedding, header.Dimensions); err == nil {
+				_, err = insertEmbedding.Exec(row.CardCode, row.CardName, row.IsBack, row.TextType, row.EnglishText, row.Embedding.toVector(), row.EmbeddingModel, row.Priority, row.TypeCode, row.FactionCode, row.EncounterCode, row.PackCode)
+				stats.CardEmbeddings++
+			}
+		case record.CardTranslation != nil:
+			row := record.CardTranslation
+			if err = checkDimensions(row.Embedding, header.Dimensions); err == nil {
+				_, err = insertTranslation.Exec(row.CardCode, row.IsBack, row.TextType, row.Language, row.Text, row.Embedding.toVector(), row.EmbeddingModel)
+				stats.CardTranslations++
+			}
+		case record.SourceFile != nil:
+			_, err = insertSourceFile.Exec(record.SourceFile.Path, record.SourceFile.Hash, cardCodesArray(record.SourceFile.CardCodes))
+			stats.SourceFiles++
+		default:
+			err = fmt.Errorf("empty record")
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to import snapshot line %d: %w", line, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stats, fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	// The ivfflat clusters are computed from the indexed data, so build them
+	// now that the embeddings are in place
+	for _, table := range []embeddingTable{cardEmbeddingsTable, cardTranslationsTable} {
+		if err := rebuildIndex(database, table, opts.metric()); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// checkDimensions reports an embedding whose size differs from the snapshot's
+func checkDimensions(embedding snapshotVector, dimensions int) error {
+	if embedding != nil && len(embedding) != dimensions {
+		return fmt.Errorf("embedding has %d dimensions, expected %d", len(embedding), dimensions)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+	"github.com/ventrosky/arkham-localize/backend/internal/testdb"
+)
+
+func TestSnapshotVector_RoundTrip(t *testing.T) {
+	vector := snapshotVector{0.1, -0.25, float32(math.Pi), math.SmallestNonzeroFloat32, 0}
+
+	encoded, err := json.Marshal(vector)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var decoded snapshotVector
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(decoded) != len(vector) {
+		t.Fatalf("Expected %d values, got %d", len(vector), len(decoded))
+	}
+	for i := range vector {
+		if math.Float32bits(decoded[i]) != math.Float32bits(vector[i]) {
+			t.Errorf("Value %d changed: %g -> %g", i, vector[i], decoded[i])
+		}
+	}
+
+	// A missing embedding stays NULL
+	record, _ := json.Marshal(snapshotCardTranslation{CardCode: "01001"})
+	if strings.Contains(string(record), "embedding") {
+		t.Errorf("Expected no embedding field, got %s", record)
+	}
+
+	if err := json.Unmarshal([]byte(`"AAA="`), &decoded); err == nil {
+		t.Error("Expected error for a truncated embedding, got nil")
+	}
+}
+
+func TestImportSnapshot_InvalidHeader(t *testing.T) {
+	for _, snapshot := range []string{"", `{"format": "other", "version": 1}`, `{"format": "arkham-localize-snapshot", "version": 99}`} {
+		if _, err := ImportSnapshot(nil, strings.NewReader(snapshot), Options{}); err == nil {
+			t.Errorf("Expected error for snapshot %q, got nil", snapshot)
+		}
+	}
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	database := testdb.Start(t)
+
+	testdb.InsertCard(t, database, "01020", "Machete", rag.TextRules, "Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(0.6, 0.8), map[string]string{"it": "Combattere. Ottieni +1 [combat] per questo attacco."})
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", rag.TextFlavor, "Nothing escapes it.",
+		testdb.Embedding(1, 0.3, 0.1), nil)
+	if _, err := database.Exec("INSERT INTO source_files (path, hash) VALUES ('pack/core/core.json', 'abc123')"); err != nil {
+		t.Fatalf("Failed to insert source file: %v", err)
+	}
+
+	var snapshot bytes.Buffer
+	exported, err := ExportSnapshot(database, &snapshot)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if exported != (SnapshotStats{CardEmbeddings: 2, CardTranslations: 1, SourceFiles: 1}) {
+		t.Errorf("Unexpected export stats: %+v", exported)
+	}
+
+	var before string
+	if err := database.QueryRow("SELECT embedding::text FROM card_embeddings WHERE card_code = '01030'").Scan(&before); err != nil {
+		t.Fatalf("Failed to read embedding: %v", err)
+	}
+
+	// The database is not empty, so importing requires clearing it
+	if _, err := ImportSnapshot(database, bytes.NewReader(snapshot.Bytes()), Options{}); err == nil {
+		t.Fatal("Expected error when importing into a non-empty database, got nil")
+	}
+
+	imported, err := ImportSnapshot(database, bytes.NewReader(snapshot.Bytes()), Options{Clear: true})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if imported != exported {
+		t.Errorf("Expected import stats %+v, got %+v", exported, imported)
+	}
+
+	var after, textType string
+	if err := database.QueryRow("SELECT embedding::text, text_type FROM card_embeddings WHERE card_code = '01030'").Scan(&after, &textType); err != nil {
+		t.Fatalf("Failed to read embedding: %v", err)
+	}
+	if after != before || textType != rag.TextFlavor {
+		t.Errorf("Expected the entry to round-trip, got %s (%s), was %s", after, textType, before)
+	}
+
+	cards, err := rag.RetrieveSimilarCards(database, testdb.Embedding(0.6, 0.8), 1, "it", rag.TextRules)
+	if err != nil {
+		t.Fatalf("Retrieval after import failed: %v", err)
+	}
+	if len(cards) != 1 || cards[0].CardCode != "01020" || cards[0].TranslatedText != "Combattere. Ottieni +1 [combat] per questo attacco." {
+		t.Errorf("Expected Machete with its translation after import, got %+v", cards)
+	}
+}
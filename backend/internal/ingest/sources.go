@@ -0,0 +1,208 @@
+package ingest
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// HashSourceFiles returns a hash for each English pack file, keyed by its path
+// relative to dataPath. The hash also covers the matching translation files,
+// so a changed translation causes the pack file to be reprocessed.
+func HashSourceFiles(dataPath string) (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(dataPath, "pack", "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]string, len(files))
+	for _, file := range files {
+		relPath, err := filepath.Rel(dataPath, file)
+		if err != nil {
+			return nil, err
+		}
+
+		hash := sha256.New()
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", relPath, err)
+		}
+		hash.Write(data)
+
+		// Translations mirror the pack layout under translations/<lang>/
+		for _, lang := range SupportedLanguages {
+			transData, err := os.ReadFile(filepath.Join(dataPath, "translations", lang, relPath))
+			if err != nil {
+				continue // No translation for this file
+			}
+			hash.Write([]byte("\x00" + lang + "\x00"))
+			hash.Write(transData)
+		}
+
+		hashes[filepath.ToSlash(relPath)] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	return hashes, nil
+}
+
+// LoadSourceHashes returns the hashes recorded by the previous ingest runs
+func LoadSourceHashes(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT path, hash FROM source_files")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query source files: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var path, hash string
+		if err := rows.Scan(&path, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan source file: %w", err)
+		}
+		hashes[path] = hash
+	}
+
+	return hashes, rows.Err()
+}
+
+// LoadSourceCards returns the card codes recorded for each source file by
+// the previous ingest runs
+func LoadSourceCards(db *sql.DB) (map[string][]string, error) {
+	rows, err := db.Query("SELECT path, card_codes FROM source_files")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query source files: %w", err)
+	}
+	defer rows.Close()
+
+	cards := make(map[string][]string)
+	for rows.Next() {
+		var path string
+		var codes pq.StringArray
+		if err := rows.Scan(&path, &codes); err != nil {
+			return nil, fmt.Errorf("failed to scan source file: %w", err)
+		}
+		cards[path] = codes
+	}
+
+	return cards, rows.Err()
+}
+
+// SaveSourceHashes records the hashes of successfully ingested source files,
+// with the card codes read from each (see sourceCards)
+func SaveSourceHashes(db *sql.DB, hashes map[string]string, cards map[string][]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO source_files (path, hash, card_codes, ingested_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (path) DO UPDATE SET hash = EXCLUDED.hash, card_codes = EXCLUDED.card_codes, ingested_at = EXCLUDED.ingested_at`
+
+	for path, hash := range hashes {
+		if _, err := tx.Exec(stmt, path, hash, cardCodesArray(cards[path])); err != nil {
+			return fmt.Errorf("failed to record source file %s: %w", path, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteSourceFiles removes the records of source files that no longer exist
+func DeleteSourceFiles(db *sql.DB, paths []string) error {
+	if _, err := db.Exec("DELETE FROM source_files WHERE path = ANY($1)", pq.Array(paths)); err != nil {
+		return fmt.Errorf("failed to delete source files: %w", err)
+	}
+	return nil
+}
+
+// cardCodesArray encodes codes for the NOT NULL card_codes column, which a
+// nil pq.StringArray would set to NULL
+func cardCodesArray(codes []string) pq.StringArray {
+	if codes == nil {
+		return pq.StringArray{}
+	}
+	return codes
+}
+
+// sourceCards returns the sorted card codes of the entries read from each
+// source file
+func sourceCards(entries []CardEntry) map[string][]string {
+	seen := make(map[string]map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.SourceFile] == nil {
+			seen[entry.SourceFile] = make(map[string]bool)
+		}
+		seen[entry.SourceFile][entry.CardCode] = true
+	}
+
+	cards := make(map[string][]string, len(seen))
+	for path, codes := range seen {
+		for code := range codes {
+			cards[path] = append(cards[path], code)
+		}
+		sort.Strings(cards[path])
+	}
+	return cards
+}
+
+// removedSourceFiles returns the sorted recorded paths without a current
+// file, leaving out those of the packs in excludePacks, whose entries are
+// kept while excluded
+func removedSourceFiles(current, stored map[string]string, excludePacks []string) []string {
+	excluded := make(map[string]bool, len(excludePacks))
+	for _, pack := range excludePacks {
+		excluded[pack] = true
+	}
+
+	var removed []string
+	for path := range stored {
+		if _, ok := current[path]; !ok && !excluded[sourcePack(path)] {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// staleCards returns the sorted card codes recorded for the given source
+// files (removed or changed ones) that no current entry has anymore: the
+// cards of a deleted file, or dropped from a changed one. A card that moved
+// to another file keeps its entries.
+func staleCards(recorded map[string][]string, paths []string, entries []CardEntry) []string {
+	current := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		current[entry.CardCode] = true
+	}
+
+	seen := make(map[string]bool)
+	var stale []string
+	for _, path := range paths {
+		for _, code := range recorded[path] {
+			if !current[code] && !seen[code] {
+				seen[code] = true
+				stale = append(stale, code)
+			}
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// changedSourceFiles returns the files whose hash differs from the stored one
+func changedSourceFiles(current, stored map[string]string) map[string]bool {
+	changed := make(map[string]bool)
+	for path, hash := range current {
+		if stored[path] != hash {
+			changed[path] = true
+		}
+	}
+	return changed
+}
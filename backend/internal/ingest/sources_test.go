@@ -0,0 +1,93 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeDataFile(t *testing.T, dataPath, relPath, content string) {
+	t.Helper()
+	path := filepath.Join(dataPath, relPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+func TestHashSourceFiles(t *testing.T) {
+	dataPath := t.TempDir()
+	writeDataFile(t, dataPath, "pack/core/core.json", `[{"code": "01001"}]`)
+	writeDataFile(t, dataPath, "pack/dwl/dwl.json", `[{"code": "02001"}]`)
+
+	before, err := HashSourceFiles(dataPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(before) != 2 {
+		t.Fatalf("Expected 2 hashed files, got %d: %v", len(before), before)
+	}
+	if _, ok := before["pack/core/core.json"]; !ok {
+		t.Errorf("Expected hash keyed by relative path, got %v", before)
+	}
+
+	// A new translation changes the hash of its pack file only
+	writeDataFile(t, dataPath, "translations/it/pack/core/core.json", `[{"code": "01001", "text": "Testo"}]`)
+
+	after, err := HashSourceFiles(dataPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	changed := changedSourceFiles(after, before)
+	if len(changed) != 1 || !changed["pack/core/core.json"] {
+		t.Errorf("Expected only pack/core/core.json to change, got %v", changed)
+	}
+}
+
+func TestChangedSourceFiles(t *testing.T) {
+	current := map[string]string{"a.json": "1", "b.json": "2", "c.json": "3"}
+	stored := map[string]string{"a.json": "1", "b.json": "old"}
+
+	changed := changedSourceFiles(current, stored)
+	if len(changed) != 2 || !changed["b.json"] || !changed["c.json"] {
+		t.Errorf("Expected b.json and c.json to change, got %v", changed)
+	}
+}
+
+func TestRemovedSourceFiles(t *testing.T) {
+	current := map[string]string{"pack/core/core.json": "1"}
+	stored := map[string]string{"pack/core/core.json": "1", "pack/dwl/dwl.json": "2", "pack/promo/promo.json": "3"}
+
+	// An excluded pack keeps its entries
+	removed := removedSourceFiles(current, stored, []string{"promo"})
+	if !reflect.DeepEqual(removed, []string{"pack/dwl/dwl.json"}) {
+		t.Errorf("Expected pack/dwl/dwl.json to be removed, got %v", removed)
+	}
+}
+
+func TestStaleCards(t *testing.T) {
+	recorded := map[string][]string{
+		"pack/core/core.json": {"01020", "01030", "01031"},
+		"pack/dwl/dwl.json":   {"02001"},
+		"pack/tmm/tmm.json":   {"02050"},
+	}
+	// 01030 left core.json, 01031 moved to another file, and dwl.json was deleted
+	entries := []CardEntry{
+		{CardCode: "01020", SourceFile: "pack/core/core.json"},
+		{CardCode: "01031", SourceFile: "pack/core/core_encounter.json"},
+		{CardCode: "02050", SourceFile: "pack/tmm/tmm.json"},
+	}
+
+	stale := staleCards(recorded, []string{"pack/dwl/dwl.json", "pack/core/core.json", "pack/tmm/tmm.json"}, entries)
+	if !reflect.DeepEqual(stale, []string{"01030", "02001"}) {
+		t.Errorf("Expected 01030 and 02001 to be stale, got %v", stale)
+	}
+
+	cards := sourceCards(entries)
+	if !reflect.DeepEqual(cards["pack/core/core.json"], []string{"01020"}) || len(cards) != 3 {
+		t.Errorf("Expected the card codes of each file, got %v", cards)
+	}
+}
@@ -0,0 +1,105 @@
+package ingest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileIssue describes a problem found in a card file
+type FileIssue struct {
+	Path string
+	Err  error
+}
+
+// FileReport collects the problems found while reading card files, so that
+// malformed or schema-changed data files don't disappear silently
+type FileReport struct {
+	Strict  bool        // Fail on the first problem instead of skipping the file
+	Skipped []FileIssue // Files that could not be read or parsed
+	Invalid []FileIssue // Files with cards missing expected fields
+
+	Reporter *ProgressReporter // Prints the warnings alongside the progress (nil prints them directly)
+	Fields   FieldMap          // Alternative JSON field names of the card files (nil = arkhamdb's)
+}
+
+// readCardFile reads, parses and validates a card file. Files that cannot be
+// parsed are skipped (nil cards) and cards missing expected fields are
+// reported; in strict mode both return an error instead.
+func (r *FileReport) readCardFile(path string) ([]Card, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, r.skip(path, fmt.Errorf("failed to read file: %w", err))
+	}
+
+	cards, err := decodeCards(data, r.Fields)
+	if err != nil {
+		return nil, r.skip(path, fmt.Errorf("failed to parse JSON: %w", err))
+	}
+
+	if problems := validateCards(cards); len(problems) > 0 {
+		issue := FileIssue{Path: path, Err: fmt.Errorf("%s", strings.Join(problems, "; "))}
+		if r.Strict {
+			return nil, fmt.Errorf("invalid card file %s: %w", path, issue.Err)
+		}
+		r.Reporter.Warnf("%s: %v", path, issue.Err)
+		r.Invalid = append(r.Invalid, issue)
+	}
+
+	return cards, nil
+}
+
+// skippedSources returns the paths of the skipped files relative to dataPath,
+// as the source files are recorded
+func (r *FileReport) skippedSources(dataPath string) map[string]bool {
+	skipped := make(map[string]bool, len(r.Skipped))
+	for _, issue := range r.Skipped {
+		if path, err := filepath.Rel(dataPath, issue.Path); err == nil {
+			skipped[filepath.ToSlash(path)] = true
+		}
+	}
+	return skipped
+}
+
+// skip records a file that could not be used, returning an error in strict mode
+func (r *FileReport) skip(path string, err error) error {
+	if r.Strict {
+		return fmt.Errorf("invalid card file %s: %w", path, err)
+	}
+	r.Reporter.Warnf("Skipping %s: %v", path, err)
+	r.Skipped = append(r.Skipped, FileIssue{Path: path, Err: err})
+	return nil
+}
+
+// validateCards checks that every card has the fields the pipeline relies on
+func validateCards(cards []Card) []string {
+	var problems []string
+	for i, card := range cards {
+		if card.Code == "" {
+			problems = append(problems, fmt.Sprintf("card %d: missing \"code\"", i))
+			continue
+		}
+		if card.Name == "" {
+			problems = append(problems, fmt.Sprintf("card %s: missing \"name\"", card.Code))
+		}
+	}
+	return problems
+}
+
+// Print writes a summary of the skipped and invalid files
+func (r *FileReport) Print() {
+	if len(r.Skipped) == 0 && len(r.Invalid) == 0 {
+		fmt.Println("✓ All card files parsed and validated")
+		return
+	}
+
+	fmt.Printf("⚠️  Skipped %d card files that could not be parsed, %d files have cards with missing fields\n",
+		len(r.Skipped), len(r.Invalid))
+	for _, issue := range r.Skipped {
+		fmt.Printf("  - skipped %s: %v\n", issue.Path, issue.Err)
+	}
+	for _, issue := range r.Invalid {
+		fmt.Printf("  - invalid %s: %v\n", issue.Path, issue.Err)
+	}
+}
@@ -0,0 +1,68 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCardFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pack.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write card file: %v", err)
+	}
+	return path
+}
+
+func TestReadCardFile_Valid(t *testing.T) {
+	path := writeCardFile(t, `[{"code": "01020", "name": "Machete", "text": "Fight."}]`)
+	report := &FileReport{}
+
+	cards, err := report.readCardFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cards) != 1 {
+		t.Errorf("Expected 1 card, got %d", len(cards))
+	}
+	if len(report.Skipped) != 0 || len(report.Invalid) != 0 {
+		t.Errorf("Expected no issues, got %+v", report)
+	}
+}
+
+func TestReadCardFile_Malformed(t *testing.T) {
+	path := writeCardFile(t, `{"not": "an array"`)
+
+	report := &FileReport{}
+	cards, err := report.readCardFile(path)
+	if err != nil {
+		t.Fatalf("Expected malformed file to be skipped without error, got %v", err)
+	}
+	if cards != nil || len(report.Skipped) != 1 {
+		t.Errorf("Expected file to be recorded as skipped, got cards=%v report=%+v", cards, report)
+	}
+
+	strictReport := &FileReport{Strict: true}
+	if _, err := strictReport.readCardFile(path); err == nil {
+		t.Error("Expected error in strict mode, got nil")
+	}
+}
+
+func TestReadCardFile_MissingFields(t *testing.T) {
+	path := writeCardFile(t, `[{"code": "01020"}, {"name": "No Code"}]`)
+
+	report := &FileReport{}
+	cards, err := report.readCardFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cards) != 2 || len(report.Invalid) != 1 {
+		t.Errorf("Expected cards to be kept and file reported as invalid, got cards=%d report=%+v", len(cards), report)
+	}
+
+	strictReport := &FileReport{Strict: true}
+	if _, err := strictReport.readCardFile(path); err == nil {
+		t.Error("Expected error in strict mode, got nil")
+	}
+}
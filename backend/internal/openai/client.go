@@ -0,0 +1,59 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Client sends every API call. It is shared so that connections, and their
+// TLS sessions, are kept alive and reused across calls instead of being
+// opened for each one, which adds up over the thousands of embeddings of an
+// ingest. It has no timeout of its own: PostJSON bounds each call. Tests may
+// replace it.
+var Client = &http.Client{Transport: newTransport()}
+
+// newTransport returns the transport of Client: the default one (HTTP/2,
+// proxy from the environment) keeping more idle connections per host, so
+// that concurrent ingest workers and requests don't close and reopen them
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 32 // The default of 2 is below the ingest concurrency
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+// PostJSON sends body to url with the API headers (see SetHeaders) and
+// decodes the JSON answer into result. The call, reading the answer
+// included, gives up after timeout or when ctx is done. Answers other than
+// 200 OK are returned as an *APIError.
+func PostJSON(ctx context.Context, url, apiKey string, body []byte, timeout time.Duration, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	SetHeaders(req, apiKey)
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return NewAPIError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPostJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			if r.Header.Get("Authorization") != "Bearer sk-test" {
+				http.Error(w, "missing key", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"answer": 42}`))
+		case "/slow":
+			select {
+			case <-time.After(300 * time.Millisecond):
+			case <-r.Context().Done():
+			}
+		default:
+			http.Error(w, `{"error": {"message": "Rate limit reached"}}`, http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	var result struct{ Answer int }
+	if err := PostJSON(context.Background(), server.URL+"/ok", "sk-test", []byte(`{}`), time.Second, &result); err != nil {
+		t.Fatalf("PostJSON failed: %v", err)
+	}
+	if result.Answer != 42 {
+		t.Errorf("Expected the answer to be decoded, got %+v", result)
+	}
+
+	err := PostJSON(context.Background(), server.URL+"/limited", "sk-test", []byte(`{}`), time.Second, &result)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected a rate limit error, got %v", err)
+	}
+
+	start := time.Now()
+	if err := PostJSON(context.Background(), server.URL+"/slow", "sk-test", []byte(`{}`), 50*time.Millisecond, &result); err == nil {
+		t.Error("Expected the slow call to time out, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the call to give up after its timeout, took %s", elapsed)
+	}
+}
+
+func TestPostJSON_ReusesConnections(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	var result struct{}
+	for i := 0; i < 5; i++ {
+		if err := PostJSON(context.Background(), server.URL, "sk-test", []byte(`{}`), time.Second, &result); err != nil {
+			t.Fatalf("PostJSON failed: %v", err)
+		}
+	}
+	if got := connections.Load(); got != 1 {
+		t.Errorf("Expected the 5 calls to share 1 connection, got %d", got)
+	}
+}
@@ -0,0 +1,126 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error classes of OpenAI API failures, matched with errors.Is
+var (
+	ErrRateLimited = errors.New("OpenAI rate limit exceeded")
+	ErrAuth        = errors.New("OpenAI authentication failed")
+	ErrServer      = errors.New("OpenAI server error")
+	ErrBadRequest  = errors.New("OpenAI rejected the request")
+)
+
+// APIError is returned for non-200 responses from the OpenAI API. Message,
+// Type, Code and Param come from the error envelope of the body
+// ({"error": {"message", "type", "code", "param"}}), and are empty when the
+// body has another shape, e.g. the HTML page of a proxy.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string        // Raw response body
+	RetryAfter time.Duration // From the Retry-After header, 0 if absent
+	Message    string        // e.g. "Incorrect API key provided: sk-..."
+	Type       string        // e.g. "invalid_request_error", "insufficient_quota"
+	Code       string        // e.g. "invalid_api_key", "rate_limit_exceeded"
+	Param      string        // The request parameter at fault, if any
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("OpenAI API error: %s - %s", e.Status, e.Body)
+	}
+	if kind := e.Kind(); kind != "" {
+		return fmt.Sprintf("OpenAI API error: %s - %s: %s", e.Status, kind, e.Message)
+	}
+	return fmt.Sprintf("OpenAI API error: %s - %s", e.Status, e.Message)
+}
+
+// Kind returns the most specific identifier of the error, its Code or else
+// its Type, empty for an unknown body shape
+func (e *APIError) Kind() string {
+	if e.Code != "" {
+		return e.Code
+	}
+	return e.Type
+}
+
+// Unwrap returns the error class matching the status code
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrAuth
+	case e.StatusCode >= 500:
+		return ErrServer
+	default:
+		return ErrBadRequest
+	}
+}
+
+// NewAPIError builds an *APIError from a failed response, reading its body
+func NewAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	apiErr.parseEnvelope(body)
+	return apiErr
+}
+
+// parseEnvelope fills the structured fields from an OpenAI error envelope,
+// leaving them empty for other bodies. code is a string in practice, but
+// null or a number for some errors.
+func (e *APIError) parseEnvelope(body []byte) {
+	var envelope struct {
+		Error *struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+			Param   *string         `json:"param"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) != nil || envelope.Error == nil {
+		return
+	}
+
+	e.Message = strings.TrimSpace(envelope.Error.Message)
+	e.Type = envelope.Error.Type
+	var code string
+	if json.Unmarshal(envelope.Error.Code, &code) == nil {
+		e.Code = code
+	} else if raw := string(envelope.Error.Code); raw != "null" {
+		e.Code = raw // A number
+	}
+	if envelope.Error.Param != nil {
+		e.Param = *envelope.Error.Param
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package openai
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAPIError_Classes(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		expected   error
+	}{
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusUnauthorized, ErrAuth},
+		{http.StatusForbidden, ErrAuth},
+		{http.StatusInternalServerError, ErrServer},
+		{http.StatusServiceUnavailable, ErrServer},
+		{http.StatusBadRequest, ErrBadRequest},
+		{http.StatusNotFound, ErrBadRequest},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{
+			StatusCode: tt.statusCode,
+			Status:     http.StatusText(tt.statusCode),
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(`{"error": {"message": "test"}}`)),
+		}
+		err := error(NewAPIError(resp))
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("Status %d: expected %v, got %v", tt.statusCode, tt.expected, errors.Unwrap(err))
+		}
+		if !strings.Contains(err.Error(), "test") {
+			t.Errorf("Expected error to include the error message, got %s", err.Error())
+		}
+	}
+}
+
+func TestNewAPIError_Envelope(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected APIError
+		message  string
+	}{
+		{"RateLimit", `{"error": {"message": "Rate limit reached for gpt-4o.", "type": "requests", "param": null, "code": "rate_limit_exceeded"}}`,
+			APIError{Message: "Rate limit reached for gpt-4o.", Type: "requests", Code: "rate_limit_exceeded"},
+			"OpenAI API error: 429 Too Many Requests - rate_limit_exceeded: Rate limit reached for gpt-4o."},
+		{"InvalidKey", `{"error": {"message": "Incorrect API key provided.", "type": "invalid_request_error", "param": null, "code": "invalid_api_key"}}`,
+			APIError{Message: "Incorrect API key provided.", Type: "invalid_request_error", Code: "invalid_api_key"},
+			"OpenAI API error: 429 Too Many Requests - invalid_api_key: Incorrect API key provided."},
+		{"TypeOnly", `{"error": {"message": "You exceeded your current quota.", "type": "insufficient_quota", "code": null}}`,
+			APIError{Message: "You exceeded your current quota.", Type: "insufficient_quota"},
+			"OpenAI API error: 429 Too Many Requests - insufficient_quota: You exceeded your current quota."},
+		{"NumericCode", `{"error": {"message": "Bad format.", "type": "invalid_request_error", "code": 400, "param": "response_format"}}`,
+			APIError{Message: "Bad format.", Type: "invalid_request_error", Code: "400", Param: "response_format"},
+			"OpenAI API error: 429 Too Many Requests - 400: Bad format."},
+		{"UnknownShape", `<html>Bad gateway</html>`, APIError{},
+			"OpenAI API error: 429 Too Many Requests - <html>Bad gateway</html>"},
+		{"OtherJSON", `{"detail": "Not found"}`, APIError{},
+			`OpenAI API error: 429 Too Many Requests - {"detail": "Not found"}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Status:     "429 Too Many Requests",
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(tc.body)),
+			}
+			apiErr := NewAPIError(resp)
+			if apiErr.Message != tc.expected.Message || apiErr.Type != tc.expected.Type || apiErr.Code != tc.expected.Code || apiErr.Param != tc.expected.Param {
+				t.Errorf("Expected %+v, got %+v", tc.expected, apiErr)
+			}
+			if apiErr.Body != tc.body {
+				t.Errorf("Expected the raw body to be kept, got %q", apiErr.Body)
+			}
+			if message := apiErr.Error(); message != tc.message {
+				t.Errorf("Expected %q, got %q", tc.message, message)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait := parseRetryAfter("20"); wait != 20*time.Second {
+		t.Errorf("Expected 20s, got %v", wait)
+	}
+	if wait := parseRetryAfter(""); wait != 0 {
+		t.Errorf("Expected 0 for missing header, got %v", wait)
+	}
+	if wait := parseRetryAfter("soon"); wait != 0 {
+		t.Errorf("Expected 0 for invalid header, got %v", wait)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if wait := parseRetryAfter(date); wait <= 0 || wait > time.Minute {
+		t.Errorf("Expected up to 1m for HTTP date, got %v", wait)
+	}
+}
@@ -0,0 +1,48 @@
+// Package openai holds settings shared by the OpenAI API clients
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultBaseURL is the official OpenAI API endpoint
+const DefaultBaseURL = "https://api.openai.com"
+
+// BaseURL is the API endpoint used for embeddings and chat completions, set
+// at startup. It can point at any OpenAI-compatible server (LM Studio, vLLM,
+// LiteLLM, ...).
+var BaseURL = DefaultBaseURL
+
+// URL joins BaseURL and an API path such as "/v1/embeddings". Base URLs that
+// already end in "/v1", as compatible servers often document them, are
+// accepted too.
+func URL(path string) string {
+	base := strings.TrimRight(BaseURL, "/")
+	if strings.HasSuffix(base, "/v1") && strings.HasPrefix(path, "/v1/") {
+		path = strings.TrimPrefix(path, "/v1")
+	}
+	return base + path
+}
+
+// Organization and Project are sent as the OpenAI-Organization and
+// OpenAI-Project headers when set, attributing usage on accounts with several
+// organizations or projects. Set at startup.
+var (
+	Organization string
+	Project      string
+)
+
+// SetHeaders sets the JSON content type, the bearer token and the
+// organization and project headers of an API request
+func SetHeaders(req *http.Request, apiKey string) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	if Organization != "" {
+		req.Header.Set("OpenAI-Organization", Organization)
+	}
+	if Project != "" {
+		req.Header.Set("OpenAI-Project", Project)
+	}
+}
@@ -0,0 +1,54 @@
+package openai
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	defer func(base string) { BaseURL = base }(BaseURL)
+
+	tests := []struct {
+		baseURL  string
+		path     string
+		expected string
+	}{
+		{DefaultBaseURL, "/v1/embeddings", "https://api.openai.com/v1/embeddings"},
+		{"http://localhost:1234", "/v1/chat/completions", "http://localhost:1234/v1/chat/completions"},
+		{"http://localhost:1234/", "/v1/embeddings", "http://localhost:1234/v1/embeddings"},
+		{"http://localhost:4000/v1", "/v1/embeddings", "http://localhost:4000/v1/embeddings"},
+		{"http://localhost:4000/v1/", "/v1/chat/completions", "http://localhost:4000/v1/chat/completions"},
+		{"http://gateway/openai", "/v1/embeddings", "http://gateway/openai/v1/embeddings"},
+	}
+
+	for _, tt := range tests {
+		BaseURL = tt.baseURL
+		if got := URL(tt.path); got != tt.expected {
+			t.Errorf("URL(%q) with base %q = %q, expected %q", tt.path, tt.baseURL, got, tt.expected)
+		}
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	defer func(organization, project string) { Organization, Project = organization, project }(Organization, Project)
+
+	Organization, Project = "", ""
+	req := httptest.NewRequest("POST", URL("/v1/embeddings"), nil)
+	SetHeaders(req, "sk-test")
+	if req.Header.Get("Authorization") != "Bearer sk-test" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the bearer token and JSON content type, got %v", req.Header)
+	}
+	if _, ok := req.Header["Openai-Organization"]; ok {
+		t.Errorf("Expected no organization header when unset, got %v", req.Header)
+	}
+	if _, ok := req.Header["Openai-Project"]; ok {
+		t.Errorf("Expected no project header when unset, got %v", req.Header)
+	}
+
+	Organization, Project = "org-test", "proj_test"
+	req = httptest.NewRequest("POST", URL("/v1/chat/completions"), nil)
+	SetHeaders(req, "sk-test")
+	if req.Header.Get("OpenAI-Organization") != "org-test" || req.Header.Get("OpenAI-Project") != "proj_test" {
+		t.Errorf("Expected the organization and project headers, got %v", req.Header)
+	}
+}
@@ -0,0 +1,69 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// MaxRetries is the number of times a rate limited (429) or failed (5xx)
+// API call is retried, and RetryBaseDelay the wait before the first retry,
+// doubled on each further one. Both are set at startup.
+var (
+	MaxRetries     = 3
+	RetryBaseDelay = time.Second
+)
+
+// maxRetryDelay caps a single wait, Retry-After included
+const maxRetryDelay = 30 * time.Second
+
+// Retryable reports whether a failed call may succeed if made again
+func Retryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServer)
+}
+
+// WithRetry runs call, retrying it with exponential backoff while it fails
+// with a Retryable error. A Retry-After sent by the API is honored. It gives
+// up with the last error once MaxRetries is reached or when the next wait
+// would outlast the deadline of ctx.
+func WithRetry(ctx context.Context, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || !Retryable(err) || attempt >= MaxRetries {
+			return err
+		}
+
+		wait := retryDelay(attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns the wait before retry number attempt+1: the
+// Retry-After of the error if any, else the exponential backoff with jitter
+func retryDelay(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return min(apiErr.RetryAfter, maxRetryDelay)
+	}
+
+	delay := RetryBaseDelay << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	// Up to 20% jitter so concurrent callers don't retry in lockstep
+	if jitter := int64(delay) / 5; jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+	return min(delay, maxRetryDelay)
+}
@@ -0,0 +1,95 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	defer func(retries int, delay time.Duration) { MaxRetries, RetryBaseDelay = retries, delay }(MaxRetries, RetryBaseDelay)
+	MaxRetries = 2
+	RetryBaseDelay = time.Millisecond
+
+	rateLimited := &APIError{StatusCode: http.StatusTooManyRequests}
+	serverError := &APIError{StatusCode: http.StatusBadGateway}
+	badRequest := &APIError{StatusCode: http.StatusBadRequest}
+
+	tests := []struct {
+		name          string
+		errs          []error // Returned by successive calls, nil afterwards
+		expectedErr   error
+		expectedCalls int
+	}{
+		{"Success", nil, nil, 1},
+		{"RateLimitedThenSuccess", []error{rateLimited}, nil, 2},
+		{"ServerErrorsThenSuccess", []error{serverError, serverError}, nil, 3},
+		{"GivesUpAfterMaxRetries", []error{serverError, serverError, rateLimited}, ErrRateLimited, 3},
+		{"BadRequestNotRetried", []error{badRequest}, ErrBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := WithRetry(context.Background(), func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+
+			if tt.expectedErr == nil && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Expected %v, got %v", tt.expectedErr, err)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestWithRetry_StopsAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	start := time.Now()
+	err := WithRetry(ctx, func() error {
+		calls++
+		return &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Second}
+	})
+
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected the rate limit error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected no retry when Retry-After exceeds the deadline, got %d calls", calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected to give up without waiting, took %v", elapsed)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	defer func(delay time.Duration) { RetryBaseDelay = delay }(RetryBaseDelay)
+	RetryBaseDelay = 100 * time.Millisecond
+
+	if wait := retryDelay(0, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 7 * time.Second}); wait != 7*time.Second {
+		t.Errorf("Expected Retry-After to be honored, got %v", wait)
+	}
+	if wait := retryDelay(0, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}); wait != maxRetryDelay {
+		t.Errorf("Expected Retry-After to be capped at %v, got %v", maxRetryDelay, wait)
+	}
+	if wait := retryDelay(2, &APIError{StatusCode: http.StatusBadGateway}); wait < 400*time.Millisecond || wait > 480*time.Millisecond {
+		t.Errorf("Expected about 400ms on the third attempt, got %v", wait)
+	}
+	if wait := retryDelay(40, &APIError{StatusCode: http.StatusBadGateway}); wait != maxRetryDelay {
+		t.Errorf("Expected the backoff to be capped at %v, got %v", maxRetryDelay, wait)
+	}
+}
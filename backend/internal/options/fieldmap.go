@@ -0,0 +1,37 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CardFields lists the JSON field names of ingest.Card, the fields a field
+// map can remap
+var CardFields = []string{
+	"code", "name", "real_name", "back_name", "subname",
+	"text", "real_text", "back_text", "flavor", "back_flavor",
+	"type_code", "faction_code", "encounter_code", "pack_code",
+}
+
+// ParseFieldMap parses a comma-separated list of arkhamdb field names and
+// the names to read them from, e.g. "text=textEn,real_text=textEn,name=title"
+func ParseFieldMap(spec string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		field, name, ok := strings.Cut(rule, "=")
+		field, name = strings.TrimSpace(field), strings.TrimSpace(name)
+		if !ok || field == "" || name == "" {
+			return nil, fmt.Errorf("invalid field mapping %q (expected e.g. text=textEn)", rule)
+		}
+		if !Valid(field, CardFields) {
+			return nil, fmt.Errorf("invalid field mapping %q: unknown card field %s", rule, field)
+		}
+		fields[field] = name
+	}
+	return fields, nil
+}
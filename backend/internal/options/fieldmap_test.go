@@ -0,0 +1,40 @@
+package options
+
+import "testing"
+
+func TestParseFieldMap(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{"", map[string]string{}, false},
+		{"text=textEn, name = title", map[string]string{"text": "textEn", "name": "title"}, false},
+		{"text", nil, true},
+		{"text=", nil, true},
+		{"rules=textEn", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			fields, err := ParseFieldMap(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %v", tc.spec, fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(fields) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, fields)
+			}
+			for field, name := range tc.expected {
+				if fields[field] != name {
+					t.Errorf("Expected %s read from %s, got %q", field, name, fields[field])
+				}
+			}
+		})
+	}
+}
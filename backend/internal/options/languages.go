@@ -0,0 +1,80 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SupportedLanguages lists the target languages. Translations are stored one
+// row per language, so adding a language only takes an entry here and in
+// LanguageNames.
+var SupportedLanguages = []string{"it", "fr", "de", "es", "pt"}
+
+// LanguageNames maps language codes to full names
+var LanguageNames = map[string]string{
+	"en": "English",
+	"it": "Italian",
+	"fr": "French",
+	"de": "German",
+	"es": "Spanish",
+	"pt": "Portuguese",
+}
+
+// ValidLanguage reports whether language is a supported target language
+func ValidLanguage(language string) bool {
+	return Valid(language, SupportedLanguages)
+}
+
+// ParseLanguageFallbacks parses a fallback specification such as
+// "de=it,en;es=it,en" into a map of target language -> fallback chain
+func ParseLanguageFallbacks(spec string) (map[string][]string, error) {
+	fallbacks := make(map[string][]string)
+	if strings.TrimSpace(spec) == "" {
+		return fallbacks, nil
+	}
+
+	for _, rule := range strings.Split(spec, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		target, chain, ok := strings.Cut(rule, "=")
+		target = strings.TrimSpace(target)
+		if !ok || target == "" {
+			return nil, fmt.Errorf("invalid fallback rule %q (expected e.g. de=it,en)", rule)
+		}
+		if !ValidLanguage(target) {
+			return nil, fmt.Errorf("invalid fallback rule %q: unsupported target language %s", rule, target)
+		}
+
+		for _, lang := range strings.Split(chain, ",") {
+			lang = strings.TrimSpace(lang)
+			if _, known := LanguageNames[lang]; !known || lang == target {
+				return nil, fmt.Errorf("invalid fallback rule %q: unsupported fallback language %q", rule, lang)
+			}
+			fallbacks[target] = append(fallbacks[target], lang)
+		}
+	}
+
+	return fallbacks, nil
+}
+
+// ParseReferenceLanguages parses a comma-separated list of supported
+// languages such as "it,fr", dropping duplicates
+func ParseReferenceLanguages(spec string) ([]string, error) {
+	var languages []string
+	seen := make(map[string]bool)
+	for _, lang := range strings.Split(spec, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang == "" || seen[lang] {
+			continue
+		}
+		if !ValidLanguage(lang) {
+			return nil, fmt.Errorf("unsupported reference language %q (supported: %s)", lang, strings.Join(SupportedLanguages, ", "))
+		}
+		seen[lang] = true
+		languages = append(languages, lang)
+	}
+	return languages, nil
+}
@@ -0,0 +1,74 @@
+package options
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLanguageFallbacks(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		expected map[string][]string
+		wantErr  bool
+	}{
+		{"Empty", "", map[string][]string{}, false},
+		{"SingleRule", "de=it", map[string][]string{"de": {"it"}}, false},
+		{"MultipleRules", "de=it,en; es=it,en", map[string][]string{"de": {"it", "en"}, "es": {"it", "en"}}, false},
+		{"MissingEquals", "de", nil, true},
+		{"UnknownFallback", "de=xx", nil, true},
+		{"SelfFallback", "de=de", nil, true},
+		{"EnglishTarget", "en=it", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fallbacks, err := ParseLanguageFallbacks(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", fallbacks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(fallbacks, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, fallbacks)
+			}
+		})
+	}
+}
+
+func TestParseReferenceLanguages(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		expected []string
+		wantErr  bool
+	}{
+		{"Empty", "", nil, false},
+		{"List", "it, fr", []string{"it", "fr"}, false},
+		{"Duplicates", "it,fr,it", []string{"it", "fr"}, false},
+		{"English", "en", nil, true},
+		{"Unknown", "it,xx", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			languages, err := ParseReferenceLanguages(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", languages)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(languages, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, languages)
+			}
+		})
+	}
+}
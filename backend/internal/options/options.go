@@ -0,0 +1,75 @@
+// Package options defines the values of the enumerated settings and parses
+// the list settings, so the config package can validate them without
+// importing the packages that act on them
+package options
+
+// Rerank modes applied after RetrieveSimilarCards
+const (
+	RerankNone   = "none"   // Keep the vector search order (default)
+	RerankDedupe = "dedupe" // Deduplicate and diversify results
+	RerankLLM    = "llm"    // Dedupe, then ask the chat model to reorder by relevance
+)
+
+// RerankModes lists the supported rerank modes
+var RerankModes = []string{RerankNone, RerankDedupe, RerankLLM}
+
+// Vector distance metrics (see rag.Metric)
+const (
+	MetricCosine       = "cosine" // Cosine distance (default)
+	MetricInnerProduct = "ip"     // Negative inner product
+	MetricL2           = "l2"     // Euclidean distance
+)
+
+// Metrics lists the supported metrics
+var Metrics = []string{MetricCosine, MetricInnerProduct, MetricL2}
+
+// Vector store backends
+const (
+	StorePostgres = "postgres"
+)
+
+// VectorStores lists the supported vector store backends
+var VectorStores = []string{StorePostgres}
+
+// Ways to handle stored entries embedded with another model than the query.
+// Similarities across embedding models are meaningless, even between models
+// of the same dimensions (text-embedding-ada-002 and text-embedding-3-small),
+// so such entries come back as context that merely looks plausible.
+const (
+	ModelMismatchWarn   = "warn"   // Search them, but log and warn about the ones retrieved
+	ModelMismatchFilter = "filter" // Leave them out of the search (SearchQuery.EmbeddingModel)
+)
+
+// ModelMismatches lists the supported ways to handle mismatched entries
+var ModelMismatches = []string{ModelMismatchWarn, ModelMismatchFilter}
+
+// Context of a card back when back references run short (see rag.BackFallback)
+const (
+	BackFallbackFront = "front" // Front references fill the remaining slots, marked IsFrontFallback
+	BackFallbackNone  = "none"  // Back references only, even if none is found
+)
+
+// BackFallbacks lists the supported back fallbacks
+var BackFallbacks = []string{BackFallbackFront, BackFallbackNone}
+
+// Orders of the context cards in the user prompt (see rag.ContextOrder)
+const (
+	ContextClosestFirst = "closest-first" // Retrieval order, most similar card first (default)
+	ContextClosestLast  = "closest-last"  // Most similar card last, right before the text to translate
+)
+
+// ContextOrders lists the supported context card orders
+var ContextOrders = []string{ContextClosestFirst, ContextClosestLast}
+
+// DefaultPackWeight is the default of rag.PackWeight
+const DefaultPackWeight = 0.1
+
+// Valid reports whether value is one of values
+func Valid(value string, values []string) bool {
+	for _, v := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package options
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultCardPriorities ranks the core set cards (codes 01xxx), whose
+// translations are the canonical terminology, above the others
+const DefaultCardPriorities = "01=1"
+
+// CardPriorities maps card code prefixes to the priority stored with the
+// cards at ingest, e.g. a cycle ("01" for the core set), a pack ("02")
+// or a single card for a manual boost
+type CardPriorities map[string]float64
+
+// ParseCardPriorities parses a comma-separated list of code prefixes and
+// priorities, e.g. "01=1,02=0.5,01030=2"
+func ParseCardPriorities(spec string) (CardPriorities, error) {
+	priorities := make(CardPriorities)
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		prefix, value, ok := strings.Cut(rule, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf("invalid priority rule %q (expected e.g. 01=1)", rule)
+		}
+		priority, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || priority < 0 {
+			return nil, fmt.Errorf("invalid priority rule %q: priority must be a non-negative number", rule)
+		}
+		priorities[prefix] = priority
+	}
+	return priorities, nil
+}
+
+// Priority returns the priority of the longest prefix matching code, 0 when
+// none does
+func (p CardPriorities) Priority(code string) float64 {
+	prefixes := make([]string, 0, len(p))
+	for prefix := range p {
+		if strings.HasPrefix(code, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return 0
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return p[prefixes[0]]
+}
@@ -0,0 +1,35 @@
+package options
+
+import "testing"
+
+func TestParseCardPriorities(t *testing.T) {
+	priorities, err := ParseCardPriorities(" 01=1, 02=0.5,01030=2,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		code     string
+		expected float64
+	}{
+		{"01020", 1},   // Core set
+		{"01030", 2},   // Manual boost beats the core set prefix
+		{"02101", 0.5}, // Dunwich
+		{"03001", 0},   // No rule
+	}
+	for _, tt := range tests {
+		if got := priorities.Priority(tt.code); got != tt.expected {
+			t.Errorf("Priority(%s) = %g, expected %g", tt.code, got, tt.expected)
+		}
+	}
+
+	if got := CardPriorities(nil).Priority("01020"); got != 0 {
+		t.Errorf("Expected 0 without priorities, got %g", got)
+	}
+
+	for _, spec := range []string{"01", "=1", "01=high", "01=-1"} {
+		if _, err := ParseCardPriorities(spec); err == nil {
+			t.Errorf("Expected error for %q, got nil", spec)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package options
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Names of the post-processors (see rag.PostProcessor)
+const (
+	PostStripQuotes    = "strip_quotes"    // Straight quotes around the translation the source doesn't have
+	PostCollapseSpaces = "collapse_spaces" // Runs of spaces and tabs within a line
+	PostBracketSpacing = "bracket_spacing" // Spaces inside [symbols], and a missing one between a word and a symbol
+)
+
+// PostProcessorNames lists the available post-processors
+var PostProcessorNames = []string{PostStripQuotes, PostCollapseSpaces, PostBracketSpacing}
+
+// DefaultPostProcessors strips the quotes models wrap translations in, as
+// the translation tests used to do by hand
+const DefaultPostProcessors = PostStripQuotes
+
+// ParsePostProcessors parses a comma-separated list of post-processor names
+// such as "strip_quotes,collapse_spaces". "none" (or an empty list) disables
+// post-processing; a name may appear only once.
+func ParsePostProcessors(spec string) ([]string, error) {
+	if strings.TrimSpace(spec) == "none" {
+		return nil, nil
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !Valid(name, PostProcessorNames) {
+			return nil, fmt.Errorf("unknown post-processor %q (supported: %s, or none)", name, strings.Join(PostProcessorNames, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("post-processor %q is listed twice", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// ParsePreservedTokens parses a space-separated list of regular expressions
+// for rag.PreservedTokens, e.g. `\{[a-z_]+\} <hb:[a-z]+>` (use \s or \x20
+// for a space inside a pattern). Patterns that match the empty string are
+// rejected, as they would match everywhere.
+func ParsePreservedTokens(spec string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Fields(spec) {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if compiled.MatchString("") {
+			return nil, fmt.Errorf("pattern %q matches the empty string", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
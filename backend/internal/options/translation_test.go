@@ -0,0 +1,60 @@
+package options
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePostProcessors(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected []string
+		wantErr  bool
+	}{
+		{"strip_quotes", []string{"strip_quotes"}, false},
+		{" collapse_spaces , bracket_spacing ", []string{"collapse_spaces", "bracket_spacing"}, false},
+		{"none", nil, false},
+		{"", nil, false},
+		{"strip_quotes,strip_quotes", nil, true},
+		{"uppercase", nil, true},
+	}
+
+	for _, tt := range tests {
+		names, err := ParsePostProcessors(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePostProcessors(%q): expected error %v, got %v", tt.spec, tt.wantErr, err)
+			continue
+		}
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("ParsePostProcessors(%q): expected %v, got %v", tt.spec, tt.expected, names)
+		}
+	}
+
+	if names, _ := ParsePostProcessors(DefaultPostProcessors); strings.Join(names, ",") != "strip_quotes" {
+		t.Errorf("Expected the default pipeline to strip quotes, got %v", names)
+	}
+}
+
+func TestParsePreservedTokens(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected []string
+		valid    bool
+	}{
+		{"", nil, true},
+		{`\{[a-z_]+\}`, []string{`\{[a-z_]+\}`}, true},
+		{`  \{[a-z_]+\}   <hb:[a-z]+> `, []string{`\{[a-z_]+\}`, `<hb:[a-z]+>`}, true},
+		{`\{[a-z_]+\} [a-z`, nil, false},
+		{`x*`, nil, false},
+	}
+	for _, tt := range tests {
+		patterns, err := ParsePreservedTokens(tt.spec)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParsePreservedTokens(%q): expected valid=%v, got %v", tt.spec, tt.valid, err)
+		}
+		if tt.valid && !reflect.DeepEqual(patterns, tt.expected) {
+			t.Errorf("ParsePreservedTokens(%q): expected %q, got %q", tt.spec, tt.expected, patterns)
+		}
+	}
+}
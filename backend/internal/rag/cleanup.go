@@ -0,0 +1,71 @@
+package rag
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// "Translation:", "Italian translation:", "Here is the translation:" ...
+	translationLabelPattern = regexp.MustCompile(`(?i)^\s*(?:here(?:'s| is) (?:the |your )?[^:\n]{0,40}translation[^:\n]{0,20}|(?:[a-z]+ )?translation(?: \([a-z]+\))?)\s*:\s*`)
+	// A trailing paragraph such as "Note: ..." or "(Explanation: ...)"
+	trailingNotePattern = regexp.MustCompile(`(?i)^[(\[]?\s*(?:notes?|explanation)\b`)
+	// The language tag of a code fence, e.g. "text" in ```text
+	fenceTagPattern = regexp.MustCompile(`^[A-Za-z]*$`)
+	// Phrases of a model declining or commenting instead of translating
+	refusalPattern = regexp.MustCompile(`(?i)\b(?:I cannot|I can't|I can not|I'm sorry|I am sorry|as an AI)\b`)
+)
+
+// quotePairs are the quotes a model may wrap its whole answer in
+var quotePairs = [][2]string{
+	{"```", "```"},
+	{`"`, `"`},
+	{"“", "”"},
+	{"«", "»"},
+}
+
+// CleanTranslation strips scaffolding the model may add around a translation
+// despite the instructions: a leading "Translation:" label, quotes or a code
+// fence around the whole output, and trailing notes. Anything that is also
+// in the source text (e.g. quotes around it) is kept. It reports whether the
+// output changed.
+func CleanTranslation(output, source string) (string, bool) {
+	cleaned := strings.TrimSpace(output)
+	source = strings.TrimSpace(source)
+
+	if label := translationLabelPattern.FindString(cleaned); label != "" && !translationLabelPattern.MatchString(source) {
+		cleaned = strings.TrimSpace(cleaned[len(label):])
+	}
+
+	for _, quotes := range quotePairs {
+		open, close := quotes[0], quotes[1]
+		if len(cleaned) > len(open)+len(close) && strings.HasPrefix(cleaned, open) && strings.HasSuffix(cleaned, close) &&
+			!strings.HasPrefix(source, open) {
+			inner := cleaned[len(open) : len(cleaned)-len(close)]
+			if open == "```" {
+				// Drop the fence's language tag, e.g. ```text
+				if tag, rest, ok := strings.Cut(inner, "\n"); ok && fenceTagPattern.MatchString(tag) {
+					inner = rest
+				}
+			}
+			cleaned = strings.TrimSpace(inner)
+			break
+		}
+	}
+
+	// Only drop note paragraphs the source doesn't account for
+	paragraphs := strings.Split(cleaned, "\n\n")
+	sourceParagraphs := len(strings.Split(source, "\n\n"))
+	for len(paragraphs) > sourceParagraphs && trailingNotePattern.MatchString(strings.TrimSpace(paragraphs[len(paragraphs)-1])) {
+		paragraphs = paragraphs[:len(paragraphs)-1]
+	}
+	cleaned = strings.TrimSpace(strings.Join(paragraphs, "\n\n"))
+
+	return cleaned, cleaned != strings.TrimSpace(output)
+}
+
+// looksLikeNonTranslation reports whether the output is empty or reads like
+// the model declining or commenting rather than translating
+func looksLikeNonTranslation(output, source string) bool {
+	return strings.TrimSpace(output) == "" || (refusalPattern.MatchString(output) && !refusalPattern.MatchString(source))
+}
@@ -0,0 +1,114 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+func TestCleanTranslation(t *testing.T) {
+	testCases := []struct {
+		name     string
+		output   string
+		source   string
+		expected string
+		cleaned  bool
+	}{
+		{"Clean", "Pesca 1 carta.", "Draw 1 card.", "Pesca 1 carta.", false},
+		{"Label", "Translation: Pesca 1 carta.", "Draw 1 card.", "Pesca 1 carta.", true},
+		{"LanguageLabel", "Italian translation:\nPesca 1 carta.", "Draw 1 card.", "Pesca 1 carta.", true},
+		{"HereIs", "Here is the Italian translation: Pesca 1 carta.", "Draw 1 card.", "Pesca 1 carta.", true},
+		{"Quotes", `"Pesca 1 carta."`, "Draw 1 card.", "Pesca 1 carta.", true},
+		{"CurlyQuotes", "“Pesca 1 carta.”", "Draw 1 card.", "Pesca 1 carta.", true},
+		{"QuotedSource", `"Pesca 1 carta."`, `"Draw 1 card."`, `"Pesca 1 carta."`, false},
+		{"CodeFence", "```text\n[action]: Pesca 1 carta.\n```", "[action]: Draw 1 card.", "[action]: Pesca 1 carta.", true},
+		{"CodeFenceNoTag", "```\n[action]: Pesca 1 carta.\nScarta 1 carta.\n```", "[action]: Draw 1 card.\nDiscard 1 card.", "[action]: Pesca 1 carta.\nScarta 1 carta.", true},
+		{"TrailingNote", "Pesca 1 carta.\n\nNote: \"Draw\" is translated as \"Pesca\".", "Draw 1 card.", "Pesca 1 carta.", true},
+		{"NoteInSource", "Pesca 1 carta.\n\nNota: non è un'azione.", "Draw 1 card.\n\nNote: this is not an action.", "Pesca 1 carta.\n\nNota: non è un'azione.", false},
+		{"InnerQuotes", `Scegli "Sì" o "No".`, `Choose "Yes" or "No".`, `Scegli "Sì" o "No".`, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cleaned, changed := CleanTranslation(tc.output, tc.source)
+			if cleaned != tc.expected || changed != tc.cleaned {
+				t.Errorf("CleanTranslation(%q) = %q, %v; expected %q, %v", tc.output, cleaned, changed, tc.expected, tc.cleaned)
+			}
+		})
+	}
+}
+
+func TestTranslate_RetriesNonTranslation(t *testing.T) {
+	replies := []string{"I'm sorry, I cannot translate this text.", `"Pesca 1 carta."`}
+	var requests [][]Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []Message `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body.Messages)
+
+		reply := replies[len(requests)-1]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": Message{Role: "assistant", Content: reply}}},
+			"usage":   Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+		})
+	}))
+	defer server.Close()
+
+	defaultBaseURL := openai.BaseURL
+	openai.BaseURL = server.URL
+	defer func() { openai.BaseURL = defaultBaseURL }()
+
+	result, err := Translate(context.Background(), "Draw 1 card.", nil, "test-key", "gpt-4o", "it")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+
+	if result.Translation != "Pesca 1 carta." || !result.Retried || !result.Cleaned {
+		t.Errorf("Expected a cleaned, retried translation, got %+v", result)
+	}
+	if result.Raw != replies[1] {
+		t.Errorf("Expected the raw answer to the retry %q, got %q", replies[1], result.Raw)
+	}
+	if result.Normalized != "Draw 1 card." {
+		t.Errorf("Expected the normalized source, got %q", result.Normalized)
+	}
+	if result.Usage.TotalTokens != 220 {
+		t.Errorf("Expected the usage of both attempts, got %+v", result.Usage)
+	}
+	if len(requests) != 2 || len(requests[1]) != 4 || requests[1][3].Role != "user" {
+		t.Fatalf("Expected the retry to add the answer and a reminder, got %+v", requests)
+	}
+}
+
+func TestTranslate_KeepsRawAnswer(t *testing.T) {
+	reply := "Translation: \"Pesca 1 carta.\"\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": Message{Role: "assistant", Content: reply}}},
+		})
+	}))
+	defer server.Close()
+
+	defer func(base string, jsonOutput bool) { openai.BaseURL, JSONOutput = base, jsonOutput }(openai.BaseURL, JSONOutput)
+	openai.BaseURL = server.URL
+	JSONOutput = false
+
+	result, err := Translate(context.Background(), "Draw 1 card.", nil, "test-key", "gpt-4o", "it")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if result.Translation != "Pesca 1 carta." {
+		t.Errorf("Expected the cleaned translation, got %q", result.Translation)
+	}
+	if result.Raw != reply {
+		t.Errorf("Expected the untouched answer %q, got %q", reply, result.Raw)
+	}
+}
@@ -0,0 +1,20 @@
+package rag
+
+import "sort"
+
+// MismatchedModels returns the embedding models of the cards other than
+// model, sorted. Cards of an unknown model (ingested before the model was
+// recorded) are assumed to match.
+func MismatchedModels(cards []ContextCard, model string) []string {
+	seen := make(map[string]bool)
+	var models []string
+	for _, card := range cards {
+		if card.EmbeddingModel == "" || card.EmbeddingModel == model || seen[card.EmbeddingModel] {
+			continue
+		}
+		seen[card.EmbeddingModel] = true
+		models = append(models, card.EmbeddingModel)
+	}
+	sort.Strings(models)
+	return models
+}
@@ -0,0 +1,223 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type previousVersionKey struct{}
+
+// previousVersion is the card text before an errata and its translation
+type previousVersion struct {
+	english     string
+	translation string
+}
+
+// WithPreviousVersion returns a context under which the text to translate
+// is a passage an errata changed, and the model is shown the card's English
+// text before the errata and its reviewed translation, to reuse their wording
+func WithPreviousVersion(ctx context.Context, english, translation string) context.Context {
+	return context.WithValue(ctx, previousVersionKey{}, previousVersion{english: english, translation: translation})
+}
+
+// previousVersionSection is appended to the user prompt under
+// WithPreviousVersion; the arguments are the language name and the previous
+// English text and translation
+const previousVersionSection = `
+---
+
+### PREVIOUS VERSION OF THE CARD
+The text to translate is a passage changed or added by an errata. Before the errata, the card read as below, with its reviewed %[1]s translation. Translate only the text to translate, reusing the wording and terminology of the previous %[1]s translation for whatever the errata left unchanged.
+
+English:
+%[2]s
+
+%[1]s:
+%[3]s
+`
+
+// requestPreviousVersion adds the previous version of the card to the user
+// prompt of messages when ctx carries one
+func requestPreviousVersion(ctx context.Context, messages []Message, language string) []Message {
+	previous, ok := ctx.Value(previousVersionKey{}).(previousVersion)
+	if !ok || len(messages) < 2 {
+		return messages
+	}
+	english, _ := SanitizeInput(previous.english)
+	translation, _ := SanitizeInput(previous.translation)
+	messages[1].Content += fmt.Sprintf(previousVersionSection, languageName(language), english, translation)
+	return messages
+}
+
+// ErrataSegment is a sentence (or line) of the English text after an
+// errata, or a run of changed ones, with its translation
+type ErrataSegment struct {
+	English     string `json:"english"`
+	Translation string `json:"translation"`
+	// Changed segments were translated by the model; the others are kept
+	// verbatim from the previous translation
+	Changed bool `json:"changed"`
+}
+
+// ErrataResult is the translation of the English text after an errata
+type ErrataResult struct {
+	Translation string
+	Segments    []ErrataSegment
+	Usage       Usage
+}
+
+// ErrErrataMisaligned is returned when the previous translation doesn't have
+// the sentences, nor the lines, of the previous English text, so its
+// unchanged segments can't be told apart
+var ErrErrataMisaligned = errors.New("the previous translation doesn't have the same sentences or lines as the previous English text")
+
+// segment is a sentence or line of a text and the whitespace following it
+type segment struct {
+	text string
+	sep  string
+}
+
+// sentenceEnd matches the end of a sentence within a line, capturing the
+// spaces after it
+var sentenceEnd = regexp.MustCompile(`[.!?…]+["'”»)]*( +)`)
+
+// splitSegments splits a trimmed text into its lines, and each line into its
+// sentences when sentences is set. Joining the segments with their
+// separators gives the text back.
+func splitSegments(text string, sentences bool) []segment {
+	var segments []segment
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if sentences {
+			offset := 0
+			for _, loc := range sentenceEnd.FindAllStringSubmatchIndex(line, -1) {
+				segments = append(segments, segment{text: line[offset:loc[2]], sep: line[loc[2]:loc[3]]})
+				offset = loc[3]
+			}
+			if offset < len(line) {
+				segments = append(segments, segment{text: line[offset:]})
+			}
+		} else if line != "" {
+			segments = append(segments, segment{text: line})
+		}
+
+		if i == len(lines)-1 {
+			continue
+		}
+		// A blank line only adds to the separator of the previous segment
+		if len(segments) > 0 {
+			segments[len(segments)-1].sep += "\n"
+		}
+	}
+	return segments
+}
+
+// alignSegments splits the previous English text and its translation into
+// matching sentences, or into lines when their sentences don't match. It
+// reports whether sentences are used.
+func alignSegments(english, translation string) ([]segment, []segment, bool, error) {
+	for _, sentences := range []bool{true, false} {
+		englishSegments := splitSegments(english, sentences)
+		translationSegments := splitSegments(translation, sentences)
+		if len(englishSegments) == len(translationSegments) {
+			return englishSegments, translationSegments, sentences, nil
+		}
+	}
+	return nil, nil, false, ErrErrataMisaligned
+}
+
+// commonSegments returns, for each segment of after, the index of the same
+// segment in before, or -1 for the segments the errata changed or added.
+// Segments are paired along their longest common subsequence.
+func commonSegments(before, after []segment) []int {
+	// lengths[i][j] is the LCS length of before[i:] and after[j:]
+	lengths := make([][]int, len(before)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i].text == after[j].text {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	matches := make([]int, len(after))
+	for j := range matches {
+		matches[j] = -1
+	}
+	for i, j := 0, 0; i < len(before) && j < len(after); {
+		switch {
+		case before[i].text == after[j].text:
+			matches[j] = i
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
+
+// TranslateErrata translates newEnglish, the text of a card after an
+// errata, keeping the sentences of oldTranslation whose English is unchanged
+// from oldEnglish verbatim. Each run of changed or added sentences is
+// translated by translator in one call (see WithPreviousVersion); removed
+// sentences are dropped. Texts whose sentences don't pair with their
+// translation's are compared by line, and ErrErrataMisaligned is returned
+// when the lines don't pair either.
+func TranslateErrata(ctx context.Context, translator Translator, oldEnglish, oldTranslation, newEnglish string, contextCards []ContextCard, model, language string) (ErrataResult, error) {
+	oldEnglish = strings.TrimSpace(oldEnglish)
+	oldTranslation = strings.TrimSpace(oldTranslation)
+	newEnglish = strings.TrimSpace(newEnglish)
+
+	before, translated, sentences, err := alignSegments(oldEnglish, oldTranslation)
+	if err != nil {
+		return ErrataResult{}, err
+	}
+	after := splitSegments(newEnglish, sentences)
+	matches := commonSegments(before, after)
+
+	var result ErrataResult
+	var merged strings.Builder
+	ctx = WithPreviousVersion(ctx, oldEnglish, oldTranslation)
+	for j := 0; j < len(after); {
+		if i := matches[j]; i >= 0 {
+			result.Segments = append(result.Segments, ErrataSegment{English: after[j].text, Translation: translated[i].text})
+			merged.WriteString(translated[i].text + after[j].sep)
+			j++
+			continue
+		}
+
+		// Translate the run of changed segments together, so the model
+		// sees whole sentences and line breaks
+		var run strings.Builder
+		end := j
+		for ; end < len(after) && matches[end] < 0; end++ {
+			run.WriteString(after[end].text)
+			if end+1 < len(after) && matches[end+1] < 0 {
+				run.WriteString(after[end].sep)
+			}
+		}
+		translation, err := translator.Translate(ctx, run.String(), contextCards, model, language)
+		if err != nil {
+			return ErrataResult{}, err
+		}
+		result.Usage = result.Usage.add(translation.Usage)
+		text := strings.TrimSpace(translation.Translation)
+		result.Segments = append(result.Segments, ErrataSegment{English: run.String(), Translation: text, Changed: true})
+		merged.WriteString(text + after[end-1].sep)
+		j = end
+	}
+
+	result.Translation = merged.String()
+	return result, nil
+}
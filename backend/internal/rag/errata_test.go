@@ -0,0 +1,135 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingTranslator records the texts it translates, returning them
+// marked with the language and the number of context cards, like
+// ragtest.Translator
+type recordingTranslator struct {
+	texts []string
+}
+
+func (t *recordingTranslator) Translate(ctx context.Context, englishText string, contextCards []ContextCard, model, language string) (TranslationResult, error) {
+	t.texts = append(t.texts, englishText)
+	return TranslationResult{Translation: fmt.Sprintf("[%s:%d] %s", language, len(contextCards), englishText)}, nil
+}
+
+func (t *recordingTranslator) TranslateCandidates(ctx context.Context, englishText string, contextCards []ContextCard, model, language string, n int) (CandidatesResult, error) {
+	return CandidatesResult{}, errors.New("candidates not supported")
+}
+
+func TestTranslateErrata(t *testing.T) {
+	oldEnglish := "Fight. You get +1 [combat] for this attack.\nForced - After you attack: Take 1 damage."
+	oldTranslation := "Combattimento. Ottieni +1 [combat] per questo attacco.\nObbligato - Dopo che hai attaccato: Subisci 1 danno."
+
+	testCases := []struct {
+		name           string
+		oldTranslation string
+		newEnglish     string
+		expected       string
+		translated     []string
+	}{
+		{
+			"ChangedSentence", oldTranslation,
+			"Fight. You get +2 [combat] for this attack.\nForced - After you attack: Take 1 damage.",
+			"Combattimento. [it:0] You get +2 [combat] for this attack.\nObbligato - Dopo che hai attaccato: Subisci 1 danno.",
+			[]string{"You get +2 [combat] for this attack."},
+		},
+		{
+			"AddedLine", oldTranslation,
+			"Fight. You get +1 [combat] for this attack.\nUses (3 charges).\nForced - After you attack: Take 1 damage.",
+			"Combattimento. Ottieni +1 [combat] per questo attacco.\n[it:0] Uses (3 charges).\nObbligato - Dopo che hai attaccato: Subisci 1 danno.",
+			[]string{"Uses (3 charges)."},
+		},
+		{
+			"RemovedSentence", oldTranslation,
+			"Fight.\nForced - After you attack: Take 1 damage.",
+			"Combattimento.\nObbligato - Dopo che hai attaccato: Subisci 1 danno.",
+			nil,
+		},
+		{
+			"Unchanged", oldTranslation, oldEnglish, oldTranslation, nil,
+		},
+		{
+			// The translation merges the sentences of the first line
+			"ByLine", "Combattimento con +1 [combat] per questo attacco.\nObbligato - Dopo che hai attaccato: Subisci 1 danno.",
+			"Fight. You get +1 [combat] for this attack.\nForced - After you attack: Take 2 damage.",
+			"Combattimento con +1 [combat] per questo attacco.\n[it:0] Forced - After you attack: Take 2 damage.",
+			[]string{"Forced - After you attack: Take 2 damage."},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			translator := &recordingTranslator{}
+			result, err := TranslateErrata(context.Background(), translator, oldEnglish, tc.oldTranslation, tc.newEnglish, nil, "gpt-4o", "it")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Translation != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result.Translation)
+			}
+			if strings.Join(translator.texts, "|") != strings.Join(tc.translated, "|") {
+				t.Errorf("Expected translated segments %q, got %q", tc.translated, translator.texts)
+			}
+			changed := 0
+			for _, segment := range result.Segments {
+				if segment.Changed {
+					changed++
+				}
+			}
+			if changed != len(tc.translated) {
+				t.Errorf("Expected %d changed segments, got %+v", len(tc.translated), result.Segments)
+			}
+		})
+	}
+}
+
+func TestTranslateErrata_Misaligned(t *testing.T) {
+	_, err := TranslateErrata(context.Background(), &recordingTranslator{}, "Fight.\nTake 1 damage.", "Combattimento e subisci 1 danno.", "Fight.", nil, "gpt-4o", "it")
+	if !errors.Is(err, ErrErrataMisaligned) {
+		t.Errorf("Expected ErrErrataMisaligned, got %v", err)
+	}
+}
+
+func TestSplitSegments(t *testing.T) {
+	text := "Fight. You get +1 [combat]!  Draw 1 card.\n\n\"It's over.\" Take 1 horror."
+	segments := splitSegments(text, true)
+
+	var joined strings.Builder
+	var texts []string
+	for _, segment := range segments {
+		joined.WriteString(segment.text + segment.sep)
+		texts = append(texts, segment.text)
+	}
+	if joined.String() != text {
+		t.Errorf("Expected the segments to join back to %q, got %q", text, joined.String())
+	}
+	expected := []string{"Fight.", "You get +1 [combat]!", "Draw 1 card.", "\"It's over.\"", "Take 1 horror."}
+	if strings.Join(texts, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected segments %q, got %q", expected, texts)
+	}
+}
+
+func TestBuildMessages_PreviousVersion(t *testing.T) {
+	ctx := WithPreviousVersion(context.Background(), "Fight. Take 1 damage.", "Combattimento. Subisci 1 danno.")
+	messages, err := BuildMessages(ctx, "Take 2 damage.", nil, "it")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	user := messages[1].Content
+	if !strings.Contains(user, "PREVIOUS VERSION OF THE CARD") || !strings.Contains(user, "Combattimento. Subisci 1 danno.") {
+		t.Errorf("Expected the previous version in the user prompt, got %q", user)
+	}
+
+	messages, _ = BuildMessages(context.Background(), "Take 2 damage.", nil, "it")
+	if strings.Contains(messages[1].Content, "PREVIOUS VERSION") {
+		t.Error("Expected no previous version without WithPreviousVersion")
+	}
+}
@@ -0,0 +1,33 @@
+package rag
+
+import "context"
+
+type explanationKey struct{}
+
+// WithExplanation returns a context under which the model is also asked for
+// a short explanation of its non-obvious choices, returned apart from the
+// translation. It needs JSON mode (see JSONOutput): plain-text answers come
+// without one.
+func WithExplanation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, explanationKey{}, true)
+}
+
+// IsExplanation reports whether ctx asks for an explanation
+func IsExplanation(ctx context.Context) bool {
+	explanation, _ := ctx.Value(explanationKey{}).(bool)
+	return explanation
+}
+
+// explanationField is added to the JSON output fields of the system prompt
+// under WithExplanation
+const explanationField = `
+* "explanation": one or two short sentences in English on the choices of the translation a reviewer may not expect (e.g. how a trait, keyword or term was rendered and which reference card it follows), or "" if there are none. Never put it in "translation".`
+
+// requestExplanation adds the explanation field to the system prompt of
+// messages when ctx asks for one and the answer is requested as JSON
+func requestExplanation(ctx context.Context, messages []Message, jsonMode bool) []Message {
+	if jsonMode && IsExplanation(ctx) && len(messages) > 0 {
+		messages[0].Content += explanationField
+	}
+	return messages
+}
@@ -0,0 +1,71 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+func TestTranslate_Explanation(t *testing.T) {
+	answer := `{"normalized": "Fight.", "translation": "Combatti.", "notes": ""}`
+	explained := `{"normalized": "Fight.", "translation": "Combatti.", "notes": "", "explanation": "Follows Machete (01020)."}`
+
+	testCases := []struct {
+		name       string
+		ctx        context.Context
+		jsonOutput bool
+		expected   string
+	}{
+		{"NotRequested", context.Background(), true, ""},
+		{"Requested", WithExplanation(context.Background()), true, "Follows Machete (01020)."},
+		{"PlainText", WithExplanation(context.Background()), false, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var systemPrompt string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Messages []Message `json:"messages"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				systemPrompt = body.Messages[0].Content
+
+				content := answer
+				if !tc.jsonOutput {
+					content = "Combatti."
+				} else if strings.Contains(systemPrompt, `"explanation"`) {
+					content = explained
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"choices": []map[string]interface{}{{"message": Message{Role: "assistant", Content: content}}},
+				})
+			}))
+			defer server.Close()
+
+			defer func(base string, jsonOutput bool) { openai.BaseURL, JSONOutput = base, jsonOutput }(openai.BaseURL, JSONOutput)
+			openai.BaseURL = server.URL
+			JSONOutput = tc.jsonOutput
+
+			result, err := Translate(tc.ctx, "Fight.", nil, "test-key", "gpt-4o", "it")
+			if err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			if result.Translation != "Combatti." {
+				t.Errorf("Expected the translation alone, got %q", result.Translation)
+			}
+			if result.Explanation != tc.expected {
+				t.Errorf("Expected explanation %q, got %q", tc.expected, result.Explanation)
+			}
+			if asked := strings.Contains(systemPrompt, `"explanation"`); asked != (tc.expected != "") {
+				t.Errorf("Expected the explanation field in the prompt: %v, got: %s", tc.expected != "", systemPrompt)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package rag
+
+import "github.com/ventrosky/arkham-localize/backend/internal/options"
+
+// LanguageFallbacks maps a target language to the languages whose official
+// translations are used as context when the target has none, in order of
+// preference. "en" uses the English text itself as the reference. Set at
+// startup; empty by default (no fallback).
+var LanguageFallbacks = map[string][]string{}
+
+// languageName returns the full name of a language code
+func languageName(language string) string {
+	if name, ok := options.LanguageNames[language]; ok {
+		return name
+	}
+	return language // Fallback
+}
@@ -0,0 +1,22 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildPrompts_LabelsFallbackCards(t *testing.T) {
+	contextCards := []ContextCard{
+		{CardName: "Machete", CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Kämpfen.", TranslationLanguage: "de"},
+		{CardName: "Survival Knife", CardCode: "03003", EnglishText: "Fight.", TranslatedText: "Combatti.", TranslationLanguage: "it", IsFallback: true},
+	}
+
+	_, userPrompt := buildPrompts("Fight.", contextCards, "de", false, false)
+
+	if !strings.Contains(userPrompt, "German: Kämpfen.") {
+		t.Errorf("Expected primary card to be labeled as German, got: %s", userPrompt)
+	}
+	if !strings.Contains(userPrompt, "Italian (FALLBACK REFERENCE") {
+		t.Errorf("Expected fallback card to be labeled as an Italian fallback reference, got: %s", userPrompt)
+	}
+}
@@ -0,0 +1,131 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+// MaxGlossaryEntries caps the glossary entries added to one prompt, to limit
+// the tokens spent on them
+var MaxGlossaryEntries = 20
+
+// glossaryEntry is a curated translation of an English term
+type glossaryEntry struct {
+	Term        string
+	Translation string
+	pattern     *regexp.Regexp // Matches Term as a whole word, ignoring case
+}
+
+// glossaries maps a language to its entries, sorted by term. Empty disables
+// the glossary section of the system prompt.
+var glossaries = map[string][]glossaryEntry{}
+
+// LoadGlossaries loads the glossary of each supported language from
+// <dir>/<language>.json, a JSON object mapping English terms to their
+// translation, e.g. {"Parley": "Parlamenta"}. Languages without a file have
+// no glossary. An empty dir disables the glossaries.
+func LoadGlossaries(dir string) error {
+	loaded, err := loadGlossaryDir(dir)
+	if err != nil {
+		return err
+	}
+
+	promptsMu.Lock()
+	glossaries = loaded
+	promptsMu.Unlock()
+	return nil
+}
+
+// loadGlossaryDir loads the glossaries LoadGlossaries uses for dir, without
+// putting them in use
+func loadGlossaryDir(dir string) (map[string][]glossaryEntry, error) {
+	loaded := map[string][]glossaryEntry{}
+	if dir == "" {
+		return loaded, nil
+	}
+
+	for _, language := range options.SupportedLanguages {
+		path := filepath.Join(dir, language+".json")
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read glossary: %w", err)
+		}
+
+		entries, err := parseGlossary(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glossary %s: %w", path, err)
+		}
+		loaded[language] = entries
+	}
+	return loaded, nil
+}
+
+// parseGlossary parses a glossary file into entries sorted by term
+func parseGlossary(content []byte) ([]glossaryEntry, error) {
+	var terms map[string]string
+	if err := json.Unmarshal(content, &terms); err != nil {
+		return nil, err
+	}
+
+	entries := make([]glossaryEntry, 0, len(terms))
+	for term, translation := range terms {
+		term, translation = strings.TrimSpace(term), strings.TrimSpace(translation)
+		if term == "" || translation == "" {
+			return nil, fmt.Errorf("empty term or translation (%q: %q)", term, translation)
+		}
+		// \b does not work next to brackets, as in [[Elite]], so the
+		// boundaries are spelled out
+		pattern := regexp.MustCompile(`(?i)(^|[^\pL\pN])` + regexp.QuoteMeta(term) + `($|[^\pL\pN])`)
+		entries = append(entries, glossaryEntry{Term: term, Translation: translation, pattern: pattern})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Term < entries[j].Term })
+	return entries, nil
+}
+
+// relevantGlossaryEntries returns the glossary entries of language whose
+// term appears in the text, at most MaxGlossaryEntries
+func relevantGlossaryEntries(englishText, language string) []glossaryEntry {
+	promptsMu.RLock()
+	entries := glossaries[language]
+	promptsMu.RUnlock()
+
+	var relevant []glossaryEntry
+	for _, entry := range entries {
+		if len(relevant) == MaxGlossaryEntries {
+			break
+		}
+		if entry.pattern.MatchString(englishText) {
+			relevant = append(relevant, entry)
+		}
+	}
+	return relevant
+}
+
+// glossarySection renders the glossary entries appended to the system
+// prompt, or "" if there are none
+func glossarySection(entries []glossaryEntry, language string) string {
+	if len(entries) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n\n---\n### GLOSSARY (MANDATORY TERMINOLOGY)\n")
+	sb.WriteString(fmt.Sprintf("Always translate these terms to %s exactly as shown:\n", languageName(language)))
+	for _, entry := range entries {
+		sb.WriteString(fmt.Sprintf("* \"%s\" -> \"%s\"\n", entry.Term, entry.Translation))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,79 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildPrompts_Glossary(t *testing.T) {
+	defer func(loaded map[string][]glossaryEntry) { glossaries = loaded }(glossaries)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "it.json"), []byte(`{"Parley": "Parlamenta", "[[Elite]]": "[[Élite]]", "Evade": "Eludere"}`), 0o644); err != nil {
+		t.Fatalf("Failed to write glossary: %v", err)
+	}
+	if err := LoadGlossaries(dir); err != nil {
+		t.Fatalf("Failed to load glossaries: %v", err)
+	}
+
+	text := "[action]: Parley. Deal 1 damage to an [[Elite]] enemy."
+	systemPrompt, _ := buildPrompts(text, nil, "it", false, false)
+	for _, expected := range []string{"### GLOSSARY", `"Parley" -> "Parlamenta"`, `"[[Elite]]" -> "[[Élite]]"`} {
+		if !strings.Contains(systemPrompt, expected) {
+			t.Errorf("Expected the Italian system prompt to contain %q", expected)
+		}
+	}
+	// Only the terms found in the text are included
+	if strings.Contains(systemPrompt, "Eludere") {
+		t.Error("Expected the unused glossary entry to be left out")
+	}
+
+	// Other languages have no glossary
+	if systemPrompt, _ := buildPrompts(text, nil, "fr", false, false); strings.Contains(systemPrompt, "GLOSSARY") {
+		t.Error("Expected no glossary in the French system prompt")
+	}
+	// Words merely containing a term don't match
+	if systemPrompt, _ := buildPrompts("Parleying is not allowed.", nil, "it", false, false); strings.Contains(systemPrompt, "GLOSSARY") {
+		t.Error("Expected no glossary when no term appears as a whole word")
+	}
+
+	// An empty directory disables the glossaries
+	if err := LoadGlossaries(""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if systemPrompt, _ := buildPrompts(text, nil, "it", false, false); strings.Contains(systemPrompt, "GLOSSARY") {
+		t.Error("Expected no glossary once disabled")
+	}
+}
+
+func TestLoadGlossaries_Invalid(t *testing.T) {
+	defer func(loaded map[string][]glossaryEntry) { glossaries = loaded }(glossaries)
+
+	for _, content := range []string{`["Parley"]`, `{"Parley": ""}`} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "de.json"), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write glossary: %v", err)
+		}
+		if err := LoadGlossaries(dir); err == nil {
+			t.Errorf("Expected error for glossary %s, got nil", content)
+		}
+	}
+}
+
+func TestRelevantGlossaryEntries_Limit(t *testing.T) {
+	defer func(loaded map[string][]glossaryEntry) { glossaries = loaded }(glossaries)
+	defer func(limit int) { MaxGlossaryEntries = limit }(MaxGlossaryEntries)
+
+	entries, err := parseGlossary([]byte(`{"Fight": "Combattere", "Evade": "Eludere", "Investigate": "Indagare"}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	glossaries = map[string][]glossaryEntry{"it": entries}
+	MaxGlossaryEntries = 2
+
+	if relevant := relevantGlossaryEntries("Fight, evade or investigate.", "it"); len(relevant) != 2 {
+		t.Errorf("Expected 2 entries, got %+v", relevant)
+	}
+}
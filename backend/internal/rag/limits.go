@@ -0,0 +1,103 @@
+package rag
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Prompt size limits, set at startup. A value of 0 disables the check.
+var (
+	// MaxInputChars is the maximum length of the text to translate, in characters
+	MaxInputChars = 4000
+	// MaxPromptTokens is the estimated token budget for the full prompt
+	// (instructions, context cards and input text)
+	MaxPromptTokens = 12000
+	// ContextTokenBudget is the estimated token budget for the context
+	// cards alone, see BudgetContextCards
+	ContextTokenBudget = 0
+)
+
+// PromptTooLargeError is returned when the input text or the combined prompt
+// would likely exceed the model's context window
+type PromptTooLargeError struct {
+	InputChars      int
+	MaxInputChars   int
+	EstimatedTokens int
+	MaxTokens       int
+}
+
+func (e *PromptTooLargeError) Error() string {
+	if e.MaxInputChars > 0 && e.InputChars > e.MaxInputChars {
+		return fmt.Sprintf("input text is too long: %d characters (maximum %d); split it into smaller parts", e.InputChars, e.MaxInputChars)
+	}
+	return fmt.Sprintf("prompt is too large: ~%d tokens (maximum %d); shorten the text or enable context auto-trimming", e.EstimatedTokens, e.MaxTokens)
+}
+
+// EstimateTokens returns a rough token count for text (about 4 characters per token)
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// estimatePromptTokens estimates the token count of the full translation prompt
+func estimatePromptTokens(englishText string, contextCards []ContextCard, language string) int {
+	systemPrompt, userPrompt := buildPrompts(englishText, contextCards, language, JSONOutput, false)
+	return EstimateTokens(systemPrompt) + EstimateTokens(userPrompt)
+}
+
+// CheckPromptSize returns a *PromptTooLargeError if the input text exceeds
+// MaxInputChars or the combined prompt exceeds MaxPromptTokens
+func CheckPromptSize(englishText string, contextCards []ContextCard, language string) error {
+	inputChars := utf8.RuneCountInString(englishText)
+	if MaxInputChars > 0 && inputChars > MaxInputChars {
+		return &PromptTooLargeError{InputChars: inputChars, MaxInputChars: MaxInputChars}
+	}
+
+	if MaxPromptTokens > 0 {
+		if tokens := estimatePromptTokens(englishText, contextCards, language); tokens > MaxPromptTokens {
+			return &PromptTooLargeError{
+				InputChars:      inputChars,
+				MaxInputChars:   MaxInputChars,
+				EstimatedTokens: tokens,
+				MaxTokens:       MaxPromptTokens,
+			}
+		}
+	}
+
+	return nil
+}
+
+// BudgetContextCards keeps the context cards, in order (most similar first),
+// while their estimated prompt tokens fit within budget, so that a few long
+// references, such as back texts, don't make the prompt size vary with the
+// cards retrieved. A budget of 0 keeps every card.
+func BudgetContextCards(contextCards []ContextCard, language string, budget int) []ContextCard {
+	if budget <= 0 {
+		return contextCards
+	}
+	langName := languageName(language)
+	tokens := 0
+	for i, card := range contextCards {
+		tokens += EstimateTokens(contextCardSection(i+1, card, langName))
+		if tokens > budget {
+			return contextCards[:i]
+		}
+	}
+	return contextCards
+}
+
+// FitContextCards drops the least similar context cards (from the end of the
+// list) until the prompt fits within MaxPromptTokens. It returns a
+// *PromptTooLargeError if the prompt does not fit even without context.
+func FitContextCards(englishText string, contextCards []ContextCard, language string) ([]ContextCard, error) {
+	for {
+		err := CheckPromptSize(englishText, contextCards, language)
+		if err == nil || len(contextCards) == 0 {
+			return contextCards, err
+		}
+		if tooLarge, ok := err.(*PromptTooLargeError); ok && tooLarge.MaxTokens == 0 {
+			// Input text alone is too long, trimming context won't help
+			return contextCards, err
+		}
+		contextCards = contextCards[:len(contextCards)-1]
+	}
+}
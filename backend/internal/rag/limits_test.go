@@ -0,0 +1,103 @@
+package rag
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func setPromptLimits(t *testing.T, maxChars, maxTokens int) {
+	t.Helper()
+	prevChars, prevTokens := MaxInputChars, MaxPromptTokens
+	MaxInputChars, MaxPromptTokens = maxChars, maxTokens
+	t.Cleanup(func() { MaxInputChars, MaxPromptTokens = prevChars, prevTokens })
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if tokens := EstimateTokens("12345678"); tokens != 2 {
+		t.Errorf("Expected 2 tokens, got %d", tokens)
+	}
+	// Multi-byte characters count as one character each
+	if tokens := EstimateTokens("èèèè"); tokens != 1 {
+		t.Errorf("Expected 1 token, got %d", tokens)
+	}
+}
+
+func TestCheckPromptSize_InputTooLong(t *testing.T) {
+	setPromptLimits(t, 10, 0)
+
+	err := CheckPromptSize(strings.Repeat("a", 11), nil, "it")
+
+	var tooLarge *PromptTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("Expected PromptTooLargeError, got %v", err)
+	}
+	if tooLarge.InputChars != 11 {
+		t.Errorf("Expected 11 input chars, got %d", tooLarge.InputChars)
+	}
+}
+
+func TestCheckPromptSize_Disabled(t *testing.T) {
+	setPromptLimits(t, 0, 0)
+
+	if err := CheckPromptSize(strings.Repeat("a", 100000), nil, "it"); err != nil {
+		t.Errorf("Expected no error with limits disabled, got %v", err)
+	}
+}
+
+func TestFitContextCards_TrimsLeastSimilar(t *testing.T) {
+	cards := []ContextCard{
+		{CardCode: "01", EnglishText: strings.Repeat("a", 2000), TranslatedText: strings.Repeat("b", 2000)},
+		{CardCode: "02", EnglishText: strings.Repeat("c", 2000), TranslatedText: strings.Repeat("d", 2000)},
+	}
+
+	// Budget that fits the instructions and one card, but not two
+	base := estimatePromptTokens("Draw 1 card.", nil, "it")
+	setPromptLimits(t, 0, base+1500)
+
+	fitted, err := FitContextCards("Draw 1 card.", cards, "it")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fitted) != 1 || fitted[0].CardCode != "01" {
+		t.Errorf("Expected only the closest card to be kept, got %v", fitted)
+	}
+}
+
+func TestFitContextCards_InputTooLong(t *testing.T) {
+	setPromptLimits(t, 10, 100000)
+
+	if _, err := FitContextCards(strings.Repeat("a", 11), []ContextCard{{CardCode: "01"}}, "it"); err == nil {
+		t.Error("Expected error for oversized input, got nil")
+	}
+}
+
+func TestBudgetContextCards(t *testing.T) {
+	cards := []ContextCard{
+		{CardCode: "01", EnglishText: "Fight.", TranslatedText: "Combattere."},
+		{CardCode: "02", EnglishText: strings.Repeat("a", 2000), TranslatedText: strings.Repeat("b", 2000), IsBack: true},
+		{CardCode: "03", EnglishText: "Investigate.", TranslatedText: "Indagare."},
+	}
+	first := EstimateTokens(contextCardSection(1, cards[0], "Italian"))
+
+	tests := []struct {
+		name   string
+		budget int
+		want   int
+	}{
+		{"no budget", 0, 3},
+		{"large budget", 10000, 3},
+		// Stops at the long back text rather than skipping it for a less similar card
+		{"stops at the long card", first + 100, 1},
+		{"first card alone", first, 1},
+		{"too small for any card", first - 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BudgetContextCards(cards, "it", tt.budget); len(got) != tt.want {
+				t.Errorf("Expected %d cards, got %d", tt.want, len(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package rag
+
+import "context"
+
+type literalKey struct{}
+
+// WithLiteral returns a context under which the translation is literal: the
+// text skips NormalizeStructure and the model gets the literal.tmpl prompt,
+// which translates it as-is instead of normalizing its wording first. For
+// comparing with and debugging the normalized translations.
+func WithLiteral(ctx context.Context) context.Context {
+	return context.WithValue(ctx, literalKey{}, true)
+}
+
+// IsLiteral reports whether ctx asks for a literal translation
+func IsLiteral(ctx context.Context) bool {
+	literal, _ := ctx.Value(literalKey{}).(bool)
+	return literal
+}
+
+// PrepareSourceFor is PrepareSource, except that a literal translation (see
+// WithLiteral) is only sanitized
+func PrepareSourceFor(ctx context.Context, text, language string) string {
+	if IsLiteral(ctx) {
+		sanitized, _ := SanitizeInput(text)
+		return sanitized
+	}
+	return PrepareSource(text, language)
+}
@@ -0,0 +1,79 @@
+package rag
+
+import (
+	"fmt"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+// Metric is the vector distance used by the ivfflat indexes and the
+// retrieval queries. Both take the operator class and operator from here so
+// they always agree; a query whose operator doesn't match the index's
+// operator class can't use the index.
+type Metric string
+
+const (
+	MetricCosine       Metric = options.MetricCosine       // Cosine distance (default)
+	MetricInnerProduct Metric = options.MetricInnerProduct // Negative inner product
+	MetricL2           Metric = options.MetricL2           // Euclidean distance
+)
+
+// SimilarityMetric is the metric used by the retrieval queries. Set at
+// startup to match the indexes.
+var SimilarityMetric = MetricCosine
+
+// metricOps holds the pgvector operator and operator class of each metric
+var metricOps = map[Metric]struct {
+	operator string
+	opClass  string
+}{
+	MetricCosine:       {"<=>", "vector_cosine_ops"},
+	MetricInnerProduct: {"<#>", "vector_ip_ops"},
+	MetricL2:           {"<->", "vector_l2_ops"},
+}
+
+// ParseMetric parses a metric name (cosine, ip or l2)
+func ParseMetric(name string) (Metric, error) {
+	metric := Metric(name)
+	if _, ok := metricOps[metric]; !ok {
+		return "", fmt.Errorf("unsupported metric: %s (supported: cosine, ip, l2)", name)
+	}
+	return metric, nil
+}
+
+// MetricForOpClass returns the metric of an index operator class, e.g.
+// vector_cosine_ops
+func MetricForOpClass(opClass string) (Metric, error) {
+	for metric, ops := range metricOps {
+		if ops.opClass == opClass {
+			return metric, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported operator class: %s", opClass)
+}
+
+// Operator returns the pgvector distance operator, e.g. <=>
+func (m Metric) Operator() string {
+	return metricOps[m].operator
+}
+
+// OpClass returns the ivfflat operator class, e.g. vector_cosine_ops
+func (m Metric) OpClass() string {
+	return metricOps[m].opClass
+}
+
+// similarity returns the SQL expression of the similarity between column and
+// the query vector param (1 = identical). OpenAI embeddings are normalized, so
+// every metric yields the cosine similarity and min_similarity thresholds
+// keep their meaning.
+func (m Metric) similarity(column, param string) string {
+	switch m {
+	case MetricInnerProduct:
+		return fmt.Sprintf("-(%s <#> %s)", column, param)
+	case MetricL2:
+		// |a - b|^2 = 2 - 2 cos for unit vectors
+		return fmt.Sprintf("1 - power(%s <-> %s, 2) / 2", column, param)
+	default:
+		return fmt.Sprintf("1 - (%s <=> %s)", column, param)
+	}
+}
@@ -0,0 +1,30 @@
+package rag
+
+import "regexp"
+
+var (
+	// "<fre>, during your turn: ..." -> "<fre> During your turn, ..."
+	freeDuringTurnPattern = regexp.MustCompile(`(?mi)(<fre>|\[free\]),?\s*during your turn\s*:\s*`)
+	// "<eld>: ..." or "[elder_sign] effect: ..." at the start of a line
+	elderSignPattern = regexp.MustCompile(`(?m)^([ \t]*)(<eld>|\[elder_sign\])(?:\s+effect)?\s*:`)
+)
+
+// elderSignLabels holds the official label that precedes elder sign effects,
+// per target language. Languages without an entry are left to the model.
+var elderSignLabels = map[string]string{
+	"it": "<b>Effetto di</b>",
+}
+
+// NormalizeStructure applies the deterministic wording-normalization rules
+// to fan-made text before translation, so that the model only has to
+// translate the prose. The symbol syntax of the input (<fre> or [free],
+// <eld> or [elder_sign]) is preserved.
+func NormalizeStructure(text, language string) string {
+	text = freeDuringTurnPattern.ReplaceAllString(text, "$1 During your turn, ")
+
+	if label, ok := elderSignLabels[language]; ok {
+		text = elderSignPattern.ReplaceAllString(text, "${1}"+label+" ${2}:")
+	}
+
+	return text
+}
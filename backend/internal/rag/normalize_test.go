@@ -0,0 +1,83 @@
+package rag
+
+import "testing"
+
+func TestNormalizeStructure(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		language string
+		expected string
+	}{
+		{
+			name:     "FreeAction_DuringYourTurn",
+			text:     "<fre>, during your turn: Discard a card.",
+			language: "it",
+			expected: "<fre> During your turn, Discard a card.",
+		},
+		{
+			name:     "FreeAction_ArkhamdbSyntax",
+			text:     "[free], during your turn: Discard a card.",
+			language: "fr",
+			expected: "[free] During your turn, Discard a card.",
+		},
+		{
+			name:     "FreeAction_AlreadyNormalized",
+			text:     "<fre> During your turn, discard a card.",
+			language: "it",
+			expected: "<fre> During your turn, discard a card.",
+		},
+		{
+			name:     "ElderSign_Italian",
+			text:     "<eld>: +2. Draw a card.",
+			language: "it",
+			expected: "<b>Effetto di</b> <eld>: +2. Draw a card.",
+		},
+		{
+			name:     "ElderSign_EffectWording",
+			text:     "[elder_sign] effect: +1.",
+			language: "it",
+			expected: "<b>Effetto di</b> [elder_sign]: +1.",
+		},
+		{
+			name:     "ElderSign_AlreadyNormalized",
+			text:     "<b>Effetto di</b> <eld>: +2.",
+			language: "it",
+			expected: "<b>Effetto di</b> <eld>: +2.",
+		},
+		{
+			name:     "ElderSign_NoLabelForLanguage",
+			text:     "<eld>: +2.",
+			language: "de",
+			expected: "<eld>: +2.",
+		},
+		{
+			name:     "ElderSign_MidSentenceUnchanged",
+			text:     "If you reveal <eld>: draw a card.",
+			language: "it",
+			expected: "If you reveal <eld>: draw a card.",
+		},
+		{
+			name: "Multiline",
+			text: `You begin the game with Ashley's Pikachu in play.
+
+<fre>, during your turn: Ready Ashley's Pikachu. (Limit once per turn.)
+
+<eld>: +1.`,
+			language: "it",
+			expected: `You begin the game with Ashley's Pikachu in play.
+
+<fre> During your turn, Ready Ashley's Pikachu. (Limit once per turn.)
+
+<b>Effetto di</b> <eld>: +1.`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeStructure(tt.text, tt.language); got != tt.expected {
+				t.Errorf("NormalizeStructure(%q, %q)\n got: %q\nwant: %q", tt.text, tt.language, got, tt.expected)
+			}
+		})
+	}
+}
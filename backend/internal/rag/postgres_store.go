@@ -0,0 +1,491 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/pgvector/pgvector-go"
+)
+
+// PostgresStore is the VectorStore backed by the card_embeddings and
+// card_translations tables, searched with pgvector
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore returns a store using the tables in db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Search implements VectorStore. It queries with SimilarityMetric and, in
+// english mode, falls back through LanguageFallbacks for the translated text.
+func (s *PostgresStore) Search(ctx context.Context, query SearchQuery) ([]ContextCard, error) {
+	if err := validateSearch(query); err != nil {
+		return nil, err
+	}
+
+	vector := pgvector.NewVector(query.Embedding)
+
+	// The pack is only a parameter of the queries boosting it, which keep
+	// the plain distance order otherwise
+	packWeight := 0.0
+	var packArg []interface{}
+	if query.PreferPack != "" && PackWeight > 0 {
+		packWeight = PackWeight
+		packArg = []interface{}{query.PreferPack}
+	}
+
+	var rows *sql.Rows
+	var err error
+	if query.Mode == RetrievalTarget {
+		args := append([]interface{}{vector, query.Limit, query.TextType, query.Language, query.TypeCode, query.FactionCode, query.EmbeddingModel, query.Deck}, packArg...)
+		rows, err = s.db.QueryContext(ctx, similarTranslationsQuery(SimilarityMetric, PriorityWeight, packWeight), args...)
+	} else {
+		// Target language first, then its configured fallbacks
+		languages := append([]string{query.Language}, LanguageFallbacks[query.Language]...)
+		args := append([]interface{}{vector, query.Limit, query.TextType, pq.Array(languages), query.TypeCode, query.FactionCode, query.EmbeddingModel, query.Deck}, packArg...)
+		rows, err = s.db.QueryContext(ctx, similarCardsQuery(SimilarityMetric, PriorityWeight, packWeight), args...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query similar cards: %w", err)
+	}
+	defer rows.Close()
+
+	cards, err := scanCards(rows, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if languages := referenceLanguagesFor(query.ReferenceLanguages, query.Language); len(languages) > 0 && len(cards) > 0 {
+		if err := s.attachReferences(ctx, cards, query.TextType, languages); err != nil {
+			return nil, err
+		}
+	}
+
+	return cards, nil
+}
+
+// Cards implements VectorStore
+func (s *PostgresStore) Cards(ctx context.Context, codes []string, query SearchQuery) ([]ContextCard, error) {
+	if err := validateSearch(query); err != nil {
+		return nil, err
+	}
+
+	languages := append([]string{query.Language}, LanguageFallbacks[query.Language]...)
+	rows, err := s.db.QueryContext(ctx, cardsByCodeQuery(SimilarityMetric), pgvector.NewVector(query.Embedding), pq.Array(codes), query.TextType, pq.Array(languages))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cards: %w", err)
+	}
+	defer rows.Close()
+
+	cards, err := scanCards(rows, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if languages := referenceLanguagesFor(query.ReferenceLanguages, query.Language); len(languages) > 0 && len(cards) > 0 {
+		if err := s.attachReferences(ctx, cards, query.TextType, languages); err != nil {
+			return nil, err
+		}
+	}
+
+	return cards, nil
+}
+
+// scanCards reads the rows of a retrieval query into context cards
+func scanCards(rows *sql.Rows, query SearchQuery) ([]ContextCard, error) {
+	cards := []ContextCard{} // Initialize as empty slice, not nil
+	for rows.Next() {
+		var card ContextCard
+		if err := rows.Scan(
+			&card.CardCode,
+			&card.CardName,
+			&card.IsBack,
+			&card.EnglishText,
+			&card.TranslatedText,
+			&card.TranslationLanguage,
+			&card.Similarity,
+			&card.Note,
+			&card.TypeCode,
+			&card.FactionCode,
+			&card.EncounterCode,
+			&card.PackCode,
+			&card.EmbeddingModel,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan card: %w", err)
+		}
+		card.IsFallback = card.TranslationLanguage != query.Language
+		card.TextType = query.TextType
+		cards = append(cards, card)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return cards, nil
+}
+
+// attachReferences sets the References of the cards to their translations
+// in languages
+func (s *PostgresStore) attachReferences(ctx context.Context, cards []ContextCard, textType string, languages []string) error {
+	codes := make([]string, len(cards))
+	for i, card := range cards {
+		codes[i] = card.CardCode
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT card_code, is_back, language, text
+		FROM card_translations
+		WHERE card_code = ANY($1::text[]) AND text_type = $2 AND language = ANY($3::text[]) AND text <> ''`,
+		pq.Array(codes), textType, pq.Array(languages))
+	if err != nil {
+		return fmt.Errorf("failed to query reference translations: %w", err)
+	}
+	defer rows.Close()
+
+	type side struct {
+		code   string
+		isBack bool
+	}
+	references := make(map[side]map[string]string)
+	for rows.Next() {
+		var key side
+		var language, text string
+		if err := rows.Scan(&key.code, &key.isBack, &language, &text); err != nil {
+			return fmt.Errorf("failed to scan reference translation: %w", err)
+		}
+		if references[key] == nil {
+			references[key] = make(map[string]string)
+		}
+		references[key][language] = text
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	for i, card := range cards {
+		for language, text := range references[side{card.CardCode, card.IsBack}] {
+			// A fallback card already shows this translation as its reference
+			if card.IsFallback && language == card.TranslationLanguage {
+				continue
+			}
+			if cards[i].References == nil {
+				cards[i].References = make(map[string]string)
+			}
+			cards[i].References[language] = text
+		}
+	}
+	return nil
+}
+
+// copyMinEntries is the batch size from which Upsert bulk-loads the rows
+// with COPY; smaller batches, e.g. a single card re-ingest, use one INSERT
+// per row
+const copyMinEntries = 20
+
+// Upsert implements VectorStore. It stores each entry and its translations
+// (one row per language) in a single transaction, deleting the existing rows
+// for the same card code, side and text type first.
+func (s *PostgresStore) Upsert(entries []StoreEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(entries) >= copyMinEntries {
+		err = copyEntries(tx, entries)
+	} else {
+		err = insertEntries(tx, entries)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertEntries replaces the rows of each entry with one DELETE and one
+// INSERT per row
+func insertEntries(tx *sql.Tx, entries []StoreEntry) error {
+	for _, e := range entries {
+		for _, table := range []string{"card_embeddings", "card_translations"} {
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE card_code = $1 AND is_back = $2 AND text_type = $3", table),
+				e.CardCode, e.IsBack, e.TextType); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(`INSERT INTO card_embeddings (card_code, card_name, is_back, text_type, english_text, embedding, embedding_model, priority, type_code, faction_code, encounter_code, pack_code)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			e.CardCode, e.CardName, e.IsBack, e.TextType, e.EnglishText, pgvector.NewVector(e.Embedding), e.EmbeddingModel, e.Priority, e.TypeCode, e.FactionCode, e.EncounterCode, e.PackCode); err != nil {
+			return err
+		}
+
+		for lang, text := range e.Translations {
+			if text == "" {
+				continue
+			}
+			// Translation embedding (NULL if not generated)
+			var embedding, model interface{}
+			if emb, ok := e.TranslationEmbeddings[lang]; ok {
+				embedding = pgvector.NewVector(emb)
+				model = e.EmbeddingModel
+			}
+			if _, err := tx.Exec(`INSERT INTO card_translations (card_code, is_back, text_type, language, text, embedding, embedding_model)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				e.CardCode, e.IsBack, e.TextType, lang, text, embedding, model); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyEntries replaces the rows of the entries with one DELETE per table and
+// a COPY per table. lib/pq only speaks COPY's text format, in which a vector
+// is its pgvector literal ("[0.1,0.2,...]"), as pgvector.Vector encodes it.
+// An entry repeated in the batch is stored once, the last one winning as
+// with insertEntries.
+func copyEntries(tx *sql.Tx, entries []StoreEntry) error {
+	type entryKey struct {
+		code, textType string
+		isBack         bool
+	}
+	latest := make(map[entryKey]int, len(entries))
+	for i, e := range entries {
+		latest[entryKey{e.CardCode, e.TextType, e.IsBack}] = i
+	}
+	unique := make([]StoreEntry, 0, len(latest))
+	for i, e := range entries {
+		if latest[entryKey{e.CardCode, e.TextType, e.IsBack}] == i {
+			unique = append(unique, e)
+		}
+	}
+
+	codes := make([]string, len(unique))
+	backs := make([]bool, len(unique))
+	textTypes := make([]string, len(unique))
+	for i, e := range unique {
+		codes[i], backs[i], textTypes[i] = e.CardCode, e.IsBack, e.TextType
+	}
+	for _, table := range []string{"card_embeddings", "card_translations"} {
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE (card_code, is_back, text_type) IN (
+			SELECT * FROM unnest($1::text[], $2::boolean[], $3::text[]))`, table),
+			pq.Array(codes), pq.Array(backs), pq.Array(textTypes)); err != nil {
+			return err
+		}
+	}
+
+	err := copyRows(tx, "card_embeddings", []string{"card_code", "card_name", "is_back", "text_type", "english_text", "embedding", "embedding_model", "priority", "type_code", "faction_code", "encounter_code", "pack_code"},
+		func(row func(...interface{}) error) error {
+			for _, e := range unique {
+				if err := row(e.CardCode, e.CardName, e.IsBack, e.TextType, e.EnglishText, pgvector.NewVector(e.Embedding), e.EmbeddingModel, e.Priority, e.TypeCode, e.FactionCode, e.EncounterCode, e.PackCode); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	return copyRows(tx, "card_translations", []string{"card_code", "is_back", "text_type", "language", "text", "embedding", "embedding_model"},
+		func(row func(...interface{}) error) error {
+			for _, e := range unique {
+				for lang, text := range e.Translations {
+					if text == "" {
+						continue
+					}
+					// Translation embedding (NULL if not generated)
+					var embedding, model interface{}
+					if emb, ok := e.TranslationEmbeddings[lang]; ok {
+						embedding = pgvector.NewVector(emb)
+						model = e.EmbeddingModel
+					}
+					if err := row(e.CardCode, e.IsBack, e.TextType, lang, text, embedding, model); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+}
+
+// copyRows loads the rows that write passes to its row function into the
+// columns of table with COPY
+func copyRows(tx *sql.Tx, table string, columns []string, write func(row func(...interface{}) error) error) error {
+	stmt, err := tx.Prepare(pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	err = write(func(values ...interface{}) error {
+		_, err := stmt.Exec(values...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy into %s: %w", table, err)
+	}
+	// The final Exec without values flushes the buffered rows
+	if _, err := stmt.Exec(); err != nil {
+		return fmt.Errorf("failed to copy into %s: %w", table, err)
+	}
+	return stmt.Close()
+}
+
+// Delete implements VectorStore, removing the card's rows from both tables
+// in a single transaction
+func (s *PostgresStore) Delete(cardCode string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM card_translations WHERE card_code = $1", cardCode); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec("DELETE FROM card_embeddings WHERE card_code = $1", cardCode)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(deleted), tx.Commit()
+}
+
+// Embedding implements VectorStore
+func (s *PostgresStore) Embedding(ctx context.Context, cardCode string, isBack bool, textType string) ([]float32, error) {
+	var embedding pgvector.Vector
+	err := s.db.QueryRowContext(ctx, `
+		SELECT embedding FROM card_embeddings
+		WHERE card_code = $1 AND is_back = $2 AND text_type = $3 AND embedding IS NOT NULL
+		LIMIT 1
+	`, cardCode, isBack, textType).Scan(&embedding)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no %s embedding stored for card %s", ErrEntryNotFound, textType, cardCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return embedding.Slice(), nil
+}
+
+// cardNoteJoin joins the note of each card side (alias e) and text type as
+// note.text, preferring the one for the language in languageExpr over the
+// one for every language. Cards without a note get an empty one.
+func cardNoteJoin(languageExpr string) string {
+	return fmt.Sprintf(`
+		LEFT JOIN LATERAL (
+			SELECT n.note AS text
+			FROM card_notes n
+			WHERE n.card_code = e.card_code AND n.is_back = e.is_back AND n.text_type = e.text_type
+				AND n.language IN (%s, '')
+			ORDER BY n.language DESC
+			LIMIT 1
+		) note ON TRUE`, languageExpr)
+}
+
+// cardMetadataFilter restricts the retrieval queries to the card type in $5
+// and the faction in $6 (alias e); an empty parameter matches every card
+const cardMetadataFilter = `
+			AND ($5 = '' OR e.type_code = $5) AND ($6 = '' OR e.faction_code = $6)`
+
+// deckFilter restricts the retrieval queries to the player cards (without an
+// encounter set) or the encounter cards (with one) for the deck in $8 (alias
+// e); an empty parameter matches every card
+const deckFilter = `
+			AND ($8 = '' OR (e.encounter_code <> '') = ($8 = 'encounter'))`
+
+// embeddingModelFilter restricts the retrieval queries to the embeddings in
+// column made with the model in $7, or of an unknown model; an empty
+// parameter matches every embedding
+func embeddingModelFilter(column string) string {
+	return fmt.Sprintf(`
+			AND ($7 = '' OR COALESCE(%s, $7) = $7)`, column)
+}
+
+// translatedTextJoin joins the translated text of each card side (alias e)
+// as tr: the first language in $4 (the target language followed by its
+// fallbacks) that has one, "en" standing for the English text itself
+const translatedTextJoin = `
+		JOIN LATERAL (
+			SELECT candidates.language, candidates.text
+			FROM (
+				SELECT t.language, t.text
+				FROM card_translations t
+				WHERE t.card_code = e.card_code AND t.is_back = e.is_back AND t.text_type = e.text_type
+				UNION ALL
+				SELECT 'en', e.english_text
+			) candidates
+			WHERE candidates.language = ANY($4::text[])
+			ORDER BY array_position($4::text[], candidates.language)
+			LIMIT 1
+		) tr ON TRUE`
+
+// similarCardsQuery builds the retrieval query matching the English
+// embeddings, with the translated text of translatedTextJoin, ordered by the
+// metric's distance (as its ivfflat index serves) unless weighted by card
+// priority or pack (see PriorityWeight and PackWeight).
+func similarCardsQuery(metric Metric, priorityWeight, packWeight float64) string {
+	return fmt.Sprintf(`
+		SELECT e.card_code, e.card_name, e.is_back, e.english_text,
+			tr.text as translated_text,
+			tr.language as translation_language,
+			%s as similarity,
+			COALESCE(note.text, '') as note,
+			e.type_code, e.faction_code, e.encounter_code, e.pack_code,
+			COALESCE(e.embedding_model, '') as embedding_model
+		FROM card_embeddings e%s%s
+		WHERE e.embedding IS NOT NULL AND e.card_code IS NOT NULL AND e.text_type = $3%s%s
+		ORDER BY %s
+		LIMIT $2
+	`, metric.similarity("e.embedding", "$1"), translatedTextJoin, cardNoteJoin("($4::text[])[1]"), cardMetadataFilter+deckFilter, embeddingModelFilter("e.embedding_model"), orderBy(metric, "e.embedding", "$1", priorityWeight, packWeight))
+}
+
+// cardsByCodeQuery builds the query of the cards with the codes in $2, in
+// their order, front first, with the translated text picked as in
+// similarCardsQuery and their similarity to $1
+func cardsByCodeQuery(metric Metric) string {
+	return fmt.Sprintf(`
+		SELECT e.card_code, e.card_name, e.is_back, e.english_text,
+			tr.text as translated_text,
+			tr.language as translation_language,
+			%s as similarity,
+			COALESCE(note.text, '') as note,
+			e.type_code, e.faction_code, e.encounter_code, e.pack_code,
+			COALESCE(e.embedding_model, '') as embedding_model
+		FROM card_embeddings e%s%s
+		WHERE e.embedding IS NOT NULL AND e.card_code = ANY($2::text[]) AND e.text_type = $3
+		ORDER BY array_position($2::text[], e.card_code), e.is_back
+	`, metric.similarity("e.embedding", "$1"), translatedTextJoin, cardNoteJoin("($4::text[])[1]"))
+}
+
+// similarTranslationsQuery builds the retrieval query matching the embeddings
+// of the translations in language $4, for target-language retrieval, ordered
+// as similarCardsQuery
+func similarTranslationsQuery(metric Metric, priorityWeight, packWeight float64) string {
+	return fmt.Sprintf(`
+		SELECT e.card_code, e.card_name, e.is_back, e.english_text,
+			t.text as translated_text,
+			t.language as translation_language,
+			%s as similarity,
+			COALESCE(note.text, '') as note,
+			e.type_code, e.faction_code, e.encounter_code, e.pack_code,
+			COALESCE(t.embedding_model, '') as embedding_model
+		FROM card_translations t
+		JOIN card_embeddings e
+			ON e.card_code = t.card_code AND e.is_back = t.is_back AND e.text_type = t.text_type%s
+		WHERE t.embedding IS NOT NULL AND t.language = $4 AND t.text_type = $3%s%s
+		ORDER BY %s
+		LIMIT $2
+	`, metric.similarity("t.embedding", "$1"), cardNoteJoin("$4"), cardMetadataFilter+deckFilter, embeddingModelFilter("t.embedding_model"), orderBy(metric, "t.embedding", "$1", priorityWeight, packWeight))
+}
@@ -0,0 +1,70 @@
+package rag
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+// PostProcessor is one output cleanup step: a pure function of the
+// translation and the source text, so a step can leave alone what the source
+// has too
+type PostProcessor func(translation, source string) string
+
+// postProcessors maps each name of options.PostProcessorNames to its step
+var postProcessors = map[string]PostProcessor{
+	options.PostStripQuotes:    stripQuotes,
+	options.PostCollapseSpaces: collapseSpaces,
+	options.PostBracketSpacing: bracketSpacing,
+}
+
+// PostProcessors is the pipeline applied to every translation after its
+// scaffolding is stripped, in order. Set at startup.
+var PostProcessors, _ = options.ParsePostProcessors(options.DefaultPostProcessors)
+
+// postProcess runs the translation through the PostProcessors pipeline
+func postProcess(translation, source string) string {
+	for _, name := range PostProcessors {
+		translation = postProcessors[name](translation, source)
+	}
+	return translation
+}
+
+// stripQuotes trims straight quotes from both ends of the translation, like
+// strings.Trim, except on a side where the source has one too
+func stripQuotes(translation, source string) string {
+	source = strings.TrimSpace(source)
+	if !strings.HasPrefix(source, `"`) {
+		translation = strings.TrimLeft(translation, `"`)
+	}
+	if !strings.HasSuffix(source, `"`) {
+		translation = strings.TrimRight(translation, `"`)
+	}
+	return strings.TrimSpace(translation)
+}
+
+var repeatedSpacePattern = regexp.MustCompile(`[ \t]{2,}`)
+
+// collapseSpaces replaces runs of spaces and tabs with a single space,
+// keeping the line breaks
+func collapseSpaces(translation, source string) string {
+	return repeatedSpacePattern.ReplaceAllString(translation, " ")
+}
+
+var (
+	// "[ combat ]" -> "[combat]", also inside [[traits]]
+	bracketInnerSpacePattern = regexp.MustCompile(`\[[ \t]+([^\[\]\n]*?)[ \t]*\]|\[([^\[\]\n]*?)[ \t]+\]`)
+	// "+1[combat]" -> "+1 [combat]"
+	wordBeforeBracketPattern = regexp.MustCompile(`([\p{L}\p{N}])\[`)
+	// "[action]Combattere" -> "[action] Combattere"
+	wordAfterBracketPattern = regexp.MustCompile(`\]([\p{L}\p{N}])`)
+)
+
+// bracketSpacing removes the spaces inside square brackets and separates
+// them from an adjacent word or number with a space
+func bracketSpacing(translation, source string) string {
+	translation = bracketInnerSpacePattern.ReplaceAllString(translation, "[$1$2]")
+	translation = wordBeforeBracketPattern.ReplaceAllString(translation, "$1 [")
+	return wordAfterBracketPattern.ReplaceAllString(translation, "] $1")
+}
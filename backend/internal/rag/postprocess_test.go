@@ -0,0 +1,115 @@
+package rag
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+func TestStripQuotes(t *testing.T) {
+	tests := []struct {
+		name        string
+		translation string
+		source      string
+		expected    string
+	}{
+		{"wrapped", `"Combattere."`, "Fight.", "Combattere."},
+		{"one side", `Combattere."`, "Fight.", "Combattere."},
+		{"inner quotes kept", `Chiamata "Machete".`, `Named "Machete".`, `Chiamata "Machete".`},
+		{"quoted source", `"Combattere."`, `"Fight."`, `"Combattere."`},
+		{"source quoted at the end", `"Nomina "Machete"`, `Name "Machete"`, `Nomina "Machete"`},
+		{"unquoted", "Combattere.", "Fight.", "Combattere."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripQuotes(tt.translation, tt.source); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCollapseSpaces(t *testing.T) {
+	tests := []struct {
+		translation string
+		expected    string
+	}{
+		{"Ottieni  +1 [combat].", "Ottieni +1 [combat]."},
+		{"Ottieni\t\t+1 [combat].", "Ottieni +1 [combat]."},
+		{"Combattere.  \nOttieni +1.", "Combattere. \nOttieni +1."},
+		{"Combattere.\n\nOttieni +1.", "Combattere.\n\nOttieni +1."},
+	}
+
+	for _, tt := range tests {
+		if got := collapseSpaces(tt.translation, ""); got != tt.expected {
+			t.Errorf("collapseSpaces(%q): expected %q, got %q", tt.translation, tt.expected, got)
+		}
+	}
+}
+
+func TestBracketSpacing(t *testing.T) {
+	tests := []struct {
+		translation string
+		expected    string
+	}{
+		{"Ottieni +1[combat].", "Ottieni +1 [combat]."},
+		{"[action]Combattere.", "[action] Combattere."},
+		{"Ottieni +1 [ combat ].", "Ottieni +1 [combat]."},
+		{"[[ Umanoide ]]. [elder_sign]: +2", "[[Umanoide]]. [elder_sign]: +2"},
+		{"[reaction] Dopo che hai scoperto un indizio:", "[reaction] Dopo che hai scoperto un indizio:"},
+		{"<b>Effetto di</b> <eld>: +1", "<b>Effetto di</b> <eld>: +1"},
+	}
+
+	for _, tt := range tests {
+		if got := bracketSpacing(tt.translation, ""); got != tt.expected {
+			t.Errorf("bracketSpacing(%q): expected %q, got %q", tt.translation, tt.expected, got)
+		}
+	}
+}
+
+func TestPostProcessors_Names(t *testing.T) {
+	if len(postProcessors) != len(options.PostProcessorNames) {
+		t.Errorf("Expected %d post-processors, got %d", len(options.PostProcessorNames), len(postProcessors))
+	}
+	for _, name := range options.PostProcessorNames {
+		if postProcessors[name] == nil {
+			t.Errorf("Expected a step for post-processor %s, got none", name)
+		}
+	}
+}
+
+func TestPostProcess_Pipeline(t *testing.T) {
+	defer func(names []string) { PostProcessors = names }(PostProcessors)
+
+	PostProcessors = []string{options.PostStripQuotes, options.PostCollapseSpaces, options.PostBracketSpacing}
+	if got := postProcess(`"Ottieni  +1[combat]."`, "You get +1 [combat]."); got != "Ottieni +1 [combat]." {
+		t.Errorf("Expected every step applied, got %q", got)
+	}
+
+	PostProcessors = nil
+	if got := postProcess(`"Ottieni  +1[combat]."`, "You get +1 [combat]."); got != `"Ottieni  +1[combat]."` {
+		t.Errorf("Expected no change without post-processors, got %q", got)
+	}
+}
+
+func TestTranslate_PostProcessorsOnJSONOutput(t *testing.T) {
+	defer func(enabled bool) { JSONOutput = enabled }(JSONOutput)
+	JSONOutput = true
+	defer func(names []string) { PostProcessors = names }(PostProcessors)
+	PostProcessors = []string{options.PostStripQuotes, options.PostCollapseSpaces}
+
+	chatServer(t, func(jsonMode bool) (int, string) {
+		return http.StatusOK, `{"normalized": "Draw 1 card.", "translation": "\"Pesca  1 carta.\""}`
+	})
+
+	result, err := Translate(context.Background(), "Draw 1 card.", nil, "test-key", "gpt-4o", "it")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if result.Translation != "Pesca 1 carta." || !result.Cleaned {
+		t.Errorf("Expected the post-processed translation, got %+v", result)
+	}
+}
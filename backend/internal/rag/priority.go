@@ -0,0 +1,35 @@
+package rag
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+// PriorityWeight is how much a card's priority (see
+// options.CardPriorities) counts against its vector distance when ordering
+// the retrieved cards: each priority point makes a card rank as if it were
+// PriorityWeight closer. 0 (the default) orders by distance alone, which is
+// the only order the ivfflat indexes can serve.
+var PriorityWeight = 0.0
+
+// PackWeight is how much closer the cards of the pack a search prefers (see
+// SearchQuery.PreferPack) rank than the cards of other packs. Like
+// PriorityWeight, a preferred pack makes the search scan every row.
+var PackWeight = options.DefaultPackWeight
+
+// orderBy returns the ORDER BY expression of a retrieval query: the
+// metric's distance between column and the query vector param, less
+// priorityWeight times the priority of the card (alias e), and less
+// packWeight for the cards of the pack in $9
+func orderBy(metric Metric, column, param string, priorityWeight, packWeight float64) string {
+	order := fmt.Sprintf("%s %s %s", column, metric.Operator(), param)
+	if priorityWeight != 0 {
+		order = fmt.Sprintf("(%s) - %s * e.priority", order, strconv.FormatFloat(priorityWeight, 'g', -1, 64))
+	}
+	if packWeight != 0 {
+		order = fmt.Sprintf("(%s) - %s * (e.pack_code = $9)::int", order, strconv.FormatFloat(packWeight, 'g', -1, 64))
+	}
+	return order
+}
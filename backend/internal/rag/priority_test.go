@@ -0,0 +1,29 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimilarCardsQuery_PriorityWeight(t *testing.T) {
+	for _, query := range []string{similarCardsQuery(MetricCosine, 0.05, 0), similarTranslationsQuery(MetricCosine, 0.05, 0)} {
+		if !strings.Contains(query, "<=> $1) - 0.05 * e.priority") {
+			t.Errorf("Expected the order to subtract the weighted priority, got: %s", query)
+		}
+	}
+	if query := similarCardsQuery(MetricCosine, 0, 0); strings.Contains(query, "priority") {
+		t.Errorf("Expected no priority without a weight, got: %s", query)
+	}
+}
+
+func TestSimilarCardsQuery_PackWeight(t *testing.T) {
+	for _, query := range []string{similarCardsQuery(MetricCosine, 0.05, 0.1), similarTranslationsQuery(MetricCosine, 0.05, 0.1)} {
+		if !strings.Contains(query, "- 0.05 * e.priority) - 0.1 * (e.pack_code = $9)::int") {
+			t.Errorf("Expected the order to favor the pack in $9, got: %s", query)
+		}
+	}
+	// Without a preferred pack the query keeps the order the index serves, and no $9
+	if query := similarCardsQuery(MetricCosine, 0, 0); strings.Contains(query, "$9") || !strings.Contains(query, "ORDER BY e.embedding <=> $1\n") {
+		t.Errorf("Expected the plain distance order without a pack weight, got: %s", query)
+	}
+}
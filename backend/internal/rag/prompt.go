@@ -0,0 +1,208 @@
+package rag
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+// embeddedPrompts holds the default system prompt templates: system.tmpl and
+// the normalization.tmpl fragment for every language, literal.tmpl for
+// literal translations, and optional _<language> overrides of each
+//
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+// PromptData is passed to the system prompt templates
+type PromptData struct {
+	Language       string // Target language code, e.g. "it"
+	LanguageName   string // Target language name, e.g. "Italian"
+	ElderSignLabel string // Official label preceding elder sign effects, e.g. "<b>Effetto di</b>" (empty if none)
+	Normalization  string // Rendered normalization fragment for the language (not available to the fragment itself)
+}
+
+// Kinds of prompt templates: the system prompt, the fragment with the
+// language's wording normalization examples, and the system prompt of
+// literal translations (see WithLiteral), which skips the normalization
+const (
+	systemTemplate        = "system"
+	normalizationTemplate = "normalization"
+	literalTemplate       = "literal"
+)
+
+var promptTemplateKinds = []string{systemTemplate, normalizationTemplate, literalTemplate}
+
+// promptTemplates maps a template kind and language ("system_it") to its
+// template; the bare kind ("system") holds the one used by languages without
+// an override
+type promptTemplates map[string]*template.Template
+
+// lookup returns the template of kind for language
+func (t promptTemplates) lookup(kind, language string) *template.Template {
+	if tmpl, ok := t[kind+"_"+language]; ok {
+		return tmpl
+	}
+	return t[kind]
+}
+
+// defaultPrompts are the embedded templates, systemPrompts the ones in use
+var (
+	defaultPrompts = mustLoadPromptTemplates(promptsFS())
+	systemPrompts  = defaultPrompts
+)
+
+// promptsMu guards systemPrompts and glossaries, which ReloadPrompts swaps
+// while requests read them
+var promptsMu sync.RWMutex
+
+// currentPrompts returns the system prompt templates in use
+func currentPrompts() promptTemplates {
+	promptsMu.RLock()
+	defer promptsMu.RUnlock()
+	return systemPrompts
+}
+
+// promptsFS returns the embedded prompts directory
+func promptsFS() fs.FS {
+	sub, err := fs.Sub(embeddedPrompts, "prompts")
+	if err != nil {
+		panic(err) // The directory is embedded at build time
+	}
+	return sub
+}
+
+// LoadPromptTemplates replaces the system prompt templates with the ones in
+// dir. Files missing from dir (system.tmpl, normalization.tmpl, literal.tmpl
+// and their _<language> overrides) fall back to the embedded ones. Every
+// supported language is rendered once so broken templates are reported at
+// startup. An empty dir keeps the defaults.
+func LoadPromptTemplates(dir string) error {
+	templates, err := loadPromptDir(dir)
+	if err != nil {
+		return err
+	}
+
+	promptsMu.Lock()
+	systemPrompts = templates
+	promptsMu.Unlock()
+	return nil
+}
+
+// loadPromptDir loads and checks the templates LoadPromptTemplates uses for
+// dir, without putting them in use
+func loadPromptDir(dir string) (promptTemplates, error) {
+	if dir == "" {
+		return defaultPrompts, nil
+	}
+
+	templates, err := loadPromptTemplates(os.DirFS(dir), promptsFS())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates from %s: %w", dir, err)
+	}
+	for _, language := range options.SupportedLanguages {
+		if _, err := renderSystemPrompt(templates, language); err != nil {
+			return nil, err
+		}
+		if _, err := renderLiteralPrompt(templates, language); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// loadPromptTemplates parses each template kind and its per-language
+// overrides, taking each file from the first file system that has it
+func loadPromptTemplates(fsyss ...fs.FS) (promptTemplates, error) {
+	templates := promptTemplates{}
+
+	for _, kind := range promptTemplateKinds {
+		keys := []string{kind}
+		for _, language := range options.SupportedLanguages {
+			keys = append(keys, kind+"_"+language)
+		}
+
+		for _, key := range keys {
+			name := key + ".tmpl"
+			content, err := readFirst(name, fsyss)
+			if errors.Is(err, fs.ErrNotExist) && key != kind {
+				continue // No override for this language
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			templates[key] = tmpl
+		}
+	}
+
+	return templates, nil
+}
+
+// mustLoadPromptTemplates is loadPromptTemplates for the embedded templates
+func mustLoadPromptTemplates(fsys fs.FS) promptTemplates {
+	templates, err := loadPromptTemplates(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// readFirst reads name from the first file system that has it
+func readFirst(name string, fsyss []fs.FS) ([]byte, error) {
+	for _, fsys := range fsyss {
+		content, err := fs.ReadFile(fsys, name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return content, err
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+}
+
+// renderSystemPrompt renders the system prompt template for language, with
+// the language's normalization fragment
+func renderSystemPrompt(templates promptTemplates, language string) (string, error) {
+	data := PromptData{
+		Language:       language,
+		LanguageName:   languageName(language),
+		ElderSignLabel: elderSignLabels[language],
+	}
+
+	normalization, err := renderPromptTemplate(templates.lookup(normalizationTemplate, language), language, data)
+	if err != nil {
+		return "", err
+	}
+	data.Normalization = normalization
+
+	return renderPromptTemplate(templates.lookup(systemTemplate, language), language, data)
+}
+
+// renderLiteralPrompt renders the literal translation prompt template for
+// language
+func renderLiteralPrompt(templates promptTemplates, language string) (string, error) {
+	data := PromptData{
+		Language:       language,
+		LanguageName:   languageName(language),
+		ElderSignLabel: elderSignLabels[language],
+	}
+	return renderPromptTemplate(templates.lookup(literalTemplate, language), language, data)
+}
+
+// renderPromptTemplate executes tmpl with data, trimming the result
+func renderPromptTemplate(tmpl *template.Template, language string, data PromptData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render %s for %s: %w", tmpl.Name(), language, err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
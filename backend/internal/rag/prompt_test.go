@@ -0,0 +1,130 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+func TestRenderSystemPrompt_DefaultForEachLanguage(t *testing.T) {
+	for _, language := range options.SupportedLanguages {
+		t.Run(language, func(t *testing.T) {
+			prompt, err := renderSystemPrompt(defaultPrompts, language)
+			if err != nil {
+				t.Fatalf("Failed to render prompt: %v", err)
+			}
+			if !strings.HasPrefix(prompt, "You are an expert in Arkham Horror") {
+				t.Errorf("Unexpected prompt start: %.60q", prompt)
+			}
+			if !strings.Contains(prompt, "from English to "+languageName(language)) {
+				t.Errorf("Expected prompt to name %s", languageName(language))
+			}
+			if strings.Contains(prompt, "<no value>") || strings.Contains(prompt, "{{") {
+				t.Errorf("Prompt has unrendered template fields: %s", prompt)
+			}
+		})
+	}
+}
+
+func TestRenderSystemPrompt_NormalizationFragments(t *testing.T) {
+	tests := []struct {
+		language string
+		want     []string
+		unwanted []string
+	}{
+		{"it", []string{"<b>Effetto di</b> <eld>:", "Durante il tuo turno"}, nil},
+		{"de", []string{"official German cards in the reference context"}, []string{"Effetto di", "Durante il tuo turno"}},
+		{"fr", []string{"official French cards in the reference context"}, []string{"Effetto di", "Durante il tuo turno"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			prompt, err := renderSystemPrompt(defaultPrompts, tt.language)
+			if err != nil {
+				t.Fatalf("Failed to render prompt: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(prompt, want) {
+					t.Errorf("Expected prompt to contain %q", want)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(prompt, unwanted) {
+					t.Errorf("Expected prompt not to contain %q", unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadPromptTemplates_NormalizationOverride(t *testing.T) {
+	t.Cleanup(func() { LoadPromptTemplates("") })
+
+	dir := t.TempDir()
+	fragment := "2.  Write elder sign effects as \"[elder_sign]-Effekt:\"."
+	if err := os.WriteFile(filepath.Join(dir, "normalization_de.tmpl"), []byte(fragment), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	if err := LoadPromptTemplates(dir); err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+
+	systemPrompt, _ := buildPrompts("Fight.", nil, "de", false, false)
+	if !strings.HasPrefix(systemPrompt, "You are an expert") {
+		t.Errorf("Expected German to keep the default template, got: %.60q", systemPrompt)
+	}
+	if !strings.Contains(systemPrompt, fragment) {
+		t.Errorf("Expected the German fragment in the prompt, got: %s", systemPrompt)
+	}
+	systemPrompt, _ = buildPrompts("Fight.", nil, "it", false, false)
+	if strings.Contains(systemPrompt, fragment) || !strings.Contains(systemPrompt, "Durante il tuo turno") {
+		t.Errorf("Expected Italian to keep its own fragment, got: %s", systemPrompt)
+	}
+}
+
+func TestLoadPromptTemplates_Overrides(t *testing.T) {
+	t.Cleanup(func() { LoadPromptTemplates("") })
+
+	dir := t.TempDir()
+	override := "Translate into {{.LanguageName}} ({{.Language}}), elder sign label {{.ElderSignLabel}}."
+	if err := os.WriteFile(filepath.Join(dir, "system_it.tmpl"), []byte(override), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	if err := LoadPromptTemplates(dir); err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+
+	systemPrompt, _ := buildPrompts("Fight.", nil, "it", false, false)
+	if !strings.HasPrefix(systemPrompt, "Translate into Italian (it), elder sign label <b>Effetto di</b>.") {
+		t.Errorf("Expected the Italian override, got: %s", systemPrompt)
+	}
+	if !strings.HasSuffix(systemPrompt, untrustedTextSection) {
+		t.Errorf("Expected overrides to keep the untrusted input section, got: %s", systemPrompt)
+	}
+	systemPrompt, _ = buildPrompts("Fight.", nil, "de", false, false)
+	if !strings.HasPrefix(systemPrompt, "You are an expert") {
+		t.Errorf("Expected German to keep the default template, got: %.60q", systemPrompt)
+	}
+}
+
+func TestLoadPromptTemplates_InvalidTemplate(t *testing.T) {
+	t.Cleanup(func() { LoadPromptTemplates("") })
+
+	for name, content := range map[string]string{
+		"syntax error":  "Translate into {{.LanguageName",
+		"unknown field": "Translate into {{.Lang}}",
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "system.tmpl"), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+		if err := LoadPromptTemplates(dir); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package rag
+
+import (
+	"context"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+)
+
+// Embedder turns a text into an embedding for retrieval, giving up when ctx
+// is done
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// Translator generates the translation of englishText with the given model,
+// guided by the context cards, giving up when ctx is done
+type Translator interface {
+	Translate(ctx context.Context, englishText string, contextCards []ContextCard, model, language string) (TranslationResult, error)
+	// TranslateCandidates returns up to n alternative translations
+	TranslateCandidates(ctx context.Context, englishText string, contextCards []ContextCard, model, language string, n int) (CandidatesResult, error)
+}
+
+// OpenAIEmbedder embeds texts with the OpenAI embeddings API
+type OpenAIEmbedder struct {
+	APIKey string
+	Model  string
+}
+
+// Embed implements Embedder
+func (e OpenAIEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return embeddings.GetEmbeddingContext(ctx, text, e.APIKey, e.Model)
+}
+
+// OpenAITranslator translates with the OpenAI chat completions API
+type OpenAITranslator struct {
+	APIKey string
+}
+
+// Translate implements Translator
+func (t OpenAITranslator) Translate(ctx context.Context, englishText string, contextCards []ContextCard, model, language string) (TranslationResult, error) {
+	return Translate(ctx, englishText, contextCards, t.APIKey, model, language)
+}
+
+// TranslateCandidates implements Translator
+func (t OpenAITranslator) TranslateCandidates(ctx context.Context, englishText string, contextCards []ContextCard, model, language string, n int) (CandidatesResult, error) {
+	return TranslateCandidates(ctx, englishText, contextCards, t.APIKey, model, language, n)
+}
@@ -0,0 +1,46 @@
+package rag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReferenceLanguages lists the languages whose official translations of each
+// context card are shown next to the target language one, so the model can
+// keep terminology consistent across languages. The target language itself
+// is skipped. Set at startup; empty by default (off), as every language adds
+// a line per context card to the prompt.
+var ReferenceLanguages []string
+
+// referenceLanguagesFor returns the reference languages to fetch for a
+// search in language
+func referenceLanguagesFor(languages []string, language string) []string {
+	var others []string
+	for _, lang := range languages {
+		if lang != language {
+			others = append(others, lang)
+		}
+	}
+	return others
+}
+
+// referencesSection writes the other-language translations of a context
+// card, in language code order
+func referencesSection(card ContextCard) string {
+	if len(card.References) == 0 {
+		return ""
+	}
+	languages := make([]string, 0, len(card.References))
+	for lang := range card.References {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+
+	var section strings.Builder
+	section.WriteString("Other official translations (for consistent terminology across languages, not wording):\n")
+	for _, lang := range languages {
+		section.WriteString(fmt.Sprintf("- %s: %s\n", languageName(lang), card.References[lang]))
+	}
+	return section.String()
+}
@@ -0,0 +1,29 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildPrompts_ReferenceLanguages(t *testing.T) {
+	contextCards := []ContextCard{
+		{CardName: "Machete", CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Kämpfen.", TranslationLanguage: "de",
+			References: map[string]string{"it": "Combattere.", "fr": "Combat."}},
+		{CardName: "Magnifying Glass", CardCode: "01030", EnglishText: "Investigate.", TranslatedText: "Ermitteln.", TranslationLanguage: "de"},
+	}
+
+	_, userPrompt := buildPrompts("Fight.", contextCards, "de", false, false)
+
+	expected := "German: Kämpfen.\nOther official translations (for consistent terminology across languages, not wording):\n- French: Combat.\n- Italian: Combattere.\n\nCard 2:"
+	if !strings.Contains(userPrompt, expected) {
+		t.Errorf("Expected the reference translations below the German one, got: %s", userPrompt)
+	}
+	if strings.Count(userPrompt, "Other official translations") != 1 {
+		t.Errorf("Expected references only for the card that has them, got: %s", userPrompt)
+	}
+
+	_, userPrompt = buildPrompts("Fight.", contextCards[1:], "de", false, false)
+	if strings.Contains(userPrompt, "Other official translations") {
+		t.Errorf("Expected no references section without references, got: %s", userPrompt)
+	}
+}
@@ -0,0 +1,62 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Refusal reasons of RefusalError
+const (
+	RefusalContentFilter = "content_filter" // OpenAI filtered the answer (finish_reason "content_filter")
+	RefusalModel         = "refusal"        // The model declined, in its refusal field or in the answer text
+	RefusalEmpty         = "empty"          // The answer was empty
+)
+
+// RefusalError is returned instead of a translation when the model doesn't
+// provide one: its answer was filtered, it declined, or it answered with an
+// empty text or an apology even after being asked again
+type RefusalError struct {
+	Reason string // One of the Refusal constants
+	Output string // The model's refusal message or answer, if any
+}
+
+func (e *RefusalError) Error() string {
+	switch e.Reason {
+	case RefusalContentFilter:
+		return "the answer was blocked by OpenAI's content filter; rephrase the text or translate it manually"
+	case RefusalEmpty:
+		return "the model returned an empty translation; try again or translate the text manually"
+	}
+	return fmt.Sprintf("the model declined to translate the text (%q); rephrase it or translate it manually", truncateOutput(e.Output))
+}
+
+// choiceRefusal returns the RefusalError of a chat completion choice, nil
+// for a usable answer. Empty answers are left to the callers, which may
+// retry them.
+func choiceRefusal(finishReason, refusal string) *RefusalError {
+	switch {
+	case finishReason == "content_filter":
+		return &RefusalError{Reason: RefusalContentFilter}
+	case strings.TrimSpace(refusal) != "":
+		return &RefusalError{Reason: RefusalModel, Output: strings.TrimSpace(refusal)}
+	}
+	return nil
+}
+
+// nonTranslationError returns the RefusalError of an output for which
+// looksLikeNonTranslation holds
+func nonTranslationError(output string) *RefusalError {
+	if strings.TrimSpace(output) == "" {
+		return &RefusalError{Reason: RefusalEmpty}
+	}
+	return &RefusalError{Reason: RefusalModel, Output: output}
+}
+
+// truncateOutput shortens a model answer quoted in an error message
+func truncateOutput(output string) string {
+	const maxRunes = 200
+	if runes := []rune(output); len(runes) > maxRunes {
+		return string(runes[:maxRunes]) + "…"
+	}
+	return output
+}
@@ -0,0 +1,129 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+// refusalChoice is a chat completion choice as returned by the API
+type refusalChoice struct {
+	Content      string
+	Refusal      string
+	FinishReason string
+}
+
+func TestTranslate_Refusal(t *testing.T) {
+	testCases := []struct {
+		name     string
+		replies  [][]refusalChoice // Choices of each request
+		reason   string
+		requests int
+	}{
+		{"ContentFilter", [][]refusalChoice{{{FinishReason: "content_filter"}}}, RefusalContentFilter, 1},
+		{"RefusalField", [][]refusalChoice{{{Refusal: "I can't help with that.", FinishReason: "stop"}}}, RefusalModel, 1},
+		{"StillApologizing", [][]refusalChoice{
+			{{Content: "I'm sorry, I cannot translate this text.", FinishReason: "stop"}},
+			{{Content: "I'm sorry, I can't do that.", FinishReason: "stop"}},
+		}, RefusalModel, 2},
+		{"StillEmpty", [][]refusalChoice{
+			{{Content: "", FinishReason: "stop"}},
+			{{Content: "  ", FinishReason: "stop"}},
+		}, RefusalEmpty, 2},
+		{"FilteredRetry", [][]refusalChoice{
+			{{Content: "", FinishReason: "stop"}},
+			{{FinishReason: "content_filter"}},
+		}, RefusalContentFilter, 2},
+		{"Translated", [][]refusalChoice{{{Content: "Pesca 1 carta.", FinishReason: "stop"}}}, "", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				choices := []map[string]interface{}{}
+				for _, choice := range tc.replies[requests] {
+					choices = append(choices, map[string]interface{}{
+						"message":       map[string]interface{}{"role": "assistant", "content": choice.Content, "refusal": choice.Refusal},
+						"finish_reason": choice.FinishReason,
+					})
+				}
+				requests++
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{"choices": choices})
+			}))
+			defer server.Close()
+
+			defer func(base string, jsonOutput bool) { openai.BaseURL, JSONOutput = base, jsonOutput }(openai.BaseURL, JSONOutput)
+			openai.BaseURL = server.URL
+			JSONOutput = false
+
+			result, err := Translate(context.Background(), "Draw 1 card.", nil, "test-key", "gpt-4o", "it")
+			if requests != tc.requests {
+				t.Errorf("Expected %d requests, got %d", tc.requests, requests)
+			}
+			if tc.reason == "" {
+				if err != nil || result.Translation != "Pesca 1 carta." {
+					t.Errorf("Expected a translation, got %+v (%v)", result, err)
+				}
+				return
+			}
+
+			var refusal *RefusalError
+			if !errors.As(err, &refusal) {
+				t.Fatalf("Expected a RefusalError, got %v", err)
+			}
+			if refusal.Reason != tc.reason {
+				t.Errorf("Expected reason %s, got %s", tc.reason, refusal.Reason)
+			}
+			if result.Translation != "" {
+				t.Errorf("Expected no translation, got %q", result.Translation)
+			}
+		})
+	}
+}
+
+func TestChatCompletions_DropsFilteredChoices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"content": ""}, "finish_reason": "content_filter"},
+				{"message": map[string]string{"content": "Pesca 1 carta."}, "finish_reason": "stop"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	defer func(base string) { openai.BaseURL = base }(openai.BaseURL)
+	openai.BaseURL = server.URL
+
+	contents, _, err := chatCompletions(context.Background(), "test-key", "gpt-4o", nil, 0.3, 2, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(contents) != 1 || contents[0] != "Pesca 1 carta." {
+		t.Errorf("Expected the unfiltered choice only, got %q", contents)
+	}
+}
+
+func TestRefusalError_Error(t *testing.T) {
+	testCases := []struct {
+		err      *RefusalError
+		expected string
+	}{
+		{&RefusalError{Reason: RefusalContentFilter}, "the answer was blocked by OpenAI's content filter; rephrase the text or translate it manually"},
+		{&RefusalError{Reason: RefusalEmpty}, "the model returned an empty translation; try again or translate the text manually"},
+		{&RefusalError{Reason: RefusalModel, Output: "I can't help with that."}, `the model declined to translate the text ("I can't help with that."); rephrase it or translate it manually`},
+	}
+	for _, tc := range testCases {
+		if message := tc.err.Error(); message != tc.expected {
+			t.Errorf("Expected %q, got %q", tc.expected, message)
+		}
+	}
+}
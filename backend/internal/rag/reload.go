@@ -0,0 +1,67 @@
+package rag
+
+import "github.com/ventrosky/arkham-localize/backend/internal/options"
+
+// PromptChanges lists the languages whose prompt inputs ReloadPrompts changed
+type PromptChanges struct {
+	Prompts    []string // Languages whose system or literal prompt renders differently
+	Glossaries []string // Languages whose glossary terms or translations changed
+}
+
+// ReloadPrompts loads the prompt templates of promptDir and the glossaries
+// of glossaryDir as LoadPromptTemplates and LoadGlossaries do, and puts them
+// in use together only if both load, so that a broken file keeps the ones
+// in use. Prompts built before the swap keep the previous ones.
+func ReloadPrompts(promptDir, glossaryDir string) (PromptChanges, error) {
+	templates, err := loadPromptDir(promptDir)
+	if err != nil {
+		return PromptChanges{}, err
+	}
+	loaded, err := loadGlossaryDir(glossaryDir)
+	if err != nil {
+		return PromptChanges{}, err
+	}
+
+	promptsMu.Lock()
+	previousTemplates, previousGlossaries := systemPrompts, glossaries
+	systemPrompts, glossaries = templates, loaded
+	promptsMu.Unlock()
+
+	var changes PromptChanges
+	for _, language := range options.SupportedLanguages {
+		if !samePrompts(previousTemplates, templates, language) {
+			changes.Prompts = append(changes.Prompts, language)
+		}
+		if !sameGlossary(previousGlossaries[language], loaded[language]) {
+			changes.Glossaries = append(changes.Glossaries, language)
+		}
+	}
+	return changes, nil
+}
+
+// samePrompts reports whether both sets of templates render the same system
+// and literal prompts for language
+func samePrompts(a, b promptTemplates, language string) bool {
+	for _, render := range []func(promptTemplates, string) (string, error){renderSystemPrompt, renderLiteralPrompt} {
+		promptA, errA := render(a, language)
+		promptB, errB := render(b, language)
+		if errA != nil || errB != nil || promptA != promptB {
+			return false
+		}
+	}
+	return true
+}
+
+// sameGlossary reports whether both glossaries (sorted by term) hold the
+// same terms and translations
+func sameGlossary(a, b []glossaryEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Term != b[i].Term || a[i].Translation != b[i].Translation {
+			return false
+		}
+	}
+	return true
+}
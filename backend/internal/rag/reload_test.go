@@ -0,0 +1,53 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReloadPrompts(t *testing.T) {
+	t.Cleanup(func() {
+		LoadPromptTemplates("")
+		LoadGlossaries("")
+	})
+
+	promptDir, glossaryDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(promptDir, "system_it.tmpl"), []byte("Translate into {{.LanguageName}}."), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(glossaryDir, "it.json"), []byte(`{"Parley": "Parlamenta"}`), 0o644); err != nil {
+		t.Fatalf("Failed to write glossary: %v", err)
+	}
+
+	changes, err := ReloadPrompts(promptDir, glossaryDir)
+	if err != nil {
+		t.Fatalf("ReloadPrompts failed: %v", err)
+	}
+	expected := PromptChanges{Prompts: []string{"it"}, Glossaries: []string{"it"}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %+v, got %+v", expected, changes)
+	}
+
+	// Reloading the same files changes nothing
+	if changes, err := ReloadPrompts(promptDir, glossaryDir); err != nil || !reflect.DeepEqual(changes, PromptChanges{}) {
+		t.Errorf("Expected no changes, got %+v (err %v)", changes, err)
+	}
+
+	// A broken glossary keeps the prompts and glossaries in use
+	if err := os.WriteFile(filepath.Join(promptDir, "system_it.tmpl"), []byte("Translate."), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(glossaryDir, "it.json"), []byte(`{"Parley": ""}`), 0o644); err != nil {
+		t.Fatalf("Failed to write glossary: %v", err)
+	}
+	if _, err := ReloadPrompts(promptDir, glossaryDir); err == nil {
+		t.Fatal("Expected error for the broken glossary, got nil")
+	}
+	systemPrompt, _ := buildPrompts("Parley.", nil, "it", false, false)
+	if !strings.HasPrefix(systemPrompt, "Translate into Italian.") || !strings.Contains(systemPrompt, "Parlamenta") {
+		t.Errorf("Expected the previous template and glossary, got: %s", systemPrompt)
+	}
+}
@@ -0,0 +1,128 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+// DedupeCards removes near-duplicate context cards, keeping the closest match.
+// Cards sharing a card_code (e.g. front and back of the same card) or with the
+// same English text only take up one context slot.
+func DedupeCards(cards []ContextCard) []ContextCard {
+	seenCodes := make(map[string]bool)
+	seenTexts := make(map[string]bool)
+
+	result := []ContextCard{}
+	for _, card := range cards {
+		text := strings.TrimSpace(card.EnglishText)
+		if seenCodes[card.CardCode] || seenTexts[text] {
+			continue
+		}
+		seenCodes[card.CardCode] = true
+		seenTexts[text] = true
+		result = append(result, card)
+	}
+
+	return result
+}
+
+// RerankCards applies the given rerank mode to the retrieved cards and returns
+// at most limit cards in their final order. For options.RerankLLM, the chat model is
+// asked to reorder the candidates by relevance to the query text; if that call
+// fails, the deduplicated order is returned along with the error.
+func RerankCards(query string, cards []ContextCard, limit int, mode, apiKey, model string) ([]ContextCard, error) {
+	var err error
+
+	switch mode {
+	case options.RerankNone, "":
+	case options.RerankDedupe:
+		cards = DedupeCards(cards)
+	case options.RerankLLM:
+		cards = DedupeCards(cards)
+		var reordered []ContextCard
+		if reordered, err = rerankWithLLM(query, cards, apiKey, model); err == nil {
+			cards = reordered
+		}
+	default:
+		return nil, fmt.Errorf("unsupported rerank mode: %s (supported: none, dedupe, llm)", mode)
+	}
+
+	if limit > 0 && len(cards) > limit {
+		cards = cards[:limit]
+	}
+
+	return cards, err
+}
+
+// rerankWithLLM asks the chat model to order the candidates by relevance to
+// the query and returns them in that order
+func rerankWithLLM(query string, cards []ContextCard, apiKey, model string) ([]ContextCard, error) {
+	if len(cards) < 2 {
+		return cards, nil
+	}
+
+	var candidates strings.Builder
+	for i, card := range cards {
+		candidates.WriteString(fmt.Sprintf("%d: %s\n", i, card.EnglishText))
+	}
+
+	systemPrompt := `You rank Arkham Horror: The Card Game card texts by how useful they are as translation references for a query text.
+Return ONLY a JSON array of candidate indices, most relevant first, e.g. [2, 0, 1].`
+	userPrompt := fmt.Sprintf("Query text:\n%s\n\nCandidates:\n%s", query, candidates.String())
+
+	content, _, err := chatCompletion(context.Background(), apiKey, model, []Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userPrompt},
+	}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank cards: %w", err)
+	}
+
+	order, err := parseRerankOrder(content, len(cards))
+	if err != nil {
+		return nil, err
+	}
+
+	reordered := make([]ContextCard, 0, len(cards))
+	for _, idx := range order {
+		reordered = append(reordered, cards[idx])
+	}
+	return reordered, nil
+}
+
+// parseRerankOrder parses the model's JSON index array. Invalid or repeated
+// indices are ignored and any candidates the model left out are appended in
+// their original order, so every card is returned exactly once.
+func parseRerankOrder(content string, n int) ([]int, error) {
+	start := strings.Index(content, "[")
+	end := strings.LastIndex(content, "]")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("rerank response is not a JSON array: %s", content)
+	}
+
+	var indices []int
+	if err := json.Unmarshal([]byte(content[start:end+1]), &indices); err != nil {
+		return nil, fmt.Errorf("failed to parse rerank response: %w", err)
+	}
+
+	seen := make(map[int]bool)
+	order := make([]int, 0, n)
+	for _, idx := range indices {
+		if idx < 0 || idx >= n || seen[idx] {
+			continue
+		}
+		seen[idx] = true
+		order = append(order, idx)
+	}
+	for idx := 0; idx < n; idx++ {
+		if !seen[idx] {
+			order = append(order, idx)
+		}
+	}
+
+	return order, nil
+}
@@ -0,0 +1,103 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+func TestDedupeCards(t *testing.T) {
+	cards := []ContextCard{
+		{CardCode: "01020", IsBack: false, EnglishText: "Fight. You get +1 [combat]."},
+		{CardCode: "01020", IsBack: true, EnglishText: "Back text."},
+		{CardCode: "03003", IsBack: false, EnglishText: "Fight. You get +1 [combat]."},
+		{CardCode: "01021", IsBack: false, EnglishText: "Discard a card."},
+	}
+
+	result := DedupeCards(cards)
+
+	var codes []string
+	for _, card := range result {
+		codes = append(codes, card.CardCode)
+	}
+	expected := []string{"01020", "01021"}
+	if !reflect.DeepEqual(codes, expected) {
+		t.Errorf("Expected codes %v, got %v", expected, codes)
+	}
+
+	// Closest match (first) must be the one kept
+	if result[0].IsBack {
+		t.Errorf("Expected front of 01020 to be kept, got back")
+	}
+}
+
+func TestRerankCards_Modes(t *testing.T) {
+	cards := []ContextCard{
+		{CardCode: "A", EnglishText: "a"},
+		{CardCode: "A", EnglishText: "a back"},
+		{CardCode: "B", EnglishText: "b"},
+		{CardCode: "C", EnglishText: "c"},
+	}
+
+	testCases := []struct {
+		name     string
+		mode     string
+		limit    int
+		expected int
+	}{
+		{"None_KeepsDuplicates", options.RerankNone, 10, 4},
+		{"None_AppliesLimit", options.RerankNone, 2, 2},
+		{"Dedupe", options.RerankDedupe, 10, 3},
+		{"Dedupe_AppliesLimit", options.RerankDedupe, 2, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := RerankCards("query", cards, tc.limit, tc.mode, "", "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(result) != tc.expected {
+				t.Errorf("Expected %d cards, got %d", tc.expected, len(result))
+			}
+		})
+	}
+
+	if _, err := RerankCards("query", cards, 10, "bogus", "", ""); err == nil {
+		t.Error("Expected error for unsupported rerank mode, got nil")
+	}
+}
+
+func TestParseRerankOrder(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected []int
+		wantErr  bool
+	}{
+		{"Plain", "[2, 0, 1]", []int{2, 0, 1}, false},
+		{"WrappedInText", "Here is the order: [1, 2, 0]", []int{1, 2, 0}, false},
+		{"MissingIndicesAppended", "[2]", []int{2, 0, 1}, false},
+		{"InvalidAndRepeatedIgnored", "[5, 1, 1, -1]", []int{1, 0, 2}, false},
+		{"NotAnArray", "no idea", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			order, err := parseRerankOrder(tc.content, 3)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got order %v", order)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(order, tc.expected) {
+				t.Errorf("Expected order %v, got %v", tc.expected, order)
+			}
+		})
+	}
+}
@@ -1,10 +1,11 @@
 package rag
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"strings"
 
-	"github.com/pgvector/pgvector-go"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
 )
 
 // ContextCard represents a card used as context for translation
@@ -14,62 +15,223 @@ type ContextCard struct {
 	IsBack         bool   `json:"is_back"`
 	EnglishText    string `json:"english_text"`
 	TranslatedText string `json:"translated_text"` // Text in the target language
+	// TranslationLanguage is the language of TranslatedText. It differs from
+	// the target language when IsFallback is set.
+	TranslationLanguage string  `json:"translation_language"`
+	IsFallback          bool    `json:"is_fallback"` // TranslatedText comes from a fallback language
+	Similarity          float64 `json:"similarity"`  // Cosine similarity to the query (1 = identical)
+	TextType            string  `json:"text_type"`   // TextRules, TextFlavor or TextName
+	// IsFrontFallback marks a front reference in the context of a back text,
+	// standing in for missing back references (see BackFallback)
+	IsFrontFallback bool `json:"is_front_fallback,omitempty"`
+	// IsPinned marks a card the client asked for by code instead of one
+	// found by similarity (see PinCards)
+	IsPinned bool `json:"is_pinned,omitempty"`
+	// References maps a reference language to the card's official
+	// translation in it (see ReferenceLanguages)
+	References map[string]string `json:"references,omitempty"`
+	// Note is the card's translation hint from the card_notes table, e.g. an
+	// errata the official translation follows (empty if none)
+	Note string `json:"note,omitempty"`
+	// TypeCode and FactionCode are the card's ArkhamDB type and faction
+	// (empty for entries ingested without them)
+	TypeCode    string `json:"type_code,omitempty"`
+	FactionCode string `json:"faction_code,omitempty"`
+	// EncounterCode is the encounter set of an encounter, scenario or story
+	// card (empty for player cards)
+	EncounterCode string `json:"encounter_code,omitempty"`
+	// PackCode is the card's ArkhamDB pack (empty for entries ingested
+	// without it)
+	PackCode string `json:"pack_code,omitempty"`
+	// EmbeddingModel is the model of the embedding the card was matched by
+	// (empty if unknown, for entries ingested before it was recorded)
+	EmbeddingModel string `json:"embedding_model,omitempty"`
 }
 
-// RetrieveSimilarCards retrieves the most similar cards from the database
-// using vector similarity search, filtered by target language
-// language is one of: "it", "fr", "de", "es"
-func RetrieveSimilarCards(db *sql.DB, queryEmbedding []float32, limit int, language string) ([]ContextCard, error) {
-	if len(queryEmbedding) == 0 {
-		return nil, fmt.Errorf("query embedding is empty")
+// Text types of the stored entries. Flavor text is only ingested with
+// -include-flavor and is matched separately, as its style differs from rules text.
+// Card names (with their subtitles) are only ingested with -include-names, so
+// that names are translated against other names.
+const (
+	TextRules  = "rules"
+	TextFlavor = "flavor"
+	TextName   = "name"
+)
+
+// ValidTextType reports whether textType is one of the stored text types
+func ValidTextType(textType string) bool {
+	return textType == TextRules || textType == TextFlavor || textType == TextName
+}
+
+// Decks a search can be restricted to (see SearchQuery.Deck). Encounter
+// cards are the entries ingested with an encounter set; entries ingested
+// before it was recorded count as player cards.
+const (
+	DeckPlayer    = "player"
+	DeckEncounter = "encounter"
+)
+
+// ValidDeck reports whether deck is DeckPlayer or DeckEncounter
+func ValidDeck(deck string) bool {
+	return deck == DeckPlayer || deck == DeckEncounter
+}
+
+// Retrieval modes select which embedding the query is compared against
+const (
+	RetrievalEnglish = "english" // Match against the English text embedding (default)
+	RetrievalTarget  = "target"  // Match against the target-language text embedding
+)
+
+// OverfetchFactor is how many times the requested number of cards
+// RetrieveContext asks the store for. In sparsely translated languages and
+// among reprints, some results are no use as references; the extra ones
+// take their place.
+const OverfetchFactor = 3
+
+// BackFallback sets which references RetrieveContext returns for a back text
+// (SearchQuery.IsBack). Many backs were never ingested, having had no
+// translation at the time, so by default fronts make up for them. Set at
+// startup.
+var BackFallback = options.BackFallbackFront
+
+// RetrieveContext searches store for OverfetchFactor times query.Limit
+// cards, drops the unusable ones (see usableCards) and returns up to
+// query.Limit of the rest, most similar first. For a back text, the back
+// references come first, followed by front ones as BackFallback allows.
+// Fewer cards are returned when the data has no more, so the length of the
+// result is the number of references actually found.
+func RetrieveContext(ctx context.Context, store VectorStore, query SearchQuery) ([]ContextCard, error) {
+	limit := query.Limit
+	query.Limit = limit * OverfetchFactor
+	cards, err := store.Search(ctx, query)
+	if err != nil {
+		return nil, err
 	}
 
-	// Validate language
-	validLanguages := map[string]string{
-		"it": "it_text",
-		"fr": "fr_text",
-		"de": "de_text",
-		"es": "es_text",
+	cards = usableCards(cards)
+	if query.IsBack {
+		cards = backContext(cards, BackFallback)
 	}
-	langColumn, ok := validLanguages[language]
-	if !ok {
-		return nil, fmt.Errorf("unsupported language: %s (supported: it, fr, de, es)", language)
+	if len(cards) > limit {
+		cards = cards[:limit]
 	}
+	return cards, nil
+}
 
-	vector := pgvector.NewVector(queryEmbedding)
+// usableCards drops the cards without translated text, and the duplicates
+// of an earlier card: the same card side, or a reprint with the same English
+// text and translation
+func usableCards(cards []ContextCard) []ContextCard {
+	type side struct {
+		code   string
+		isBack bool
+	}
+	seenSides := make(map[side]bool)
+	seenTexts := make(map[[2]string]bool)
 
-	query := fmt.Sprintf(`
-		SELECT card_code, card_name, is_back, english_text, COALESCE(%s, '') as translated_text
-		FROM card_embeddings
-		WHERE embedding IS NOT NULL AND card_code IS NOT NULL AND %s IS NOT NULL
-		ORDER BY embedding <-> $1
-		LIMIT $2
-	`, langColumn, langColumn)
+	usable := []ContextCard{}
+	for _, card := range cards {
+		text := [2]string{strings.TrimSpace(card.EnglishText), strings.TrimSpace(card.TranslatedText)}
+		key := side{card.CardCode, card.IsBack}
+		if text[1] == "" || seenSides[key] || seenTexts[text] {
+			continue
+		}
+		seenSides[key] = true
+		seenTexts[text] = true
+		usable = append(usable, card)
+	}
+	return usable
+}
 
-	rows, err := db.Query(query, vector, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query similar cards: %w", err)
+// backContext returns the context of a back text: the back references, then
+// with options.BackFallbackFront the front ones marked IsFrontFallback, each group in
+// its original order
+func backContext(cards []ContextCard, fallback string) []ContextCard {
+	sorted := PreferSide(cards, true)
+	for i := range sorted {
+		if sorted[i].IsBack {
+			continue
+		}
+		if fallback == options.BackFallbackNone {
+			return sorted[:i]
+		}
+		sorted[i].IsFrontFallback = true
 	}
-	defer rows.Close()
-
-	cards := []ContextCard{} // Initialize as empty slice, not nil
-	for rows.Next() {
-		var card ContextCard
-		if err := rows.Scan(
-			&card.CardCode,
-			&card.CardName,
-			&card.IsBack,
-			&card.EnglishText,
-			&card.TranslatedText,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan card: %w", err)
+	return sorted
+}
+
+// RetrieveSimilarCards retrieves the most similar cards from the pgvector
+// database using vector similarity search, filtered by target language and
+// text type. It is a shorthand for RetrieveContext on a PostgresStore.
+// language is one of options.SupportedLanguages
+// textType is TextRules, TextFlavor or TextName
+func RetrieveSimilarCards(db *sql.DB, queryEmbedding []float32, limit int, language, textType string) ([]ContextCard, error) {
+	return RetrieveContext(context.Background(), NewPostgresStore(db), SearchQuery{Embedding: queryEmbedding, Limit: limit, Language: language, TextType: textType, Mode: RetrievalEnglish})
+}
+
+// RetrieveSimilarCardsByTranslation retrieves the most similar cards by
+// comparing the query against the target-language text embeddings, so that
+// text already written in the target language can be matched directly
+// language is one of options.SupportedLanguages
+// textType is TextRules, TextFlavor or TextName
+func RetrieveSimilarCardsByTranslation(db *sql.DB, queryEmbedding []float32, limit int, language, textType string) ([]ContextCard, error) {
+	return RetrieveContext(context.Background(), NewPostgresStore(db), SearchQuery{Embedding: queryEmbedding, Limit: limit, Language: language, TextType: textType, Mode: RetrievalTarget})
+}
+
+// FilterBySimilarity drops the cards whose similarity to the query is below
+// minSimilarity, keeping the order of the remaining cards
+func FilterBySimilarity(cards []ContextCard, minSimilarity float64) []ContextCard {
+	filtered := []ContextCard{}
+	for _, card := range cards {
+		if card.Similarity >= minSimilarity {
+			filtered = append(filtered, card)
 		}
-		cards = append(cards, card)
 	}
+	return filtered
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+// PreferSide moves the cards from the given side (front or back) ahead of the
+// others, keeping the relative order within each group. Back text
+// (encounter/story) is worded differently from player-facing front text, so
+// references from the same side are the better guide.
+func PreferSide(cards []ContextCard, isBack bool) []ContextCard {
+	sorted := make([]ContextCard, 0, len(cards))
+	for _, card := range cards {
+		if card.IsBack == isBack {
+			sorted = append(sorted, card)
+		}
 	}
+	for _, card := range cards {
+		if card.IsBack != isBack {
+			sorted = append(sorted, card)
+		}
+	}
+	return sorted
+}
 
-	return cards, nil
+// PinCards returns the pinned cards, marked IsPinned, followed by the
+// retrieved cards that are not pinned while there are fewer than limit. The
+// pinned cards come first so that trimming the context drops retrieved ones
+// first.
+func PinCards(pinned, retrieved []ContextCard, limit int) []ContextCard {
+	type side struct {
+		code   string
+		isBack bool
+	}
+	seen := make(map[side]bool, len(pinned))
+	cards := make([]ContextCard, 0, limit)
+	for _, card := range pinned {
+		card.IsPinned = true
+		seen[side{card.CardCode, card.IsBack}] = true
+		cards = append(cards, card)
+	}
+	for _, card := range retrieved {
+		if len(cards) >= limit {
+			break
+		}
+		if !seen[side{card.CardCode, card.IsBack}] {
+			cards = append(cards, card)
+		}
+	}
+	return cards
 }
@@ -1,19 +1,25 @@
 package rag
 
 import (
+	"context"
 	"database/sql"
+	"math"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/lib/pq"
 	"github.com/pgvector/pgvector-go"
 	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/testdb"
 )
 
 func TestRetrieveSimilarCards_EmptyEmbedding(t *testing.T) {
 	var db *sql.DB
 	emptyEmbedding := []float32{}
 
-	cards, err := RetrieveSimilarCards(db, emptyEmbedding, 5, "it")
+	cards, err := RetrieveSimilarCards(db, emptyEmbedding, 5, "it", TextRules)
 
 	if err == nil {
 		t.Error("Expected error for empty embedding, got nil")
@@ -29,7 +35,281 @@ func TestRetrieveSimilarCards_EmptyEmbedding(t *testing.T) {
 	}
 }
 
-func TestRetrieveSimilarCards_RealDatabase(t *testing.T) {
+// staticStore is a VectorStore returning fixed cards, up to the query limit
+type staticStore struct {
+	cards  []ContextCard
+	limits []int
+}
+
+func (s *staticStore) Upsert(entries []StoreEntry) error { return nil }
+
+func (s *staticStore) Search(ctx context.Context, query SearchQuery) ([]ContextCard, error) {
+	s.limits = append(s.limits, query.Limit)
+	return s.cards[:min(query.Limit, len(s.cards))], nil
+}
+
+func (s *staticStore) Delete(cardCode string) (int, error) { return 0, nil }
+
+func (s *staticStore) Embedding(ctx context.Context, cardCode string, isBack bool, textType string) ([]float32, error) {
+	return nil, ErrEntryNotFound
+}
+
+func (s *staticStore) Cards(ctx context.Context, codes []string, query SearchQuery) ([]ContextCard, error) {
+	return nil, nil
+}
+
+func TestRetrieveContext_OverfetchesUsableCards(t *testing.T) {
+	store := &staticStore{cards: []ContextCard{
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere."},
+		{CardCode: "01020", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere."}, // Same side twice
+		{CardCode: "01516", CardName: "Machete", EnglishText: "Fight.", TranslatedText: "Combattere."}, // Reprint
+		{CardCode: "01016", CardName: ".45 Automatic", EnglishText: "Uses (4 ammo). Fight.", TranslatedText: ""},
+		{CardCode: "01016", CardName: ".45 Automatic", IsBack: true, EnglishText: "Uses (4 ammo).", TranslatedText: "Usi (4 munizioni)."},
+		{CardCode: "01030", CardName: "Magnifying Glass", EnglishText: "You get +1 [intellect].", TranslatedText: "Ottieni +1 [intellect]."},
+		{CardCode: "01039", CardName: "Deduction", EnglishText: "Investigate.", TranslatedText: "Indaga."},
+	}}
+
+	cards, err := RetrieveContext(context.Background(), store, SearchQuery{Embedding: []float32{0.1}, Limit: 3, Language: "it", TextType: TextRules})
+	if err != nil {
+		t.Fatalf("Failed to retrieve context: %v", err)
+	}
+	if len(store.limits) != 1 || store.limits[0] != 3*OverfetchFactor {
+		t.Errorf("Expected one search for %d cards, got %v", 3*OverfetchFactor, store.limits)
+	}
+
+	var codes []string
+	for _, card := range cards {
+		codes = append(codes, card.CardCode)
+	}
+	if strings.Join(codes, ",") != "01020,01016,01030" {
+		t.Errorf("Expected Machete, the .45 Automatic back and Magnifying Glass, got %v", codes)
+	}
+
+	// Sparse data returns what there is
+	store.cards = store.cards[:4]
+	cards, err = RetrieveContext(context.Background(), store, SearchQuery{Embedding: []float32{0.1}, Limit: 3, Language: "it", TextType: TextRules})
+	if err != nil {
+		t.Fatalf("Failed to retrieve context: %v", err)
+	}
+	if len(cards) != 1 {
+		t.Errorf("Expected the only usable card, got %+v", cards)
+	}
+}
+
+func TestSimilarCardsQuery_UsesCosineDistance(t *testing.T) {
+	query := similarCardsQuery(MetricCosine, 0, 0)
+
+	// The ivfflat index is built with vector_cosine_ops, so the query must
+	// order by the cosine distance operator for the index to be used
+	if !strings.Contains(query, "ORDER BY e.embedding <=> $1") {
+		t.Errorf("Expected query to order by cosine distance (<=>), got: %s", query)
+	}
+	if !strings.Contains(query, "1 - (e.embedding <=> $1) as similarity") {
+		t.Errorf("Expected query to return the cosine similarity, got: %s", query)
+	}
+	if strings.Contains(query, "<->") {
+		t.Errorf("Query should not use L2 distance (<->), got: %s", query)
+	}
+}
+
+func TestSimilarQueries_UseMetricOperator(t *testing.T) {
+	testCases := []struct {
+		metric   Metric
+		operator string
+		opClass  string
+	}{
+		{MetricCosine, "<=>", "vector_cosine_ops"},
+		{MetricInnerProduct, "<#>", "vector_ip_ops"},
+		{MetricL2, "<->", "vector_l2_ops"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.metric), func(t *testing.T) {
+			if tc.metric.Operator() != tc.operator || tc.metric.OpClass() != tc.opClass {
+				t.Errorf("Expected %s with %s, got %s with %s", tc.operator, tc.opClass, tc.metric.Operator(), tc.metric.OpClass())
+			}
+			if metric, err := MetricForOpClass(tc.opClass); err != nil || metric != tc.metric {
+				t.Errorf("Expected %s for %s, got %s (%v)", tc.metric, tc.opClass, metric, err)
+			}
+			if query := similarCardsQuery(tc.metric, 0, 0); !strings.Contains(query, "ORDER BY e.embedding "+tc.operator+" $1") {
+				t.Errorf("Expected query to order by %s, got: %s", tc.operator, query)
+			}
+			if query := similarTranslationsQuery(tc.metric, 0, 0); !strings.Contains(query, "ORDER BY t.embedding "+tc.operator+" $1") {
+				t.Errorf("Expected query to order by %s, got: %s", tc.operator, query)
+			}
+		})
+	}
+
+	if _, err := ParseMetric("dot"); err == nil {
+		t.Error("Expected error for unsupported metric, got nil")
+	}
+}
+
+func TestSimilarQueries_EmbeddingModelFilter(t *testing.T) {
+	for column, query := range map[string]string{
+		"e.embedding_model": similarCardsQuery(MetricCosine, 0, 0),
+		"t.embedding_model": similarTranslationsQuery(MetricCosine, 0, 0),
+	} {
+		if !strings.Contains(query, "COALESCE("+column+", $7) = $7") {
+			t.Errorf("Expected query to filter on %s, got: %s", column, query)
+		}
+	}
+}
+
+func TestSimilarQueries_DeckFilter(t *testing.T) {
+	for _, query := range []string{similarCardsQuery(MetricCosine, 0, 0), similarTranslationsQuery(MetricCosine, 0, 0)} {
+		if !strings.Contains(query, "(e.encounter_code <> '') = ($8 = 'encounter')") {
+			t.Errorf("Expected query to filter on the deck in $8, got: %s", query)
+		}
+	}
+	if query := cardsByCodeQuery(MetricCosine); strings.Contains(query, "$8") {
+		t.Errorf("Expected pinned cards not to be filtered by deck, got: %s", query)
+	}
+}
+
+func TestSimilarCardsQuery_FallbackChain(t *testing.T) {
+	query := similarCardsQuery(MetricCosine, 0, 0)
+
+	// Translations are joined per language, preferring languages earlier in the chain
+	expected := []string{
+		"FROM card_translations t",
+		"SELECT 'en', e.english_text",
+		"candidates.language = ANY($4::text[])",
+		"ORDER BY array_position($4::text[], candidates.language)",
+		"e.text_type = $3",
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(query, fragment) {
+			t.Errorf("Expected query to contain '%s', got: %s", fragment, query)
+		}
+	}
+}
+
+func TestSimilarTranslationsQuery_TargetLanguageEmbedding(t *testing.T) {
+	query := similarTranslationsQuery(MetricCosine, 0, 0)
+
+	expected := []string{
+		"ORDER BY t.embedding <=> $1",
+		"t.embedding IS NOT NULL",
+		"t.language = $4",
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(query, fragment) {
+			t.Errorf("Expected query to contain '%s', got: %s", fragment, query)
+		}
+	}
+}
+
+func TestRetrieveSimilarCardsByTranslation_EmptyEmbedding(t *testing.T) {
+	var db *sql.DB
+
+	if _, err := RetrieveSimilarCardsByTranslation(db, []float32{}, 5, "it", TextRules); err == nil {
+		t.Error("Expected error for empty embedding, got nil")
+	}
+}
+
+func TestFilterBySimilarity(t *testing.T) {
+	cards := []ContextCard{
+		{CardCode: "01001", Similarity: 0.91},
+		{CardCode: "01002", Similarity: 0.42},
+		{CardCode: "01003", Similarity: 0.75},
+	}
+
+	filtered := FilterBySimilarity(cards, 0.7)
+	if len(filtered) != 2 || filtered[0].CardCode != "01001" || filtered[1].CardCode != "01003" {
+		t.Errorf("Expected 01001 and 01003 in order, got %+v", filtered)
+	}
+
+	if filtered := FilterBySimilarity(cards, 0.95); filtered == nil || len(filtered) != 0 {
+		t.Errorf("Expected empty non-nil slice, got %#v", filtered)
+	}
+}
+
+func TestPreferSide(t *testing.T) {
+	cards := []ContextCard{
+		{CardCode: "01001"},
+		{CardCode: "01002", IsBack: true},
+		{CardCode: "01003"},
+		{CardCode: "01004", IsBack: true},
+	}
+
+	var codes []string
+	for _, card := range PreferSide(cards, true) {
+		codes = append(codes, card.CardCode)
+	}
+	if strings.Join(codes, ",") != "01002,01004,01001,01003" {
+		t.Errorf("Expected backs first in their original order, got %v", codes)
+	}
+}
+
+func TestBackContext(t *testing.T) {
+	cards := []ContextCard{
+		{CardCode: "01001"},
+		{CardCode: "01002", IsBack: true},
+		{CardCode: "01003"},
+	}
+
+	testCases := []struct {
+		fallback  string
+		expected  string
+		fallbacks string // Codes marked IsFrontFallback
+	}{
+		{options.BackFallbackFront, "01002,01001,01003", "01001,01003"},
+		{options.BackFallbackNone, "01002", ""},
+	}
+
+	for _, tc := range testCases {
+		var codes, fallbacks []string
+		for _, card := range backContext(cards, tc.fallback) {
+			codes = append(codes, card.CardCode)
+			if card.IsFrontFallback {
+				fallbacks = append(fallbacks, card.CardCode)
+			}
+		}
+		if strings.Join(codes, ",") != tc.expected {
+			t.Errorf("Fallback %s: expected %s, got %v", tc.fallback, tc.expected, codes)
+		}
+		if strings.Join(fallbacks, ",") != tc.fallbacks {
+			t.Errorf("Fallback %s: expected fallbacks %s, got %v", tc.fallback, tc.fallbacks, fallbacks)
+		}
+	}
+	if cards[0].IsFrontFallback {
+		t.Error("Expected the retrieved cards to be left unchanged")
+	}
+}
+
+func TestPinCards(t *testing.T) {
+	pinned := []ContextCard{{CardCode: "01030"}, {CardCode: "01030", IsBack: true}}
+	retrieved := []ContextCard{{CardCode: "01020"}, {CardCode: "01030"}, {CardCode: "01016"}, {CardCode: "01017"}}
+
+	var codes []string
+	for _, card := range PinCards(pinned, retrieved, 4) {
+		codes = append(codes, card.CardCode)
+		if card.IsPinned != (len(codes) <= 2) {
+			t.Errorf("Expected only the pinned cards to be marked, got %+v", card)
+		}
+	}
+	if strings.Join(codes, ",") != "01030,01030,01020,01016" {
+		t.Errorf("Expected the pinned cards first and no duplicate, got %v", codes)
+	}
+	if pinned[0].IsPinned {
+		t.Error("Expected the pinned cards to be left unchanged")
+	}
+}
+
+func TestRetrieveSimilarCards_InvalidTextType(t *testing.T) {
+	var db *sql.DB
+
+	if _, err := RetrieveSimilarCards(db, []float32{0.1}, 5, "it", "lore"); err == nil {
+		t.Error("Expected error for unsupported text type, got nil")
+	}
+}
+
+// connectTestDB connects to the integration test database, skipping the test
+// if DB_TEST is not set
+func connectTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
 	// Skip if DB_TEST environment variable is not set
 	if os.Getenv("DB_TEST") == "" {
 		t.Skip("Skipping integration test (set DB_TEST=1 to enable)")
@@ -61,13 +341,80 @@ func TestRetrieveSimilarCards_RealDatabase(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to connect to database: %v", err)
 	}
-	defer database.Close()
+	t.Cleanup(func() { database.Close() })
+
+	return database
+}
+
+func TestRetrieveSimilarCards_QueryPlanUsesIndex(t *testing.T) {
+	database := connectTestDB(t)
+
+	// Run EXPLAIN inside a transaction so the planner settings stay on one connection
+	tx, err := database.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Disable sequential scans so small test tables don't hide a missing index match
+	if _, err := tx.Exec("SET LOCAL enable_seqscan = off"); err != nil {
+		t.Fatalf("Failed to disable sequential scans: %v", err)
+	}
+
+	var embeddingVector pgvector.Vector
+	err = tx.QueryRow(`
+		SELECT embedding
+		FROM card_embeddings
+		WHERE embedding IS NOT NULL
+		LIMIT 1
+	`).Scan(&embeddingVector)
+	if err != nil {
+		t.Fatalf("Failed to get an embedding: %v", err)
+	}
+
+	// Query with the metric of the index actually built
+	opClass, err := db.IndexOpClass(database, "card_embeddings_embedding_idx")
+	if err != nil {
+		t.Fatalf("Failed to read the index operator class: %v", err)
+	}
+	metric, err := MetricForOpClass(opClass)
+	if err != nil {
+		t.Fatalf("Unexpected index operator class: %v", err)
+	}
+
+	rows, err := tx.Query("EXPLAIN "+similarCardsQuery(metric, 0, 0), embeddingVector, 6, TextRules, pq.Array([]string{"it"}), "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to explain retrieval query: %v", err)
+	}
+	defer rows.Close()
+
+	var plan strings.Builder
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			t.Fatalf("Failed to scan query plan: %v", err)
+		}
+		plan.WriteString(line + "\n")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Error iterating query plan: %v", err)
+	}
+
+	t.Logf("Query plan:\n%s", plan.String())
+
+	if !strings.Contains(plan.String(), "card_embeddings_embedding_idx") {
+		t.Errorf("Expected query plan to use card_embeddings_embedding_idx")
+	}
+}
+
+func TestRetrieveSimilarCards_RealDatabase(t *testing.T) {
+	database := connectTestDB(t)
 
 	// Find Machete card and get its embedding
 	var macheteCode string
 	var macheteName string
 
-	err = database.QueryRow(`
+	err := database.QueryRow(`
 		SELECT card_code, card_name
 		FROM card_embeddings
 		WHERE LOWER(card_name) LIKE '%machete%'
@@ -106,7 +453,7 @@ func TestRetrieveSimilarCards_RealDatabase(t *testing.T) {
 
 	// Test retrieval - search for cards similar to Machete (using Italian)
 	limit := 6
-	cards, err := RetrieveSimilarCards(database, embedding, limit, "it")
+	cards, err := RetrieveSimilarCards(database, embedding, limit, "it", TextRules)
 	if err != nil {
 		t.Fatalf("Failed to retrieve similar cards: %v", err)
 	}
@@ -153,3 +500,167 @@ func TestRetrieveSimilarCards_RealDatabase(t *testing.T) {
 		t.Errorf("Expected Machete (%s) to be in results", macheteCode)
 	}
 }
+
+func TestRetrieveSimilarCards_Container(t *testing.T) {
+	database := testdb.Start(t)
+
+	testdb.InsertCard(t, database, "01020", "Machete", TextRules, "Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(1, 0, 0), map[string]string{"it": "Combattere. Ottieni +1 [combat] per questo attacco."})
+	testdb.InsertCard(t, database, "01016", ".45 Automatic", TextRules, "Uses (4 ammo). Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(0.8, 0.6, 0), map[string]string{"it": "Usi (4 munizioni). Combattere. Ottieni +1 [combat] per questo attacco.", "fr": "Utilisations (4 munitions)."})
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", TextRules, "You get +1 [intellect] while investigating.",
+		testdb.Embedding(0, 0, 1), map[string]string{"fr": "Vous obtenez +1 [intellect] lorsque vous enquêtez."})
+	testdb.InsertCard(t, database, "01020", "Machete", TextFlavor, "A trusty blade.",
+		testdb.Embedding(1, 0, 0), map[string]string{"it": "Una lama fidata."})
+
+	t.Run("English", func(t *testing.T) {
+		cards, err := RetrieveSimilarCards(database, testdb.Embedding(1, 0, 0), 2, "it", TextRules)
+		if err != nil {
+			t.Fatalf("Failed to retrieve similar cards: %v", err)
+		}
+		if len(cards) != 2 || cards[0].CardCode != "01020" || cards[1].CardCode != "01016" {
+			t.Fatalf("Expected Machete then .45 Automatic, got %+v", cards)
+		}
+		if cards[0].TranslatedText != "Combattere. Ottieni +1 [combat] per questo attacco." || cards[0].IsFallback || cards[0].TextType != TextRules {
+			t.Errorf("Unexpected first card: %+v", cards[0])
+		}
+		if math.Abs(cards[0].Similarity-1) > 1e-6 || math.Abs(cards[1].Similarity-0.8) > 1e-6 {
+			t.Errorf("Expected similarities 1 and 0.8, got %g and %g", cards[0].Similarity, cards[1].Similarity)
+		}
+	})
+
+	t.Run("TextType", func(t *testing.T) {
+		cards, err := RetrieveSimilarCards(database, testdb.Embedding(1, 0, 0), 5, "it", TextFlavor)
+		if err != nil {
+			t.Fatalf("Failed to retrieve similar cards: %v", err)
+		}
+		if len(cards) != 1 || cards[0].TranslatedText != "Una lama fidata." || cards[0].TextType != TextFlavor {
+			t.Errorf("Expected only the flavor entry, got %+v", cards)
+		}
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		defer func(fallbacks map[string][]string) { LanguageFallbacks = fallbacks }(LanguageFallbacks)
+		LanguageFallbacks = map[string][]string{"de": {"fr", "en"}}
+
+		cards, err := RetrieveSimilarCards(database, testdb.Embedding(0, 0, 1), 3, "de", TextRules)
+		if err != nil {
+			t.Fatalf("Failed to retrieve similar cards: %v", err)
+		}
+		languages := map[string]string{}
+		for _, card := range cards {
+			if !card.IsFallback {
+				t.Errorf("Expected a fallback translation for %s, got %+v", card.CardCode, card)
+			}
+			languages[card.CardCode] = card.TranslationLanguage
+		}
+		if languages["01030"] != "fr" || languages["01016"] != "fr" || languages["01020"] != "en" {
+			t.Errorf("Expected French where available and English otherwise, got %v", languages)
+		}
+	})
+
+	t.Run("Target", func(t *testing.T) {
+		cards, err := RetrieveSimilarCardsByTranslation(database, testdb.Embedding(0, 1, 0), 1, "it", TextRules)
+		if err != nil {
+			t.Fatalf("Failed to retrieve similar cards: %v", err)
+		}
+		if len(cards) != 1 || cards[0].CardCode != "01016" || cards[0].TranslationLanguage != "it" {
+			t.Errorf("Expected the .45 Automatic Italian translation, got %+v", cards)
+		}
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		if _, err := database.Exec("UPDATE card_embeddings SET type_code = 'asset', faction_code = CASE WHEN card_code = '01030' THEN 'seeker' ELSE 'guardian' END"); err != nil {
+			t.Fatalf("Failed to set card metadata: %v", err)
+		}
+		store := NewPostgresStore(database)
+
+		tests := []struct {
+			name        string
+			typeCode    string
+			factionCode string
+			want        []string
+		}{
+			{"no filter", "", "", []string{"01020", "01016", "01030"}},
+			{"type", "asset", "", []string{"01020", "01016", "01030"}},
+			{"faction", "", "seeker", []string{"01030"}},
+			{"type and faction", "asset", "guardian", []string{"01020", "01016"}},
+			{"no match", "event", "", nil},
+		}
+		for _, tt := range tests {
+			cards, err := store.Search(context.Background(), SearchQuery{
+				Embedding: testdb.Embedding(1, 0, 0), Limit: 5, Language: "it", TextType: TextRules,
+				TypeCode: tt.typeCode, FactionCode: tt.factionCode,
+			})
+			if err != nil {
+				t.Fatalf("%s: failed to search: %v", tt.name, err)
+			}
+			var codes []string
+			for _, card := range cards {
+				codes = append(codes, card.CardCode)
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, codes)
+			}
+			if len(cards) > 0 && cards[0].TypeCode != "asset" {
+				t.Errorf("%s: expected the type code in the results, got %+v", tt.name, cards[0])
+			}
+		}
+	})
+
+	t.Run("EmbeddingModel", func(t *testing.T) {
+		if _, err := database.Exec(`UPDATE card_embeddings SET embedding_model = CASE card_code
+			WHEN '01020' THEN 'text-embedding-3-small' WHEN '01016' THEN 'text-embedding-ada-002' END`); err != nil {
+			t.Fatalf("Failed to set the embedding models: %v", err)
+		}
+		store := NewPostgresStore(database)
+
+		tests := []struct {
+			model string
+			want  []string
+		}{
+			{"", []string{"01020", "01016", "01030"}},
+			{"text-embedding-3-small", []string{"01020", "01030"}}, // 01030's model is unknown
+			{"text-embedding-ada-002", []string{"01016", "01030"}},
+		}
+		for _, tt := range tests {
+			cards, err := store.Search(context.Background(), SearchQuery{
+				Embedding: testdb.Embedding(1, 0, 0), Limit: 5, Language: "it", TextType: TextRules, EmbeddingModel: tt.model,
+			})
+			if err != nil {
+				t.Fatalf("%q: failed to search: %v", tt.model, err)
+			}
+			var codes []string
+			for _, card := range cards {
+				codes = append(codes, card.CardCode)
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("%q: expected %v, got %v", tt.model, tt.want, codes)
+			}
+			if tt.model == "" && cards[1].EmbeddingModel != "text-embedding-ada-002" {
+				t.Errorf("Expected the embedding model in the results, got %+v", cards[1])
+			}
+		}
+	})
+}
+
+func TestMismatchedModels(t *testing.T) {
+	cards := []ContextCard{
+		{CardCode: "01020", EmbeddingModel: "text-embedding-3-small"},
+		{CardCode: "01016", EmbeddingModel: "text-embedding-ada-002"},
+		{CardCode: "01030"},
+		{CardCode: "01017", EmbeddingModel: "text-embedding-ada-002"},
+		{CardCode: "01018", EmbeddingModel: "text-embedding-3-large"},
+	}
+
+	models := MismatchedModels(cards, "text-embedding-3-small")
+	if strings.Join(models, ",") != "text-embedding-3-large,text-embedding-ada-002" {
+		t.Errorf("Expected the other models once each, got %v", models)
+	}
+	if models := MismatchedModels(cards[:3], "text-embedding-ada-002"); strings.Join(models, ",") != "text-embedding-3-small" {
+		t.Errorf("Expected only text-embedding-3-small, got %v", models)
+	}
+	if models := MismatchedModels(cards[2:3], "text-embedding-3-small"); len(models) != 0 {
+		t.Errorf("Expected cards of an unknown model to match, got %v", models)
+	}
+}
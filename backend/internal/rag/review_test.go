@@ -0,0 +1,86 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+func TestTranslate_Review(t *testing.T) {
+	draft := "Ricevi +1 combattimento in questo attacco."
+	reviewed := "Ricevi +1 [combat] in questo attacco."
+
+	testCases := []struct {
+		name     string
+		ctx      context.Context
+		review   string
+		expected string
+		requests int
+	}{
+		{"NoReview", context.Background(), reviewed, draft, 1},
+		{"Review", WithReview(context.Background()), reviewed, reviewed, 2},
+		{"ReviewDeclined", WithReview(context.Background()), "I'm sorry, I cannot review this text.", draft, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests [][]Message
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Messages []Message `json:"messages"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				requests = append(requests, body.Messages)
+
+				content := draft
+				if len(requests) > 1 {
+					content = tc.review
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"choices": []map[string]interface{}{{"message": Message{Role: "assistant", Content: content}}},
+					"usage":   Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+				})
+			}))
+			defer server.Close()
+
+			defer func(base string, jsonOutput bool) { openai.BaseURL, JSONOutput = base, jsonOutput }(openai.BaseURL, JSONOutput)
+			openai.BaseURL = server.URL
+			JSONOutput = false
+
+			result, err := Translate(tc.ctx, "You get +1 [combat] for this attack.", nil, "test-key", "gpt-4o", "it")
+			if err != nil {
+				t.Fatalf("Translate failed: %v", err)
+			}
+			if len(requests) != tc.requests {
+				t.Fatalf("Expected %d requests, got %d", tc.requests, len(requests))
+			}
+			if result.Translation != tc.expected {
+				t.Errorf("Expected translation %q, got %q", tc.expected, result.Translation)
+			}
+			if tc.requests == 1 {
+				if result.Draft != "" {
+					t.Errorf("Expected no draft without review, got %q", result.Draft)
+				}
+				return
+			}
+
+			if result.Draft != draft {
+				t.Errorf("Expected draft %q, got %q", draft, result.Draft)
+			}
+			if result.Usage.TotalTokens != 220 {
+				t.Errorf("Expected the usage of both calls, got %+v", result.Usage)
+			}
+			review := requests[1]
+			if !strings.Contains(review[0].Content, "Italian") || !strings.Contains(review[1].Content, draft) ||
+				!strings.Contains(review[1].Content, "You get +1 [combat] for this attack.") {
+				t.Errorf("Expected the review to get the language, source and draft, got %+v", review)
+			}
+		})
+	}
+}
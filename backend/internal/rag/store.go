@@ -0,0 +1,121 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+)
+
+// VectorStore stores the embedded card entries and finds the ones most
+// similar to a query. PostgresStore (pgvector) is the built-in
+// implementation; other backends only need these methods.
+type VectorStore interface {
+	// Upsert stores the entries, replacing any existing entry with the same
+	// card code, side and text type, along with its translations
+	Upsert(entries []StoreEntry) error
+	// Search returns up to query.Limit cards ordered by similarity to
+	// query.Embedding, with their text in the query language (or a fallback),
+	// giving up when ctx is done
+	Search(ctx context.Context, query SearchQuery) ([]ContextCard, error)
+	// Delete removes every entry of the card (both sides, all text types)
+	// with its translations and returns the number of entries removed
+	Delete(cardCode string) (int, error)
+	// Embedding returns the stored English embedding of a card side and text
+	// type, or ErrEntryNotFound
+	Embedding(ctx context.Context, cardCode string, isBack bool, textType string) ([]float32, error)
+	// Cards returns the entries (every side) of the given cards, in the order
+	// of codes, like Search would return them for query: with their text in
+	// the query language (or a fallback) and their similarity to
+	// query.Embedding. Limit, Mode and the filters of the query don't apply.
+	// Cards without such an entry are left out.
+	Cards(ctx context.Context, codes []string, query SearchQuery) ([]ContextCard, error)
+}
+
+// ErrEntryNotFound is returned by VectorStore.Embedding for a card side and
+// text type without a stored embedding
+var ErrEntryNotFound = errors.New("entry not found")
+
+// StoreEntry is an embedded card entry, as written by the ingest tool
+type StoreEntry struct {
+	CardCode    string
+	CardName    string
+	IsBack      bool
+	TextType    string
+	EnglishText string
+	Embedding   []float32
+	// Translations maps a language code to the translated text
+	Translations map[string]string
+	// TranslationEmbeddings maps a language code to the embedding of its
+	// translation, for target-language retrieval (missing = not embedded)
+	TranslationEmbeddings map[string][]float32
+	EmbeddingModel        string  // Model the embeddings were generated with
+	Priority              float64 // Ranks the entry higher in retrieval, see PriorityWeight
+	TypeCode              string  // ArkhamDB card type, e.g. "asset" (empty if unknown)
+	FactionCode           string  // ArkhamDB faction, e.g. "guardian" (empty if unknown)
+	EncounterCode         string  // ArkhamDB encounter set, e.g. "the_gathering" (empty for player cards)
+	PackCode              string  // ArkhamDB pack, e.g. "dwl" (empty if unknown)
+}
+
+// SearchQuery describes a similarity search
+type SearchQuery struct {
+	Embedding []float32
+	Limit     int
+	Language  string // One of options.SupportedLanguages
+	TextType  string // TextRules, TextFlavor or TextName
+	Mode      string // RetrievalEnglish (default) or RetrievalTarget
+	// ReferenceLanguages are the languages whose translations of each card
+	// are returned in ContextCard.References (Language is skipped)
+	ReferenceLanguages []string
+	// TypeCode and FactionCode, when set, restrict the search to cards of
+	// that ArkhamDB type (e.g. "asset") and faction (e.g. "guardian")
+	TypeCode    string
+	FactionCode string
+	// Deck, when set, restricts the search to player cards (DeckPlayer) or
+	// to encounter, scenario and story cards (DeckEncounter)
+	Deck string
+	// PreferPack, when set, ranks the cards of this ArkhamDB pack (e.g.
+	// "dwl") above closer cards of other packs, see PackWeight
+	PreferPack string
+	// EmbeddingModel, when set, restricts the search to the entries embedded
+	// with this model (the one of Embedding); entries of an unknown model
+	// are kept
+	EmbeddingModel string
+	// IsBack is set when the query is a card back; stores ignore it, and
+	// RetrieveContext orders the results by side (see BackFallback)
+	IsBack bool
+}
+
+// NewVectorStore returns the vector store backend called name. database is
+// the application database, which the postgres backend stores vectors in.
+func NewVectorStore(name string, database *sql.DB) (VectorStore, error) {
+	switch name {
+	case options.StorePostgres, "":
+		return NewPostgresStore(database), nil
+	default:
+		return nil, fmt.Errorf("unsupported vector store: %s (supported: postgres)", name)
+	}
+}
+
+// validateSearch checks the query fields every backend relies on
+func validateSearch(query SearchQuery) error {
+	if len(query.Embedding) == 0 {
+		return fmt.Errorf("query embedding is empty")
+	}
+	if !options.ValidLanguage(query.Language) {
+		return fmt.Errorf("unsupported language: %s (supported: %s)", query.Language, strings.Join(options.SupportedLanguages, ", "))
+	}
+	if !ValidTextType(query.TextType) {
+		return fmt.Errorf("unsupported text type: %s (supported: rules, flavor, name)", query.TextType)
+	}
+	if query.Mode != "" && query.Mode != RetrievalEnglish && query.Mode != RetrievalTarget {
+		return fmt.Errorf("unsupported retrieval mode: %s (supported: english, target)", query.Mode)
+	}
+	if query.Deck != "" && !ValidDeck(query.Deck) {
+		return fmt.Errorf("unsupported deck: %s (supported: player, encounter)", query.Deck)
+	}
+	return nil
+}
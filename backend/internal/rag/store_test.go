@@ -0,0 +1,424 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
+	"github.com/ventrosky/arkham-localize/backend/internal/testdb"
+)
+
+func TestNewVectorStore(t *testing.T) {
+	store, err := NewVectorStore(options.StorePostgres, nil)
+	if err != nil {
+		t.Fatalf("Failed to create postgres store: %v", err)
+	}
+	if _, ok := store.(*PostgresStore); !ok {
+		t.Errorf("Expected a *PostgresStore, got %T", store)
+	}
+
+	if _, err := NewVectorStore("qdrant", nil); err == nil {
+		t.Error("Expected error for unsupported vector store, got nil")
+	}
+}
+
+func TestPostgresStore_SearchValidation(t *testing.T) {
+	store := NewPostgresStore(nil) // Invalid queries fail before the database is used
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+	}{
+		{"EmptyEmbedding", SearchQuery{Limit: 5, Language: "it", TextType: TextRules}},
+		{"Language", SearchQuery{Embedding: []float32{0.1}, Limit: 5, Language: "xx", TextType: TextRules}},
+		{"TextType", SearchQuery{Embedding: []float32{0.1}, Limit: 5, Language: "it", TextType: "lore"}},
+		{"Mode", SearchQuery{Embedding: []float32{0.1}, Limit: 5, Language: "it", TextType: TextRules, Mode: "hybrid"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Search(context.Background(), tt.query); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestPostgresStore_Upsert_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+
+	entry := StoreEntry{
+		CardCode:              "01020",
+		CardName:              "Machete",
+		TextType:              TextRules,
+		EnglishText:           "Fight. You get +1 [combat] for this attack.",
+		Embedding:             testdb.Embedding(1, 0, 0),
+		Translations:          map[string]string{"it": "Combattere. Ottieni +1 [combat] per questo attacco.", "fr": ""},
+		TranslationEmbeddings: map[string][]float32{"it": testdb.Embedding(0, 1, 0)},
+		EmbeddingModel:        "text-embedding-3-small",
+	}
+	if err := store.Upsert([]StoreEntry{entry}); err != nil {
+		t.Fatalf("Failed to upsert: %v", err)
+	}
+
+	// Upserting again replaces the entry instead of duplicating it
+	entry.Translations = map[string]string{"it": "Combattere. +1 [combat]."}
+	if err := store.Upsert([]StoreEntry{entry}); err != nil {
+		t.Fatalf("Failed to upsert again: %v", err)
+	}
+
+	cards, err := store.Search(context.Background(), SearchQuery{Embedding: testdb.Embedding(1, 0, 0), Limit: 5, Language: "it", TextType: TextRules})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(cards) != 1 || cards[0].CardCode != "01020" || cards[0].TranslatedText != "Combattere. +1 [combat]." {
+		t.Fatalf("Expected the replaced Machete entry, got %+v", cards)
+	}
+
+	cards, err = store.Search(context.Background(), SearchQuery{Embedding: testdb.Embedding(0, 1, 0), Limit: 5, Language: "it", TextType: TextRules, Mode: RetrievalTarget})
+	if err != nil {
+		t.Fatalf("Failed to search translations: %v", err)
+	}
+	if len(cards) != 1 || cards[0].TranslationLanguage != "it" {
+		t.Errorf("Expected the Italian translation by its embedding, got %+v", cards)
+	}
+}
+
+func TestPostgresStore_Search_PreferPack_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+
+	entries := storeEntries(2)
+	entries[0].PackCode, entries[0].Embedding = "core", testdb.Embedding(1, 0.1)
+	entries[1].PackCode, entries[1].Embedding = "dwl", testdb.Embedding(1, 0.3)
+	if err := store.Upsert(entries); err != nil {
+		t.Fatalf("Failed to upsert: %v", err)
+	}
+
+	testCases := []struct {
+		pack     string
+		expected []string
+	}{
+		{"", []string{"core", "dwl"}},
+		{"dwl", []string{"dwl", "core"}},
+		{"tmm", []string{"core", "dwl"}}, // No card of the pack: nearest first
+	}
+	for _, tc := range testCases {
+		cards, err := store.Search(context.Background(), SearchQuery{Embedding: testdb.Embedding(1, 0), Limit: 2, Language: "it", TextType: TextRules, PreferPack: tc.pack})
+		if err != nil {
+			t.Fatalf("Failed to search preferring %q: %v", tc.pack, err)
+		}
+		var packs []string
+		for _, card := range cards {
+			packs = append(packs, card.PackCode)
+		}
+		if !reflect.DeepEqual(packs, tc.expected) {
+			t.Errorf("Expected packs %v preferring %q, got %v", tc.expected, tc.pack, packs)
+		}
+	}
+}
+
+// storeEntries returns n entries with an Italian translation and its
+// embedding, starting at card code 10000
+func storeEntries(n int) []StoreEntry {
+	entries := make([]StoreEntry, n)
+	for i := range entries {
+		entries[i] = StoreEntry{
+			CardCode:              fmt.Sprintf("%05d", 10000+i),
+			CardName:              fmt.Sprintf("Card %d", i),
+			TextType:              TextRules,
+			EnglishText:           fmt.Sprintf("Draw %d cards.", i),
+			Embedding:             testdb.Embedding(1, float64(i)),
+			Translations:          map[string]string{"it": fmt.Sprintf("Pesca %d carte.", i)},
+			TranslationEmbeddings: map[string][]float32{"it": testdb.Embedding(float64(i), 1)},
+			EmbeddingModel:        "text-embedding-3-small",
+			Priority:              0.5,
+		}
+	}
+	return entries
+}
+
+func TestPostgresStore_Upsert_Copy_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+
+	entries := storeEntries(copyMinEntries)
+	if err := store.Upsert(entries); err != nil {
+		t.Fatalf("Failed to upsert: %v", err)
+	}
+
+	// Upserting again replaces the entries; the repeated one is stored once
+	entries[0].Translations = map[string]string{"it": "Pesca zero carte."}
+	entries = append(entries, entries[0])
+	if err := store.Upsert(entries); err != nil {
+		t.Fatalf("Failed to upsert again: %v", err)
+	}
+
+	var rows, translations int
+	if err := database.QueryRow("SELECT COUNT(*) FROM card_embeddings").Scan(&rows); err != nil {
+		t.Fatalf("Failed to count entries: %v", err)
+	}
+	if err := database.QueryRow("SELECT COUNT(*) FROM card_translations WHERE embedding IS NOT NULL").Scan(&translations); err != nil {
+		t.Fatalf("Failed to count translations: %v", err)
+	}
+	if rows != copyMinEntries || translations != copyMinEntries {
+		t.Errorf("Expected %d entries and embedded translations, got %d and %d", copyMinEntries, rows, translations)
+	}
+	var priority float64
+	if err := database.QueryRow("SELECT priority FROM card_embeddings WHERE card_code = '10001'").Scan(&priority); err != nil || priority != 0.5 {
+		t.Errorf("Expected priority 0.5, got %g (%v)", priority, err)
+	}
+
+	cards, err := store.Search(context.Background(), SearchQuery{Embedding: testdb.Embedding(1, 0), Limit: 1, Language: "it", TextType: TextRules})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(cards) != 1 || cards[0].CardCode != "10000" || cards[0].TranslatedText != "Pesca zero carte." {
+		t.Errorf("Expected the replaced first entry, got %+v", cards)
+	}
+}
+
+func TestPostgresStore_Upsert_VectorRoundTrip_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+
+	// Components that need every significant digit of a float32, and tiny
+	// and large ones written in exponent form
+	embedding := testdb.Embedding(1, 0)
+	copy(embedding, []float32{1.0 / 3, -0.1, 1e-30, -2.5e-7, 123456.79, 0.99999994, 7e+10})
+	translationEmbedding := append([]float32(nil), embedding...)
+	translationEmbedding[0] = 2.0 / 3
+
+	for _, tc := range []struct {
+		name string
+		n    int
+	}{
+		{"Insert", 1},
+		{"Copy", copyMinEntries},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entries := storeEntries(tc.n)
+			entries[0].Embedding = embedding
+			entries[0].TranslationEmbeddings = map[string][]float32{"it": translationEmbedding}
+			if err := store.Upsert(entries); err != nil {
+				t.Fatalf("Failed to upsert: %v", err)
+			}
+
+			stored, err := store.Embedding(context.Background(), entries[0].CardCode, false, TextRules)
+			if err != nil {
+				t.Fatalf("Failed to read the embedding: %v", err)
+			}
+			if !reflect.DeepEqual(stored, embedding) {
+				t.Errorf("Expected the embedding to read back unchanged, got %v", stored[:7])
+			}
+
+			var translation pgvector.Vector
+			if err := database.QueryRow("SELECT embedding FROM card_translations WHERE card_code = $1 AND language = 'it'", entries[0].CardCode).Scan(&translation); err != nil {
+				t.Fatalf("Failed to read the translation embedding: %v", err)
+			}
+			if !reflect.DeepEqual(translation.Slice(), translationEmbedding) {
+				t.Errorf("Expected the translation embedding to read back unchanged, got %v", translation.Slice()[:7])
+			}
+		})
+	}
+}
+
+// BenchmarkPostgresStore_Upsert compares one INSERT per row with COPY, on
+// batches of the ingest tool's default size:
+//
+//	go test ./internal/rag -run '^$' -bench Upsert
+func BenchmarkPostgresStore_Upsert(b *testing.B) {
+	database := testdb.Start(b)
+	entries := storeEntries(50)
+
+	for _, bc := range []struct {
+		name   string
+		upsert func(*sql.Tx, []StoreEntry) error
+	}{
+		{"Insert", insertEntries},
+		{"Copy", copyEntries},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tx, err := database.Begin()
+				if err != nil {
+					b.Fatalf("Failed to begin: %v", err)
+				}
+				if err := bc.upsert(tx, entries); err != nil {
+					b.Fatalf("Failed to upsert: %v", err)
+				}
+				if err := tx.Commit(); err != nil {
+					b.Fatalf("Failed to commit: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPostgresStore_Delete_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+
+	testdb.InsertCard(t, database, "01020", "Machete", TextRules, "Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(1, 0, 0), map[string]string{"it": "Combattere."})
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", TextRules, "You get +1 [intellect] while investigating.",
+		testdb.Embedding(0, 0, 1), map[string]string{"it": "Indagare."})
+
+	deleted, err := store.Delete("01020")
+	if err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted entry, got %d", deleted)
+	}
+
+	var translations int
+	if err := database.QueryRow("SELECT COUNT(*) FROM card_translations WHERE card_code = '01020'").Scan(&translations); err != nil {
+		t.Fatalf("Failed to count translations: %v", err)
+	}
+	if translations != 0 {
+		t.Errorf("Expected the translations to be deleted, got %d", translations)
+	}
+
+	cards, err := store.Search(context.Background(), SearchQuery{Embedding: testdb.Embedding(1, 0, 0), Limit: 5, Language: "it", TextType: TextRules})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(cards) != 1 || cards[0].CardCode != "01030" {
+		t.Errorf("Expected only Magnifying Glass left, got %+v", cards)
+	}
+
+	if deleted, err := store.Delete("01020"); err != nil || deleted != 0 {
+		t.Errorf("Expected nothing left to delete, got %d (%v)", deleted, err)
+	}
+}
+
+func TestPostgresStore_Embedding_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+
+	testdb.InsertCard(t, database, "01020", "Machete", TextRules, "Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(1, 0, 0), map[string]string{"it": "Combattere."})
+
+	embedding, err := store.Embedding(context.Background(), "01020", false, TextRules)
+	if err != nil {
+		t.Fatalf("Failed to load embedding: %v", err)
+	}
+	if !reflect.DeepEqual(embedding, testdb.Embedding(1, 0, 0)) {
+		t.Errorf("Expected the stored embedding, got %d dimensions starting %v", len(embedding), embedding[:3])
+	}
+
+	if _, err := store.Embedding(context.Background(), "01020", true, TextRules); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Expected ErrEntryNotFound for the card back, got %v", err)
+	}
+	if _, err := store.Embedding(context.Background(), "99999", false, TextRules); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Expected ErrEntryNotFound for an unknown card, got %v", err)
+	}
+}
+
+func TestPostgresStore_PriorityWeight_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+	defer func(weight float64) { PriorityWeight = weight }(PriorityWeight)
+
+	if err := store.Upsert([]StoreEntry{
+		{CardCode: "02016", CardName: "Knife", TextType: TextRules, EnglishText: "Fight.",
+			Embedding: testdb.Embedding(1, 0.1, 0), Translations: map[string]string{"it": "Combattere."}},
+		{CardCode: "01020", CardName: "Machete", TextType: TextRules, EnglishText: "Fight. You get +1 [combat].",
+			Embedding: testdb.Embedding(1, 0.3, 0), Translations: map[string]string{"it": "Combattere. Ottieni +1 [combat]."}, Priority: 1},
+	}); err != nil {
+		t.Fatalf("Failed to upsert: %v", err)
+	}
+
+	query := SearchQuery{Embedding: testdb.Embedding(1, 0, 0), Limit: 2, Language: "it", TextType: TextRules}
+	for _, tt := range []struct {
+		weight   float64
+		expected string
+	}{
+		{0, "02016"},   // Closest first
+		{0.5, "01020"}, // The core set card outranks a slightly closer one
+	} {
+		PriorityWeight = tt.weight
+		cards, err := store.Search(context.Background(), query)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(cards) != 2 || cards[0].CardCode != tt.expected {
+			t.Errorf("Expected %s first with weight %g, got %+v", tt.expected, tt.weight, cards)
+		}
+	}
+}
+
+func TestPostgresStore_CardNotes_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+
+	testdb.InsertCard(t, database, "01020", "Machete", TextRules, "Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(1, 0, 0), map[string]string{"it": "Combattere.", "fr": "Combat."})
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", TextRules, "You get +1 [intellect] while investigating.",
+		testdb.Embedding(0, 0, 1), map[string]string{"it": "Indagare."})
+	if _, err := database.Exec(`INSERT INTO card_notes (card_code, language, note) VALUES
+		('01020', '', 'Errata: the bonus applies to the attack only.'),
+		('01020', 'it', 'The Italian text follows the FAQ errata.')`); err != nil {
+		t.Fatalf("Failed to insert notes: %v", err)
+	}
+
+	tests := []struct {
+		language string
+		expected string
+	}{
+		{"it", "The Italian text follows the FAQ errata."},
+		{"fr", "Errata: the bonus applies to the attack only."},
+	}
+	for _, tt := range tests {
+		cards, err := store.Search(context.Background(), SearchQuery{Embedding: testdb.Embedding(1, 0, 0), Limit: 2, Language: tt.language, TextType: TextRules})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(cards) == 0 || cards[0].CardCode != "01020" || cards[0].Note != tt.expected {
+			t.Errorf("Expected Machete with note %q in %s, got %+v", tt.expected, tt.language, cards)
+		}
+		for _, card := range cards[1:] {
+			if card.Note != "" {
+				t.Errorf("Expected no note for %s, got %q", card.CardCode, card.Note)
+			}
+		}
+	}
+}
+
+func TestPostgresStore_ReferenceLanguages_Container(t *testing.T) {
+	database := testdb.Start(t)
+	store := NewPostgresStore(database)
+
+	testdb.InsertCard(t, database, "01020", "Machete", TextRules, "Fight. You get +1 [combat] for this attack.",
+		testdb.Embedding(1, 0, 0), map[string]string{"de": "Kämpfen.", "it": "Combattere.", "fr": "Combat.", "es": "Luchar."})
+	testdb.InsertCard(t, database, "01030", "Magnifying Glass", TextRules, "You get +1 [intellect] while investigating.",
+		testdb.Embedding(0, 0, 1), map[string]string{"de": "Ermitteln."})
+
+	cards, err := store.Search(context.Background(), SearchQuery{
+		Embedding:          testdb.Embedding(1, 0, 0),
+		Limit:              2,
+		Language:           "de",
+		TextType:           TextRules,
+		ReferenceLanguages: []string{"it", "fr", "de"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(cards) != 2 {
+		t.Fatalf("Expected 2 cards, got %+v", cards)
+	}
+	expected := map[string]string{"it": "Combattere.", "fr": "Combat."}
+	if !reflect.DeepEqual(cards[0].References, expected) {
+		t.Errorf("Expected Machete references %v, got %v", expected, cards[0].References)
+	}
+	if cards[1].References != nil {
+		t.Errorf("Expected no references for Magnifying Glass, got %v", cards[1].References)
+	}
+}
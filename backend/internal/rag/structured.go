@@ -0,0 +1,175 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+// JSONOutput makes translation requests use the JSON response format
+// (response_format json_object), so the translation comes back in a typed
+// field instead of being trimmed out of free text. Models or compatible
+// servers that reject it are asked again in plain text. Set at startup.
+var JSONOutput = true
+
+// jsonOutputSection is appended to the system prompt in JSON mode. It
+// overrides the plain-text output rule of the template.
+const jsonOutputSection = `
+
+---
+### OUTPUT FORMAT (JSON)
+Instead of plain text, return a single JSON object with these fields:
+* "normalized": the source text after STEP 1 (structure normalized, still in English)
+* "translation": the %s translation after STEP 2, and nothing else
+* "notes": any warning about the source or the translation (e.g. an unknown term), or "" if none`
+
+// jsonLiteralOutputSection replaces jsonOutputSection for literal
+// translations, which have no STEP 1
+const jsonLiteralOutputSection = `
+
+---
+### OUTPUT FORMAT (JSON)
+Instead of plain text, return a single JSON object with these fields:
+* "normalized": the source text, unchanged
+* "translation": the literal %s translation, and nothing else
+* "notes": any warning about the source or the translation (e.g. an unknown term), or "" if none`
+
+// jsonRetryReminder replaces retryReminder in JSON mode
+const jsonRetryReminder = `That was not a translation. Translate the text exactly as instructed and return the JSON object with ONLY the %s translation in "translation": no notes, explanations or apologies there.`
+
+// jsonUnsupportedModels remembers the models that rejected JSON mode, so
+// they are asked in plain text right away
+var jsonUnsupportedModels sync.Map
+
+// useJSONOutput reports whether requests to model use JSON mode
+func useJSONOutput(model string) bool {
+	if !JSONOutput {
+		return false
+	}
+	_, unsupported := jsonUnsupportedModels.Load(model)
+	return !unsupported
+}
+
+// jsonModeRejected reports whether the API refused a request because of its
+// response_format
+func jsonModeRejected(err error) bool {
+	var apiErr *openai.APIError
+	return errors.As(err, &apiErr) && errors.Is(err, openai.ErrBadRequest) && strings.Contains(apiErr.Body, "response_format")
+}
+
+// structuredOutput is the JSON object the model returns in JSON mode
+type structuredOutput struct {
+	Translation string
+	Normalized  string
+	Notes       string
+	Explanation string // Only asked for under WithExplanation
+}
+
+// parseStructuredOutput parses a JSON mode answer. Notes may be a string or
+// a list of strings. It fails if the answer isn't a JSON object with a
+// string translation field.
+func parseStructuredOutput(content string) (structuredOutput, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		return structuredOutput{}, fmt.Errorf("answer is not a JSON object: %w", err)
+	}
+
+	var output structuredOutput
+	if err := json.Unmarshal(fields["translation"], &output.Translation); err != nil {
+		return structuredOutput{}, fmt.Errorf("answer has no string translation field")
+	}
+	output.Translation = strings.TrimSpace(output.Translation)
+	output.Normalized = jsonText(fields["normalized"])
+	output.Notes = jsonText(fields["notes"])
+	output.Explanation = jsonText(fields["explanation"])
+	return output, nil
+}
+
+// jsonText returns a JSON string, or the strings of a JSON list joined with
+// "; ", and "" for anything else
+func jsonText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return strings.TrimSpace(text)
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return strings.TrimSpace(strings.Join(list, "; "))
+	}
+	return ""
+}
+
+// translationOutput is a model answer parsed into its parts
+type translationOutput struct {
+	Translation     string
+	ModelNormalized string // The model's own STEP 1 output, JSON mode only
+	Notes           string // Warnings from the model, JSON mode only
+	Explanation     string // The model's rationale, JSON mode under WithExplanation only
+	Cleaned         bool   // Scaffolding stripped, or changed by the PostProcessors
+}
+
+// parseTranslationOutput reads the translation out of a model answer. In JSON
+// mode the typed fields are used as is; a plain-text answer (or a JSON mode
+// answer that isn't valid) goes through CleanTranslation. Either way the
+// translation then goes through the PostProcessors.
+func parseTranslationOutput(output, source string, jsonMode bool) translationOutput {
+	parsed, ok := translationOutput{}, false
+	if jsonMode {
+		if structured, err := parseStructuredOutput(output); err == nil {
+			parsed, ok = translationOutput{
+				Translation:     structured.Translation,
+				ModelNormalized: structured.Normalized,
+				Notes:           structured.Notes,
+				Explanation:     structured.Explanation,
+			}, true
+		}
+	}
+	if !ok {
+		translation, cleaned := CleanTranslation(output, source)
+		parsed = translationOutput{Translation: translation, Cleaned: cleaned}
+	}
+
+	if processed := postProcess(parsed.Translation, source); processed != parsed.Translation {
+		parsed.Translation = processed
+		parsed.Cleaned = true
+	}
+	return parsed
+}
+
+// requestTranslations builds the prompt for the text and asks the model for
+// n translations, in JSON mode when enabled. If the model rejects JSON mode,
+// it is remembered and the request is made again in plain text. It returns
+// the messages that were sent, for follow-ups, and whether JSON mode was used.
+func requestTranslations(ctx context.Context, englishText string, contextCards []ContextCard, apiKey, model, language string, n int) ([]Message, []string, Usage, bool, error) {
+	jsonMode := useJSONOutput(model)
+	literal := IsLiteral(ctx)
+	messages, err := buildMessages(englishText, contextCards, language, jsonMode, literal)
+	if err != nil {
+		return nil, nil, Usage{}, false, err
+	}
+	messages = requestPreviousVersion(ctx, messages, language)
+	messages = requestExplanation(ctx, messages, jsonMode)
+
+	outputs, usage, err := chatCompletions(ctx, apiKey, model, messages, TranslationTemperature, n, jsonMode)
+	if jsonMode && jsonModeRejected(err) {
+		log.Printf("Model %s does not support JSON output, using plain text: %v", model, err)
+		jsonUnsupportedModels.Store(model, true)
+
+		jsonMode = false
+		if messages, err = buildMessages(englishText, contextCards, language, false, literal); err != nil {
+			return nil, nil, Usage{}, false, err
+		}
+		messages = requestPreviousVersion(ctx, messages, language)
+		outputs, usage, err = chatCompletions(ctx, apiKey, model, messages, TranslationTemperature, n, false)
+	}
+	if err != nil {
+		return nil, nil, Usage{}, false, err
+	}
+	return messages, outputs, usage, jsonMode, nil
+}
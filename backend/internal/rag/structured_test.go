@@ -0,0 +1,161 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+)
+
+func TestParseStructuredOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected structuredOutput
+		valid    bool
+	}{
+		{
+			name:     "All fields",
+			content:  `{"normalized": "<b>Effetto di</b> <eld>: Draw 1 card.", "translation": " <b>Effetto di</b> <eld>: Pesca 1 carta. ", "notes": ""}`,
+			expected: structuredOutput{Translation: "<b>Effetto di</b> <eld>: Pesca 1 carta.", Normalized: "<b>Effetto di</b> <eld>: Draw 1 card."},
+			valid:    true,
+		},
+		{
+			name:     "Quotes are part of the translation",
+			content:  `{"translation": "\"Non è niente.\""}`,
+			expected: structuredOutput{Translation: `"Non è niente."`},
+			valid:    true,
+		},
+		{
+			name:     "Notes as a list",
+			content:  `{"translation": "Pesca 1 carta.", "notes": ["Unknown term: Parley", "Check the trait"]}`,
+			expected: structuredOutput{Translation: "Pesca 1 carta.", Notes: "Unknown term: Parley; Check the trait"},
+			valid:    true,
+		},
+		{name: "Missing translation", content: `{"normalized": "Draw 1 card."}`},
+		{name: "Translation not a string", content: `{"translation": ["Pesca 1 carta."]}`},
+		{name: "Plain text", content: `Pesca 1 carta.`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := parseStructuredOutput(tt.content)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", output)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, output)
+			}
+		})
+	}
+}
+
+// chatServer fakes the chat completions API. reply returns the status and
+// answer for each request, given whether it asked for JSON.
+func chatServer(t *testing.T, reply func(jsonMode bool) (int, string)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ResponseFormat map[string]string `json:"response_format"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		status, content := reply(body.ResponseFormat["type"] == "json_object")
+		if status != http.StatusOK {
+			http.Error(w, content, status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": Message{Role: "assistant", Content: content}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	defaultBaseURL := openai.BaseURL
+	openai.BaseURL = server.URL
+	t.Cleanup(func() { openai.BaseURL = defaultBaseURL })
+	return server
+}
+
+func TestTranslate_JSONOutput(t *testing.T) {
+	defer func(enabled bool) { JSONOutput = enabled }(JSONOutput)
+	JSONOutput = true
+	defer func(names []string) { PostProcessors = names }(PostProcessors)
+	PostProcessors = nil
+
+	chatServer(t, func(jsonMode bool) (int, string) {
+		if !jsonMode {
+			t.Error("Expected a JSON mode request")
+		}
+		return http.StatusOK, `{"normalized": "Draw 1 card.", "translation": "\"Pesca 1 carta.\"", "notes": "Kept the quotes"}`
+	})
+
+	result, err := Translate(context.Background(), "Draw 1 card.", nil, "test-key", "gpt-4o", "it")
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	// No scaffolding trimming of the typed field, unlike plain-text answers
+	if result.Translation != `"Pesca 1 carta."` || result.Cleaned {
+		t.Errorf("Expected the translation field as is, got %+v", result)
+	}
+	if result.ModelNormalized != "Draw 1 card." || result.Notes != "Kept the quotes" {
+		t.Errorf("Expected the normalized text and notes, got %+v", result)
+	}
+}
+
+func TestTranslate_JSONOutputFallback(t *testing.T) {
+	defer func(enabled bool) { JSONOutput = enabled }(JSONOutput)
+	JSONOutput = true
+	model := "local-model-without-json"
+	defer jsonUnsupportedModels.Delete(model)
+
+	var jsonRequests, plainRequests int
+	chatServer(t, func(jsonMode bool) (int, string) {
+		if jsonMode {
+			jsonRequests++
+			return http.StatusBadRequest, `{"error": {"message": "Invalid parameter: 'response_format' is not supported with this model."}}`
+		}
+		plainRequests++
+		return http.StatusOK, "Translation: Pesca 1 carta."
+	})
+
+	for i := 0; i < 2; i++ {
+		result, err := Translate(context.Background(), "Draw 1 card.", nil, "test-key", model, "it")
+		if err != nil {
+			t.Fatalf("Translate failed: %v", err)
+		}
+		if result.Translation != "Pesca 1 carta." || !result.Cleaned {
+			t.Errorf("Expected the plain-text answer to be cleaned, got %+v", result)
+		}
+	}
+
+	// The model is only asked for JSON once
+	if jsonRequests != 1 || plainRequests != 2 {
+		t.Errorf("Expected 1 JSON and 2 plain requests, got %d and %d", jsonRequests, plainRequests)
+	}
+}
+
+func TestBuildMessages_JSONOutput(t *testing.T) {
+	defer func(enabled bool) { JSONOutput = enabled }(JSONOutput)
+
+	for _, enabled := range []bool{true, false} {
+		JSONOutput = enabled
+		messages, err := BuildMessages(context.Background(), "Draw 1 card.", nil, "it")
+		if err != nil {
+			t.Fatalf("BuildMessages failed: %v", err)
+		}
+		if hasSection := strings.Contains(messages[0].Content, "OUTPUT FORMAT (JSON)"); hasSection != enabled {
+			t.Errorf("JSONOutput %v: expected the JSON section %v, got %v", enabled, enabled, hasSection)
+		}
+	}
+}
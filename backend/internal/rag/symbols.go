@@ -0,0 +1,178 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// symbolPattern matches the tokens a translation must keep verbatim: game
+// symbols such as [action] or [per_investigator] and markup tags such as
+// <b>, </i> or <fre>. Traits in double brackets ([[Ally]]) are matched only
+// to be skipped, since their inner text is translated.
+const symbolPattern = `\[\[[^\]]*\]\]|\[[a-z_]+\]|</?[a-z]+>`
+
+// PreservedTokens are extra regular expressions of tokens a translation must
+// keep verbatim, such as the custom symbols of fan sets ({doom}, <hb:icon>),
+// on top of symbolPattern. The system prompt lists them and MissingSymbols
+// checks them. Set at startup.
+var PreservedTokens []string
+
+// preservedTokensSection returns the system prompt rule preserving the
+// PreservedTokens, or "" when there are none
+func preservedTokensSection() string {
+	if len(PreservedTokens) == 0 {
+		return ""
+	}
+	var section strings.Builder
+	section.WriteString("\n\n---\n### CUSTOM SYMBOLS - NEVER TRANSLATE OR MODIFY (PRESERVE EXACTLY)\n")
+	section.WriteString("Tokens matching these regular expressions are game symbols too: keep every one of them exactly as written, like the symbols in square brackets.\n")
+	for _, pattern := range PreservedTokens {
+		fmt.Fprintf(&section, "* `%s`\n", pattern)
+	}
+	return strings.TrimRight(section.String(), "\n")
+}
+
+// tokenPatterns caches the compiled tokenPattern of each PreservedTokens
+var tokenPatterns sync.Map
+
+// tokenPattern returns the pattern of the tokens to preserve: the
+// PreservedTokens, which take precedence where they overlap, then
+// symbolPattern
+func tokenPattern() *regexp.Regexp {
+	source := strings.Join(append(append([]string{}, PreservedTokens...), symbolPattern), "|")
+	if pattern, ok := tokenPatterns.Load(source); ok {
+		return pattern.(*regexp.Regexp)
+	}
+	pattern := regexp.MustCompile(source) // PreservedTokens are validated at startup
+	tokenPatterns.Store(source, pattern)
+	return pattern
+}
+
+// countSymbols counts the occurrences of each required token in text
+func countSymbols(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, token := range tokenPattern().FindAllString(text, -1) {
+		if strings.HasPrefix(token, "[[") {
+			continue
+		}
+		counts[token]++
+	}
+	return counts
+}
+
+// MissingSymbols returns the game symbols, markup tags and PreservedTokens
+// of source that the translation drops, once per missing occurrence, sorted. An empty
+// result means every required token was preserved.
+func MissingSymbols(source, translation string) []string {
+	translated := countSymbols(translation)
+	var missing []string
+	for token, count := range countSymbols(source) {
+		for i := translated[token]; i < count; i++ {
+			missing = append(missing, token)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Symbol formats of a translation: as in the input, or converted to one
+// notation with ConvertSymbols
+const (
+	SymbolFormatPreserve    = "preserve"
+	SymbolFormatArkhamDB    = "arkhamdb"     // [elder_sign], [free], ...
+	SymbolFormatStrangeEons = "strange-eons" // <eld>, <fre>, ...
+)
+
+// ValidSymbolFormat reports whether format is a supported symbol format
+func ValidSymbolFormat(format string) bool {
+	return format == SymbolFormatPreserve || format == SymbolFormatArkhamDB || format == SymbolFormatStrangeEons
+}
+
+// strangeEonsSymbols maps the Strange Eons tags of the game symbols to their
+// arkhamdb notation
+var strangeEonsSymbols = map[string]string{
+	"<act>":  "[action]",
+	"<rea>":  "[reaction]",
+	"<fre>":  "[free]",
+	"<eld>":  "[elder_sign]",
+	"<sku>":  "[skull]",
+	"<cul>":  "[cultist]",
+	"<tab>":  "[tablet]",
+	"<mon>":  "[elder_thing]",
+	"<ten>":  "[auto_fail]",
+	"<ble>":  "[bless]",
+	"<cur>":  "[curse]",
+	"<wil>":  "[willpower]",
+	"<int>":  "[intellect]",
+	"<com>":  "[combat]",
+	"<agi>":  "[agility]",
+	"<wild>": "[wild]",
+	"<per>":  "[per_investigator]",
+	"<gua>":  "[guardian]",
+	"<see>":  "[seeker]",
+	"<rog>":  "[rogue]",
+	"<mys>":  "[mystic]",
+	"<sur>":  "[survivor]",
+}
+
+// strangeEonsAliases are spelled-out tags found in hand-written input, which
+// are converted like the official ones
+var strangeEonsAliases = map[string]string{
+	"<action>":   "[action]",
+	"<reaction>": "[reaction]",
+	"<free>":     "[free]",
+	"<fast>":     "[fast]",
+}
+
+// arkhamDBSymbols maps the arkhamdb notation of the game symbols to their
+// Strange Eons tags; the legacy [fast] is written <fre> like [free]
+var arkhamDBSymbols = func() map[string]string {
+	symbols := map[string]string{"[fast]": "<fre>"}
+	for tag, symbol := range strangeEonsSymbols {
+		symbols[symbol] = tag
+	}
+	return symbols
+}()
+
+var (
+	// Single-bracket symbols; traits in double brackets are matched only to
+	// be skipped
+	arkhamDBSymbolPattern    = regexp.MustCompile(`\[\[[^\]]*\]\]|\[[a-z_]+\]`)
+	strangeEonsSymbolPattern = regexp.MustCompile(`<[a-z]+>`)
+)
+
+// ConvertSymbols rewrites the game symbols of text in format, e.g. <eld> to
+// [elder_sign] for SymbolFormatArkhamDB. Markup tags (<b>, <i>), traits and
+// symbols without an equivalent are left alone, and SymbolFormatPreserve
+// returns text unchanged.
+func ConvertSymbols(text, format string) string {
+	switch format {
+	case SymbolFormatArkhamDB:
+		return strangeEonsSymbolPattern.ReplaceAllStringFunc(text, func(tag string) string {
+			if symbol, ok := strangeEonsSymbols[tag]; ok {
+				return symbol
+			}
+			if symbol, ok := strangeEonsAliases[tag]; ok {
+				return symbol
+			}
+			return tag
+		})
+	case SymbolFormatStrangeEons:
+		text = strangeEonsSymbolPattern.ReplaceAllStringFunc(text, func(tag string) string {
+			if symbol, ok := strangeEonsAliases[tag]; ok {
+				return arkhamDBSymbols[symbol] // <free> -> <fre>
+			}
+			return tag
+		})
+		return arkhamDBSymbolPattern.ReplaceAllStringFunc(text, func(symbol string) string {
+			if tag, ok := arkhamDBSymbols[symbol]; ok {
+				return tag
+			}
+			return symbol
+		})
+	}
+	return text
+}
@@ -0,0 +1,131 @@
+package rag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMissingSymbols(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		translation string
+		expected    []string
+	}{
+		{
+			name:        "All preserved",
+			source:      "[action]: <b>Fight.</b> You get +1 [combat] for this attack.",
+			translation: "[action]: <b>Combatti.</b> Ricevi +1 [combat] in questo attacco.",
+		},
+		{
+			name:        "Dropped symbol and tag",
+			source:      "[action]: <b>Fight.</b> You get +1 [combat] for this attack.",
+			translation: "[action]: Combatti. Ricevi +1 in questo attacco.",
+			expected:    []string{"</b>", "<b>", "[combat]"},
+		},
+		{
+			name:        "Repeated symbol counted",
+			source:      "[reaction] [reaction] Discover 1 clue.",
+			translation: "[reaction] Scopri 1 indizio.",
+			expected:    []string{"[reaction]"},
+		},
+		{
+			name:        "Traits are translated",
+			source:      "Play only on a [[Monster]] enemy. <fre>",
+			translation: "Gioca solo su un nemico [[Mostro]]. <fre>",
+		},
+		{
+			name:        "Extra symbols are not flagged",
+			source:      "Draw 1 card.",
+			translation: "<i>Pesca</i> 1 carta.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing := MissingSymbols(tt.source, tt.translation)
+			if len(missing) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(missing, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, missing)
+			}
+		})
+	}
+}
+
+func TestMissingSymbols_PreservedTokens(t *testing.T) {
+	defer func(tokens []string) { PreservedTokens = tokens }(PreservedTokens)
+
+	source := "[action]: Place 1 {hb_doom} on <hb:portal>."
+	translation := "[action]: Piazza 1 destino su <hb:portal>."
+
+	PreservedTokens = nil
+	if missing := MissingSymbols(source, translation); len(missing) != 0 {
+		t.Errorf("Expected custom tokens to be ignored by default, got %v", missing)
+	}
+
+	PreservedTokens = []string{`\{[a-z_]+\}`, `<hb:[a-z]+>`}
+	expected := []string{"{hb_doom}"}
+	if missing := MissingSymbols(source, translation); !reflect.DeepEqual(missing, expected) {
+		t.Errorf("Expected %v, got %v", expected, missing)
+	}
+	if missing := MissingSymbols(source, "[action]: Piazza 1 {hb_doom} su <hb:portal>."); len(missing) != 0 {
+		t.Errorf("Expected every token preserved, got %v", missing)
+	}
+}
+
+func TestBuildPrompts_PreservedTokens(t *testing.T) {
+	defer func(tokens []string) { PreservedTokens = tokens }(PreservedTokens)
+
+	PreservedTokens = nil
+	systemPrompt, _ := buildPrompts("Place 1 {hb_doom}.", nil, "it", false, false)
+	if strings.Contains(systemPrompt, "CUSTOM SYMBOLS") {
+		t.Errorf("Expected no custom symbols rule by default, got: %s", systemPrompt)
+	}
+
+	PreservedTokens = []string{`\{[a-z_]+\}`}
+	systemPrompt, _ = buildPrompts("Place 1 {hb_doom}.", nil, "it", false, false)
+	if !strings.Contains(systemPrompt, "CUSTOM SYMBOLS") || !strings.Contains(systemPrompt, "* `\\{[a-z_]+\\}`") {
+		t.Errorf("Expected the custom symbols rule with the pattern, got: %s", systemPrompt)
+	}
+}
+
+func TestConvertSymbols(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		format   string
+		expected string
+	}{
+		{"elder sign to arkhamdb", "<b>Effetto di</b> <eld>: +1", SymbolFormatArkhamDB, "<b>Effetto di</b> [elder_sign]: +1"},
+		{"elder sign to strange eons", "<b>Effetto di</b> [elder_sign]: +1", SymbolFormatStrangeEons, "<b>Effetto di</b> <eld>: +1"},
+		{"free action to arkhamdb", "<fre> During your turn, draw 1 card.", SymbolFormatArkhamDB, "[free] During your turn, draw 1 card."},
+		{"free and fast to strange eons", "[free] Draw. [fast] Play.", SymbolFormatStrangeEons, "<fre> Draw. <fre> Play."},
+		{"chaos tokens", "<sku> <cul> <tab> <mon> <ten> <ble> <cur>", SymbolFormatArkhamDB, "[skull] [cultist] [tablet] [elder_thing] [auto_fail] [bless] [curse]"},
+		{"skills and classes", "[willpower][intellect][combat][agility] [guardian] [survivor]", SymbolFormatStrangeEons, "<wil><int><com><agi> <gua> <sur>"},
+		{"aliases to arkhamdb", "<action> <reaction> <free> <fast>", SymbolFormatArkhamDB, "[action] [reaction] [free] [fast]"},
+		{"aliases to strange eons", "<action> <free>", SymbolFormatStrangeEons, "<act> <fre>"},
+		{"traits and markup kept", "[[Ally]]. <i>Flavor</i> <b>Forced</b> – <eld>", SymbolFormatArkhamDB, "[[Ally]]. <i>Flavor</i> <b>Forced</b> – [elder_sign]"},
+		{"traits kept to strange eons", "[[Item]]. [[Weapon]]. [action]", SymbolFormatStrangeEons, "[[Item]]. [[Weapon]]. <act>"},
+		{"unknown symbols kept", "<vs> [unique] [doom]", SymbolFormatStrangeEons, "<vs> [unique] [doom]"},
+		{"preserve", "<eld> [free]", SymbolFormatPreserve, "<eld> [free]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConvertSymbols(tt.text, tt.format); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestConvertSymbols_RoundTrip(t *testing.T) {
+	for tag, symbol := range strangeEonsSymbols {
+		if got := ConvertSymbols(ConvertSymbols(tag, SymbolFormatArkhamDB), SymbolFormatStrangeEons); got != tag {
+			t.Errorf("Expected %s to round-trip through %s, got %s", tag, symbol, got)
+		}
+	}
+}
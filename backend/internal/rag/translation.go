@@ -1,108 +1,306 @@
 package rag
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"log"
 	"strings"
 	"time"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
 )
 
-// GenerateTranslation generates a translation using GPT-4o
-// with context from similar cards
-// language is one of: "it", "fr", "de", "es"
-func GenerateTranslation(englishText string, contextCards []ContextCard, apiKey string, language string) (string, error) {
-	url := "https://api.openai.com/v1/chat/completions"
-
-	// Map language codes to full names
-	langNames := map[string]string{
-		"it": "Italian",
-		"fr": "French",
-		"de": "German",
-		"es": "Spanish",
-	}
-	langName := langNames[language]
-	if langName == "" {
-		langName = language // Fallback
-	}
-
-	// Build system prompt with instructions
-	systemPrompt := fmt.Sprintf(`You are an expert in Arkham Horror: The Card Game, specializing in text **normalization, formatting, and translation** from English to %s.
-
-Your primary goal is to ensure the final output text matches the official %s wording patterns and formatting conventions found in the reference context.
-
----
-### CRITICAL WORKFLOW: NORMALIZE FIRST, THEN TRANSLATE
-You MUST follow this two-step process:
-
-**STEP 1: NORMALIZE STRUCTURE (using English keywords and RAG context)**
-First, scan the input text for structural patterns (like "<eld>:", "[reaction]", "<fre>, during...").
-Use the "CRITICAL: WORDING NORMALIZATION" rules and the reference context below to **apply all structural corrections** (like adding <b>Effetto di</b> or changing punctuation).
-* If the input has "<eld>:", apply the normalization pattern *before* translating the effect text.
-* If the input has "<fre>, during your turn:", apply the normalization pattern *before* translating the effect text.
-
-**STEP 2: TRANSLATE PROSE**
-After the structure has been corrected, translate all remaining English prose to %s, following the "TRANSLATION RULES".
-
-This process ensures that "fan-made" structural errors are corrected *before* translation.
-If the input text is already in %s, skip STEP 2 but **you MUST still perform STEP 1 to correct formatting and normalization.**
----
-
-### CRITICAL RULES - NEVER TRANSLATE OR MODIFY (PRESERVE EXACTLY)
-1.  ALL content in SINGLE square brackets [ ] must be preserved EXACTLY as written (these are game symbols):
-    * Action symbols: [action], [reaction], [free], [fast]
-    * Chaos tokens: [elder_sign], [skull], [cultist], [tablet], [elder_thing], [auto_fail], [bless], [curse]
-    * Skills: [willpower], [intellect], [combat], [agility]
-    * Card traits: [guardian], [seeker], [rogue], [mystic], [survivor]
-2.  ALL HTML/angle bracket symbols < > must be preserved exactly as written (these are Strange Eons notation):
-    * <free>, <eld>, <vs>, <action>, <reaction>, <fast>, etc.
-    * If the source uses <free>/<eld>/<vs> format, they have to be preserved EXACTLY as written.
-    * NEVER convert Strange Eons format < > to arkhamdb format [ ].
-3.  ALL HTML tags must be preserved exactly: <b>...</b>, <i>...</i>, etc.
-4.  ALL numbers and mathematical symbols must be preserved: +1, +2, -1, 0, 1, 2, etc.
-5.  ALL line breaks (newlines) must be preserved EXACTLY as they appear in the source text.
-
----
-### TRANSLATION RULES (APPLY DURING STEP 2)
-* Content in DOUBLE square brackets [[ ]] represents card traits/types that SHOULD be translated to %s.
-* Use the official %s translations provided as context to determine the correct translation for these traits. (e.g., If context shows [[Humanoid]] -> [[Umanoide]], use [[Umanoide]]. If context shows [[Elite]] -> [[Elite]], use [[Elite]]).
-* Always maintain the double brackets [[ ]] format when translating.
-* Use the official %s translations provided as context to ensure terminology consistency.
-* Match the style and tone of the official translations.
-* Maintain game mechanics terminology (actions, skills, resources, etc.).
-* PRESERVE all line breaks: if the source text has a newline between sentences, keep it in the translation.
-* Return ONLY the %s translation, no explanations or additional text.
-* Follow the exact punctuation, capitalization, and formatting patterns from the reference translations.
-
----
-### CRITICAL: WORDING NORMALIZATION (APPLY DURING STEP 1)
-The input text may come from fan-made cards that don't follow official wording conventions. You MUST use the reference translations to:
-1.  **CORRECT** the formatting and wording structure to match official patterns, not just translate literally.
-2.  **ELDER SIGN EFFECTS:**
-    * Input Pattern: "<eld>:" or "[elder_sign]:"
-    * RAG Context (Example): "<b>Effetto di</b> [elder_sign]: +2..."
-    * **Action:** Apply this pattern. Correct "<eld>:" to "<b>Effetto di</b> <eld>:" (keeping the original <eld> syntax).
-3.  **FREE ACTIONS:**
-    * Input Pattern: "<fre>, during your turn:"
-    * RAG Context (Example): "[free] Durante il tuo turno, scarta..."
-    * **Action:** Apply this pattern. Correct "<fre>, during your turn: ..." to "<fre> Durante il tuo turno, ..." (no comma after <fre>, "Durante" maiuscolo, virgola dopo "turno", rimuovere i due punti).
-4.  **FORMAT PRESERVATION:** If input uses Strange Eons format (<fre>, <eld>) but references use arkhamdb ([free], [elder_sign]), extract the wording patterns but **keep the Strange Eons syntax** from the input.
-5.  Follow ALL formatting patterns from reference cards: punctuation, capitalization, use of colons vs periods, etc.
-6.  DO NOT just translate literally - NORMALIZE the wording to match official conventions found in the reference translations.`, langName, langName, langName, langName, langName, langName, langName, langName)
+// Usage reports the tokens consumed by a chat completion
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// GenerateTranslation generates a translation using the given chat model
+// (e.g. "gpt-4o") with context from similar cards
+// language is one of options.SupportedLanguages
+func GenerateTranslation(englishText string, contextCards []ContextCard, apiKey, model string, language string) (string, error) {
+	result, err := Translate(context.Background(), englishText, contextCards, apiKey, model, language)
+	return result.Translation, err
+}
+
+// GenerateTranslationWithUsage is like GenerateTranslation but also returns
+// the token usage reported by the API
+func GenerateTranslationWithUsage(englishText string, contextCards []ContextCard, apiKey, model string, language string) (string, Usage, error) {
+	result, err := Translate(context.Background(), englishText, contextCards, apiKey, model, language)
+	return result.Translation, result.Usage, err
+}
+
+// TranslationResult is the outcome of Translate
+type TranslationResult struct {
+	Translation string
+	Normalized  string // The text after PrepareSource, as sent to the model
+	// ModelNormalized and Notes are the model's STEP 1 output and warnings,
+	// only set in JSON mode (see JSONOutput)
+	ModelNormalized string
+	Notes           string
+	Usage           Usage  // Summed over both attempts when retried
+	Cleaned         bool   // Scaffolding (label, quotes, notes) was stripped from the output
+	Retried         bool   // The first output didn't look like a translation and the model was asked again
+	Draft           string // The translation before the review pass, set under WithReview
+	// Explanation is the model's rationale for its non-obvious choices, only
+	// set in JSON mode under WithExplanation
+	Explanation string
+	// Raw is the model's answer the translation was parsed from, untouched:
+	// before the cleanup, JSON parsing and post-processing (the answer to the
+	// retry when retried, the draft's answer under WithReview)
+	Raw string
+}
+
+// Translate is GenerateTranslation that retries a refusal once and reports the post-processing
+func Translate(ctx context.Context, englishText string, contextCards []ContextCard, apiKey, model string, language string) (TranslationResult, error) {
+	messages, outputs, usage, jsonMode, err := requestTranslations(ctx, englishText, contextCards, apiKey, model, language, 1)
+	if err != nil {
+		return TranslationResult{}, err
+	}
+	source := PrepareSourceFor(ctx, englishText, language)
+
+	output := outputs[0]
+	result := TranslationResult{Normalized: source, Usage: usage, Raw: output}
+	result.setOutput(parseTranslationOutput(output, source, jsonMode))
+
+	if looksLikeNonTranslation(result.Translation, source) {
+		reminder := retryReminder
+		if jsonMode {
+			reminder = jsonRetryReminder
+		}
+		messages = append(messages,
+			Message{Role: "assistant", Content: output},
+			Message{Role: "user", Content: fmt.Sprintf(reminder, languageName(language))},
+		)
+		retried, usage, err := chatCompletions(ctx, apiKey, model, messages, TranslationTemperature, 1, jsonMode)
+		if err != nil {
+			return TranslationResult{}, err
+		}
+		result.Retried = true
+		result.Raw = retried[0]
+		result.Usage = result.Usage.add(usage)
+		result.setOutput(parseTranslationOutput(retried[0], source, jsonMode))
+		if looksLikeNonTranslation(result.Translation, source) {
+			return TranslationResult{}, nonTranslationError(result.Translation)
+		}
+	}
+
+	if IsReview(ctx) {
+		reviewed, usage, err := reviewTranslation(ctx, apiKey, model, source, result.Translation, language)
+		if err != nil {
+			return TranslationResult{}, err
+		}
+		result.Draft = result.Translation
+		result.Translation = reviewed
+		result.Usage = result.Usage.add(usage)
+	}
+
+	return result, nil
+}
+
+// setOutput fills the result from a parsed model answer
+func (r *TranslationResult) setOutput(output translationOutput) {
+	r.Translation = output.Translation
+	r.ModelNormalized = output.ModelNormalized
+	r.Notes = output.Notes
+	r.Explanation = output.Explanation
+	r.Cleaned = output.Cleaned
+}
+
+// retryReminder is sent when the first output wasn't a translation
+const retryReminder = `That was not a translation. Translate the text exactly as instructed and return ONLY the %s translation: no quotes, labels, notes, explanations or apologies.`
+
+// MaxCandidates bounds the alternatives of one TranslateCandidates call,
+// since every candidate is paid for in completion tokens
+const MaxCandidates = 3
+
+// Candidate is one of several alternative translations
+type Candidate struct {
+	Translation    string   `json:"translation"`
+	Cleaned        bool     `json:"cleaned,omitempty"`         // Scaffolding was stripped from the model output
+	MissingSymbols []string `json:"missing_symbols,omitempty"` // Symbols and tags of the text the translation dropped
+	Notes          string   `json:"notes,omitempty"`           // Warnings from the model, JSON mode only
+	Explanation    string   `json:"explanation,omitempty"`     // The model's rationale, see TranslationResult.Explanation
+	Raw            string   `json:"raw,omitempty"`             // The model's untouched answer, see TranslationResult.Raw
+}
+
+// CandidatesResult is the outcome of TranslateCandidates
+type CandidatesResult struct {
+	Candidates []Candidate
+	Normalized string // The text after PrepareSource, as sent to the model
+	Usage      Usage
+}
+
+// TranslateCandidates returns n distinct alternative translations from a single call, without retries
+func TranslateCandidates(ctx context.Context, englishText string, contextCards []ContextCard, apiKey, model, language string, n int) (CandidatesResult, error) {
+	if n < 1 || n > MaxCandidates {
+		return CandidatesResult{}, fmt.Errorf("candidates must be between 1 and %d, got %d", MaxCandidates, n)
+	}
+
+	_, outputs, usage, jsonMode, err := requestTranslations(ctx, englishText, contextCards, apiKey, model, language, n)
+	if err != nil {
+		return CandidatesResult{}, err
+	}
+	source := PrepareSourceFor(ctx, englishText, language)
+
+	result := CandidatesResult{Normalized: source, Usage: usage}
+	seen := make(map[string]bool)
+	for _, output := range outputs {
+		parsed := parseTranslationOutput(output, source, jsonMode)
+		if seen[parsed.Translation] {
+			continue
+		}
+		seen[parsed.Translation] = true
+		result.Candidates = append(result.Candidates, Candidate{
+			Translation:    parsed.Translation,
+			Cleaned:        parsed.Cleaned,
+			MissingSymbols: MissingSymbols(source, parsed.Translation),
+			Notes:          parsed.Notes,
+			Explanation:    parsed.Explanation,
+			Raw:            output,
+		})
+	}
+	return result, nil
+}
+
+// add returns the sum of two usages
+func (u Usage) add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// TranslationTemperature is the sampling temperature of translation requests,
+// kept low for more consistent translations
+const TranslationTemperature = 0.3
+
+// TranslationTimeout bounds each attempt of a chat completion call, retries
+// getting a fresh one; set at startup
+var TranslationTimeout = 60 * time.Second
+
+// BuildMessages returns the chat messages GenerateTranslation sends for the
+// text: the deterministic structure fixes are applied and the prompt size is
+// checked first, so it fails the same way GenerateTranslation would. The
+// JSON output instructions are included when JSONOutput is set, and the
+// literal prompt is used when ctx asks for it (see WithLiteral), with the
+// explanation field when it asks for one (see WithExplanation).
+func BuildMessages(ctx context.Context, englishText string, contextCards []ContextCard, language string) ([]Message, error) {
+	messages, err := buildMessages(englishText, contextCards, language, JSONOutput, IsLiteral(ctx))
+	if err != nil {
+		return nil, err
+	}
+	messages = requestPreviousVersion(ctx, messages, language)
+	return requestExplanation(ctx, messages, JSONOutput), nil
+}
+
+// buildMessages is BuildMessages with or without the JSON output
+// instructions, and for a normalized or literal translation
+func buildMessages(englishText string, contextCards []ContextCard, language string, jsonMode, literal bool) ([]Message, error) {
+	// Strip injected instructions, then apply the deterministic structure
+	// fixes up front (unless translating literally); the model handles the rest
+	if _, removed := SanitizeInput(englishText); len(removed) > 0 {
+		log.Printf("Removed possible prompt injection from the text to translate: %q", removed)
+	}
+	if literal {
+		englishText, _ = SanitizeInput(englishText)
+	} else {
+		englishText = PrepareSource(englishText, language)
+	}
+
+	if err := CheckPromptSize(englishText, contextCards, language); err != nil {
+		return nil, err
+	}
+
+	systemPrompt, userPrompt := buildPrompts(englishText, contextCards, language, jsonMode, literal)
+
+	return []Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userPrompt},
+	}, nil
+}
+
+// ContextOrder sets how the context cards are listed in the user prompt.
+// Models tend to weigh what they read last, so closest-last can make them
+// follow the best match more closely. Set at startup.
+var ContextOrder = options.ContextClosestFirst
+
+// orderContextCards returns the context cards (most similar first) in the
+// prompt order
+func orderContextCards(cards []ContextCard, order string) []ContextCard {
+	if order != options.ContextClosestLast {
+		return cards
+	}
+	reversed := make([]ContextCard, len(cards))
+	for i, card := range cards {
+		reversed[len(cards)-1-i] = card
+	}
+	return reversed
+}
+
+// buildPrompts builds the system and user prompts, in JSON mode and/or for a literal translation
+func buildPrompts(englishText string, contextCards []ContextCard, language string, jsonMode, literal bool) (string, string) {
+	langName := languageName(language)
+
+	// Build system prompt with instructions from the template for the language.
+	// Custom templates are checked when loaded, so fall back to the embedded
+	// default if one still fails
+	render := renderSystemPrompt
+	if literal {
+		render = renderLiteralPrompt
+	}
+	systemPrompt, err := render(currentPrompts(), language)
+	if err != nil {
+		systemPrompt, _ = render(defaultPrompts, language)
+	}
+	// Curated terminology, only for the terms that appear in the text
+	systemPrompt += glossarySection(relevantGlossaryEntries(englishText, language), language)
+	systemPrompt += preservedTokensSection()
+	// The text to translate is data, whatever it says
+	systemPrompt += untrustedTextSection
+	if jsonMode && literal {
+		systemPrompt += fmt.Sprintf(jsonLiteralOutputSection, langName)
+	} else if jsonMode {
+		systemPrompt += fmt.Sprintf(jsonOutputSection, langName)
+	}
 
 	// Build user prompt with context
 	var contextBuilder strings.Builder
 	if len(contextCards) > 0 {
-		contextBuilder.WriteString(fmt.Sprintf("Official %s card translations for reference:\n\n", langName))
-		for i, card := range contextCards {
-			contextBuilder.WriteString(fmt.Sprintf("Card %d: %s (%s)\n", i+1, card.CardName, card.CardCode))
-			contextBuilder.WriteString(fmt.Sprintf("English: %s\n", card.EnglishText))
-			contextBuilder.WriteString(fmt.Sprintf("%s: %s\n\n", langName, card.TranslatedText))
+		switch contextCards[0].TextType {
+		case TextFlavor:
+			// Flavor text is narrative prose: references show tone and vocabulary, not rules wording
+			contextBuilder.WriteString(fmt.Sprintf("Official %s flavor text translations for reference (match their literary tone):\n\n", langName))
+		case TextName:
+			// Names are short: references show how proper nouns and subtitles are rendered
+			contextBuilder.WriteString(fmt.Sprintf("Official %s card name translations for reference (follow how they translate proper nouns, titles and subtitles):\n\n", langName))
+		default:
+			contextBuilder.WriteString(fmt.Sprintf("Official %s card translations for reference:\n\n", langName))
+		}
+		// Fronts hold player-facing rules, backs encounter/story text with a different style
+		contextBuilder.WriteString("Each card is marked FRONT (player rules text) or BACK (encounter/story text); prefer the wording of references from the same side as the text to translate.\n\n")
+		for i, card := range orderContextCards(contextCards, ContextOrder) {
+			contextBuilder.WriteString(contextCardSection(i+1, card, langName))
 		}
 	}
 
+	if literal {
+		return systemPrompt, fmt.Sprintf(`### REFERENCE CONTEXT CARDS
+	Use these official translations for terminology only; translate the text below literally, as per your instructions.
+	%s
+	
+	---
+	
+	### TEXT TO TRANSLATE
+	%s
+	`, contextBuilder.String(), delimitText(englishText))
+	}
+
 	userPrompt := fmt.Sprintf(`### REFERENCE CONTEXT CARDS
 	Use these official translations to correct the formatting and wording of the text below, as per your instructions.
 	%s
@@ -111,62 +309,133 @@ The input text may come from fan-made cards that don't follow official wording c
 	
 	### TEXT TO NORMALIZE AND TRANSLATE
 	%s
-	`, contextBuilder.String(), englishText)
+	`, contextBuilder.String(), delimitText(englishText))
 
-	reqBody := struct {
-		Model       string    `json:"model"`
-		Messages    []Message `json:"messages"`
-		Temperature float64   `json:"temperature"`
-	}{
-		Model: "gpt-4o",
-		Messages: []Message{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: userPrompt},
-		},
-		Temperature: 0.3, // Lower temperature for more consistent translations
+	return systemPrompt, userPrompt
+}
+
+// contextCardSection formats the nth context card of the user prompt, in
+// the target language langName
+func contextCardSection(n int, card ContextCard, langName string) string {
+	var section strings.Builder
+	side := sideLabel(card.IsBack)
+	if card.IsFrontFallback {
+		// Player-facing wording differs from the encounter/story text of a back
+		side += " - FALLBACK, no BACK reference available: follow its terminology, not its style"
+	}
+	section.WriteString(fmt.Sprintf("Card %d: %s (%s, %s)\n", n, card.CardName, card.CardCode, side))
+	section.WriteString(fmt.Sprintf("English: %s\n", card.EnglishText))
+	if card.IsFallback {
+		// Related-language reference: useful for structure and terminology patterns, not exact wording
+		section.WriteString(fmt.Sprintf("%s (FALLBACK REFERENCE - no official %s translation available, use only for structure and formatting patterns): %s\n",
+			languageName(card.TranslationLanguage), langName, card.TranslatedText))
+	} else {
+		section.WriteString(fmt.Sprintf("%s: %s\n", langName, card.TranslatedText))
 	}
+	if card.Note != "" {
+		section.WriteString(fmt.Sprintf("Translation note: %s\n", card.Note))
+	}
+	section.WriteString(referencesSection(card))
+	section.WriteString("\n")
+	return section.String()
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+// sideLabel returns the prompt label for the side of a card
+func sideLabel(isBack bool) string {
+	if isBack {
+		return "BACK"
 	}
+	return "FRONT"
+}
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	req, err := http.NewRequest("POST", url, bytes.NewReader(jsonData))
+// chatCompletion sends messages to the OpenAI chat completions API and
+// returns the trimmed content of the first choice along with the token usage.
+// Rate limits and server errors are retried (see openai.WithRetry) until ctx
+// is done.
+func chatCompletion(ctx context.Context, apiKey, model string, messages []Message, temperature float64) (string, Usage, error) {
+	contents, usage, err := chatCompletions(ctx, apiKey, model, messages, temperature, 1, false)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", Usage{}, err
 	}
+	return strings.TrimSpace(contents[0]), usage, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+// WarmUpChat sends the model a one-word chat completion request, opening
+// the connection of the shared OpenAI client and waking the model up before
+// the first translation. The answer is ignored.
+func WarmUpChat(ctx context.Context, apiKey, model string) error {
+	_, _, err := chatCompletion(ctx, apiKey, model, []Message{{Role: "user", Content: "Reply with OK."}}, 0)
+	return err
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to execute request: %w", err)
+// chatCompletions is like chatCompletion but asks for n choices and returns
+// the content of each as sent, untrimmed. jsonMode requests a JSON object
+// answer (response_format json_object); the messages must ask for JSON.
+func chatCompletions(ctx context.Context, apiKey, model string, messages []Message, temperature float64, n int, jsonMode bool) ([]string, Usage, error) {
+	url := openai.URL("/v1/chat/completions")
+
+	reqBody := struct {
+		Model       string    `json:"model"`
+		Messages    []Message `json:"messages"`
+		Temperature float64   `json:"temperature"`
+		N           int       `json:"n,omitempty"`
+		// ResponseFormat is {"type": "json_object"} in JSON mode
+		ResponseFormat map[string]string `json:"response_format,omitempty"`
+	}{
+		Model:       model,
+		Messages:    messages,
+		Temperature: temperature,
+	}
+	if n > 1 {
+		reqBody.N = n
+	}
+	if jsonMode {
+		reqBody.ResponseFormat = map[string]string{"type": "json_object"}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("OpenAI API error: %s - %s", resp.Status, string(body))
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, Usage{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	var result struct {
 		Choices []struct {
-			Message Message `json:"message"`
+			Message struct {
+				Content string `json:"content"`
+				Refusal string `json:"refusal"` // Set instead of the content when the model declines
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
+		Usage Usage `json:"usage"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	// Each attempt gets its own timeout; ctx bounds the attempts and waits together
+	err = openai.WithRetry(ctx, func() error {
+		return openai.PostJSON(ctx, url, apiKey, jsonData, TranslationTimeout, &result)
+	})
+	if err != nil {
+		return nil, Usage{}, err
 	}
 
 	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("no translation returned")
+		return nil, Usage{}, fmt.Errorf("no choices returned")
 	}
 
-	translation := strings.TrimSpace(result.Choices[0].Message.Content)
-	return translation, nil
+	// Filtered or declined choices are dropped; only when all of them are
+	// is the refusal returned
+	var contents []string
+	var refusal *RefusalError
+	for _, choice := range result.Choices {
+		if err := choiceRefusal(choice.FinishReason, choice.Message.Refusal); err != nil {
+			refusal = err
+			continue
+		}
+		contents = append(contents, choice.Message.Content)
+	}
+	if len(contents) == 0 {
+		return nil, Usage{}, refusal
+	}
+	return contents, result.Usage, nil
 }
 
 // Message represents a chat message
@@ -1,13 +1,20 @@
 package rag
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/ventrosky/arkham-localize/backend/internal/openai"
+	"github.com/ventrosky/arkham-localize/backend/internal/options"
 )
 
 func init() {
@@ -49,7 +56,7 @@ func TestGenerateTranslation_SimilarToMachete(t *testing.T) {
 	}
 
 	// Generate translation (using Italian as target language for the test)
-	translation, err := GenerateTranslation(englishText, contextCards, apiKey, "it")
+	translation, err := GenerateTranslation(englishText, contextCards, apiKey, "gpt-4o", "it")
 	if err != nil {
 		t.Fatalf("Failed to generate translation: %v", err)
 	}
@@ -58,8 +65,9 @@ func TestGenerateTranslation_SimilarToMachete(t *testing.T) {
 		t.Fatal("Translation is empty")
 	}
 
-	// Remove quotes if the LLM wrapped the response in quotes
-	cleanTranslation := strings.Trim(translation, `"`)
+	// Quotes the LLM may wrap the response in are stripped by the default
+	// post-processors
+	cleanTranslation := translation
 
 	t.Logf("Original: %s", englishText)
 	t.Logf("Translation: %s", cleanTranslation)
@@ -290,12 +298,12 @@ func TestNormalization_TableDriven(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			translation, err := GenerateTranslation(tc.englishText, tc.contextCards, apiKey, "it")
+			translation, err := GenerateTranslation(tc.englishText, tc.contextCards, apiKey, "gpt-4o", "it")
 			if err != nil {
 				t.Fatalf("Failed to generate translation: %v", err)
 			}
 
-			cleanTranslation := strings.Trim(translation, `"`)
+			cleanTranslation := translation // Quotes stripped by the default post-processors
 			t.Logf("Original: %s", tc.englishText)
 			t.Logf("Translation: %s", cleanTranslation)
 
@@ -307,3 +315,247 @@ func TestNormalization_TableDriven(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildPrompts_LabelsCardSide(t *testing.T) {
+	contextCards := []ContextCard{
+		{CardName: "The Gathering", CardCode: "01104", IsBack: true, EnglishText: "You are in your study.", TranslatedText: "Sei nel tuo studio."},
+		{CardName: "Machete", CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Combatti."},
+		{CardName: "Roland Banks", CardCode: "01001", EnglishText: "Investigate.", TranslatedText: "Indaga.", IsFrontFallback: true},
+	}
+
+	_, userPrompt := buildPrompts("Fight.", contextCards, "it", false, false)
+
+	for _, expected := range []string{
+		"Card 1: The Gathering (01104, BACK)",
+		"Card 2: Machete (01020, FRONT)",
+		"Card 3: Roland Banks (01001, FRONT - FALLBACK, no BACK reference available",
+	} {
+		if !strings.Contains(userPrompt, expected) {
+			t.Errorf("Expected prompt to contain %q, got: %s", expected, userPrompt)
+		}
+	}
+}
+
+func TestBuildPrompts_CardNotes(t *testing.T) {
+	contextCards := []ContextCard{
+		{CardName: "Machete", CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Combatti.", Note: "The Italian text follows the FAQ errata."},
+		{CardName: "Knife", CardCode: "01086", EnglishText: "Fight.", TranslatedText: "Combatti."},
+	}
+
+	_, userPrompt := buildPrompts("Fight.", contextCards, "it", false, false)
+
+	if !strings.Contains(userPrompt, "Italian: Combatti.\nTranslation note: The Italian text follows the FAQ errata.\n") {
+		t.Errorf("Expected the note under Machete, got: %s", userPrompt)
+	}
+	if strings.Count(userPrompt, "Translation note:") != 1 {
+		t.Errorf("Expected no note for the card without one, got: %s", userPrompt)
+	}
+}
+
+func TestBuildPrompts_ContextOrder(t *testing.T) {
+	defer func(order string) { ContextOrder = order }(ContextOrder)
+
+	contextCards := []ContextCard{
+		{CardName: "Machete", CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Combatti."},
+		{CardName: "Knife", CardCode: "01086", EnglishText: "Fight.", TranslatedText: "Combatti."},
+		{CardName: "Kukri", CardCode: "02036", EnglishText: "Fight.", TranslatedText: "Combatti."},
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{options.ContextClosestFirst, []string{"Card 1: Machete", "Card 2: Knife", "Card 3: Kukri"}},
+		{options.ContextClosestLast, []string{"Card 1: Kukri", "Card 2: Knife", "Card 3: Machete"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			ContextOrder = tt.order
+			_, userPrompt := buildPrompts("Fight.", contextCards, "it", false, false)
+
+			last := -1
+			for _, expected := range tt.expected {
+				index := strings.Index(userPrompt, expected)
+				if index < 0 {
+					t.Fatalf("Expected prompt to contain %q, got: %s", expected, userPrompt)
+				}
+				if index < last {
+					t.Errorf("Expected %q after the previous card, got: %s", expected, userPrompt)
+				}
+				last = index
+			}
+		})
+	}
+
+	if contextCards[0].CardName != "Machete" {
+		t.Errorf("Expected the context cards to be left in place, got %+v", contextCards)
+	}
+}
+
+func TestBuildMessages(t *testing.T) {
+	contextCards := []ContextCard{
+		{CardName: "Machete", CardCode: "01020", EnglishText: "Fight.", TranslatedText: "Combatti."},
+	}
+
+	messages, err := BuildMessages(context.Background(), "<fre>, during your turn: draw 1 card.", contextCards, "it")
+	if err != nil {
+		t.Fatalf("Failed to build messages: %v", err)
+	}
+
+	if len(messages) != 2 || messages[0].Role != "system" || messages[1].Role != "user" {
+		t.Fatalf("Expected a system and a user message, got %+v", messages)
+	}
+	if !strings.Contains(messages[1].Content, "Card 1: Machete (01020, FRONT)") {
+		t.Errorf("Expected the context card in the user message, got: %s", messages[1].Content)
+	}
+	if !strings.Contains(messages[1].Content, "<fre> During your turn, draw 1 card.") {
+		t.Errorf("Expected the normalized text in the user message, got: %s", messages[1].Content)
+	}
+}
+
+func TestBuildMessages_Literal(t *testing.T) {
+	text := "<fre>, during your turn: draw 1 card."
+
+	testCases := []struct {
+		name       string
+		ctx        context.Context
+		expected   string
+		normalizes bool
+	}{
+		{"Normalized", context.Background(), "<fre> During your turn, draw 1 card.", true},
+		{"Literal", WithLiteral(context.Background()), text, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages, err := BuildMessages(tc.ctx, text, nil, "it")
+			if err != nil {
+				t.Fatalf("Failed to build messages: %v", err)
+			}
+			if !strings.Contains(messages[1].Content, tc.expected) {
+				t.Errorf("Expected %q in the user message, got: %s", tc.expected, messages[1].Content)
+			}
+			if normalizes := strings.Contains(messages[0].Content, "STEP 1"); normalizes != tc.normalizes {
+				t.Errorf("Expected normalization instructions %v, got %v", tc.normalizes, normalizes)
+			}
+			if got := PrepareSourceFor(tc.ctx, text, "it"); got != tc.expected {
+				t.Errorf("Expected prepared source %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenerateTranslation_RetriesRateLimit(t *testing.T) {
+	defer func(retries int, delay time.Duration) {
+		openai.MaxRetries, openai.RetryBaseDelay = retries, delay
+	}(openai.MaxRetries, openai.RetryBaseDelay)
+	openai.MaxRetries = 3
+	openai.RetryBaseDelay = time.Millisecond
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			http.Error(w, `{"error": {"message": "Rate limit reached"}}`, http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": Message{Role: "assistant", Content: "Pesca 1 carta."}}},
+		})
+	}))
+	defer server.Close()
+
+	defer func(base string) { openai.BaseURL = base }(openai.BaseURL)
+	openai.BaseURL = server.URL
+
+	translation, err := GenerateTranslation("Draw 1 card.", nil, "test-key", "gpt-4o", "it")
+	if err != nil {
+		t.Fatalf("Expected the rate limited call to be retried, got %v", err)
+	}
+	if translation != "Pesca 1 carta." {
+		t.Errorf("Expected %q, got %q", "Pesca 1 carta.", translation)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+func TestGenerateTranslation_Timeout(t *testing.T) {
+	defer func(retries int, timeout time.Duration) {
+		openai.MaxRetries, TranslationTimeout = retries, timeout
+	}(openai.MaxRetries, TranslationTimeout)
+	openai.MaxRetries = 0
+	TranslationTimeout = 50 * time.Millisecond
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	defer func(base string) { openai.BaseURL = base }(openai.BaseURL)
+	openai.BaseURL = server.URL
+
+	start := time.Now()
+	if _, err := GenerateTranslation("Draw 1 card.", nil, "test-key", "gpt-4o", "it"); err == nil {
+		t.Fatal("Expected the slow call to time out, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the call to give up after TranslationTimeout, took %s", elapsed)
+	}
+}
+
+func TestTranslateCandidates(t *testing.T) {
+	replies := []string{
+		"[action]: <b>Combatti.</b> Ricevi +1 [combat] in questo attacco.",
+		`"[action]: <b>Combatti.</b> Ricevi +1 [combat] in questo attacco."`,
+		"[action]: <b>Combatti.</b> Ottieni +1 in questo attacco.",
+	}
+	var requested int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			N int `json:"n"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requested = body.N
+
+		choices := []map[string]interface{}{}
+		for _, reply := range replies[:body.N] {
+			choices = append(choices, map[string]interface{}{"message": Message{Role: "assistant", Content: reply}})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"choices": choices})
+	}))
+	defer server.Close()
+
+	defer func(base string) { openai.BaseURL = base }(openai.BaseURL)
+	openai.BaseURL = server.URL
+
+	englishText := "[action]: <b>Fight.</b> You get +1 [combat] for this attack."
+	result, err := TranslateCandidates(context.Background(), englishText, nil, "test-key", "gpt-4o", "it", 3)
+	if err != nil {
+		t.Fatalf("TranslateCandidates failed: %v", err)
+	}
+
+	if requested != 3 {
+		t.Errorf("Expected n=3 in the request, got %d", requested)
+	}
+	// The quoted reply is the first one once cleaned, so it is dropped
+	if len(result.Candidates) != 2 {
+		t.Fatalf("Expected 2 distinct candidates, got %+v", result.Candidates)
+	}
+	if len(result.Candidates[0].MissingSymbols) != 0 {
+		t.Errorf("Expected no missing symbols in the first candidate, got %v", result.Candidates[0].MissingSymbols)
+	}
+	if missing := result.Candidates[1].MissingSymbols; len(missing) != 1 || missing[0] != "[combat]" {
+		t.Errorf("Expected [combat] to be flagged in the second candidate, got %v", missing)
+	}
+
+	if _, err := TranslateCandidates(context.Background(), englishText, nil, "test-key", "gpt-4o", "it", MaxCandidates+1); err == nil {
+		t.Error("Expected an error above MaxCandidates, got nil")
+	}
+}
@@ -0,0 +1,103 @@
+// Package ragtest provides deterministic offline providers of the rag
+// package for tests, so the full flow runs without OpenAI
+package ragtest
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+// Embedder is a deterministic offline rag.Embedder. Each word of
+// the text is hashed to one dimension, so texts sharing words are similar
+// and identical texts have a similarity of 1.
+type Embedder struct{}
+
+// Embed implements rag.Embedder
+func (Embedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return nil, fmt.Errorf("cannot embed text without words")
+	}
+
+	embedding := make([]float32, embeddings.Dimensions)
+	for _, word := range words {
+		hash := fnv.New32a()
+		hash.Write([]byte(word))
+		embedding[hash.Sum32()%uint32(len(embedding))]++
+	}
+
+	// Normalize to unit length like OpenAI embeddings
+	var norm float64
+	for _, value := range embedding {
+		norm += float64(value) * float64(value)
+	}
+	norm = math.Sqrt(norm)
+	for i := range embedding {
+		embedding[i] = float32(float64(embedding[i]) / norm)
+	}
+	return embedding, nil
+}
+
+// Translator is a deterministic offline rag.Translator. It builds
+// the prompt like the real one, so size limits still apply, and returns the
+// English text marked with the language and the number of context cards,
+// e.g. "[it:3] Draw 1 card.". Reviews (rag.WithReview) leave the draft as
+// is, and explanations (rag.WithExplanation) are Explanation.
+type Translator struct{}
+
+// Translate implements rag.Translator
+func (Translator) Translate(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string) (rag.TranslationResult, error) {
+	if _, err := rag.BuildMessages(ctx, englishText, contextCards, language); err != nil {
+		return rag.TranslationResult{}, err
+	}
+	result := rag.TranslationResult{
+		Translation: Translation(englishText, language, len(contextCards)),
+		Normalized:  rag.PrepareSourceFor(ctx, englishText, language),
+	}
+	result.Raw = result.Translation
+	if rag.IsReview(ctx) {
+		result.Draft = result.Translation
+	}
+	if rag.IsExplanation(ctx) {
+		result.Explanation = Explanation
+	}
+	return result, nil
+}
+
+// TranslateCandidates implements rag.Translator, returning n distinct fake
+// translations: Translation, then the same numbered "(2)", "(3)", ...
+func (Translator) TranslateCandidates(ctx context.Context, englishText string, contextCards []rag.ContextCard, model, language string, n int) (rag.CandidatesResult, error) {
+	if n < 1 || n > rag.MaxCandidates {
+		return rag.CandidatesResult{}, fmt.Errorf("candidates must be between 1 and %d, got %d", rag.MaxCandidates, n)
+	}
+	if _, err := rag.BuildMessages(ctx, englishText, contextCards, language); err != nil {
+		return rag.CandidatesResult{}, err
+	}
+	result := rag.CandidatesResult{Normalized: rag.PrepareSourceFor(ctx, englishText, language)}
+	for i := 0; i < n; i++ {
+		translation := Translation(englishText, language, len(contextCards))
+		if i > 0 {
+			translation = fmt.Sprintf("%s (%d)", translation, i+1)
+		}
+		result.Candidates = append(result.Candidates, rag.Candidate{Translation: translation, Raw: translation})
+	}
+	return result, nil
+}
+
+// Explanation is the explanation Translator returns under
+// rag.WithExplanation
+const Explanation = "Follows the wording of the context cards."
+
+// Translation returns the translation Translator produces
+func Translation(englishText, language string, contextCount int) string {
+	return fmt.Sprintf("[%s:%d] %s", language, contextCount, englishText)
+}
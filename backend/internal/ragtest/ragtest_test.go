@@ -0,0 +1,50 @@
+package ragtest
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/ventrosky/arkham-localize/backend/internal/rag"
+)
+
+func TestEmbedder(t *testing.T) {
+	embedder := Embedder{}
+
+	similarity := func(a, b string) float64 {
+		t.Helper()
+		embeddingA, err := embedder.Embed(context.Background(), a)
+		if err != nil {
+			t.Fatalf("Failed to embed %q: %v", a, err)
+		}
+		embeddingB, err := embedder.Embed(context.Background(), b)
+		if err != nil {
+			t.Fatalf("Failed to embed %q: %v", b, err)
+		}
+		var dot float64
+		for i := range embeddingA {
+			dot += float64(embeddingA[i]) * float64(embeddingB[i])
+		}
+		return dot
+	}
+
+	if s := similarity("Draw 1 card.", "draw 1 card"); math.Abs(s-1) > 1e-6 {
+		t.Errorf("Expected identical words to have similarity 1, got %g", s)
+	}
+	if close, far := similarity("Draw 1 card.", "Draw 1 card and gain 1 resource."), similarity("Draw 1 card.", "Discover 1 clue."); close <= far {
+		t.Errorf("Expected texts sharing more words to be closer, got %g <= %g", close, far)
+	}
+	if _, err := embedder.Embed(context.Background(), "..."); err == nil {
+		t.Error("Expected error for a text without words, got nil")
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	result, err := Translator{}.Translate(context.Background(), "Draw 1 card.", []rag.ContextCard{{CardCode: "01001"}}, "gpt-4o", "it")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Translation != "[it:1] Draw 1 card." {
+		t.Errorf("Expected marked translation, got %q", result.Translation)
+	}
+}
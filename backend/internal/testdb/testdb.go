@@ -0,0 +1,140 @@
+// Package testdb starts a throwaway PostgreSQL database with pgvector for
+// integration tests, so that they run without a pre-ingested database
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+
+	"github.com/pgvector/pgvector-go"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/ventrosky/arkham-localize/backend/internal/db"
+	"github.com/ventrosky/arkham-localize/backend/internal/embeddings"
+)
+
+// image is the same pgvector image as in docker-compose.yml
+const image = "pgvector/pgvector:pg16"
+
+const (
+	dbName     = "arkham_localize"
+	dbUser     = "arkham"
+	dbPassword = "arkham"
+)
+
+// Start runs a pgvector container, applies the migrations and returns a
+// connection to the database. The container is removed when the test ends.
+// The test (or benchmark) is skipped with -short or when Docker is not
+// available.
+func Start(t testing.TB) *sql.DB {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping container test in short mode")
+	}
+	if !dockerAvailable() {
+		t.Skip("Skipping container test (Docker is not available)")
+	}
+
+	ctx := context.Background()
+	container, err := postgres.Run(ctx, image,
+		postgres.WithDatabase(dbName),
+		postgres.WithUsername(dbUser),
+		postgres.WithPassword(dbPassword),
+		postgres.BasicWaitStrategies(),
+	)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("Failed to start database container: %v", err)
+	}
+
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("Failed to get connection string: %v", err)
+	}
+
+	setup, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer setup.Close()
+
+	if _, err := db.Migrate(setup); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	// The ivfflat indexes are built on empty tables, so a single probe would
+	// miss rows; searching every list keeps the results exact
+	if _, err := setup.Exec("ALTER DATABASE " + dbName + " SET ivfflat.probes = 100"); err != nil {
+		t.Fatalf("Failed to configure ivfflat probes: %v", err)
+	}
+
+	// Connect again so that every pooled connection has the setting
+	database, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	return database
+}
+
+// InsertCard inserts a front entry with its translations. The translations
+// are stored with the same embedding as the English text.
+func InsertCard(t *testing.T, database *sql.DB, code, name, textType, englishText string, embedding []float32, translations map[string]string) {
+	t.Helper()
+
+	_, err := database.Exec(`
+		INSERT INTO card_embeddings (card_code, card_name, is_back, english_text, embedding, text_type)
+		VALUES ($1, $2, false, $3, $4, $5)
+	`, code, name, englishText, pgvector.NewVector(embedding), textType)
+	if err != nil {
+		t.Fatalf("Failed to insert card %s: %v", code, err)
+	}
+
+	for language, text := range translations {
+		_, err := database.Exec(`
+			INSERT INTO card_translations (card_code, is_back, text_type, language, text, embedding)
+			VALUES ($1, false, $2, $3, $4, $5)
+		`, code, textType, language, text, pgvector.NewVector(embedding))
+		if err != nil {
+			t.Fatalf("Failed to insert %s translation of %s: %v", language, code, err)
+		}
+	}
+}
+
+// dockerAvailable reports whether a healthy Docker daemon can be reached.
+// testcontainers panics when it finds no Docker host at all.
+func dockerAvailable() (available bool) {
+	defer func() {
+		if recover() != nil {
+			available = false
+		}
+	}()
+
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		return false
+	}
+	defer provider.Close()
+	return provider.Health(context.Background()) == nil
+}
+
+// Embedding returns a deterministic fake embedding with the given leading
+// components (the rest are zero), normalized to unit length like OpenAI
+// embeddings. Embedding(1, 0) and Embedding(0, 1) are orthogonal, while
+// Embedding(0.8, 0.6) has a cosine similarity of 0.8 with Embedding(1).
+func Embedding(components ...float64) []float32 {
+	var norm float64
+	for _, component := range components {
+		norm += component * component
+	}
+	norm = math.Sqrt(norm)
+
+	embedding := make([]float32, embeddings.Dimensions)
+	for i, component := range components {
+		embedding[i] = float32(component / norm)
+	}
+	return embedding
+}
@@ -1,10 +1,11 @@
-export type SupportedLanguage = 'it' | 'fr' | 'de' | 'es';
+export type SupportedLanguage = 'it' | 'fr' | 'de' | 'es' | 'pt';
 
 export const SUPPORTED_LANGUAGES = [
   { code: 'it', name: 'Italian' },
   { code: 'fr', name: 'French' },
   { code: 'de', name: 'German' },
   { code: 'es', name: 'Spanish' },
+  { code: 'pt', name: 'Portuguese' },
 ] as const;
 
 export interface ContextCard {
@@ -20,6 +21,14 @@ export interface TranslateResponse {
   context: ContextCard[];
 }
 
+// Body of every backend error response
+export interface ErrorResponse {
+  error: {
+    code: string;
+    message: string;
+  };
+}
+
 const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:3001';
 
 export async function translate(
@@ -35,8 +44,8 @@ export async function translate(
   });
 
   if (!response.ok) {
-    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
-    throw new Error(error.error || `HTTP error! status: ${response.status}`);
+    const error: Partial<ErrorResponse> = await response.json().catch(() => ({}));
+    throw new Error(error.error?.message || `HTTP error! status: ${response.status}`);
   }
 
   return response.json();